@@ -2,14 +2,27 @@ package main
 
 import (
 	// "database/sql"
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	"Bridgo/internal/auth" // Added for middleware
+	"Bridgo/internal/config"
+	"Bridgo/internal/core"
 	"Bridgo/internal/metadata"
+	"Bridgo/internal/models"
 	"Bridgo/internal/server"
+	"Bridgo/internal/users"
 	"Bridgo/internal/web"
 
 	_ "github.com/go-sql-driver/mysql" // MySQL driver
@@ -17,8 +30,57 @@ import (
 )
 
 func main() {
-	// Initialize DuckDB
-	db, err := metadata.InitDB(".")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "check the pending metadata schema migrations without applying them, then exit")
+	backupFile := flag.String("backup", "", "write a snapshot of the metadata database to `file`, then exit")
+	restoreFile := flag.String("restore", "", "replace the metadata database with the snapshot in `file`, then exit; Bridgo must be stopped")
+	gitOpsPlan := flag.Bool("gitops-plan", false, "print the changes reconciling the declarative configuration would make, then exit")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration with secrets redacted, then exit")
+	configLoader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+
+	// Settings come from the configuration file, then the environment, then the flags; the first
+	// admin can be given with -admin-username, -admin-email and -admin-password
+	cfg, err := configLoader.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if *printConfig {
+		if err = cfg.PrintConfig(os.Stdout); err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		return
+	}
+	closeLog, err := config.SetupLogging(cfg.Logging)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer closeLog()
+	if cfg.File != "" {
+		fmt.Printf("Loaded configuration from %s\n", cfg.File)
+	}
+
+	// The metadata store is embedded DuckDB unless PostgreSQL is configured
+	storeConfig := cfg.StoreConfig()
+
+	backupConfig := cfg.BackupConfig()
+	gitOpsConfig := cfg.GitOpsConfig()
+
+	switch {
+	case *migrateDryRun:
+		dryRunMigrations(storeConfig)
+		return
+	case *backupFile != "":
+		backupMetadata(storeConfig, *backupFile)
+		return
+	case *restoreFile != "":
+		restoreMetadata(storeConfig, backupConfig, *restoreFile)
+		return
+	case *gitOpsPlan:
+		printGitOpsPlan(storeConfig, gitOpsConfig)
+		return
+	}
+
+	db, err := metadata.InitDB(storeConfig)
 	if err != nil {
 		log.Fatalf("Failed to initialize metadata database: %v", err)
 	}
@@ -28,52 +90,340 @@ func main() {
 		}
 	}()
 
+	// Load the JWT signing keys; without configured keys, a secret generated on first start is used
+	auth.AccessTokenTTL = cfg.JWT.AccessTokenTTL
+	users.RefreshTokenTTL = cfg.JWT.RefreshTokenTTL
+	jwtSecret, err := metadata.GetSetting(db, models.SettingJWTSecret)
+	if err != nil {
+		log.Fatalf("Failed to read JWT secret: %v", err)
+	}
+	keySet, err := auth.LoadKeySet(cfg.KeyConfig(), jwtSecret)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+	auth.SetKeySet(keySet)
+	fmt.Printf("Signing tokens with %s key %s\n", keySet.Active().Algorithm, keySet.Active().ID)
+
 	// Initialize the central application which holds all services
 	app := server.NewApp(db) // Pass db to NewApp
 
 	// Create a new ServeMux (router)
 	mux := http.NewServeMux()
 
+	if ldapConfig := cfg.LDAPConfig(); ldapConfig.Enabled() {
+		if err = app.UserService.EnableLDAP(ldapConfig); err != nil {
+			log.Fatalf("Failed to configure LDAP authentication: %v", err)
+		}
+		fmt.Printf("LDAP authentication enabled with %s\n", ldapConfig.URL)
+	}
+
+	if err = app.UserService.SetRegistrationPolicy(cfg.RegistrationPolicy()); err != nil {
+		log.Fatalf("Invalid registration policy: %v", err)
+	}
+	fmt.Printf("Self-registration mode: %s\n", app.UserService.RegistrationMode())
+
+	if err = app.UserService.SetPasswordPolicy(cfg.PasswordPolicy()); err != nil {
+		log.Fatalf("Invalid password policy: %v", err)
+	}
+	if err = app.UserService.SetLoginThrottle(cfg.LoginThrottleConfig()); err != nil {
+		log.Fatalf("Invalid login throttle configuration: %v", err)
+	}
+	if err = app.UserService.SetMFAPolicy(cfg.MFAPolicy()); err != nil {
+		log.Fatalf("Invalid two-factor authentication policy: %v", err)
+	}
+	if err = app.UserService.SetClientCertUserField(cfg.Server.TLSClientUser); err != nil {
+		log.Fatalf("Invalid client certificate configuration: %v", err)
+	}
+
+	// Without an admin, either create one from the given credentials or offer a one-time setup link
+	setupToken, err := app.UserService.Bootstrap(cfg.BootstrapConfig())
+	if err != nil {
+		log.Fatalf("Failed to bootstrap admin account: %v", err)
+	}
+	if setupToken != "" {
+		fmt.Printf("No admin account exists. Create one at %s/setup#token=%s\n", cfg.Server.BaseURL(), setupToken)
+	}
+
 	// Initialize web handlers/routes with necessary service dependencies
-	handlerDeps := web.NewHandlers(app.UserService, app.CoreService)
-	handlerDeps.RegisterRoutes(mux) // Register routes onto the new mux
+	handlerDeps := web.NewHandlers(app.UserService, app.CoreService, app.AuditService)
+	handlerDeps.StaticDir = cfg.Server.StaticDir
+	handlerDeps.Features = cfg.Features
+	handlerDeps.TrustedProxies = cfg.Server.TrustedProxyNets()
+	if oidcConfig := cfg.OIDCConfig(); oidcConfig.Enabled() {
+		handlerDeps.OIDCProvider, err = auth.NewOIDCProvider(oidcConfig)
+		if err != nil {
+			log.Fatalf("Failed to configure single sign-on: %v", err)
+		}
+		fmt.Printf("Single sign-on enabled with issuer %s\n", oidcConfig.Issuer)
+	}
+	handlerDeps.MetaDB = db
+	handlerDeps.ReadinessDataSources = cfg.Server.ReadinessDataSources
 
-	// Define public paths that do not require authentication
-	publicPaths := []string{
-		"/",
-		"/login",
-		"/register",
-		"/api/login",
-		"/api/register",
-		"/static/",        // Static assets
-		"/dashboard",      // Main dashboard page
-		"/dashboard_home", // Dashboard iframe content
-		"/db_connections", // Dashboard iframe content
-		"/virtual_views",  // Dashboard iframe content
-		"/settings",       // Dashboard iframe content
-		"/favicon.ico",    // Browser favicon request
+	// Background jobs are stopped at shutdown, finishing their current run before the metadata
+	// database is closed
+	stopJobs := make(chan struct{})
+	var jobs sync.WaitGroup
+	runJob := func(run func(stop <-chan struct{})) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			run(stopJobs)
+		}()
 	}
+	handlerDeps.Backups = metadata.NewBackupStore(db, backupConfig)
+	if backupConfig.Interval > 0 {
+		runJob(handlerDeps.Backups.RunSchedule)
+		fmt.Printf("Scheduled metadata backups every %s to %s, keeping %d\n", backupConfig.Interval, backupConfig.Dir, backupConfig.Retain)
+	}
+	handlerDeps.Reconciler = core.NewReconcileService(db, gitOpsConfig)
+	if gitOpsConfig.Enabled() {
+		handlerDeps.Reconciler.OnScheduledApply(handlerDeps.AuditScheduledReconcile)
+		runJob(handlerDeps.Reconciler.Run)
+		fmt.Printf("Reconciling declarative configuration from %s every %s\n", gitOpsConfig.Dir, gitOpsConfig.Interval)
+	}
+	handlerDeps.RegisterRoutes(mux) // Register routes onto the new mux
 
 	// Wrap the mux with the JWT middleware
-	protectedMux := auth.JWTMiddleware(mux, publicPaths)
+	protectedMux := auth.JWTMiddleware(mux, handlerDeps.PublicPaths(), app.UserService)
+
+	addr := cfg.Server.ListenAddr
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", addr, err)
+	}
+	fmt.Printf("Listening on %s. Access it at %s\n", listener.Addr().String(), cfg.Server.BaseURL())
+
+	srv := &http.Server{
+		Handler:           protectedMux,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	var redirectServer *http.Server
+	serveErr := make(chan error, 1)
+	if cfg.Server.TLSEnabled() {
+		var reloader *server.TLSReloader
+		reloader, err = server.NewTLSReloader(server.TLSConfig{
+			CertFile:          cfg.Server.TLSCertFile,
+			KeyFile:           cfg.Server.TLSKeyFile,
+			MinVersion:        cfg.Server.TLSMinVersion,
+			ClientCAFile:      cfg.Server.TLSClientCAFile,
+			RequireClientCert: cfg.Server.TLSClientAuth == "require",
+		})
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+		srv.TLSConfig = reloader.ServerConfig()
+		if cfg.Server.MutualTLS() {
+			fmt.Printf("Client certificates from %s authenticate users by %s (%s)\n", cfg.Server.TLSClientCAFile, cfg.Server.TLSClientUser, cfg.Server.TLSClientAuth)
+		}
+		if cfg.Server.HTTPRedirectAddr != "" {
+			redirectServer = redirectToHTTPS(cfg.Server)
+		}
+		go func() { serveErr <- srv.ServeTLS(listener, "", "") }()
+	} else {
+		if !cfg.Server.Loopback() {
+			slog.Warn("Serving plain HTTP on a network address; tokens and passwords travel in cleartext. Configure server.tls_cert_file to serve HTTPS.", "addr", addr)
+		}
+		go func() { serveErr <- srv.Serve(listener) }()
+	}
+
+	// On SIGINT or SIGTERM, stop accepting connections and let in-flight requests, such as
+	// exports, finish; a second signal exits at once
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-serveErr:
+		log.Fatalf("HTTP server failed: %v", err)
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down", sig)
+	}
+	go func() {
+		<-signals
+		log.Fatalf("Received a second signal, exiting without waiting for in-flight requests")
+	}()
+
+	// Fail readiness first, so load balancers stop routing new requests here before the listener closes
+	handlerDeps.BeginShutdown()
+	if cfg.Server.ShutdownDelay > 0 {
+		time.Sleep(cfg.Server.ShutdownDelay)
+	}
+	shutdownCtx := context.Background()
+	if cfg.Server.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, cfg.Server.ShutdownTimeout)
+		defer cancel()
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Requests still running after %s were cut off: %v", cfg.Server.ShutdownTimeout, err)
+		srv.Close()
+	}
+	close(stopJobs)
+	jobs.Wait()
+	log.Println("HTTP server shut down.")
+}
+
+// redirectToHTTPS starts a plain HTTP listener that redirects every request to HTTPS.
+func redirectToHTTPS(serverConfig config.ServerConfig) *http.Server {
+	_, httpsPort, _ := net.SplitHostPort(serverConfig.ListenAddr)
+	fmt.Printf("Redirecting HTTP on %s to HTTPS\n", serverConfig.HTTPRedirectAddr)
+	redirectServer := &http.Server{
+		Addr:              serverConfig.HTTPRedirectAddr,
+		Handler:           server.HTTPSRedirect(httpsPort),
+		ReadHeaderTimeout: serverConfig.ReadHeaderTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
+	}
+	go func() {
+		if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP redirect server failed: %v", err)
+		}
+	}()
+	return redirectServer
+}
+
+// dryRunMigrations reports the schema migrations the metadata database is missing and checks that
+// they apply, rolling them back afterwards.
+func dryRunMigrations(storeConfig metadata.StoreConfig) {
+	db, err := metadata.OpenDB(storeConfig)
+	if err != nil {
+		log.Fatalf("Failed to open metadata database: %v", err)
+	}
+	defer db.Close()
+
+	version, err := metadata.SchemaVersion(db)
+	if err != nil {
+		log.Fatalf("Failed to read metadata schema version: %v", err)
+	}
+	fmt.Printf("Metadata schema is at version %d; this binary migrates it to version %d.\n", version, metadata.LatestSchemaVersion())
+
+	pending, err := metadata.DryRunMigrations(db)
+	for _, m := range pending {
+		fmt.Printf("  pending migration %d: %s\n", m.Version, m.Description)
+	}
+	if err != nil {
+		log.Fatalf("Migration dry run failed: %v", err)
+	}
+	if len(pending) == 0 {
+		fmt.Println("No pending migrations.")
+	} else {
+		fmt.Println("All pending migrations applied cleanly and were rolled back.")
+	}
+}
+
+// backupMetadata writes a snapshot of the metadata database to path.
+func backupMetadata(storeConfig metadata.StoreConfig, path string) {
+	db, err := metadata.OpenDB(storeConfig)
+	if err != nil {
+		log.Fatalf("Failed to open metadata database: %v", err)
+	}
+	defer db.Close()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		log.Fatalf("Failed to create backup file: %v", err)
+	}
+	info, err := metadata.WriteSnapshot(db, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		log.Fatalf("Backup failed: %v", err)
+	}
+	fmt.Printf("Wrote snapshot of schema version %d to %s (%s).\n", info.SchemaVersion, path, formatRowCounts(info.RowCounts))
+}
 
-	addr := "0.0.0.0:18080"
-	fmt.Printf("Attempting to listen on tcp4 %s\n", addr)
+// restoreMetadata replaces the metadata database with the snapshot in path, after backing up the
+// current contents to the backup directory.
+func restoreMetadata(storeConfig metadata.StoreConfig, backupConfig metadata.BackupConfig, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("Failed to open snapshot: %v", err)
+	}
+	snapshot, err := metadata.ReadSnapshot(file)
+	file.Close()
+	if err == nil {
+		err = snapshot.CheckVersion()
+	}
+	if err != nil {
+		log.Fatalf("Cannot restore snapshot: %v", err)
+	}
+
+	db, err := metadata.OpenDB(storeConfig)
+	if err != nil {
+		log.Fatalf("Failed to open metadata database: %v", err)
+	}
+	defer db.Close()
+
+	version, err := metadata.SchemaVersion(db)
+	if err != nil {
+		log.Fatalf("Failed to read metadata schema version: %v", err)
+	}
+	if version > 0 {
+		backup, _, err := metadata.NewBackupStore(db, backupConfig).Create()
+		if err != nil {
+			log.Fatalf("Failed to back up the current metadata before restoring: %v", err)
+		}
+		fmt.Printf("Current metadata backed up to %s\n", filepath.Join(backupConfig.Dir, backup.Name))
+	}
+
+	info, err := metadata.RestoreSnapshot(db, snapshot)
+	if err != nil {
+		log.Fatalf("Restore failed, the metadata database is unchanged: %v", err)
+	}
+	fmt.Printf("Restored snapshot of schema version %d taken at %s (%s); the schema is now at version %d.\n",
+		info.SchemaVersion, info.CreatedAt.Format(time.RFC3339), formatRowCounts(info.RowCounts), metadata.LatestSchemaVersion())
+}
 
-	listener, err := net.Listen("tcp4", addr)
+// printGitOpsPlan prints the changes reconciling the manifests would make. The metadata schema
+// must be up to date, since planning only reads.
+func printGitOpsPlan(storeConfig metadata.StoreConfig, gitOpsConfig core.GitOpsConfig) {
+	db, err := metadata.OpenDB(storeConfig)
 	if err != nil {
-		log.Fatalf("Failed to listen on tcp4 %s: %v", addr, err)
+		log.Fatalf("Failed to open metadata database: %v", err)
 	}
+	defer db.Close()
 
-	fmt.Printf("Successfully listening on tcp4 %s. Access it at http://%s\n", listener.Addr().String(), addr)
-	fmt.Println("Starting server...")
+	version, err := metadata.SchemaVersion(db)
+	if err != nil {
+		log.Fatalf("Failed to read metadata schema version: %v", err)
+	}
+	if version != metadata.LatestSchemaVersion() {
+		log.Fatalf("Metadata schema is at version %d, not %d; start Bridgo once to migrate it", version, metadata.LatestSchemaVersion())
+	}
 
-	// Use the protected mux for the HTTP server
-	if err := http.Serve(listener, protectedMux); err != nil {
-		if err != http.ErrServerClosed {
-			log.Fatalf("HTTP server ListenAndServe: %v", err)
-		} else {
-			log.Println("HTTP server shut down.")
+	plan, err := core.NewReconcileService(db, gitOpsConfig).Plan()
+	if err != nil {
+		log.Fatalf("Failed to plan reconciliation: %v", err)
+	}
+	for _, change := range plan.Changes {
+		fmt.Printf("%-7s %s %s", change.Action, change.Kind, change.Name)
+		if change.Manifest != "" {
+			fmt.Printf(" (%s)", change.Manifest)
+		}
+		fmt.Println()
+		for _, line := range change.Diff {
+			fmt.Printf("        %s\n", line)
 		}
 	}
+	for _, problem := range plan.Errors {
+		fmt.Printf("error   %s\n", problem)
+	}
+	fmt.Printf("%d change(s), %d unchanged, %d error(s)\n", len(plan.Changes), plan.Unchanged, len(plan.Errors))
+	if len(plan.Errors) > 0 {
+		os.Exit(1)
+	}
+}
+
+// formatRowCounts summarizes the row counts of a snapshot.
+func formatRowCounts(counts map[string]int) string {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return fmt.Sprintf("%d rows in %d tables", total, len(counts))
 }
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"Bridgo/internal/models"
+)
+
+// Repository stores audit log entries. NewSQLRepository keeps them in the metadata database;
+// other stores can be substituted, e.g. in tests.
+type Repository interface {
+	// Insert stores a new entry.
+	Insert(entry models.AuditLog) error
+	// Search returns the entries matching filter, newest first. Limit and Offset are already
+	// normalized by the Service.
+	Search(filter models.AuditLogFilter) ([]models.AuditLog, error)
+}
+
+// sqlRepository keeps audit entries in the 'audit_logs' table. Its queries only use SQL that
+// DuckDB and PostgreSQL both understand.
+type sqlRepository struct {
+	db *sql.DB
+}
+
+// NewSQLRepository returns a Repository on the metadata database.
+func NewSQLRepository(db *sql.DB) Repository {
+	return &sqlRepository{db: db}
+}
+
+func (r *sqlRepository) Insert(entry models.AuditLog) error {
+	_, err := r.db.Exec(`
+		INSERT INTO audit_logs (id, user_id, action_type, target_resource_id, details, ip_address, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, entry.ID, nullString(entry.UserID), entry.ActionType, nullString(entry.TargetResourceID), nullString(entry.Details), nullString(entry.IPAddress), entry.Timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit log entry: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlRepository) Search(filter models.AuditLogFilter) ([]models.AuditLog, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, "a.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.ActionType != "" {
+		if strings.HasSuffix(filter.ActionType, ".") {
+			conditions = append(conditions, "strpos(a.action_type, ?) = 1")
+		} else {
+			conditions = append(conditions, "a.action_type = ?")
+		}
+		args = append(args, filter.ActionType)
+	}
+	if filter.TargetResourceID != "" {
+		conditions = append(conditions, "a.target_resource_id = ?")
+		args = append(args, filter.TargetResourceID)
+	}
+	if filter.IPAddress != "" {
+		conditions = append(conditions, "a.ip_address = ?")
+		args = append(args, filter.IPAddress)
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, "strpos(a.details, ?) > 0")
+		args = append(args, filter.Search)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "a.timestamp >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "a.timestamp < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	query := `
+		SELECT a.id, a.user_id, u.username, a.action_type, a.target_resource_id, a.details, a.ip_address, a.timestamp
+		FROM audit_logs a
+		LEFT JOIN users u ON u.id = a.user_id`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY a.timestamp DESC\n\t\tLIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditLog{}
+	for rows.Next() {
+		var entry models.AuditLog
+		var userID, username, targetID, details, ip sql.NullString
+		err = rows.Scan(&entry.ID, &userID, &username, &entry.ActionType, &targetID, &details, &ip, &entry.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit log entry: %w", err)
+		}
+		entry.UserID = stringPtr(userID)
+		entry.Username = stringPtr(username)
+		entry.TargetResourceID = stringPtr(targetID)
+		entry.Details = stringPtr(details)
+		entry.IPAddress = stringPtr(ip)
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit log rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// nullString maps a nil pointer to SQL NULL.
+func nullString(value *string) sql.NullString {
+	if value == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *value, Valid: true}
+}
+
+// stringPtr converts a nullable string to a pointer for JSON output.
+func stringPtr(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
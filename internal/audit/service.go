@@ -0,0 +1,81 @@
+// Package audit records security-relevant and data-access actions in the 'audit_logs' table.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Default and maximum number of entries returned by Search.
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 10000
+)
+
+// Service writes and searches audit log entries.
+type Service struct {
+	repo Repository
+}
+
+// NewService creates and returns a new audit Service on the metadata database.
+func NewService(db *sql.DB) *Service {
+	return NewServiceWithRepository(NewSQLRepository(db))
+}
+
+// NewServiceWithRepository creates an audit Service storing entries in repo.
+func NewServiceWithRepository(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// Record writes an audit entry. userID, targetID and ip may be empty; details is stored as JSON.
+// Failures are logged rather than returned so that auditing never breaks the audited request.
+func (s *Service) Record(userID, actionType, targetID string, details map[string]interface{}, ip string) {
+	entry := models.AuditLog{
+		ID:               uuid.NewString(),
+		UserID:           nilIfEmpty(userID),
+		ActionType:       actionType,
+		TargetResourceID: nilIfEmpty(targetID),
+		IPAddress:        nilIfEmpty(ip),
+		Timestamp:        time.Now().UTC(),
+	}
+	if len(details) > 0 {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			log.Printf("Failed to encode audit details for %s: %v", actionType, err)
+		} else {
+			entry.Details = nilIfEmpty(string(encoded))
+		}
+	}
+
+	if err := s.repo.Insert(entry); err != nil {
+		log.Printf("Failed to write audit log entry %s for user %s: %v", actionType, userID, err)
+	}
+}
+
+// Search returns audit entries matching the filter, newest first.
+func (s *Service) Search(filter models.AuditLogFilter) ([]models.AuditLog, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultSearchLimit
+	}
+	if filter.Limit > maxSearchLimit {
+		filter.Limit = maxSearchLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.repo.Search(filter)
+}
+
+// nilIfEmpty maps "" to nil, stored as SQL NULL.
+func nilIfEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
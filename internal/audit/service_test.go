@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"database/sql"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+)
+
+func TestSearch(t *testing.T) {
+	for store, open := range metadatatest.Stores {
+		t.Run(store, func(t *testing.T) {
+			testSearch(t, open(t))
+		})
+	}
+}
+
+func testSearch(t *testing.T, db *sql.DB) {
+	s := NewService(db)
+
+	s.Record("", "view.create", "v1", map[string]interface{}{"name": "sales_100%"}, "10.0.0.1")
+	s.Record("", "view.delete", "v2", map[string]interface{}{"name": "salesX100"}, "10.0.0.2")
+	s.Record("", "viewer.open", "v3", nil, "10.0.0.1")
+	s.Record("", "user.login", "", map[string]interface{}{"method": "password"}, "10.0.0.3")
+
+	tests := []struct {
+		name   string
+		filter models.AuditLogFilter
+		want   []string // Target IDs, in any order
+	}{
+		{"action prefix", models.AuditLogFilter{ActionType: "view."}, []string{"v1", "v2"}},
+		{"exact action", models.AuditLogFilter{ActionType: "viewer.open"}, []string{"v3"}},
+		{"details substring", models.AuditLogFilter{Search: "sales"}, []string{"v1", "v2"}},
+		{"wildcards are literal", models.AuditLogFilter{Search: "sales_100%"}, []string{"v1"}},
+		{"ip address", models.AuditLogFilter{IPAddress: "10.0.0.1"}, []string{"v1", "v3"}},
+		{"target", models.AuditLogFilter{TargetResourceID: "v2"}, []string{"v2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := s.Search(tt.filter)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			got := map[string]bool{}
+			for _, e := range entries {
+				if e.TargetResourceID != nil {
+					got[*e.TargetResourceID] = true
+				}
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %v", len(entries), tt.want)
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Errorf("missing entry for target %s", id)
+				}
+			}
+		})
+	}
+
+	entries, err := s.Search(models.AuditLogFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("Search with limit: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("got %d entries with limit 2", len(entries))
+	}
+}
@@ -1,29 +1,70 @@
 package auth
 
 import (
+	"fmt"
 	"time"
 
+	"Bridgo/internal/models"
+
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-// jwtSecretKey is used to sign and verify JWT tokens.
-// In a production environment, this should be loaded from a secure configuration.
-var jwtSecretKey = []byte("your-secret-key-please-change") // TODO: Change this and load from config
+// AccessTokenTTL is how long an access token is valid. Clients renew it with a refresh token.
+// It is set from the configuration at startup.
+var AccessTokenTTL = 15 * time.Minute
+
+func init() {
+	// Issue iat with millisecond precision, so revoking all of a user's tokens does not also
+	// reject a token issued within the same second right after the revocation.
+	jwt.TimePrecision = time.Millisecond
+}
+
+// APIKeyPrefix starts every Bridgo API key, telling keys apart from JWTs.
+const APIKeyPrefix = "bgo_"
 
 // Claims defines the structure of the JWT claims.
+// Requests authenticated with an API key carry claims built from the key instead.
 type Claims struct {
-	Username string `json:"username"`
-	UserID   string `json:"userID"`
+	Username string   `json:"username"`
+	UserID   string   `json:"userID"`
+	Roles    []string `json:"roles"`
 	jwt.RegisteredClaims
+
+	APIKeyID string               `json:"-"` // Set when the request was authenticated with an API key
+	Scopes   []models.APIKeyScope `json:"-"` // Data sources and views the API key may access
+
+	ClientCertificate string `json:"-"` // Subject of the client certificate the request was authenticated with
+}
+
+// IsAPIKey reports whether the request was authenticated with an API key rather than a login token.
+func (c *Claims) IsAPIKey() bool {
+	return c.APIKeyID != ""
+}
+
+// InScope reports whether the caller may access the data source or view. Login tokens are not
+// scoped; API keys only reach the resources listed in their scopes.
+func (c *Claims) InScope(scopeType, id string) bool {
+	if !c.IsAPIKey() {
+		return true
+	}
+	for _, scope := range c.Scopes {
+		if scope.Type == scopeType && scope.ID == id {
+			return true
+		}
+	}
+	return false
 }
 
-// GenerateJWT generates a new JWT for a given username and userID.
-func GenerateJWT(username, userID string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// GenerateJWT generates a new JWT for a given username, userID and the user's role names.
+func GenerateJWT(username, userID string, roles []string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 	claims := &Claims{
 		Username: username,
 		UserID:   userID,
+		Roles:    roles,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(), // jti, so a single token can be revoked
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -31,8 +72,15 @@ func GenerateJWT(username, userID string) (string, error) {
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecretKey)
+	ks, err := currentKeySet()
+	if err != nil {
+		return "", err
+	}
+	key := ks.Active()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -40,10 +88,25 @@ func GenerateJWT(username, userID string) (string, error) {
 }
 
 // ValidateJWT validates a JWT string and returns the claims if the token is valid.
+// The token must name, in its kid header, one of the configured keys and be signed
+// with that key's algorithm.
 func ValidateJWT(tokenString string) (*Claims, error) {
+	ks, err := currentKeySet()
+	if err != nil {
+		return nil, err
+	}
+
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecretKey, nil
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key '%s'", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s for key '%s'", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
 	})
 
 	if err != nil {
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minSecretLength is the minimum length, in bytes, of an HS256 signing secret.
+const minSecretLength = 32
+
+// KeyConfig describes where the JWT signing and verification keys come from.
+type KeyConfig struct {
+	Secret         string   // HS256 secret, used when KeyFile is empty
+	KeyFile        string   // PEM private key (RSA for RS256, Ed25519 for EdDSA), or a file holding an HS256 secret
+	KeyID          string   // kid of the signing key; derived from the key when empty
+	VerifyKeyFiles []string // Extra keys still accepted for verification, as "path" or "kid=path"
+}
+
+// SigningKey is a key tokens are signed or verified with, identified by its kid.
+type SigningKey struct {
+	ID        string
+	Algorithm string      // "HS256", "RS256" or "EdDSA"
+	signKey   interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey; nil for verification-only keys
+	verifyKey interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens are accepted from.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+var (
+	keySetMu sync.RWMutex
+	keySet   *KeySet
+)
+
+// SetKeySet makes ks the key set used by GenerateJWT and ValidateJWT.
+func SetKeySet(ks *KeySet) {
+	keySetMu.Lock()
+	defer keySetMu.Unlock()
+	keySet = ks
+}
+
+// currentKeySet returns the configured key set, or an error before SetKeySet has been called.
+func currentKeySet() (*KeySet, error) {
+	keySetMu.RLock()
+	defer keySetMu.RUnlock()
+	if keySet == nil {
+		return nil, errors.New("JWT signing keys are not configured")
+	}
+	return keySet, nil
+}
+
+// LoadKeySet builds a KeySet from cfg. When cfg configures no signing key, fallbackSecret
+// (such as a secret generated and stored by the metadata database) is used for HS256.
+func LoadKeySet(cfg KeyConfig, fallbackSecret string) (*KeySet, error) {
+	var active *SigningKey
+	var err error
+	switch {
+	case cfg.KeyFile != "":
+		active, err = loadKeyFile(cfg.KeyFile, cfg.KeyID)
+	case cfg.Secret != "":
+		active, err = newHMACKey([]byte(cfg.Secret), cfg.KeyID)
+	default:
+		active, err = newHMACKey([]byte(fallbackSecret), cfg.KeyID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("signing key %s is a public key; a private key is required to sign tokens", cfg.KeyFile)
+	}
+
+	ks := &KeySet{active: active, keys: map[string]*SigningKey{active.ID: active}}
+	for _, entry := range cfg.VerifyKeyFiles {
+		kid, path := "", entry
+		if i := strings.Index(entry, "="); i > 0 {
+			kid, path = entry[:i], entry[i+1:]
+		}
+		key, err := loadKeyFile(path, kid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load verification key: %w", err)
+		}
+		if _, exists := ks.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key ID '%s'", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+	return ks, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (ks *KeySet) Active() *SigningKey {
+	return ks.active
+}
+
+// newHMACKey creates an HS256 key from a shared secret.
+func newHMACKey(secret []byte, kid string) (*SigningKey, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minSecretLength)
+	}
+	if kid == "" {
+		kid = deriveKeyID(secret)
+	}
+	return &SigningKey{ID: kid, Algorithm: jwt.SigningMethodHS256.Alg(), signKey: secret, verifyKey: secret}, nil
+}
+
+// loadKeyFile reads a PEM encoded RSA or Ed25519 key (private or public), or a file holding an HS256 secret.
+func loadKeyFile(path, kid string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %w", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return newHMACKey([]byte(strings.TrimSpace(string(data))), kid)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block '%s' in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+	}
+
+	key := &SigningKey{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.signKey, key.verifyKey = jwt.SigningMethodRS256.Alg(), k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Algorithm, key.verifyKey = jwt.SigningMethodRS256.Alg(), k
+	case ed25519.PrivateKey:
+		key.Algorithm, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA.Alg(), k, k.Public()
+	case ed25519.PublicKey:
+		key.Algorithm, key.verifyKey = jwt.SigningMethodEdDSA.Alg(), k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T in %s (expected RSA or Ed25519)", parsed, path)
+	}
+
+	if rsaKey, ok := key.verifyKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA key in %s must be at least 2048 bits", path)
+	}
+
+	key.ID = kid
+	if key.ID == "" {
+		der, err := x509.MarshalPKIXPublicKey(key.verifyKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode public key of %s: %w", path, err)
+		}
+		key.ID = deriveKeyID(der)
+	}
+	return key, nil
+}
+
+// deriveKeyID returns a stable kid for key material: the first 16 hex digits of its SHA-256.
+func deriveKeyID(material []byte) string {
+	sum := sha256.Sum256(material)
+	return hex.EncodeToString(sum[:8])
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS returns the public keys of the configured key set, so other services can verify
+// Bridgo tokens. HS256 secrets are never published.
+func JWKS() ([]JWK, error) {
+	ks, err := currentKeySet()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []JWK{}
+	for _, key := range ks.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+		switch k := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return keys, nil
+}
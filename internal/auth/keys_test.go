@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret-test-secret-test-secret"
+
+// writePEM writes a PKCS#8 private key, or a PKIX public key, to a file in dir.
+func writePEM(t *testing.T, dir, name string, key interface{}) string {
+	t.Helper()
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			t.Fatalf("marshal public key: %v", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			t.Fatalf("marshal private key: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return path
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	secretFile := filepath.Join(dir, "secret")
+	if err = os.WriteFile(secretFile, []byte(testSecret+"\n"), 0o600); err != nil {
+		t.Fatalf("write secret: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     KeyConfig
+		wantAlg string
+		wantKID string
+		wantErr string
+	}{
+		{name: "fallback secret", wantAlg: "HS256", wantKID: deriveKeyID([]byte(testSecret))},
+		{name: "configured secret", cfg: KeyConfig{Secret: testSecret + "!", KeyID: "2024-01"}, wantAlg: "HS256", wantKID: "2024-01"},
+		{name: "secret file", cfg: KeyConfig{KeyFile: secretFile}, wantAlg: "HS256", wantKID: deriveKeyID([]byte(testSecret))},
+		{name: "RSA", cfg: KeyConfig{KeyFile: writePEM(t, dir, "rsa.pem", rsaKey)}, wantAlg: "RS256"},
+		{name: "Ed25519", cfg: KeyConfig{KeyFile: writePEM(t, dir, "ed.pem", edKey), KeyID: "ed"}, wantAlg: "EdDSA", wantKID: "ed"},
+		{name: "short secret", cfg: KeyConfig{Secret: "too-short"}, wantErr: "at least 32 bytes"},
+		{name: "public signing key", cfg: KeyConfig{KeyFile: writePEM(t, dir, "ed.pub", edPublic)}, wantErr: "private key is required"},
+		{name: "duplicate key ID", cfg: KeyConfig{Secret: testSecret, KeyID: "k", VerifyKeyFiles: []string{"k=" + writePEM(t, dir, "rsa.pub", &rsaKey.PublicKey)}}, wantErr: "duplicate key ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := LoadKeySet(tt.cfg, testSecret)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadKeySet = %v, want an error mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadKeySet: %v", err)
+			}
+			active := ks.Active()
+			if active.Algorithm != tt.wantAlg || (tt.wantKID != "" && active.ID != tt.wantKID) {
+				t.Errorf("active key = %s %q, want %s %q", active.Algorithm, active.ID, tt.wantAlg, tt.wantKID)
+			}
+
+			SetKeySet(ks)
+			token, err := GenerateJWT("alice", "u1", []string{"viewer"})
+			if err != nil {
+				t.Fatalf("GenerateJWT: %v", err)
+			}
+			claims, err := ValidateJWT(token)
+			if err != nil || claims.UserID != "u1" {
+				t.Errorf("ValidateJWT = %+v (%v), want the claims of u1", claims, err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, oldKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+
+	oldSet, err := LoadKeySet(KeyConfig{KeyFile: writePEM(t, dir, "old.pem", oldKey)}, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	SetKeySet(oldSet)
+	oldToken, err := GenerateJWT("alice", "u1", nil)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+
+	// The new key signs; the old public key, with the kid derived from it, still verifies
+	rotated, err := LoadKeySet(KeyConfig{
+		KeyFile:        writePEM(t, dir, "new.pem", newKey),
+		VerifyKeyFiles: []string{writePEM(t, dir, "old.pub", oldKey.Public())},
+	}, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	SetKeySet(rotated)
+	if _, err = ValidateJWT(oldToken); err != nil {
+		t.Errorf("token of the previous key: %v", err)
+	}
+	newToken, err := GenerateJWT("alice", "u1", nil)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	if _, err = ValidateJWT(newToken); err != nil {
+		t.Errorf("token of the new key: %v", err)
+	}
+
+	jwks, err := JWKS()
+	if err != nil || len(jwks) != 2 {
+		t.Fatalf("JWKS = %+v (%v), want both public keys", jwks, err)
+	}
+	for _, jwk := range jwks {
+		if (jwk.KeyType == "RSA") != (jwk.KeyID == rotated.Active().ID) {
+			t.Errorf("JWK %+v: only the active key is RSA", jwk)
+		}
+	}
+
+	// A token naming the RSA key but signed with HS256 must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "u1"})
+	forged.Header["kid"] = rotated.Active().ID
+	forgedString, err := forged.SignedString(x509.MarshalPKCS1PublicKey(&newKey.PublicKey))
+	if err != nil {
+		t.Fatalf("sign forged token: %v", err)
+	}
+	if _, err = ValidateJWT(forgedString); err == nil {
+		t.Error("token with a mismatched algorithm was accepted")
+	}
+
+	// Once the old key is dropped, its tokens are rejected
+	dropped, err := LoadKeySet(KeyConfig{KeyFile: filepath.Join(dir, "new.pem")}, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	SetKeySet(dropped)
+	if _, err = ValidateJWT(oldToken); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Errorf("token of a dropped key: got %v, want unknown signing key", err)
+	}
+	if jwks, err = JWKS(); err != nil || len(jwks) != 1 {
+		t.Errorf("JWKS = %+v (%v), want only the active key", jwks, err)
+	}
+
+	hmacSet, err := LoadKeySet(KeyConfig{}, testSecret)
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	SetKeySet(hmacSet)
+	if jwks, err = JWKS(); err != nil || len(jwks) != 0 {
+		t.Errorf("JWKS = %+v (%v), want the HS256 secret kept private", jwks, err)
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"crypto/x509"
 	"net/http"
 	"strings"
 )
@@ -12,9 +13,20 @@ type MiddlewareKey string
 // UserContextKey is the key used to store user claims in the request context.
 const UserContextKey MiddlewareKey = "userClaims"
 
-// JWTMiddleware validates the JWT token from the Authorization header,
-// skipping authentication for specified public paths.
-func JWTMiddleware(next http.Handler, publicPaths []string) http.Handler {
+// SessionChecker decides whether the session behind a validly signed token may still be used,
+// e.g. that the user is still active and the token has not been revoked, and authenticates API keys
+// and client certificates.
+type SessionChecker interface {
+	CheckSession(claims *Claims) error
+	AuthenticateAPIKey(key string) (*Claims, error)
+	AuthenticateClientCertificate(cert *x509.Certificate) (*Claims, error)
+}
+
+// JWTMiddleware validates the JWT token from the Authorization header and checks the session
+// with sessions, skipping authentication for specified public paths. An API key, sent in the
+// X-API-Key header or as the Bearer token, is accepted instead of a JWT. Without either, a
+// verified TLS client certificate authenticates the user it maps to.
+func JWTMiddleware(next http.Handler, publicPaths []string, sessions SessionChecker) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if the current request path is one of the public paths
 		var isPublicPath bool
@@ -40,23 +52,47 @@ func JWTMiddleware(next http.Handler, publicPaths []string) http.Handler {
 		}
 
 		// If not a public path, proceed with token validation
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
-			return
-		}
+		tokenString := r.Header.Get("X-API-Key")
+		if tokenString == "" {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+					claims, err := sessions.AuthenticateClientCertificate(r.TLS.VerifiedChains[0][0])
+					if err != nil {
+						http.Error(w, "Invalid client certificate: "+err.Error(), http.StatusUnauthorized)
+						return
+					}
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserContextKey, claims)))
+					return
+				}
+				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				return
+			}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			http.Error(w, "Authorization header format must be Bearer {token}", http.StatusUnauthorized)
-			return
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+				http.Error(w, "Authorization header format must be Bearer {token}", http.StatusUnauthorized)
+				return
+			}
+			tokenString = parts[1]
 		}
 
-		tokenString := parts[1]
-		claims, err := ValidateJWT(tokenString)
-		if err != nil {
-			http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
-			return
+		var claims *Claims
+		var err error
+		if strings.HasPrefix(tokenString, APIKeyPrefix) {
+			if claims, err = sessions.AuthenticateAPIKey(tokenString); err != nil {
+				http.Error(w, "Invalid API key: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+		} else {
+			if claims, err = ValidateJWT(tokenString); err != nil {
+				http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err = sessions.CheckSession(claims); err != nil {
+				http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
 		}
 
 		// Token is valid, add claims to context for downstream handlers
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Key is the SHA-1 test key of RFC 6238, appendix B.
+var rfc6238Key = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes; 6-digit codes are their last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Key, tt.unix/int64(totpPeriod.Seconds())); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString(rfc6238Key)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / int64(totpPeriod.Seconds())
+
+	if step, ok := ValidateTOTP(secret, "050471", now); !ok || step != current {
+		t.Errorf("current code: got step %d, %v", step, ok)
+	}
+	for _, offset := range []int64{-1, 1} {
+		if step, ok := ValidateTOTP(secret, totpCode(rfc6238Key, current+offset), now); !ok || step != current+offset {
+			t.Errorf("code of step %+d: got step %d, %v; want accepted", offset, step, ok)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		if _, ok := ValidateTOTP(secret, totpCode(rfc6238Key, current+offset), now); ok {
+			t.Errorf("code of step %+d accepted", offset)
+		}
+	}
+	if _, ok := ValidateTOTP(secret, "50471", now); ok {
+		t.Errorf("5-digit code accepted")
+	}
+	if _, ok := ValidateTOTP("not base32!", "050471", now); ok {
+		t.Errorf("code for an invalid secret accepted")
+	}
+	if _, ok := ValidateTOTP(totpEncoding.EncodeToString(rfc6238Key[:len(rfc6238Key)-1]), "050471", now); ok {
+		t.Errorf("code for another secret accepted")
+	}
+}
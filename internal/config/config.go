@@ -0,0 +1,874 @@
+// Package config loads Bridgo's application settings. Each setting starts at its default and is
+// overridden, in turn, by a YAML configuration file, a BRIDGO_* environment variable and a
+// command-line flag.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/core"
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/users"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the application settings.
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Metadata MetadataConfig `yaml:"metadata"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Logging  LoggingConfig  `yaml:"logging"`
+	Features FeatureConfig  `yaml:"features"`
+
+	Admin        AdminConfig        `yaml:"admin"`
+	Backup       BackupConfig       `yaml:"backup"`
+	GitOps       GitOpsConfig       `yaml:"gitops"`
+	LDAP         LDAPConfig         `yaml:"ldap"`
+	OIDC         OIDCConfig         `yaml:"oidc"`
+	Registration RegistrationConfig `yaml:"registration"`
+	Password     PasswordConfig     `yaml:"password_policy"`
+	Login        LoginConfig        `yaml:"login"`
+	MFA          MFAConfig          `yaml:"mfa"`
+
+	File    string            `yaml:"-"` // Configuration file the settings were read from, if any
+	sources map[string]string // Setting key -> where its value came from, for PrintConfig
+}
+
+// ServerConfig controls the HTTP server.
+type ServerConfig struct {
+	ListenAddr           string        `yaml:"listen_addr"`
+	StaticDir            string        `yaml:"static_dir"` // Web UI files; found next to the working directory or the executable when empty
+	TLSCertFile          string        `yaml:"tls_cert_file"`
+	TLSKeyFile           string        `yaml:"tls_key_file"`
+	TLSMinVersion        string        `yaml:"tls_min_version"`    // 1.2 or 1.3
+	TLSClientCAFile      string        `yaml:"tls_client_ca_file"` // CAs of accepted client certificates; enables mutual TLS
+	TLSClientAuth        string        `yaml:"tls_client_auth"`    // optional or require
+	TLSClientUser        string        `yaml:"tls_client_user"`    // Certificate field naming the user: cn or email
+	HTTPRedirectAddr     string        `yaml:"http_redirect_addr"` // Plain HTTP address redirecting to HTTPS
+	ReadHeaderTimeout    time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout          time.Duration `yaml:"read_timeout"`
+	WriteTimeout         time.Duration `yaml:"write_timeout"`
+	IdleTimeout          time.Duration `yaml:"idle_timeout"`
+	ShutdownDelay        time.Duration `yaml:"shutdown_delay"`         // How long /readyz fails before the listener closes after SIGTERM
+	ShutdownTimeout      time.Duration `yaml:"shutdown_timeout"`       // How long in-flight requests may finish after SIGTERM
+	ReadinessDataSources bool          `yaml:"readiness_data_sources"` // /readyz also checks that every data source answers
+	TrustedProxies       []string      `yaml:"trusted_proxies"`        // Addresses or CIDR ranges whose X-Forwarded-For is believed
+}
+
+// TLSEnabled reports whether the server serves HTTPS.
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != ""
+}
+
+// MutualTLS reports whether clients may authenticate with certificates.
+func (s ServerConfig) MutualTLS() bool {
+	return s.TLSClientCAFile != ""
+}
+
+// Loopback reports whether the server only listens on a loopback address.
+func (s ServerConfig) Loopback() bool {
+	host, _, err := net.SplitHostPort(s.ListenAddr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// TrustedProxyNets returns the trusted proxies as networks, single addresses as /32 or /128.
+// Entries that do not parse are skipped; Validate reports them.
+func (s ServerConfig) TrustedProxyNets() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range s.TrustedProxies {
+		if network := parseProxy(entry); network != nil {
+			nets = append(nets, network)
+		}
+	}
+	return nets
+}
+
+// parseProxy parses an address or CIDR range, returning nil if it is neither.
+func parseProxy(entry string) *net.IPNet {
+	entry = strings.TrimSpace(entry)
+	if _, network, err := net.ParseCIDR(entry); err == nil {
+		return network
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// BaseURL returns the URL the server can be reached at from the local host.
+func (s ServerConfig) BaseURL() string {
+	scheme := "http"
+	if s.TLSEnabled() {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(s.ListenAddr)
+	if err != nil {
+		return scheme + "://" + s.ListenAddr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+// MetadataConfig selects the metadata database and sizes its connection pool.
+type MetadataConfig struct {
+	Driver          string        `yaml:"driver"` // duckdb or postgres
+	DSN             string        `yaml:"dsn"`    // DuckDB file path, or PostgreSQL connection string
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// JWTConfig controls the tokens Bridgo issues.
+type JWTConfig struct {
+	Secret          string        `yaml:"secret"`
+	KeyFile         string        `yaml:"key_file"`
+	KeyID           string        `yaml:"key_id"`
+	VerifyKeyFiles  []string      `yaml:"verify_key_files"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+}
+
+// LoggingConfig controls the server log.
+type LoggingConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // text or json
+	File   string `yaml:"file"`   // Appended to; standard error when empty
+}
+
+// FeatureConfig switches optional parts of the server on or off.
+type FeatureConfig struct {
+	UI         bool `yaml:"ui"`          // Serve the web interface, not only the API
+	Bundles    bool `yaml:"bundles"`     // Export and import bundles of data sources and views
+	SampleData bool `yaml:"sample_data"` // Preview rows of views
+}
+
+// AdminConfig holds the credentials of the first admin, created at startup while no admin exists.
+type AdminConfig struct {
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"` // Temporary; the admin must change it at their first login
+}
+
+// BackupConfig controls the metadata backup directory and scheduled backups.
+type BackupConfig struct {
+	Dir      string        `yaml:"dir"`
+	Interval time.Duration `yaml:"interval"` // 0 disables scheduled backups
+	Retain   int           `yaml:"retain"`
+}
+
+// GitOpsConfig controls reconciliation with a directory of manifests.
+type GitOpsConfig struct {
+	Dir        string        `yaml:"dir"` // Empty disables reconciliation
+	Interval   time.Duration `yaml:"interval"`
+	Owner      string        `yaml:"owner"`
+	Prune      bool          `yaml:"prune"`
+	Adopt      bool          `yaml:"adopt"`
+	SecretsKey string        `yaml:"secrets_key"`
+}
+
+// LDAPConfig describes the directory users without a local password authenticate against.
+type LDAPConfig struct {
+	URL             string            `yaml:"url"` // Empty disables LDAP authentication
+	StartTLS        bool              `yaml:"start_tls"`
+	CAFile          string            `yaml:"ca_file"`
+	BindDN          string            `yaml:"bind_dn"`
+	BindPassword    string            `yaml:"bind_password"`
+	UserSearchBase  string            `yaml:"user_search_base"`
+	UserFilter      string            `yaml:"user_filter"`
+	EmailAttribute  string            `yaml:"email_attribute"`
+	GroupSearchBase string            `yaml:"group_search_base"`
+	GroupFilter     string            `yaml:"group_filter"`
+	GroupRoles      map[string]string `yaml:"group_roles"` // Group DN or CN -> role name
+	DefaultRole     string            `yaml:"default_role"`
+}
+
+// OIDCConfig describes the OpenID Connect provider users can sign in with.
+type OIDCConfig struct {
+	Issuer       string            `yaml:"issuer"` // Empty disables single sign-on
+	ClientID     string            `yaml:"client_id"`
+	ClientSecret string            `yaml:"client_secret"`
+	RedirectURL  string            `yaml:"redirect_url"`
+	Scopes       []string          `yaml:"scopes"`
+	GroupsClaim  string            `yaml:"groups_claim"`
+	GroupRoles   map[string]string `yaml:"group_roles"` // Provider group -> role name
+	DefaultRole  string            `yaml:"default_role"`
+}
+
+// RegistrationConfig controls self-registration.
+type RegistrationConfig struct {
+	Mode    string   `yaml:"mode"`    // disabled, invite, domain or open
+	Domains []string `yaml:"domains"` // E-mail domains allowed in domain mode
+}
+
+// PasswordConfig lists the rules new passwords must satisfy.
+type PasswordConfig struct {
+	MinLength int      `yaml:"min_length"`
+	Require   []string `yaml:"require"` // Character classes: upper, lower, digit or symbol
+}
+
+// LoginConfig controls the backoff and lockout after failed logins.
+type LoginConfig struct {
+	FreeAttempts     int           `yaml:"free_attempts"`
+	IPFreeAttempts   int           `yaml:"ip_free_attempts"`
+	BackoffBase      time.Duration `yaml:"backoff_base"`
+	BackoffMax       time.Duration `yaml:"backoff_max"`
+	LockoutThreshold int           `yaml:"lockout_threshold"` // 0 disables lockout
+	LockoutDuration  time.Duration `yaml:"lockout_duration"`
+	FailureWindow    time.Duration `yaml:"failure_window"`
+}
+
+// MFAConfig controls who must use two-factor authentication.
+type MFAConfig struct {
+	RequiredRoles []string `yaml:"required_roles"`
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddr:        "0.0.0.0:18080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       time.Minute,
+			WriteTimeout:      5 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+			TLSMinVersion:     "1.2",
+			TLSClientAuth:     "optional",
+			TLSClientUser:     "cn",
+		},
+		Metadata: MetadataConfig{Driver: metadata.DefaultStoreConfig.Driver, DSN: metadata.DefaultStoreConfig.DSN},
+		JWT:      JWTConfig{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: 7 * 24 * time.Hour},
+		Logging:  LoggingConfig{Level: "info", Format: "text"},
+		Features: FeatureConfig{UI: true, Bundles: true, SampleData: true},
+		Admin:    AdminConfig{Username: "admin"},
+		Backup: BackupConfig{
+			Dir:    metadata.DefaultBackupConfig.Dir,
+			Retain: metadata.DefaultBackupConfig.Retain,
+		},
+		GitOps: GitOpsConfig{
+			Interval: core.DefaultGitOpsConfig.Interval,
+			Owner:    core.DefaultGitOpsConfig.Owner,
+			Prune:    core.DefaultGitOpsConfig.Prune,
+		},
+		Registration: RegistrationConfig{Mode: users.RegistrationDisabled},
+		Password:     PasswordConfig{MinLength: users.DefaultPasswordPolicy.MinLength},
+		Login: LoginConfig{
+			FreeAttempts:     users.DefaultLoginThrottleConfig.FreeAttempts,
+			IPFreeAttempts:   users.DefaultLoginThrottleConfig.IPFreeAttempts,
+			BackoffBase:      users.DefaultLoginThrottleConfig.BaseDelay,
+			BackoffMax:       users.DefaultLoginThrottleConfig.MaxDelay,
+			LockoutThreshold: users.DefaultLoginThrottleConfig.LockoutThreshold,
+			LockoutDuration:  users.DefaultLoginThrottleConfig.LockoutDuration,
+			FailureWindow:    users.DefaultLoginThrottleConfig.FailureWindow,
+		},
+		sources: map[string]string{},
+	}
+}
+
+// setting describes one setting: its key in the configuration file, and the environment variable
+// and flag overriding it.
+type setting struct {
+	key   string
+	env   string
+	flag  string // No flag when empty
+	usage string
+	field func(c *Config) interface{} // Pointer to the setting's field
+}
+
+var settings = []setting{
+	{"server.listen_addr", "BRIDGO_LISTEN_ADDR", "listen", "`address` to listen on, host:port", func(c *Config) interface{} { return &c.Server.ListenAddr }},
+	{"server.static_dir", "BRIDGO_STATIC_DIR", "static-dir", "`directory` of the web UI files", func(c *Config) interface{} { return &c.Server.StaticDir }},
+	{"server.tls_cert_file", "BRIDGO_TLS_CERT_FILE", "tls-cert", "PEM certificate `file`; enables HTTPS", func(c *Config) interface{} { return &c.Server.TLSCertFile }},
+	{"server.tls_key_file", "BRIDGO_TLS_KEY_FILE", "tls-key", "PEM private key `file` of the certificate", func(c *Config) interface{} { return &c.Server.TLSKeyFile }},
+	{"server.tls_min_version", "BRIDGO_TLS_MIN_VERSION", "", "", func(c *Config) interface{} { return &c.Server.TLSMinVersion }},
+	{"server.tls_client_ca_file", "BRIDGO_TLS_CLIENT_CA_FILE", "tls-client-ca", "PEM `file` of the CAs client certificates are accepted from; enables mutual TLS", func(c *Config) interface{} { return &c.Server.TLSClientCAFile }},
+	{"server.tls_client_auth", "BRIDGO_TLS_CLIENT_AUTH", "", "", func(c *Config) interface{} { return &c.Server.TLSClientAuth }},
+	{"server.tls_client_user", "BRIDGO_TLS_CLIENT_USER", "", "", func(c *Config) interface{} { return &c.Server.TLSClientUser }},
+	{"server.http_redirect_addr", "BRIDGO_HTTP_REDIRECT_ADDR", "http-redirect", "`address` of a plain HTTP listener redirecting to HTTPS", func(c *Config) interface{} { return &c.Server.HTTPRedirectAddr }},
+	{"server.read_header_timeout", "BRIDGO_READ_HEADER_TIMEOUT", "", "", func(c *Config) interface{} { return &c.Server.ReadHeaderTimeout }},
+	{"server.read_timeout", "BRIDGO_READ_TIMEOUT", "", "", func(c *Config) interface{} { return &c.Server.ReadTimeout }},
+	{"server.write_timeout", "BRIDGO_WRITE_TIMEOUT", "", "", func(c *Config) interface{} { return &c.Server.WriteTimeout }},
+	{"server.idle_timeout", "BRIDGO_IDLE_TIMEOUT", "", "", func(c *Config) interface{} { return &c.Server.IdleTimeout }},
+	{"server.shutdown_delay", "BRIDGO_SHUTDOWN_DELAY", "", "", func(c *Config) interface{} { return &c.Server.ShutdownDelay }},
+	{"server.shutdown_timeout", "BRIDGO_SHUTDOWN_TIMEOUT", "shutdown-timeout", "how long in-flight requests may finish on shutdown (`duration`, 0 for no limit)", func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+	{"server.readiness_data_sources", "BRIDGO_READINESS_DATA_SOURCES", "", "", func(c *Config) interface{} { return &c.Server.ReadinessDataSources }},
+	{"server.trusted_proxies", "BRIDGO_TRUSTED_PROXIES", "", "", func(c *Config) interface{} { return &c.Server.TrustedProxies }},
+	{"metadata.driver", "BRIDGO_METADATA_DRIVER", "metadata-driver", "metadata store `driver`, duckdb or postgres", func(c *Config) interface{} { return &c.Metadata.Driver }},
+	{"metadata.dsn", "BRIDGO_METADATA_DSN", "metadata-dsn", "DuckDB file or PostgreSQL connection `string` of the metadata store", func(c *Config) interface{} { return &c.Metadata.DSN }},
+	{"metadata.max_open_conns", "BRIDGO_METADATA_MAX_OPEN_CONNS", "", "", func(c *Config) interface{} { return &c.Metadata.MaxOpenConns }},
+	{"metadata.max_idle_conns", "BRIDGO_METADATA_MAX_IDLE_CONNS", "", "", func(c *Config) interface{} { return &c.Metadata.MaxIdleConns }},
+	{"metadata.conn_max_lifetime", "BRIDGO_METADATA_CONN_MAX_LIFETIME", "", "", func(c *Config) interface{} { return &c.Metadata.ConnMaxLifetime }},
+	{"jwt.secret", "BRIDGO_JWT_SECRET", "", "", func(c *Config) interface{} { return &c.JWT.Secret }},
+	{"jwt.key_file", "BRIDGO_JWT_KEY_FILE", "", "", func(c *Config) interface{} { return &c.JWT.KeyFile }},
+	{"jwt.key_id", "BRIDGO_JWT_KEY_ID", "", "", func(c *Config) interface{} { return &c.JWT.KeyID }},
+	{"jwt.verify_key_files", "BRIDGO_JWT_VERIFY_KEY_FILES", "", "", func(c *Config) interface{} { return &c.JWT.VerifyKeyFiles }},
+	{"jwt.access_token_ttl", "BRIDGO_ACCESS_TOKEN_TTL", "", "", func(c *Config) interface{} { return &c.JWT.AccessTokenTTL }},
+	{"jwt.refresh_token_ttl", "BRIDGO_REFRESH_TOKEN_TTL", "", "", func(c *Config) interface{} { return &c.JWT.RefreshTokenTTL }},
+	{"logging.level", "BRIDGO_LOG_LEVEL", "log-level", "log `level`: debug, info, warn or error", func(c *Config) interface{} { return &c.Logging.Level }},
+	{"logging.format", "BRIDGO_LOG_FORMAT", "log-format", "log `format`: text or json", func(c *Config) interface{} { return &c.Logging.Format }},
+	{"logging.file", "BRIDGO_LOG_FILE", "log-file", "`file` to append the log to instead of standard error", func(c *Config) interface{} { return &c.Logging.File }},
+	{"features.ui", "BRIDGO_FEATURE_UI", "", "", func(c *Config) interface{} { return &c.Features.UI }},
+	{"features.bundles", "BRIDGO_FEATURE_BUNDLES", "", "", func(c *Config) interface{} { return &c.Features.Bundles }},
+	{"features.sample_data", "BRIDGO_FEATURE_SAMPLE_DATA", "", "", func(c *Config) interface{} { return &c.Features.SampleData }},
+	{"admin.username", "BRIDGO_ADMIN_USERNAME", "admin-username", "`username` of the first admin", func(c *Config) interface{} { return &c.Admin.Username }},
+	{"admin.email", "BRIDGO_ADMIN_EMAIL", "admin-email", "e-mail `address` of the first admin", func(c *Config) interface{} { return &c.Admin.Email }},
+	{"admin.password", "BRIDGO_ADMIN_PASSWORD", "admin-password", "temporary `password` of the first admin, to be changed at the first login", func(c *Config) interface{} { return &c.Admin.Password }},
+	{"backup.dir", "BRIDGO_BACKUP_DIR", "", "", func(c *Config) interface{} { return &c.Backup.Dir }},
+	{"backup.interval", "BRIDGO_BACKUP_INTERVAL", "", "", func(c *Config) interface{} { return &c.Backup.Interval }},
+	{"backup.retain", "BRIDGO_BACKUP_RETAIN", "", "", func(c *Config) interface{} { return &c.Backup.Retain }},
+	{"gitops.dir", "BRIDGO_GITOPS_DIR", "", "", func(c *Config) interface{} { return &c.GitOps.Dir }},
+	{"gitops.interval", "BRIDGO_GITOPS_INTERVAL", "", "", func(c *Config) interface{} { return &c.GitOps.Interval }},
+	{"gitops.owner", "BRIDGO_GITOPS_OWNER", "", "", func(c *Config) interface{} { return &c.GitOps.Owner }},
+	{"gitops.prune", "BRIDGO_GITOPS_PRUNE", "", "", func(c *Config) interface{} { return &c.GitOps.Prune }},
+	{"gitops.adopt", "BRIDGO_GITOPS_ADOPT", "", "", func(c *Config) interface{} { return &c.GitOps.Adopt }},
+	{"gitops.secrets_key", "BRIDGO_GITOPS_SECRETS_KEY", "", "", func(c *Config) interface{} { return &c.GitOps.SecretsKey }},
+	{"ldap.url", "BRIDGO_LDAP_URL", "", "", func(c *Config) interface{} { return &c.LDAP.URL }},
+	{"ldap.start_tls", "BRIDGO_LDAP_START_TLS", "", "", func(c *Config) interface{} { return &c.LDAP.StartTLS }},
+	{"ldap.ca_file", "BRIDGO_LDAP_CA_FILE", "", "", func(c *Config) interface{} { return &c.LDAP.CAFile }},
+	{"ldap.bind_dn", "BRIDGO_LDAP_BIND_DN", "", "", func(c *Config) interface{} { return &c.LDAP.BindDN }},
+	{"ldap.bind_password", "BRIDGO_LDAP_BIND_PASSWORD", "", "", func(c *Config) interface{} { return &c.LDAP.BindPassword }},
+	{"ldap.user_search_base", "BRIDGO_LDAP_USER_SEARCH_BASE", "", "", func(c *Config) interface{} { return &c.LDAP.UserSearchBase }},
+	{"ldap.user_filter", "BRIDGO_LDAP_USER_FILTER", "", "", func(c *Config) interface{} { return &c.LDAP.UserFilter }},
+	{"ldap.email_attribute", "BRIDGO_LDAP_EMAIL_ATTRIBUTE", "", "", func(c *Config) interface{} { return &c.LDAP.EmailAttribute }},
+	{"ldap.group_search_base", "BRIDGO_LDAP_GROUP_SEARCH_BASE", "", "", func(c *Config) interface{} { return &c.LDAP.GroupSearchBase }},
+	{"ldap.group_filter", "BRIDGO_LDAP_GROUP_FILTER", "", "", func(c *Config) interface{} { return &c.LDAP.GroupFilter }},
+	{"ldap.group_roles", "BRIDGO_LDAP_GROUP_ROLES", "", "", func(c *Config) interface{} { return &c.LDAP.GroupRoles }},
+	{"ldap.default_role", "BRIDGO_LDAP_DEFAULT_ROLE", "", "", func(c *Config) interface{} { return &c.LDAP.DefaultRole }},
+	{"oidc.issuer", "BRIDGO_OIDC_ISSUER", "", "", func(c *Config) interface{} { return &c.OIDC.Issuer }},
+	{"oidc.client_id", "BRIDGO_OIDC_CLIENT_ID", "", "", func(c *Config) interface{} { return &c.OIDC.ClientID }},
+	{"oidc.client_secret", "BRIDGO_OIDC_CLIENT_SECRET", "", "", func(c *Config) interface{} { return &c.OIDC.ClientSecret }},
+	{"oidc.redirect_url", "BRIDGO_OIDC_REDIRECT_URL", "", "", func(c *Config) interface{} { return &c.OIDC.RedirectURL }},
+	{"oidc.scopes", "BRIDGO_OIDC_SCOPES", "", "", func(c *Config) interface{} { return &c.OIDC.Scopes }},
+	{"oidc.groups_claim", "BRIDGO_OIDC_GROUPS_CLAIM", "", "", func(c *Config) interface{} { return &c.OIDC.GroupsClaim }},
+	{"oidc.group_roles", "BRIDGO_OIDC_GROUP_ROLES", "", "", func(c *Config) interface{} { return &c.OIDC.GroupRoles }},
+	{"oidc.default_role", "BRIDGO_OIDC_DEFAULT_ROLE", "", "", func(c *Config) interface{} { return &c.OIDC.DefaultRole }},
+	{"registration.mode", "BRIDGO_REGISTRATION", "", "", func(c *Config) interface{} { return &c.Registration.Mode }},
+	{"registration.domains", "BRIDGO_REGISTRATION_DOMAINS", "", "", func(c *Config) interface{} { return &c.Registration.Domains }},
+	{"password_policy.min_length", "BRIDGO_PASSWORD_MIN_LENGTH", "", "", func(c *Config) interface{} { return &c.Password.MinLength }},
+	{"password_policy.require", "BRIDGO_PASSWORD_REQUIRE", "", "", func(c *Config) interface{} { return &c.Password.Require }},
+	{"login.free_attempts", "BRIDGO_LOGIN_FREE_ATTEMPTS", "", "", func(c *Config) interface{} { return &c.Login.FreeAttempts }},
+	{"login.ip_free_attempts", "BRIDGO_LOGIN_IP_FREE_ATTEMPTS", "", "", func(c *Config) interface{} { return &c.Login.IPFreeAttempts }},
+	{"login.backoff_base", "BRIDGO_LOGIN_BACKOFF_BASE", "", "", func(c *Config) interface{} { return &c.Login.BackoffBase }},
+	{"login.backoff_max", "BRIDGO_LOGIN_BACKOFF_MAX", "", "", func(c *Config) interface{} { return &c.Login.BackoffMax }},
+	{"login.lockout_threshold", "BRIDGO_LOCKOUT_THRESHOLD", "", "", func(c *Config) interface{} { return &c.Login.LockoutThreshold }},
+	{"login.lockout_duration", "BRIDGO_LOCKOUT_DURATION", "", "", func(c *Config) interface{} { return &c.Login.LockoutDuration }},
+	{"login.failure_window", "BRIDGO_LOGIN_FAILURE_WINDOW", "", "", func(c *Config) interface{} { return &c.Login.FailureWindow }},
+	{"mfa.required_roles", "BRIDGO_MFA_REQUIRED_ROLES", "", "", func(c *Config) interface{} { return &c.MFA.RequiredRoles }},
+}
+
+// setValue parses value into the field a setting points to.
+func setValue(field interface{}, value string) error {
+	switch f := field.(type) {
+	case *string:
+		*f = value
+	case *[]string:
+		*f = nil
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				*f = append(*f, entry)
+			}
+		}
+	case *map[string]string:
+		// Mappings are separated by semicolons, since LDAP group DNs contain commas, and split at
+		// their last "=": "CN=Admins,OU=Groups,DC=corp,DC=com=admin;analysts=viewer"
+		*f = map[string]string{}
+		for _, entry := range strings.Split(value, ";") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			i := strings.LastIndex(entry, "=")
+			if i <= 0 || i == len(entry)-1 {
+				return fmt.Errorf("'%s' is not a name=value mapping", entry)
+			}
+			(*f)[strings.TrimSpace(entry[:i])] = strings.TrimSpace(entry[i+1:])
+		}
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+		*f = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not true or false", value)
+		}
+		*f = b
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a duration such as 30s or 5m", value)
+		}
+		*f = d
+	default:
+		return fmt.Errorf("unsupported setting type %T", field)
+	}
+	return nil
+}
+
+// Loader loads the configuration. Create it before the flags are parsed, so it can register the
+// -config flag and the flags overriding settings.
+type Loader struct {
+	fs    *flag.FlagSet
+	path  *string
+	flags map[string]*string // Flag name -> value given on the command line
+}
+
+// NewLoader registers the configuration flags on fs.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{fs: fs, flags: map[string]*string{}}
+	l.path = fs.String("config", "", "YAML configuration `file` (default $BRIDGO_CONFIG)")
+	for _, s := range settings {
+		if s.flag != "" {
+			l.flags[s.flag] = fs.String(s.flag, "", s.usage+" (setting "+s.key+")")
+		}
+	}
+	return l
+}
+
+// Load reads the configuration file, the environment and the parsed flags, and validates the
+// result.
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+
+	cfg.File = *l.path
+	if cfg.File == "" {
+		cfg.File = os.Getenv("BRIDGO_CONFIG")
+	}
+	if cfg.File != "" {
+		if err := cfg.readFile(cfg.File); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		value := os.Getenv(s.env)
+		if value == "" {
+			continue
+		}
+		if err := setValue(s.field(cfg), value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+		cfg.sources[s.key] = "env " + s.env
+	}
+
+	var err error
+	l.fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && err == nil {
+				if err = setValue(s.field(cfg), *l.flags[s.flag]); err != nil {
+					err = fmt.Errorf("invalid -%s: %w", s.flag, err)
+				}
+				cfg.sources[s.key] = "flag -" + s.flag
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The default DuckDB file is no PostgreSQL connection string
+	if _, set := cfg.sources["metadata.dsn"]; !set && cfg.Metadata.Driver != Default().Metadata.Driver {
+		cfg.Metadata.DSN = ""
+	}
+	if cfg.Server.StaticDir == "" {
+		cfg.Server.StaticDir = findStaticDir()
+		cfg.sources["server.static_dir"] = "detected"
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile applies the settings of a YAML configuration file. Unknown keys are errors.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	var document yaml.Node
+	if err = yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	if len(document.Content) > 0 {
+		recordKeys(document.Content[0], "", func(key string) { c.sources[key] = "file" })
+	}
+	return nil
+}
+
+// recordKeys calls record with the dotted key of every value in a YAML mapping.
+func recordKeys(node *yaml.Node, prefix string, record func(key string)) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := prefix + node.Content[i].Value
+		if node.Content[i+1].Kind == yaml.MappingNode {
+			recordKeys(node.Content[i+1], key+".", record)
+		} else {
+			record(key)
+		}
+	}
+}
+
+// findStaticDir locates the web UI files: web/ui in the working directory, or else next to the
+// executable, so services started from another directory still find them.
+func findStaticDir() string {
+	dir := filepath.Join("web", "ui")
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir
+	}
+	if executable, err := os.Executable(); err == nil {
+		candidate := filepath.Join(filepath.Dir(executable), "web", "ui")
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate
+		}
+	}
+	return dir
+}
+
+// Validate checks that the settings are usable.
+func (c *Config) Validate() error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddr); err != nil {
+		fail("server.listen_addr '%s' is not host:port", c.Server.ListenAddr)
+	}
+	if c.Features.UI {
+		if info, err := os.Stat(c.Server.StaticDir); err != nil || !info.IsDir() {
+			fail("server.static_dir '%s' is not a directory; set it, or disable features.ui", c.Server.StaticDir)
+		}
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		fail("server.tls_cert_file and server.tls_key_file must be set together")
+	}
+	if !c.Server.TLSEnabled() && (c.Server.MutualTLS() || c.Server.HTTPRedirectAddr != "") {
+		fail("server.tls_client_ca_file and server.http_redirect_addr require server.tls_cert_file")
+	}
+	if c.Server.HTTPRedirectAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Server.HTTPRedirectAddr); err != nil {
+			fail("server.http_redirect_addr '%s' is not host:port", c.Server.HTTPRedirectAddr)
+		}
+	}
+	switch c.Server.TLSMinVersion {
+	case "1.2", "1.3":
+	default:
+		fail("server.tls_min_version '%s' is not 1.2 or 1.3", c.Server.TLSMinVersion)
+	}
+	switch c.Server.TLSClientAuth {
+	case "optional", "require":
+	default:
+		fail("server.tls_client_auth '%s' is not optional or require", c.Server.TLSClientAuth)
+	}
+	switch c.Server.TLSClientUser {
+	case "cn", "email":
+	default:
+		fail("server.tls_client_user '%s' is not cn or email", c.Server.TLSClientUser)
+	}
+	for key, path := range map[string]string{
+		"server.tls_cert_file": c.Server.TLSCertFile, "server.tls_key_file": c.Server.TLSKeyFile,
+		"server.tls_client_ca_file": c.Server.TLSClientCAFile, "jwt.key_file": c.JWT.KeyFile,
+		"ldap.ca_file": c.LDAP.CAFile,
+	} {
+		if path != "" {
+			if _, err := os.Stat(path); err != nil {
+				fail("%s: %v", key, err)
+			}
+		}
+	}
+	for key, d := range map[string]time.Duration{
+		"server.read_header_timeout": c.Server.ReadHeaderTimeout, "server.read_timeout": c.Server.ReadTimeout,
+		"server.write_timeout": c.Server.WriteTimeout, "server.idle_timeout": c.Server.IdleTimeout,
+		"server.shutdown_timeout":    c.Server.ShutdownTimeout,
+		"metadata.conn_max_lifetime": c.Metadata.ConnMaxLifetime,
+	} {
+		if d < 0 {
+			fail("%s must not be negative (0 means no limit)", key)
+		}
+	}
+	if c.Server.ShutdownDelay < 0 {
+		fail("server.shutdown_delay must not be negative")
+	}
+	for _, entry := range c.Server.TrustedProxies {
+		if parseProxy(entry) == nil {
+			fail("server.trusted_proxies entry '%s' is not an IP address or CIDR range", entry)
+		}
+	}
+
+	switch c.Metadata.Driver {
+	case metadata.DriverDuckDB, metadata.DriverPostgres:
+		if c.Metadata.DSN == "" {
+			fail("metadata.dsn is required for the %s metadata store", c.Metadata.Driver)
+		}
+	default:
+		fail("metadata.driver '%s' is not supported (use duckdb or postgres)", c.Metadata.Driver)
+	}
+	if c.Metadata.MaxOpenConns < 0 || c.Metadata.MaxIdleConns < 0 {
+		fail("metadata.max_open_conns and metadata.max_idle_conns must not be negative")
+	}
+
+	if c.JWT.AccessTokenTTL < time.Minute {
+		fail("jwt.access_token_ttl must be at least 1m")
+	}
+	if c.JWT.RefreshTokenTTL <= c.JWT.AccessTokenTTL {
+		fail("jwt.refresh_token_ttl must be longer than jwt.access_token_ttl")
+	}
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		fail("logging.level '%s' is not debug, info, warn or error", c.Logging.Level)
+	}
+	switch c.Logging.Format {
+	case "text", "json":
+	default:
+		fail("logging.format '%s' is not text or json", c.Logging.Format)
+	}
+
+	if c.Backup.Dir == "" {
+		fail("backup.dir is required")
+	}
+	if c.Backup.Interval < 0 || (c.Backup.Interval > 0 && c.Backup.Interval < time.Minute) {
+		fail("backup.interval must be at least 1m, or 0 to disable scheduled backups")
+	}
+	if c.Backup.Retain < 1 {
+		fail("backup.retain must be at least 1")
+	}
+
+	if c.GitOps.Interval < 10*time.Second {
+		fail("gitops.interval must be at least 10s")
+	}
+	if c.GitOps.Dir != "" && c.GitOps.Owner == "" {
+		fail("gitops.owner is required with gitops.dir")
+	}
+
+	if c.LDAP.URL != "" || c.LDAP.UserSearchBase != "" {
+		if u, err := url.Parse(c.LDAP.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+			fail("ldap.url '%s' is not an ldap:// or ldaps:// URL", c.LDAP.URL)
+		}
+		if c.LDAP.UserSearchBase == "" {
+			fail("ldap.user_search_base is required with ldap.url")
+		}
+	}
+
+	if c.OIDC.Issuer != "" || c.OIDC.ClientID != "" {
+		if u, err := url.Parse(c.OIDC.Issuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			fail("oidc.issuer '%s' is not an http(s) URL", c.OIDC.Issuer)
+		}
+		if c.OIDC.ClientID == "" {
+			fail("oidc.client_id is required with oidc.issuer")
+		}
+		if c.OIDC.RedirectURL == "" {
+			fail("oidc.redirect_url is required with oidc.issuer")
+		}
+	}
+
+	switch strings.ToLower(c.Registration.Mode) {
+	case users.RegistrationDisabled, users.RegistrationInvite, users.RegistrationOpen:
+	case users.RegistrationDomain:
+		if len(c.Registration.Domains) == 0 {
+			fail("registration.mode 'domain' needs registration.domains")
+		}
+	default:
+		fail("registration.mode '%s' is not disabled, invite, domain or open", c.Registration.Mode)
+	}
+
+	if c.Password.MinLength < 1 || c.Password.MinLength > 72 {
+		fail("password_policy.min_length must be between 1 and 72")
+	}
+	for _, class := range c.Password.Require {
+		switch strings.ToLower(class) {
+		case "upper", "lower", "digit", "symbol":
+		default:
+			fail("password_policy.require entry '%s' is not upper, lower, digit or symbol", class)
+		}
+	}
+
+	if c.Login.FreeAttempts < 1 || c.Login.IPFreeAttempts < 1 {
+		fail("login.free_attempts and login.ip_free_attempts must be at least 1")
+	}
+	if c.Login.BackoffBase <= 0 || c.Login.BackoffMax < c.Login.BackoffBase {
+		fail("login.backoff_base must be positive and login.backoff_max not below it")
+	}
+	if c.Login.LockoutThreshold < 0 || (c.Login.LockoutThreshold > 0 && c.Login.LockoutDuration <= 0) {
+		fail("login.lockout_threshold must not be negative, and lockouts need a positive login.lockout_duration")
+	}
+	if c.Login.FailureWindow <= 0 {
+		fail("login.failure_window must be positive")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// StoreConfig returns the metadata store settings.
+func (c *Config) StoreConfig() metadata.StoreConfig {
+	return metadata.StoreConfig{
+		Driver:          c.Metadata.Driver,
+		DSN:             c.Metadata.DSN,
+		MaxOpenConns:    c.Metadata.MaxOpenConns,
+		MaxIdleConns:    c.Metadata.MaxIdleConns,
+		ConnMaxLifetime: c.Metadata.ConnMaxLifetime,
+	}
+}
+
+// KeyConfig returns where the JWT signing and verification keys come from.
+func (c *Config) KeyConfig() auth.KeyConfig {
+	return auth.KeyConfig{
+		Secret:         c.JWT.Secret,
+		KeyFile:        c.JWT.KeyFile,
+		KeyID:          c.JWT.KeyID,
+		VerifyKeyFiles: c.JWT.VerifyKeyFiles,
+	}
+}
+
+// BootstrapConfig returns the credentials of the first admin.
+func (c *Config) BootstrapConfig() users.BootstrapConfig {
+	return users.BootstrapConfig{
+		AdminUsername: c.Admin.Username,
+		AdminEmail:    c.Admin.Email,
+		AdminPassword: c.Admin.Password,
+	}
+}
+
+// BackupConfig returns the backup settings.
+func (c *Config) BackupConfig() metadata.BackupConfig {
+	return metadata.BackupConfig{Dir: c.Backup.Dir, Interval: c.Backup.Interval, Retain: c.Backup.Retain}
+}
+
+// GitOpsConfig returns the declarative configuration settings.
+func (c *Config) GitOpsConfig() core.GitOpsConfig {
+	return core.GitOpsConfig{
+		Dir:        c.GitOps.Dir,
+		Interval:   c.GitOps.Interval,
+		Owner:      c.GitOps.Owner,
+		Prune:      c.GitOps.Prune,
+		Adopt:      c.GitOps.Adopt,
+		SecretsKey: c.GitOps.SecretsKey,
+	}
+}
+
+// LDAPConfig returns the directory settings. Group names are matched case-insensitively.
+func (c *Config) LDAPConfig() users.LDAPConfig {
+	groupRoles := make(map[string]string, len(c.LDAP.GroupRoles))
+	for group, role := range c.LDAP.GroupRoles {
+		groupRoles[strings.ToLower(group)] = role
+	}
+	return users.LDAPConfig{
+		URL:             c.LDAP.URL,
+		StartTLS:        c.LDAP.StartTLS,
+		CAFile:          c.LDAP.CAFile,
+		BindDN:          c.LDAP.BindDN,
+		BindPassword:    c.LDAP.BindPassword,
+		UserSearchBase:  c.LDAP.UserSearchBase,
+		UserFilter:      c.LDAP.UserFilter,
+		EmailAttribute:  c.LDAP.EmailAttribute,
+		GroupSearchBase: c.LDAP.GroupSearchBase,
+		GroupFilter:     c.LDAP.GroupFilter,
+		GroupRoles:      groupRoles,
+		DefaultRole:     c.LDAP.DefaultRole,
+	}
+}
+
+// OIDCConfig returns the single sign-on provider settings.
+func (c *Config) OIDCConfig() auth.OIDCConfig {
+	groupRoles := make(map[string]string, len(c.OIDC.GroupRoles))
+	for group, role := range c.OIDC.GroupRoles {
+		groupRoles[group] = role
+	}
+	return auth.OIDCConfig{
+		Issuer:       strings.TrimSuffix(c.OIDC.Issuer, "/"),
+		ClientID:     c.OIDC.ClientID,
+		ClientSecret: c.OIDC.ClientSecret,
+		RedirectURL:  c.OIDC.RedirectURL,
+		Scopes:       c.OIDC.Scopes,
+		GroupsClaim:  c.OIDC.GroupsClaim,
+		GroupRoles:   groupRoles,
+		DefaultRole:  c.OIDC.DefaultRole,
+	}
+}
+
+// RegistrationPolicy returns the self-registration settings.
+func (c *Config) RegistrationPolicy() users.RegistrationPolicy {
+	policy := users.RegistrationPolicy{Mode: strings.ToLower(c.Registration.Mode)}
+	for _, domain := range c.Registration.Domains {
+		policy.AllowedDomains = append(policy.AllowedDomains, strings.ToLower(strings.TrimPrefix(domain, "@")))
+	}
+	return policy
+}
+
+// PasswordPolicy returns the rules new passwords must satisfy.
+func (c *Config) PasswordPolicy() users.PasswordPolicy {
+	policy := users.PasswordPolicy{MinLength: c.Password.MinLength}
+	for _, class := range c.Password.Require {
+		switch strings.ToLower(class) {
+		case "upper":
+			policy.RequireUpper = true
+		case "lower":
+			policy.RequireLower = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		}
+	}
+	return policy
+}
+
+// LoginThrottleConfig returns the backoff and lockout settings.
+func (c *Config) LoginThrottleConfig() users.LoginThrottleConfig {
+	return users.LoginThrottleConfig{
+		FreeAttempts:     c.Login.FreeAttempts,
+		IPFreeAttempts:   c.Login.IPFreeAttempts,
+		BaseDelay:        c.Login.BackoffBase,
+		MaxDelay:         c.Login.BackoffMax,
+		LockoutThreshold: c.Login.LockoutThreshold,
+		LockoutDuration:  c.Login.LockoutDuration,
+		FailureWindow:    c.Login.FailureWindow,
+	}
+}
+
+// MFAPolicy returns who must use two-factor authentication.
+func (c *Config) MFAPolicy() users.MFAPolicy {
+	return users.MFAPolicy{RequiredRoles: c.MFA.RequiredRoles}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load runs a Loader with the given configuration file content (none when empty), environment
+// and command-line arguments. The web UI is pointed at an empty directory, so it validates.
+func load(t *testing.T, file string, env map[string]string, args ...string) (*Config, error) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("BRIDGO_CONFIG", "")
+	t.Setenv("BRIDGO_STATIC_DIR", dir)
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	if file != "" {
+		path := filepath.Join(dir, "bridgo.yaml")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatalf("write configuration file: %v", err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+
+	fs := flag.NewFlagSet("bridgo", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+	return loader.Load()
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	const key = "server.listen_addr"
+	file := "server:\n  listen_addr: 127.0.0.1:1001\n"
+	env := map[string]string{"BRIDGO_LISTEN_ADDR": "127.0.0.1:1002"}
+	flags := []string{"-listen", "127.0.0.1:1003"}
+
+	tests := []struct {
+		name       string
+		file       string
+		env        map[string]string
+		args       []string
+		want       string
+		wantSource string
+	}{
+		{"default", "", nil, nil, Default().Server.ListenAddr, ""},
+		{"file over default", file, nil, nil, "127.0.0.1:1001", "file"},
+		{"env over file", file, env, nil, "127.0.0.1:1002", "env BRIDGO_LISTEN_ADDR"},
+		{"flag over env", file, env, flags, "127.0.0.1:1003", "flag -listen"},
+		{"flag over default", "", nil, flags, "127.0.0.1:1003", "flag -listen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.file, tt.env, tt.args...)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Server.ListenAddr != tt.want || cfg.sources[key] != tt.wantSource {
+				t.Errorf("%s = %q from %q, want %q from %q", key, cfg.Server.ListenAddr, cfg.sources[key], tt.want, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestLoadSettingTypes(t *testing.T) {
+	file := `
+jwt:
+  access_token_ttl: 20m
+mfa:
+  required_roles: [admin, editor]
+ldap:
+  group_roles:
+    CN=Admins,DC=corp: admin
+`
+	env := map[string]string{
+		"BRIDGO_REFRESH_TOKEN_TTL":     "48h",
+		"BRIDGO_FEATURE_BUNDLES":       "false",
+		"BRIDGO_PASSWORD_REQUIRE":      "upper, digit,",
+		"BRIDGO_LDAP_GROUP_ROLES":      "CN=Admins,OU=Groups,DC=corp=admin; analysts = viewer",
+		"BRIDGO_LOCKOUT_THRESHOLD":     "5",
+		"BRIDGO_LDAP_URL":              "ldaps://dc.example.com",
+		"BRIDGO_LDAP_USER_SEARCH_BASE": "dc=example,dc=com",
+	}
+	cfg, err := load(t, file, env, "-shutdown-timeout", "45s")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.JWT.AccessTokenTTL != 20*time.Minute || cfg.JWT.RefreshTokenTTL != 48*time.Hour || cfg.Server.ShutdownTimeout != 45*time.Second {
+		t.Errorf("durations = %s, %s, %s, want 20m, 48h and 45s", cfg.JWT.AccessTokenTTL, cfg.JWT.RefreshTokenTTL, cfg.Server.ShutdownTimeout)
+	}
+	if cfg.Features.Bundles || !cfg.Features.UI {
+		t.Errorf("features = %+v, want bundles off and the UI on", cfg.Features)
+	}
+	if cfg.Login.LockoutThreshold != 5 {
+		t.Errorf("login.lockout_threshold = %d, want 5", cfg.Login.LockoutThreshold)
+	}
+	if want := []string{"admin", "editor"}; !reflect.DeepEqual(cfg.MFA.RequiredRoles, want) {
+		t.Errorf("mfa.required_roles = %v, want %v", cfg.MFA.RequiredRoles, want)
+	}
+	if want := []string{"upper", "digit"}; !reflect.DeepEqual(cfg.Password.Require, want) {
+		t.Errorf("password_policy.require = %v, want %v", cfg.Password.Require, want)
+	}
+	// The variable replaces the file's mapping rather than adding to it
+	if want := map[string]string{"CN=Admins,OU=Groups,DC=corp": "admin", "analysts": "viewer"}; !reflect.DeepEqual(cfg.LDAP.GroupRoles, want) {
+		t.Errorf("ldap.group_roles = %v, want %v", cfg.LDAP.GroupRoles, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string // Substring of the error
+	}{
+		{"bad duration", "", map[string]string{"BRIDGO_ACCESS_TOKEN_TTL": "soon"}, nil, "BRIDGO_ACCESS_TOKEN_TTL"},
+		{"bad flag duration", "", nil, []string{"-shutdown-timeout", "soon"}, "-shutdown-timeout"},
+		{"bad bool", "", map[string]string{"BRIDGO_FEATURE_UI": "maybe"}, nil, "not true or false"},
+		{"bad int", "", map[string]string{"BRIDGO_BACKUP_RETAIN": "seven"}, nil, "not a number"},
+		{"bad mapping", "", map[string]string{"BRIDGO_LDAP_GROUP_ROLES": "admins"}, nil, "name=value"},
+		{"unknown file key", "server:\n  listen: 127.0.0.1:1\n", nil, nil, "listen"},
+		{"invalid value", "logging:\n  level: loud\n", nil, nil, "logging.level"},
+		{"invalid trusted proxy", "", map[string]string{"BRIDGO_TRUSTED_PROXIES": "10.0.0.0/8,proxy"}, nil, "server.trusted_proxies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(t, tt.file, tt.env, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
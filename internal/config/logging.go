@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// SetupLogging sends the server log to the configured file, or standard error, at the configured
+// level and format. Messages written with the log package go through it too. The returned function
+// closes the log file.
+func SetupLogging(cfg LoggingConfig) (func(), error) {
+	var out io.Writer = os.Stderr
+	closeLog := func() {}
+	if cfg.File != "" {
+		file, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = file
+		closeLog = func() { file.Close() }
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		closeLog()
+		return nil, fmt.Errorf("invalid log level '%s': %w", cfg.Level, err)
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler = slog.NewTextHandler(out, options)
+	if cfg.Format == "json" {
+		handler = slog.NewJSONHandler(out, options)
+	}
+	slog.SetDefault(slog.New(handler))
+	return closeLog, nil
+}
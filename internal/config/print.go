@@ -0,0 +1,93 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in the printed configuration.
+const redacted = "REDACTED"
+
+var dsnPasswordPattern = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// PrintConfig writes the effective configuration to w as YAML, with secrets redacted. Each value
+// is annotated with where it came from, so the output can also serve as a configuration file.
+func (c *Config) PrintConfig(w io.Writer) error {
+	printed := *c
+	for _, secret := range []*string{
+		&printed.JWT.Secret, &printed.Admin.Password, &printed.GitOps.SecretsKey,
+		&printed.LDAP.BindPassword, &printed.OIDC.ClientSecret,
+	} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	printed.Metadata.DSN = redactDSN(printed.Metadata.DSN)
+
+	var document yaml.Node
+	if err := document.Encode(&printed); err != nil {
+		return err
+	}
+	annotate(&document, "", func(key string) string {
+		// Entries of a mapping such as ldap.group_roles come from where the mapping was set
+		for ; key != ""; key = key[:max(strings.LastIndex(key, "."), 0)] {
+			if source, ok := c.sources[key]; ok {
+				return source
+			}
+		}
+		return "default"
+	})
+
+	if c.File != "" {
+		if _, err := io.WriteString(w, "# Configuration file: "+c.File+"\n"); err != nil {
+			return err
+		}
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// annotate adds the source of every value in a YAML mapping as a line comment.
+func annotate(node *yaml.Node, prefix string, source func(key string) string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := prefix + node.Content[i].Value
+		switch value := node.Content[i+1]; value.Kind {
+		case yaml.MappingNode:
+			if len(value.Content) == 0 {
+				node.Content[i].LineComment = source(key)
+			}
+			annotate(value, key+".", source)
+		case yaml.SequenceNode:
+			// Lists are printed on one line, so the comment can follow them
+			value.Style = yaml.FlowStyle
+			value.LineComment = source(key)
+		default:
+			node.Content[i].LineComment = source(key)
+		}
+	}
+}
+
+// redactDSN hides the password of a PostgreSQL URL or key=value connection string.
+func redactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		if u, err := url.Parse(dsn); err == nil && u.User != nil {
+			if _, set := u.User.Password(); set {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+				return u.String()
+			}
+		}
+		return dsn
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "${1}"+redacted)
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Bundle passwords are sealed with AES-256-GCM under a key derived from a passphrase shared between
+// the exporting and the importing installation, never with either installation's own secrets.
+// Each password gets its own salt, so equal passwords do not show as equal in the bundle.
+const (
+	bundleSecretSaltSize  = 16
+	bundleSecretMinKeyLen = 12
+)
+
+// errBundleSecretKey is returned when an encrypted password cannot be opened with the given key.
+var errBundleSecretKey = errors.New("wrong secrets key or corrupted password")
+
+// bundleSecretCipher derives the AES-GCM cipher for passphrase and salt.
+func bundleSecretCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive secrets key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptBundleSecret returns base64(salt | nonce | ciphertext) of plaintext.
+func encryptBundleSecret(plaintext, passphrase string) (string, error) {
+	salt := make([]byte, bundleSecretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := bundleSecretCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := append(salt, nonce...)
+	sealed = gcm.Seal(sealed, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptBundleSecret opens a password sealed by encryptBundleSecret.
+func decryptBundleSecret(encoded, passphrase string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < bundleSecretSaltSize {
+		return "", errBundleSecretKey
+	}
+	gcm, err := bundleSecretCipher(passphrase, sealed[:bundleSecretSaltSize])
+	if err != nil {
+		return "", err
+	}
+	rest := sealed[bundleSecretSaltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return "", errBundleSecretKey
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errBundleSecretKey
+	}
+	return string(plaintext), nil
+}
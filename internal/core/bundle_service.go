@@ -0,0 +1,784 @@
+package core
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// bundleKindDataSource names data sources in import reports; views use their view type.
+const bundleKindDataSource = "data_source"
+
+// BundleService exports data sources and views to bundles and imports them back.
+type BundleService struct {
+	metaDB *sql.DB
+}
+
+// NewBundleService creates a new BundleService
+func NewBundleService(metaDB *sql.DB) *BundleService {
+	return &BundleService{metaDB: metaDB}
+}
+
+// EncodeBundle serializes a bundle as YAML or JSON.
+func EncodeBundle(bundle *models.Bundle, format string) ([]byte, error) {
+	switch format {
+	case "", models.BundleFormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(bundle); err != nil {
+			return nil, fmt.Errorf("failed to encode bundle: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, fmt.Errorf("failed to encode bundle: %w", err)
+		}
+		return buf.Bytes(), nil
+	case models.BundleFormatJSON:
+		data, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode bundle: %w", err)
+		}
+		return append(data, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unsupported bundle format '%s' (use %s or %s)", format, models.BundleFormatYAML, models.BundleFormatJSON)
+	}
+}
+
+// DecodeBundle parses a YAML or JSON bundle and checks that this version of Bridgo can read it.
+// Unknown fields are rejected, so typos in hand-edited bundles are not silently ignored.
+func DecodeBundle(data []byte) (*models.Bundle, error) {
+	var bundle models.Bundle
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if err := checkBundleHeader(&bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// checkBundleHeader checks the kind and version of a decoded bundle.
+func checkBundleHeader(bundle *models.Bundle) error {
+	if bundle.Kind != models.BundleKind {
+		return fmt.Errorf("invalid bundle: kind must be %s", models.BundleKind)
+	}
+	if bundle.Version < 1 || bundle.Version > models.BundleVersion {
+		return fmt.Errorf("unsupported bundle version %d (this Bridgo reads up to version %d)", bundle.Version, models.BundleVersion)
+	}
+	return nil
+}
+
+// bundleColumnPath formats a column reference as schema.table.column, or table.column when the
+// data source has no schemas.
+func bundleColumnPath(schemaName sql.NullString, tableName, columnName string) string {
+	if schemaName.Valid && schemaName.String != "" {
+		return schemaName.String + "." + tableName + "." + columnName
+	}
+	return tableName + "." + columnName
+}
+
+// Export builds a bundle of the selected data sources and views. Data sources must be owned by the
+// caller, since the bundle carries their connection settings; views need at least VIEW access.
+func (bs *BundleService) Export(input models.ExportBundleInput) (*models.Bundle, error) {
+	switch input.Secrets {
+	case "", models.BundleSecretsOmit:
+	case models.BundleSecretsEncrypt:
+		if len(input.SecretsKey) < bundleSecretMinKeyLen {
+			return nil, fmt.Errorf("secrets_key must be at least %d characters to encrypt passwords", bundleSecretMinKeyLen)
+		}
+	default:
+		return nil, fmt.Errorf("invalid secrets mode '%s' (use %s or %s)", input.Secrets, models.BundleSecretsOmit, models.BundleSecretsEncrypt)
+	}
+	if len(input.DataSourceIDs)+len(input.VirtualBaseViewIDs)+len(input.VirtualViewIDs) == 0 {
+		return nil, fmt.Errorf("select at least one data source or view to export")
+	}
+
+	bundle := &models.Bundle{Kind: models.BundleKind, Version: models.BundleVersion}
+
+	// Views reference data sources by name, so two referenced data sources must not share one
+	names := map[string]string{}
+	addName := func(name, dataSourceID string) error {
+		if existing, ok := names[name]; ok && existing != dataSourceID {
+			return fmt.Errorf("more than one exported data source is named '%s'; rename one before exporting", name)
+		}
+		names[name] = dataSourceID
+		return nil
+	}
+
+	for _, id := range uniqueStrings(input.DataSourceIDs) {
+		ds, err := bs.exportDataSource(id, input)
+		if err != nil {
+			return nil, err
+		}
+		if err = addName(ds.Name, id); err != nil {
+			return nil, err
+		}
+		bundle.DataSources = append(bundle.DataSources, *ds)
+	}
+
+	for _, id := range uniqueStrings(input.VirtualBaseViewIDs) {
+		if _, err := requireViewAccess(bs.metaDB, models.ViewTypeVirtualBaseView, id, input.UserID, models.ViewAccessView); err != nil {
+			return nil, err
+		}
+		var view models.BundleVirtualBaseView
+		var description sql.NullString
+		var dataSourceID, selectedColumns string
+		err := bs.metaDB.QueryRow(`
+			SELECT v.name, v.description, v.table_name, v.selected_columns, ds.id, ds.source_name
+			FROM virtual_base_views v JOIN data_sources ds ON ds.id = v.data_source_id
+			WHERE v.id = ?
+		`, id).Scan(&view.Name, &description, &view.Table, &selectedColumns, &dataSourceID, &view.DataSource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get virtual base view: %w", err)
+		}
+		var definition models.VirtualBaseViewDefinition
+		if err = json.Unmarshal([]byte(selectedColumns), &definition); err != nil {
+			return nil, fmt.Errorf("failed to parse virtual base view '%s': %w", view.Name, err)
+		}
+		if err = addName(view.DataSource, dataSourceID); err != nil {
+			return nil, err
+		}
+		view.Description = description.String
+		view.Columns = definition.ColumnNames
+		bundle.VirtualBaseViews = append(bundle.VirtualBaseViews, view)
+	}
+
+	for _, id := range uniqueStrings(input.VirtualViewIDs) {
+		if _, err := requireViewAccess(bs.metaDB, models.ViewTypeVirtualView, id, input.UserID, models.ViewAccessView); err != nil {
+			return nil, err
+		}
+		var view models.BundleVirtualView
+		var description sql.NullString
+		var definitionJSON string
+		err := bs.metaDB.QueryRow("SELECT name, description, definition FROM virtual_views WHERE id = ?", id).Scan(&view.Name, &description, &definitionJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get virtual view: %w", err)
+		}
+		var definition models.VirtualViewDefinition
+		if err = json.Unmarshal([]byte(definitionJSON), &definition); err != nil {
+			return nil, fmt.Errorf("failed to parse virtual view '%s': %w", view.Name, err)
+		}
+		view.Description = description.String
+
+		for _, column := range definition.SelectedColumns {
+			var dataSourceID, tableName, columnName string
+			var ref models.BundleColumnRef
+			var schemaName sql.NullString
+			err = bs.metaDB.QueryRow(`
+				SELECT ds.id, ds.source_name, dss.schema_name, dss.table_name, dss.column_name
+				FROM data_source_schemas dss JOIN data_sources ds ON ds.id = dss.data_source_id
+				WHERE dss.id = ?
+			`, column.DataSourceSchemaID).Scan(&dataSourceID, &ref.DataSource, &schemaName, &tableName, &columnName)
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("virtual view '%s' references a column that no longer exists", view.Name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get column of virtual view '%s': %w", view.Name, err)
+			}
+			if err = addName(ref.DataSource, dataSourceID); err != nil {
+				return nil, err
+			}
+			ref.Column = bundleColumnPath(schemaName, tableName, columnName)
+			if column.Alias != nil {
+				ref.Alias = *column.Alias
+			}
+			view.Columns = append(view.Columns, ref)
+		}
+		bundle.VirtualViews = append(bundle.VirtualViews, view)
+	}
+
+	// Stable ordering keeps bundles kept in version control free of spurious diffs
+	sort.Slice(bundle.DataSources, func(i, j int) bool { return bundle.DataSources[i].Name < bundle.DataSources[j].Name })
+	sort.Slice(bundle.VirtualBaseViews, func(i, j int) bool { return bundle.VirtualBaseViews[i].Name < bundle.VirtualBaseViews[j].Name })
+	sort.Slice(bundle.VirtualViews, func(i, j int) bool { return bundle.VirtualViews[i].Name < bundle.VirtualViews[j].Name })
+	return bundle, nil
+}
+
+// exportDataSource reads one of the caller's data sources with its cached schema.
+func (bs *BundleService) exportDataSource(id string, input models.ExportBundleInput) (*models.BundleDataSource, error) {
+	var ds models.BundleDataSource
+	var host, databaseName, username, password, sslMode, additionalParams, description sql.NullString
+	var port sql.NullInt64
+	err := bs.metaDB.QueryRow(`
+		SELECT source_name, db_type, host, port, database_name, db_username, password_encrypted, ssl_mode, additional_params, description
+		FROM data_sources WHERE id = ? AND user_id = ?
+	`, id, input.UserID).Scan(&ds.Name, &ds.DBType, &host, &port, &databaseName, &username, &password, &sslMode, &additionalParams, &description)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("data source %s not found or not owned by you", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data source: %w", err)
+	}
+	ds.Host = host.String
+	ds.Port = int(port.Int64)
+	ds.Database = databaseName.String
+	ds.Username = username.String
+	ds.SSLMode = sslMode.String
+	if ds.AdditionalParams, err = parseDriverParams(additionalParams); err != nil {
+		return nil, fmt.Errorf("data source '%s': %w", ds.Name, err)
+	}
+	ds.Description = description.String
+
+	if input.Secrets == models.BundleSecretsEncrypt && password.String != "" {
+		if ds.PasswordEncrypted, err = encryptBundleSecret(password.String, input.SecretsKey); err != nil {
+			return nil, fmt.Errorf("failed to encrypt password of data source '%s': %w", ds.Name, err)
+		}
+	}
+
+	rows, err := bs.metaDB.Query(`
+		SELECT schema_name, table_name, column_name, column_type, is_nullable, is_primary_key
+		FROM data_source_schemas WHERE data_source_id = ?
+		ORDER BY schema_name, table_name, column_name
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema of data source '%s': %w", ds.Name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schemaName sql.NullString
+		var isNullable, isPrimaryKey sql.NullBool
+		var column models.BundleColumn
+		var tableName string
+		if err = rows.Scan(&schemaName, &tableName, &column.Name, &column.Type, &isNullable, &isPrimaryKey); err != nil {
+			return nil, fmt.Errorf("failed to scan schema of data source '%s': %w", ds.Name, err)
+		}
+		if isNullable.Valid {
+			value := isNullable.Bool
+			column.Nullable = &value
+		}
+		column.PrimaryKey = isPrimaryKey.Bool
+
+		last := len(ds.Tables) - 1
+		if last < 0 || ds.Tables[last].Schema != schemaName.String || ds.Tables[last].Name != tableName {
+			ds.Tables = append(ds.Tables, models.BundleTable{Schema: schemaName.String, Name: tableName})
+			last++
+		}
+		ds.Tables[last].Columns = append(ds.Tables[last].Columns, column)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema of data source '%s': %w", ds.Name, err)
+	}
+	return &ds, nil
+}
+
+// bundleTarget is a data source that bundle references resolve to, either an existing one or one
+// the import creates.
+type bundleTarget struct {
+	id      string
+	columns map[string]string          // Column path -> data_source_schemas.id
+	tables  map[string]map[string]bool // Table name -> column names, as virtual base views reference them
+}
+
+func newBundleTarget(id string) *bundleTarget {
+	return &bundleTarget{id: id, columns: map[string]string{}, tables: map[string]map[string]bool{}}
+}
+
+func (t *bundleTarget) addColumn(schemaName sql.NullString, tableName, columnName, schemaID string) {
+	t.columns[bundleColumnPath(schemaName, tableName, columnName)] = schemaID
+	if t.tables[tableName] == nil {
+		t.tables[tableName] = map[string]bool{}
+	}
+	t.tables[tableName][columnName] = true
+}
+
+// loadBundleTarget reads the cached schema of an existing data source.
+func loadBundleTarget(db *sql.DB, dataSourceID string) (*bundleTarget, error) {
+	rows, err := db.Query("SELECT id, schema_name, table_name, column_name FROM data_source_schemas WHERE data_source_id = ?", dataSourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data source schema: %w", err)
+	}
+	defer rows.Close()
+
+	target := newBundleTarget(dataSourceID)
+	for rows.Next() {
+		var schemaID, tableName, columnName string
+		var schemaName sql.NullString
+		if err = rows.Scan(&schemaID, &schemaName, &tableName, &columnName); err != nil {
+			return nil, fmt.Errorf("failed to scan data source schema: %w", err)
+		}
+		target.addColumn(schemaName, tableName, columnName, schemaID)
+	}
+	return target, rows.Err()
+}
+
+// findByName returns the ID of the row of table (data_sources, virtual_base_views or
+// virtual_views) that userID owns under name, or "" when there is none.
+func (bs *BundleService) findByName(table, nameColumn, userID, name string) (string, error) {
+	var id string
+	err := bs.metaDB.QueryRow(fmt.Sprintf("SELECT id FROM %s WHERE user_id = ? AND %s = ? ORDER BY created_at LIMIT 1", table, nameColumn), userID, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up '%s': %w", name, err)
+	}
+	return id, nil
+}
+
+// bundleImport is the plan of an import: what happens to each object, and the writes that do it.
+type bundleImport struct {
+	input   models.ImportBundleInput
+	report  *models.BundleImportReport
+	targets map[string]*bundleTarget // Data source name -> target
+	steps   []func(tx *sql.Tx) error
+	now     time.Time
+}
+
+func (p *bundleImport) errorf(format string, args ...interface{}) {
+	p.report.Errors = append(p.report.Errors, fmt.Sprintf(format, args...))
+}
+
+func (p *bundleImport) item(kind, name, existingID, action, message string) {
+	if action == models.BundleActionConflict {
+		p.report.Conflicts++
+	}
+	p.report.Items = append(p.report.Items, models.BundleImportItem{Kind: kind, Name: name, ID: existingID, Action: action, Message: message})
+}
+
+// conflictAction reports, for an object whose name is taken, the action the import's conflict
+// mode leads to.
+func (p *bundleImport) conflictAction() string {
+	switch p.input.OnConflict {
+	case models.BundleConflictSkip:
+		return models.BundleActionSkip
+	case models.BundleConflictOverwrite:
+		return models.BundleActionUpdate
+	default:
+		return models.BundleActionConflict
+	}
+}
+
+// overwritable reports whether an import may take the planned action on an existing object. It
+// records an error for overwrites of objects managed by declarative configuration.
+func (bs *BundleService) overwritable(p *bundleImport, objectType, name, existingID, action string) (bool, error) {
+	if action != models.BundleActionUpdate {
+		return true, nil
+	}
+	managed, err := isManaged(bs.metaDB, objectType, existingID)
+	if err != nil {
+		return false, err
+	}
+	if managed {
+		p.errorf("%s '%s' is %v", objectType, name, ErrManagedObject)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Import creates the bundle's data sources and views as the caller. Names already taken by the
+// caller's objects are handled according to OnConflict. References to data sources missing from
+// the bundle resolve, by name, to data sources the caller owns or may QUERY. Nothing is written
+// when any reference fails to resolve, when conflicts are to fail the import, or on a dry run;
+// otherwise all writes happen in one transaction.
+func (bs *BundleService) Import(input models.ImportBundleInput) (*models.BundleImportReport, error) {
+	switch input.OnConflict {
+	case "":
+		input.OnConflict = models.BundleConflictFail
+	case models.BundleConflictFail, models.BundleConflictSkip, models.BundleConflictOverwrite:
+	default:
+		return nil, fmt.Errorf("invalid conflict mode '%s' (use %s, %s or %s)", input.OnConflict,
+			models.BundleConflictFail, models.BundleConflictSkip, models.BundleConflictOverwrite)
+	}
+
+	p := &bundleImport{
+		input:   input,
+		report:  &models.BundleImportReport{DryRun: input.DryRun, Items: []models.BundleImportItem{}},
+		targets: map[string]*bundleTarget{},
+		now:     time.Now().UTC(),
+	}
+	if len(input.Bundle.Roles) > 0 || len(input.Bundle.DataSourceGrants) > 0 || len(input.Bundle.ViewGrants) > 0 {
+		p.errorf("roles and grants are applied by declarative configuration only; remove them from the bundle")
+	}
+	for _, ds := range input.Bundle.DataSources {
+		if err := bs.planDataSource(p, ds); err != nil {
+			return nil, err
+		}
+	}
+	for _, view := range input.Bundle.VirtualBaseViews {
+		if err := bs.planVirtualBaseView(p, view); err != nil {
+			return nil, err
+		}
+	}
+	for _, view := range input.Bundle.VirtualViews {
+		if err := bs.planVirtualView(p, view); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(p.report.Errors) > 0 || p.report.Conflicts > 0 || input.DryRun {
+		return p.report, nil
+	}
+
+	tx, err := bs.metaDB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin metadata transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, step := range p.steps {
+		if err = step(tx); err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit metadata transaction: %w", err)
+	}
+	p.report.Applied = true
+	return p.report, nil
+}
+
+// planDataSource plans the creation or update of a bundled data source.
+func (bs *BundleService) planDataSource(p *bundleImport, ds models.BundleDataSource) error {
+	if ds.Name == "" || ds.DBType == "" {
+		p.errorf("data sources need a name and a db_type")
+		return nil
+	}
+	if err := (dataSourceConnection{DBType: ds.DBType, SSLMode: ds.SSLMode}).validate(); err != nil {
+		p.errorf("data source '%s': %v", ds.Name, err)
+		return nil
+	}
+	additionalParams, err := driverParamsColumn(ds.DBType, ds.AdditionalParams)
+	if err != nil {
+		p.errorf("data source '%s': %v", ds.Name, err)
+		return nil
+	}
+	if _, ok := p.targets[ds.Name]; ok {
+		p.errorf("data source '%s' appears more than once in the bundle", ds.Name)
+		return nil
+	}
+
+	password := sql.NullString{}
+	if ds.PasswordEncrypted != "" {
+		if p.input.SecretsKey == "" {
+			p.errorf("data source '%s' has an encrypted password; the secrets key it was exported with is required", ds.Name)
+			return nil
+		}
+		plaintext, err := decryptBundleSecret(ds.PasswordEncrypted, p.input.SecretsKey)
+		if err != nil {
+			p.errorf("data source '%s': %v", ds.Name, err)
+			return nil
+		}
+		password = sql.NullString{String: plaintext, Valid: true}
+	}
+
+	existingID, err := bs.findByName("data_sources", "source_name", p.input.UserID, ds.Name)
+	if err != nil {
+		return err
+	}
+
+	var target *bundleTarget
+	action := models.BundleActionCreate
+	if existingID == "" {
+		target = newBundleTarget(uuid.NewString())
+	} else {
+		if target, err = loadBundleTarget(bs.metaDB, existingID); err != nil {
+			return err
+		}
+		action = p.conflictAction()
+		if ok, err := bs.overwritable(p, models.ManagedDataSource, ds.Name, existingID, action); !ok {
+			return err
+		}
+	}
+	p.targets[ds.Name] = target
+
+	// Columns the target lacks; all of them for a new data source
+	type newColumn struct {
+		id, table, column, columnType string
+		schema                        sql.NullString
+		nullable, primaryKey          sql.NullBool
+	}
+	var added []newColumn
+	for _, table := range ds.Tables {
+		schemaName := sql.NullString{String: table.Schema, Valid: table.Schema != ""}
+		for _, column := range table.Columns {
+			if _, ok := target.columns[bundleColumnPath(schemaName, table.Name, column.Name)]; ok {
+				continue
+			}
+			c := newColumn{id: uuid.NewString(), schema: schemaName, table: table.Name, column: column.Name, columnType: column.Type,
+				primaryKey: sql.NullBool{Bool: column.PrimaryKey, Valid: true}}
+			if column.Nullable != nil {
+				c.nullable = sql.NullBool{Bool: *column.Nullable, Valid: true}
+			}
+			added = append(added, c)
+		}
+	}
+
+	message := ""
+	switch action {
+	case models.BundleActionConflict:
+		message = "a data source with this name already exists"
+	case models.BundleActionSkip:
+		message = "kept the existing data source"
+	case models.BundleActionUpdate:
+		message = fmt.Sprintf("connection settings updated, %d column(s) added", len(added))
+	}
+	p.item(bundleKindDataSource, ds.Name, existingID, action, message)
+	if action != models.BundleActionCreate && action != models.BundleActionUpdate {
+		return nil
+	}
+
+	for _, c := range added {
+		target.addColumn(c.schema, c.table, c.column, c.id)
+	}
+	nullable := func(s string) sql.NullString { return sql.NullString{String: s, Valid: s != ""} }
+	port := sql.NullInt64{Int64: int64(ds.Port), Valid: ds.Port != 0}
+	p.steps = append(p.steps, func(tx *sql.Tx) error {
+		var err error
+		if action == models.BundleActionCreate {
+			_, err = tx.Exec(`
+				INSERT INTO data_sources (id, user_id, source_name, db_type, host, port, database_name, db_username, password_encrypted, ssl_mode, additional_params, description, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, target.id, p.input.UserID, ds.Name, ds.DBType, nullable(ds.Host), port, nullable(ds.Database), nullable(ds.Username),
+				password, nullable(ds.SSLMode), additionalParams, nullable(ds.Description), p.now, p.now)
+		} else {
+			_, err = tx.Exec(`
+				UPDATE data_sources SET db_type = ?, host = ?, port = ?, database_name = ?, db_username = ?, ssl_mode = ?, additional_params = ?, description = ?, updated_at = ?
+				WHERE id = ?
+			`, ds.DBType, nullable(ds.Host), port, nullable(ds.Database), nullable(ds.Username),
+				nullable(ds.SSLMode), additionalParams, nullable(ds.Description), p.now, target.id)
+			if err == nil && password.Valid {
+				_, err = tx.Exec("UPDATE data_sources SET password_encrypted = ? WHERE id = ?", password, target.id)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save data source '%s': %w", ds.Name, err)
+		}
+
+		for _, c := range added {
+			_, err = tx.Exec(`
+				INSERT INTO data_source_schemas (id, data_source_id, schema_name, table_name, column_name, column_type, is_nullable, is_primary_key, retrieved_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, c.id, target.id, c.schema, c.table, c.column, c.columnType, c.nullable, c.primaryKey, p.now)
+			if err != nil {
+				return fmt.Errorf("failed to save schema of data source '%s': %w", ds.Name, err)
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+// resolveDataSource returns the target a bundle reference to a data source name resolves to.
+func (bs *BundleService) resolveDataSource(p *bundleImport, name string) (*bundleTarget, error) {
+	if target, ok := p.targets[name]; ok {
+		return target, nil
+	}
+
+	condition, args := dataSourceAccessCondition("id", "user_id", p.input.UserID, models.PrivilegeQuery)
+	rows, err := bs.metaDB.Query("SELECT id FROM data_sources WHERE source_name = ? AND "+condition, append([]interface{}{name}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up data source '%s': %w", name, err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan data source: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look up data source '%s': %w", name, err)
+	}
+
+	switch len(ids) {
+	case 0:
+		p.targets[name] = nil
+	case 1:
+		if p.targets[name], err = loadBundleTarget(bs.metaDB, ids[0]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("data source name '%s' is ambiguous: you can query %d data sources with it", name, len(ids))
+	}
+	return p.targets[name], nil
+}
+
+// planVirtualBaseView plans the creation or update of a bundled virtual base view.
+func (bs *BundleService) planVirtualBaseView(p *bundleImport, view models.BundleVirtualBaseView) error {
+	if view.Name == "" || view.DataSource == "" || view.Table == "" || len(view.Columns) == 0 {
+		p.errorf("virtual base view '%s' needs a name, data_source, table and at least one column", view.Name)
+		return nil
+	}
+	target, err := bs.resolveDataSource(p, view.DataSource)
+	if err != nil {
+		p.errorf("virtual base view '%s': %v", view.Name, err)
+		return nil
+	}
+	if target == nil {
+		p.errorf("virtual base view '%s': data source '%s' is neither in the bundle nor one you can query", view.Name, view.DataSource)
+		return nil
+	}
+	tableColumns, ok := target.tables[view.Table]
+	if !ok {
+		p.errorf("virtual base view '%s': table '%s' not found in data source '%s'", view.Name, view.Table, view.DataSource)
+		return nil
+	}
+	for _, column := range view.Columns {
+		if !tableColumns[column] {
+			p.errorf("virtual base view '%s': column '%s' not found in table '%s'", view.Name, column, view.Table)
+			return nil
+		}
+	}
+
+	existingID, err := bs.findByName("virtual_base_views", "name", p.input.UserID, view.Name)
+	if err != nil {
+		return err
+	}
+	action := models.BundleActionCreate
+	if existingID != "" {
+		action = p.conflictAction()
+		if ok, err := bs.overwritable(p, models.ManagedVirtualBaseView, view.Name, existingID, action); !ok {
+			return err
+		}
+	}
+	if action == models.BundleActionUpdate {
+		var dataSourceID string
+		if err = bs.metaDB.QueryRow("SELECT data_source_id FROM virtual_base_views WHERE id = ?", existingID).Scan(&dataSourceID); err != nil {
+			return fmt.Errorf("failed to get virtual base view: %w", err)
+		}
+		if dataSourceID != target.id {
+			p.errorf("virtual base view '%s' exists on another data source; delete it before importing", view.Name)
+			return nil
+		}
+	}
+
+	switch action {
+	case models.BundleActionConflict:
+		p.item(models.ViewTypeVirtualBaseView, view.Name, existingID, action, "a virtual base view with this name already exists")
+		return nil
+	case models.BundleActionSkip:
+		p.item(models.ViewTypeVirtualBaseView, view.Name, existingID, action, "kept the existing virtual base view")
+		return nil
+	}
+	p.item(models.ViewTypeVirtualBaseView, view.Name, existingID, action, "")
+
+	definitionJSON, err := json.Marshal(models.VirtualBaseViewDefinition{ColumnNames: view.Columns})
+	if err != nil {
+		return fmt.Errorf("failed to marshal virtual base view definition: %w", err)
+	}
+	description := sql.NullString{String: view.Description, Valid: view.Description != ""}
+	p.steps = append(p.steps, func(tx *sql.Tx) error {
+		var err error
+		if action == models.BundleActionCreate {
+			_, err = tx.Exec(`
+				INSERT INTO virtual_base_views (id, user_id, name, description, data_source_id, table_name, selected_columns, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, uuid.NewString(), p.input.UserID, view.Name, description, target.id, view.Table, string(definitionJSON), p.now, p.now)
+		} else {
+			_, err = tx.Exec("UPDATE virtual_base_views SET description = ?, table_name = ?, selected_columns = ?, updated_at = ? WHERE id = ?",
+				description, view.Table, string(definitionJSON), p.now, existingID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save virtual base view '%s': %w", view.Name, err)
+		}
+		return nil
+	})
+	return nil
+}
+
+// planVirtualView plans the creation or update of a bundled virtual view.
+func (bs *BundleService) planVirtualView(p *bundleImport, view models.BundleVirtualView) error {
+	if view.Name == "" || len(view.Columns) == 0 {
+		p.errorf("virtual view '%s' needs a name and at least one column", view.Name)
+		return nil
+	}
+
+	definition := models.VirtualViewDefinition{SelectedColumns: make([]models.SelectedColumn, 0, len(view.Columns))}
+	for _, ref := range view.Columns {
+		target, err := bs.resolveDataSource(p, ref.DataSource)
+		if err != nil {
+			p.errorf("virtual view '%s': %v", view.Name, err)
+			return nil
+		}
+		if target == nil {
+			p.errorf("virtual view '%s': data source '%s' is neither in the bundle nor one you can query", view.Name, ref.DataSource)
+			return nil
+		}
+		if parts := strings.Split(ref.Column, "."); len(parts) < 2 || len(parts) > 3 {
+			p.errorf("virtual view '%s': column '%s' must be given as schema.table.column or table.column", view.Name, ref.Column)
+			return nil
+		}
+		schemaID, ok := target.columns[ref.Column]
+		if !ok {
+			p.errorf("virtual view '%s': column '%s' not found in data source '%s'", view.Name, ref.Column, ref.DataSource)
+			return nil
+		}
+		column := models.SelectedColumn{DataSourceSchemaID: schemaID}
+		if ref.Alias != "" {
+			alias := ref.Alias
+			column.Alias = &alias
+		}
+		definition.SelectedColumns = append(definition.SelectedColumns, column)
+	}
+
+	existingID, err := bs.findByName("virtual_views", "name", p.input.UserID, view.Name)
+	if err != nil {
+		return err
+	}
+	action := models.BundleActionCreate
+	if existingID != "" {
+		action = p.conflictAction()
+		if ok, err := bs.overwritable(p, models.ManagedVirtualView, view.Name, existingID, action); !ok {
+			return err
+		}
+	}
+	switch action {
+	case models.BundleActionConflict:
+		p.item(models.ViewTypeVirtualView, view.Name, existingID, action, "a virtual view with this name already exists")
+		return nil
+	case models.BundleActionSkip:
+		p.item(models.ViewTypeVirtualView, view.Name, existingID, action, "kept the existing virtual view")
+		return nil
+	}
+	p.item(models.ViewTypeVirtualView, view.Name, existingID, action, "")
+
+	definitionJSON, err := json.Marshal(definition)
+	if err != nil {
+		return fmt.Errorf("failed to marshal virtual view definition: %w", err)
+	}
+	description := sql.NullString{String: view.Description, Valid: view.Description != ""}
+	p.steps = append(p.steps, func(tx *sql.Tx) error {
+		var err error
+		if action == models.BundleActionCreate {
+			_, err = tx.Exec(`
+				INSERT INTO virtual_views (id, user_id, name, description, definition, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, uuid.NewString(), p.input.UserID, view.Name, description, string(definitionJSON), p.now, p.now)
+		} else {
+			_, err = tx.Exec("UPDATE virtual_views SET description = ?, definition = ?, updated_at = ? WHERE id = ?",
+				description, string(definitionJSON), p.now, existingID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save virtual view '%s': %w", view.Name, err)
+		}
+		return nil
+	})
+	return nil
+}
+
+// uniqueStrings returns values without duplicates, in their first order.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,254 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	db := metadatatest.NewDB(t)
+	bs := NewBundleService(db)
+	alice := metadatatest.InsertUser(t, db, "alice", "password")
+	bob := metadatatest.InsertUser(t, db, "bob", "password")
+
+	ds := metadatatest.InsertDataSource(t, db, alice, "sales")
+	if _, err := db.Exec("UPDATE data_sources SET password_encrypted = 's3cret-db-password' WHERE id = ?", ds); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	schemaIDs := map[string]string{}
+	for _, column := range []string{"id", "region"} {
+		schemaIDs[column] = uuid.NewString()
+		_, err := db.Exec("INSERT INTO data_source_schemas (id, data_source_id, schema_name, table_name, column_name, column_type) VALUES (?, ?, 'public', 'orders', ?, 'text')",
+			schemaIDs[column], ds, column)
+		if err != nil {
+			t.Fatalf("insert column: %v", err)
+		}
+	}
+	baseViewID, viewID := uuid.NewString(), uuid.NewString()
+	_, err := db.Exec(`INSERT INTO virtual_base_views (id, user_id, name, data_source_id, table_name, selected_columns)
+		VALUES (?, ?, 'orders', ?, 'orders', '{"column_names":["id","region"]}')`, baseViewID, alice, ds)
+	if err != nil {
+		t.Fatalf("insert base view: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO virtual_views (id, user_id, name, definition) VALUES (?, ?, 'regions', ?)`,
+		viewID, alice, `{"selected_columns":[{"data_source_schema_id":"`+schemaIDs["region"]+`","alias":"area"}]}`)
+	if err != nil {
+		t.Fatalf("insert view: %v", err)
+	}
+
+	const secretsKey = "correct horse battery"
+	if _, err = bs.Export(models.ExportBundleInput{UserID: bob, DataSourceIDs: []string{ds}}); err == nil {
+		t.Error("exported a data source owned by someone else")
+	}
+	if _, err = bs.Export(models.ExportBundleInput{UserID: alice, DataSourceIDs: []string{ds}, Secrets: models.BundleSecretsEncrypt, SecretsKey: "short"}); err == nil {
+		t.Error("encrypted passwords with a short secrets key")
+	}
+	bundle, err := bs.Export(models.ExportBundleInput{
+		UserID: alice, DataSourceIDs: []string{ds}, VirtualBaseViewIDs: []string{baseViewID}, VirtualViewIDs: []string{viewID},
+		Secrets: models.BundleSecretsEncrypt, SecretsKey: secretsKey,
+	})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	encoded, err := EncodeBundle(bundle, models.BundleFormatYAML)
+	if err != nil {
+		t.Fatalf("EncodeBundle: %v", err)
+	}
+	if bytes.Contains(encoded, []byte("s3cret-db-password")) || bytes.Contains(encoded, []byte(ds)) {
+		t.Errorf("bundle carries the plain password or an ID:\n%s", encoded)
+	}
+	if !bytes.Contains(encoded, []byte("public.orders.region")) {
+		t.Errorf("bundle does not reference the view's column by name:\n%s", encoded)
+	}
+	decoded, err := DecodeBundle(encoded)
+	if err != nil {
+		t.Fatalf("DecodeBundle: %v", err)
+	}
+
+	importAsBob := func(secretsKey string, dryRun bool) *models.BundleImportReport {
+		t.Helper()
+		report, err := bs.Import(models.ImportBundleInput{UserID: bob, Bundle: *decoded, SecretsKey: secretsKey, DryRun: dryRun})
+		if err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+		return report
+	}
+	for _, key := range []string{"", "wrong horse battery"} {
+		if report := importAsBob(key, false); report.Applied || len(report.Errors) == 0 || !strings.Contains(report.Errors[0], "secrets key") {
+			t.Errorf("import with secrets key %q = %+v, want a secrets key error and nothing applied", key, report)
+		}
+	}
+
+	report := importAsBob(secretsKey, true)
+	if report.Applied || len(report.Items) != 3 || len(report.Errors) != 0 {
+		t.Fatalf("dry run = %+v, want three planned creations", report)
+	}
+	var count int
+	if err = db.QueryRow("SELECT COUNT(*) FROM data_sources WHERE user_id = ?", bob).Scan(&count); err != nil || count != 0 {
+		t.Fatalf("dry run created %d data sources (%v)", count, err)
+	}
+
+	if report = importAsBob(secretsKey, false); !report.Applied {
+		t.Fatalf("Import = %+v, want it applied", report)
+	}
+	var bobDS, password string
+	if err = db.QueryRow("SELECT id, password_encrypted FROM data_sources WHERE user_id = ? AND source_name = 'sales'", bob).Scan(&bobDS, &password); err != nil {
+		t.Fatalf("imported data source: %v", err)
+	}
+	if password != "s3cret-db-password" {
+		t.Errorf("imported password = %q, want the exported one", password)
+	}
+	// The views resolve to the imported data source, not to alice's
+	var definition string
+	if err = db.QueryRow("SELECT definition FROM virtual_views WHERE user_id = ? AND name = 'regions'", bob).Scan(&definition); err != nil {
+		t.Fatalf("imported view: %v", err)
+	}
+	var view models.VirtualViewDefinition
+	if err = json.Unmarshal([]byte(definition), &view); err != nil || len(view.SelectedColumns) != 1 {
+		t.Fatalf("imported view definition %s (%v), want one column", definition, err)
+	}
+	if alias := view.SelectedColumns[0].Alias; alias == nil || *alias != "area" {
+		t.Errorf("imported view column alias = %v, want area", alias)
+	}
+	var dataSourceID, columnName string
+	err = db.QueryRow("SELECT data_source_id, column_name FROM data_source_schemas WHERE id = ?", view.SelectedColumns[0].DataSourceSchemaID).Scan(&dataSourceID, &columnName)
+	if err != nil || dataSourceID != bobDS || columnName != "region" {
+		t.Errorf("imported view reads %s of %s (%v), want region of the imported data source", columnName, dataSourceID, err)
+	}
+	if err = db.QueryRow("SELECT COUNT(*) FROM virtual_base_views WHERE user_id = ? AND data_source_id = ?", bob, bobDS).Scan(&count); err != nil || count != 1 {
+		t.Errorf("%d imported base views on the imported data source (%v), want 1", count, err)
+	}
+}
+
+func TestBundleImportResolvesReferences(t *testing.T) {
+	db := metadatatest.NewDB(t)
+	bs := NewBundleService(db)
+	owner := metadatatest.InsertUser(t, db, "owner", "password")
+	carol := metadatatest.InsertUser(t, db, "carol", "password")
+	ds := metadatatest.InsertDataSource(t, db, owner, "warehouse")
+	_, err := db.Exec("INSERT INTO data_source_schemas (id, data_source_id, table_name, column_name, column_type) VALUES (?, ?, 'stock', 'sku', 'text')", uuid.NewString(), ds)
+	if err != nil {
+		t.Fatalf("insert column: %v", err)
+	}
+
+	bundle := models.Bundle{
+		Kind: models.BundleKind, Version: models.BundleVersion,
+		VirtualBaseViews: []models.BundleVirtualBaseView{{Name: "stock", DataSource: "warehouse", Table: "stock", Columns: []string{"sku"}}},
+		VirtualViews:     []models.BundleVirtualView{{Name: "skus", Columns: []models.BundleColumnRef{{DataSource: "warehouse", Column: "stock.sku"}}}},
+	}
+	importAsCarol := func(b models.Bundle) *models.BundleImportReport {
+		t.Helper()
+		report, err := bs.Import(models.ImportBundleInput{UserID: carol, Bundle: b})
+		if err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+		return report
+	}
+
+	// References outside the bundle resolve only to data sources the importer can query
+	report := importAsCarol(bundle)
+	if report.Applied || len(report.Errors) != 2 || !strings.Contains(report.Errors[0], "neither in the bundle nor one you can query") {
+		t.Fatalf("import without access = %+v, want two unresolved references", report)
+	}
+	_, err = NewPrivilegeService(db).GrantPrivilege(models.GrantDataSourcePrivilegeInput{
+		DataSourceID: ds, UserID: carol, PrivilegeType: models.PrivilegeQuery, GrantorUserID: owner,
+	})
+	if err != nil {
+		t.Fatalf("GrantPrivilege: %v", err)
+	}
+
+	broken := bundle
+	broken.VirtualViews = []models.BundleVirtualView{{Name: "skus", Columns: []models.BundleColumnRef{{DataSource: "warehouse", Column: "stock.price"}}}}
+	if report = importAsCarol(broken); report.Applied || len(report.Errors) != 1 || !strings.Contains(report.Errors[0], "column 'stock.price' not found") {
+		t.Errorf("import of an unknown column = %+v, want one error", report)
+	}
+
+	if report = importAsCarol(bundle); !report.Applied {
+		t.Fatalf("import with QUERY = %+v, want it applied", report)
+	}
+	var count int
+	if err = db.QueryRow("SELECT COUNT(*) FROM virtual_base_views WHERE user_id = ? AND data_source_id = ?", carol, ds).Scan(&count); err != nil || count != 1 {
+		t.Errorf("%d base views of carol on the shared data source (%v), want 1", count, err)
+	}
+}
+
+func TestBundleImportConflicts(t *testing.T) {
+	db := metadatatest.NewDB(t)
+	bs := NewBundleService(db)
+	owner := metadatatest.InsertUser(t, db, "owner", "password")
+	ds := metadatatest.InsertDataSource(t, db, owner, "sales")
+
+	bundle := models.Bundle{
+		Kind: models.BundleKind, Version: models.BundleVersion,
+		DataSources: []models.BundleDataSource{
+			{Name: "sales", DBType: "postgresql", Host: "new.example.com"},
+			{Name: "crm", DBType: "mysql", Host: "crm.example.com"},
+		},
+	}
+	importBundle := func(onConflict string, dryRun bool) *models.BundleImportReport {
+		t.Helper()
+		report, err := bs.Import(models.ImportBundleInput{UserID: owner, Bundle: bundle, OnConflict: onConflict, DryRun: dryRun})
+		if err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+		return report
+	}
+	actions := func(report *models.BundleImportReport) string {
+		var out []string
+		for _, item := range report.Items {
+			out = append(out, item.Name+":"+item.Action)
+		}
+		return strings.Join(out, ",")
+	}
+	host := func() string {
+		t.Helper()
+		var host string
+		if err := db.QueryRow("SELECT host FROM data_sources WHERE id = ?", ds).Scan(&host); err != nil {
+			t.Fatalf("read host: %v", err)
+		}
+		return host
+	}
+	dataSources := func() int {
+		t.Helper()
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM data_sources").Scan(&count); err != nil {
+			t.Fatalf("count data sources: %v", err)
+		}
+		return count
+	}
+
+	if _, err := bs.Import(models.ImportBundleInput{UserID: owner, Bundle: bundle, OnConflict: "merge"}); err == nil {
+		t.Error("Import accepted an unknown conflict mode")
+	}
+
+	report := importBundle("", true)
+	if report.Conflicts != 1 || actions(report) != "sales:conflict,crm:create" || report.Items[0].ID != ds {
+		t.Errorf("dry run = %+v, want sales to conflict with %s and crm to be created", report, ds)
+	}
+	if report = importBundle(models.BundleConflictFail, false); report.Applied || dataSources() != 1 {
+		t.Errorf("failing import = %+v, want nothing written", report)
+	}
+	if report = importBundle(models.BundleConflictOverwrite, true); report.Applied || actions(report) != "sales:update,crm:create" || host() != "localhost" {
+		t.Errorf("overwriting dry run = %+v, want updates planned and nothing written", report)
+	}
+
+	if report = importBundle(models.BundleConflictSkip, false); !report.Applied || actions(report) != "sales:skip,crm:create" {
+		t.Fatalf("skipping import = %+v, want sales kept and crm created", report)
+	}
+	if host() != "localhost" || dataSources() != 2 {
+		t.Errorf("skipping import left host %q and %d data sources, want localhost and 2", host(), dataSources())
+	}
+	if report = importBundle(models.BundleConflictOverwrite, false); !report.Applied || actions(report) != "sales:update,crm:update" {
+		t.Fatalf("overwriting import = %+v, want both updated", report)
+	}
+	if host() != "new.example.com" || dataSources() != 2 {
+		t.Errorf("overwriting import left host %q and %d data sources, want new.example.com and 2", host(), dataSources())
+	}
+}
@@ -32,34 +32,47 @@ type ConnectAndFetchSchemaInput struct {
 	Password   string `json:"dbPassword"`
 	DBName     string `json:"dbName"`
 	UserID     string `json:"-"` // UserID is passed internally, not from JSON request
+
+	SSLMode     string `json:"sslMode"`     // One of the models.SSLMode* values; disable when empty
+	SSLRootCert string `json:"sslRootCert"` // PEM CA bundle the server certificate is verified against
+	SSLCert     string `json:"sslCert"`     // PEM client certificate chain
+	SSLKey      string `json:"sslKey"`      // PEM private key of the client certificate
+
+	AdditionalParams map[string]string `json:"additionalParams"` // Driver options, see driverParams
+}
+
+// connection returns the connection details of the input.
+func (input ConnectAndFetchSchemaInput) connection() dataSourceConnection {
+	return dataSourceConnection{
+		DBType:     input.DBType,
+		Host:       input.Host,
+		Port:       input.Port,
+		Database:   input.DBName,
+		User:       input.User,
+		Password:   input.Password,
+		SSLMode:    input.SSLMode,
+		CACert:     input.SSLRootCert,
+		ClientCert: input.SSLCert,
+		ClientKey:  input.SSLKey,
+		Params:     input.AdditionalParams,
+	}
 }
 
 // ConnectAndFetchSchema connects to a given database, fetches its schema,
 // saves the data source and its schema, and returns the schema.
 func (cs *ConnectionService) ConnectAndFetchSchema(input ConnectAndFetchSchemaInput) ([]models.DataSourceSchema, error) {
-	var dsn string
-	var driver_name string
-
-	switch input.DBType {
-	case "postgresql":
-		driver_name = "postgres"
-		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			input.Host, input.Port, input.User, input.Password, input.DBName)
-	case "mysql":
-		driver_name = "mysql"
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-			input.User, input.Password, input.Host, input.Port, input.DBName)
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", input.DBType)
-	}
-
-	ext_db, err := sql.Open(driver_name, dsn)
+	conn := input.connection()
+	additional_params, err := driverParamsColumn(conn.DBType, conn.Params)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open external database connection: %w", err)
+		return nil, err
+	}
+	if err = conn.validate(); err != nil {
+		return nil, err
+	}
+	ext_db, ping_err := conn.open()
+	if ping_err == nil {
+		defer ext_db.Close()
 	}
-	defer ext_db.Close()
-
-	ping_err := ext_db.Ping()
 	now := time.Now().UTC()
 
 	// Begin transaction for metadata updates
@@ -76,9 +89,9 @@ func (cs *ConnectionService) ConnectAndFetchSchema(input ConnectAndFetchSchemaIn
 	password_encrypted := sql.NullString{String: input.Password, Valid: input.Password != ""}
 
 	_, err = tx.Exec(`
-        INSERT INTO data_sources (id, user_id, source_name, db_type, host, port, database_name, db_username, password_encrypted, created_at, updated_at, last_connection_status, last_connection_at, last_error_message)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-    `, data_source_id, input.UserID, input.SourceName, input.DBType, input.Host, input.Port, input.DBName, input.User, password_encrypted, now, now,
+        INSERT INTO data_sources (id, user_id, source_name, db_type, host, port, database_name, db_username, password_encrypted, ssl_mode, additional_params, created_at, updated_at, last_connection_status, last_connection_at, last_error_message)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, data_source_id, input.UserID, input.SourceName, input.DBType, input.Host, input.Port, input.DBName, input.User, password_encrypted, conn.sslMode(), additional_params, now, now,
 		func() string {
 			if ping_err == nil {
 				return "connected"
@@ -104,10 +117,13 @@ func (cs *ConnectionService) ConnectAndFetchSchema(input ConnectAndFetchSchemaIn
 	if err != nil {
 		return nil, fmt.Errorf("failed to save data source: %w", err)
 	}
+	if err = saveDataSourceTLS(cs.metaDB, tx, data_source_id, conn, now); err != nil {
+		return nil, err
+	}
 
 	if ping_err != nil {
 		_ = tx.Commit() // Commit the data source with failed status
-		return nil, fmt.Errorf("failed to ping external database: %w", ping_err)
+		return nil, ping_err
 	}
 
 	log.Printf("Successfully connected to %s database: %s for user: %s, source: %s\n", input.DBType, input.DBName, input.UserID, input.SourceName)
@@ -137,52 +153,46 @@ func (cs *ConnectionService) ConnectAndFetchSchema(input ConnectAndFetchSchemaIn
 }
 
 // TestConnectionAndFetchSchema connects to a database and fetches its schema
-// without saving to metadata. Returns schema for preview.
-func (cs *ConnectionService) TestConnectionAndFetchSchema(input ConnectAndFetchSchemaInput) ([]models.DataSourceSchema, error) {
-	var dsn string
-	var driver_name string
-
-	switch input.DBType {
-	case "postgresql":
-		driver_name = "postgres"
-		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			input.Host, input.Port, input.User, input.Password, input.DBName)
-	case "mysql":
-		driver_name = "mysql"
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-			input.User, input.Password, input.Host, input.Port, input.DBName)
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", input.DBType)
-	}
-
-	ext_db, err := sql.Open(driver_name, dsn)
+// without saving to metadata. Returns schema for preview, and the negotiated TLS state when the
+// database reports it.
+func (cs *ConnectionService) TestConnectionAndFetchSchema(input ConnectAndFetchSchemaInput) ([]models.DataSourceSchema, *models.DataSourceTLSState, error) {
+	conn := input.connection()
+	ext_db, err := conn.open()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open external database connection: %w", err)
+		return nil, nil, err
 	}
 	defer ext_db.Close()
 
-	ping_err := ext_db.Ping()
-	if ping_err != nil {
-		return nil, fmt.Errorf("failed to ping external database: %w", ping_err)
-	}
-
 	log.Printf("Successfully tested connection to %s database: %s\n", input.DBType, input.DBName)
+	tlsState := conn.negotiatedTLS(ext_db)
 
 	// Fetch Schema (without saving)
 	now := time.Now().UTC()
-	return cs.fetchSchemaFromDatabase(ext_db, input, "", now)
+	schema, err := cs.fetchSchemaFromDatabase(ext_db, input, "", now)
+	if err != nil {
+		return nil, nil, err
+	}
+	return schema, tlsState, nil
 }
 
 // SaveDataSource saves a data source and its schema to metadata after successful testing
 func (cs *ConnectionService) SaveDataSource(input ConnectAndFetchSchemaInput, schema []models.DataSourceSchema) (*models.DataSource, error) {
 	now := time.Now().UTC()
+	conn := input.connection()
+	if err := conn.validate(); err != nil {
+		return nil, err
+	}
+	additional_params, err := driverParamsColumn(conn.DBType, conn.Params)
+	if err != nil {
+		return nil, err
+	}
 
 	// Debug: Log the UserID being used
 	log.Printf("Attempting to save data source for UserID: %s", input.UserID)
 
 	// Verify user exists before proceeding
 	var existingUserID string
-	err := cs.metaDB.QueryRow("SELECT id FROM users WHERE id = ?", input.UserID).Scan(&existingUserID)
+	err = cs.metaDB.QueryRow("SELECT id FROM users WHERE id = ?", input.UserID).Scan(&existingUserID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user with ID %s does not exist", input.UserID)
@@ -203,12 +213,15 @@ func (cs *ConnectionService) SaveDataSource(input ConnectAndFetchSchemaInput, sc
 	password_encrypted := sql.NullString{String: input.Password, Valid: input.Password != ""}
 
 	_, err = tx.Exec(`
-        INSERT INTO data_sources (id, user_id, source_name, db_type, host, port, database_name, db_username, password_encrypted, created_at, updated_at, last_connection_status, last_connection_at)
-        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-    `, data_source_id, input.UserID, input.SourceName, input.DBType, input.Host, input.Port, input.DBName, input.User, password_encrypted, now, now, "connected", sql.NullTime{Time: now, Valid: true})
+        INSERT INTO data_sources (id, user_id, source_name, db_type, host, port, database_name, db_username, password_encrypted, ssl_mode, additional_params, created_at, updated_at, last_connection_status, last_connection_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, data_source_id, input.UserID, input.SourceName, input.DBType, input.Host, input.Port, input.DBName, input.User, password_encrypted, conn.sslMode(), additional_params, now, now, "connected", sql.NullTime{Time: now, Valid: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to save data source: %w", err)
 	}
+	if err = saveDataSourceTLS(cs.metaDB, tx, data_source_id, conn, now); err != nil {
+		return nil, err
+	}
 
 	// Save Schema with new IDs
 	for _, schemaItem := range schema {
@@ -228,16 +241,18 @@ func (cs *ConnectionService) SaveDataSource(input ConnectAndFetchSchemaInput, sc
 
 	// Return the saved data source
 	saved_data_source := &models.DataSource{
-		ID:           data_source_id,
-		UserID:       input.UserID,
-		SourceName:   input.SourceName,
-		DBType:       input.DBType,
-		Host:         sql.NullString{String: input.Host, Valid: true},
-		Port:         sql.NullInt64{Int64: int64(input.Port), Valid: true},
-		DatabaseName: sql.NullString{String: input.DBName, Valid: true},
-		DBUsername:   sql.NullString{String: input.User, Valid: true},
-		CreatedAt:    now,
-		UpdatedAt:    now,
+		ID:               data_source_id,
+		UserID:           input.UserID,
+		SourceName:       input.SourceName,
+		DBType:           input.DBType,
+		Host:             sql.NullString{String: input.Host, Valid: true},
+		Port:             sql.NullInt64{Int64: int64(input.Port), Valid: true},
+		DatabaseName:     sql.NullString{String: input.DBName, Valid: true},
+		DBUsername:       sql.NullString{String: input.User, Valid: true},
+		SSLMode:          sql.NullString{String: conn.sslMode(), Valid: true},
+		AdditionalParams: additional_params,
+		CreatedAt:        now,
+		UpdatedAt:        now,
 	}
 
 	log.Printf("Successfully saved data source: %s for user: %s\n", input.SourceName, input.UserID)
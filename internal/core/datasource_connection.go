@@ -0,0 +1,373 @@
+package core
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"Bridgo/internal/models"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// dataSourceConnection holds what is needed to connect to an external database.
+type dataSourceConnection struct {
+	DBType   string
+	Host     string
+	Port     int
+	Database string
+	User     string
+	Password string
+
+	SSLMode    string // One of the models.SSLMode* values; disable when empty
+	CACert     string // PEM CA bundle; the system CAs are used when empty
+	ClientCert string // PEM client certificate chain
+	ClientKey  string // PEM private key of the client certificate
+
+	Params map[string]string // Allowlisted driver options, see driverParams
+}
+
+// sslMode returns the SSL mode, defaulting to disable as before SSL modes existed.
+func (c dataSourceConnection) sslMode() string {
+	if c.SSLMode == "" {
+		return models.SSLModeDisable
+	}
+	return c.SSLMode
+}
+
+// validate checks the SSL mode, the driver options and that the certificates parse.
+func (c dataSourceConnection) validate() error {
+	switch c.sslMode() {
+	case models.SSLModeDisable, models.SSLModeRequire, models.SSLModeVerifyCA, models.SSLModeVerifyFull:
+	default:
+		return fmt.Errorf("unsupported SSL mode '%s' (use %s, %s, %s or %s)", c.SSLMode,
+			models.SSLModeDisable, models.SSLModeRequire, models.SSLModeVerifyCA, models.SSLModeVerifyFull)
+	}
+	if _, err := normalizeDriverParams(c.DBType, c.Params); err != nil {
+		return err
+	}
+	if c.CACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(c.CACert)) {
+		return errors.New("the CA certificate is not a PEM certificate")
+	}
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return errors.New("a client certificate needs its private key, and the other way around")
+	}
+	if c.ClientCert != "" {
+		if _, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey)); err != nil {
+			return fmt.Errorf("invalid client certificate or key: %w", err)
+		}
+	}
+	return nil
+}
+
+// open connects to the external database and checks that it answers.
+func (c dataSourceConnection) open() (*sql.DB, error) {
+	return c.openContext(context.Background())
+}
+
+// openContext is open, giving up when ctx is done.
+func (c dataSourceConnection) openContext(ctx context.Context) (*sql.DB, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	var db *sql.DB
+	switch c.DBType {
+	case "postgresql":
+		var err error
+		if db, err = sql.Open("postgres", c.postgresDSN()); err != nil {
+			return nil, fmt.Errorf("failed to open external database connection: %w", err)
+		}
+	case "mysql":
+		cfg := mysql.NewConfig()
+		cfg.User = c.User
+		cfg.Passwd = c.Password
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+		cfg.DBName = c.Database
+		cfg.TLS = c.mysqlTLSConfig()
+		if err := applyMySQLDriverParams(cfg, c.Params); err != nil {
+			return nil, fmt.Errorf("failed to apply driver options: %w", err)
+		}
+		connector, err := mysql.NewConnector(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open external database connection: %w", err)
+		}
+		db = sql.OpenDB(connector)
+	default:
+		return nil, fmt.Errorf("unsupported database type: %s", c.DBType)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping external database: %w", err)
+	}
+	return db, nil
+}
+
+// postgresDSN returns the lib/pq connection string. Certificates are passed inline, so they never
+// touch the disk.
+func (c dataSourceConnection) postgresDSN() string {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	params := []string{
+		"host=" + "'" + quote.Replace(c.Host) + "'",
+		"port=" + strconv.Itoa(c.Port),
+		"user=" + "'" + quote.Replace(c.User) + "'",
+		"password=" + "'" + quote.Replace(c.Password) + "'",
+		"dbname=" + "'" + quote.Replace(c.Database) + "'",
+		"sslmode=" + c.sslMode(),
+	}
+	if c.sslMode() != models.SSLModeDisable && (c.CACert != "" || c.ClientCert != "") {
+		params = append(params, "sslinline=true")
+		if c.CACert != "" {
+			params = append(params, "sslrootcert='"+quote.Replace(c.CACert)+"'")
+		}
+		if c.ClientCert != "" {
+			params = append(params, "sslcert='"+quote.Replace(c.ClientCert)+"'", "sslkey='"+quote.Replace(c.ClientKey)+"'")
+		}
+	}
+	params = append(params, postgresDriverParams(c.Params, quote)...)
+	return strings.Join(params, " ")
+}
+
+// mysqlTLSConfig returns the TLS configuration of a MySQL connection; nil for plain connections.
+func (c dataSourceConnection) mysqlTLSConfig() *tls.Config {
+	mode := c.sslMode()
+	if mode == models.SSLModeDisable {
+		return nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	var roots *x509.CertPool // nil verifies against the system CAs
+	if c.CACert != "" {
+		roots = x509.NewCertPool()
+		roots.AppendCertsFromPEM([]byte(c.CACert))
+		if mode == models.SSLModeRequire {
+			mode = models.SSLModeVerifyCA
+		}
+	}
+	if c.ClientCert != "" {
+		cert, _ := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey)) // Checked by validate
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case models.SSLModeRequire:
+		config.InsecureSkipVerify = true
+	case models.SSLModeVerifyCA:
+		// Verify the chain but not the host name, which crypto/tls only does together
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyCertificateChain(rawCerts, roots)
+		}
+	case models.SSLModeVerifyFull:
+		config.RootCAs = roots
+		config.ServerName = c.Host
+	}
+	return config
+}
+
+// verifyCertificateChain checks that the server certificate chains up to roots.
+func verifyCertificateChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("the server sent no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	var leaf *x509.Certificate
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("invalid server certificate: %w", err)
+		}
+		if i == 0 {
+			leaf = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	return err
+}
+
+// negotiatedTLS asks the external database whether the connection is encrypted. It returns nil
+// when the server does not tell.
+func (c dataSourceConnection) negotiatedTLS(db *sql.DB) *models.DataSourceTLSState {
+	state := &models.DataSourceTLSState{SSLMode: c.sslMode()}
+	var err error
+	switch c.DBType {
+	case "postgresql":
+		err = db.QueryRow("SELECT ssl, COALESCE(version, ''), COALESCE(cipher, '') FROM pg_stat_ssl WHERE pid = pg_backend_pid()").
+			Scan(&state.Enabled, &state.Version, &state.Cipher)
+	case "mysql":
+		var rows *sql.Rows
+		rows, err = db.Query("SHOW SESSION STATUS WHERE Variable_name IN ('Ssl_version', 'Ssl_cipher')")
+		if err == nil {
+			defer rows.Close()
+			for rows.Next() {
+				var name, value string
+				if err = rows.Scan(&name, &value); err != nil {
+					break
+				}
+				if name == "Ssl_version" {
+					state.Version = value
+				} else {
+					state.Cipher = value
+				}
+			}
+			if err == nil {
+				err = rows.Err()
+			}
+			state.Enabled = state.Version != ""
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to read the TLS state of the %s connection: %v", c.DBType, err)
+		return nil
+	}
+	return state
+}
+
+// loadDataSourceConnection reads the connection details of a data source, decrypting its
+// certificates. Callers check access to the data source first.
+func loadDataSourceConnection(metaDB *sql.DB, dataSourceID string) (dataSourceConnection, error) {
+	var c dataSourceConnection
+	var host, database, user, password, sslMode, additionalParams sql.NullString
+	var port sql.NullInt64
+	err := metaDB.QueryRow(`
+		SELECT db_type, host, port, database_name, db_username, password_encrypted, ssl_mode, additional_params
+		FROM data_sources WHERE id = ?
+	`, dataSourceID).Scan(&c.DBType, &host, &port, &database, &user, &password, &sslMode, &additionalParams)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c, fmt.Errorf("data source not found")
+		}
+		return c, fmt.Errorf("failed to get data source info: %w", err)
+	}
+	c.Host, c.Port, c.Database, c.User, c.Password, c.SSLMode = host.String, int(port.Int64), database.String, user.String, password.String, sslMode.String
+	if c.Params, err = parseDriverParams(additionalParams); err != nil {
+		return c, err
+	}
+
+	var caCert, clientCert, clientKey sql.NullString
+	err = metaDB.QueryRow("SELECT ca_cert_encrypted, client_cert_encrypted, client_key_encrypted FROM data_source_tls WHERE data_source_id = ?", dataSourceID).
+		Scan(&caCert, &clientCert, &clientKey)
+	if err == sql.ErrNoRows {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to get data source certificates: %w", err)
+	}
+	for _, field := range []struct {
+		sealed sql.NullString
+		target *string
+	}{{caCert, &c.CACert}, {clientCert, &c.ClientCert}, {clientKey, &c.ClientKey}} {
+		if field.sealed.Valid {
+			if *field.target, err = openDataSourceSecret(metaDB, field.sealed.String); err != nil {
+				return c, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// openDataSourceByID connects to a data source. Callers check access to the data source first.
+func openDataSourceByID(metaDB *sql.DB, dataSourceID string) (*sql.DB, error) {
+	c, err := loadDataSourceConnection(metaDB, dataSourceID)
+	if err != nil {
+		return nil, err
+	}
+	return c.open()
+}
+
+// saveDataSourceTLS stores the certificates of a data source, encrypted, in the transaction.
+func saveDataSourceTLS(metaDB *sql.DB, tx *sql.Tx, dataSourceID string, c dataSourceConnection, now time.Time) error {
+	if _, err := tx.Exec("DELETE FROM data_source_tls WHERE data_source_id = ?", dataSourceID); err != nil {
+		return fmt.Errorf("failed to replace data source certificates: %w", err)
+	}
+	if c.CACert == "" && c.ClientCert == "" {
+		return nil
+	}
+
+	sealed := make([]sql.NullString, 3)
+	for i, plaintext := range []string{c.CACert, c.ClientCert, c.ClientKey} {
+		if plaintext == "" {
+			continue
+		}
+		value, err := sealDataSourceSecret(metaDB, plaintext)
+		if err != nil {
+			return err
+		}
+		sealed[i] = sql.NullString{String: value, Valid: true}
+	}
+	_, err := tx.Exec(`
+		INSERT INTO data_source_tls (data_source_id, ca_cert_encrypted, client_cert_encrypted, client_key_encrypted, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, dataSourceID, sealed[0], sealed[1], sealed[2], now)
+	if err != nil {
+		return fmt.Errorf("failed to save data source certificates: %w", err)
+	}
+	return nil
+}
+
+// dataSourceSecretCipher returns the AES-GCM cipher of the installation's data source secret.
+func dataSourceSecretCipher(metaDB *sql.DB) (cipher.AEAD, error) {
+	var secret string
+	err := metaDB.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key = ?", models.SettingDataSourceSecret).Scan(&secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data source secret: %w", err)
+	}
+	key, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data source secret: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealDataSourceSecret returns base64(nonce | ciphertext) of plaintext.
+func sealDataSourceSecret(metaDB *sql.DB, plaintext string) (string, error) {
+	gcm, err := dataSourceSecretCipher(metaDB)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil)), nil
+}
+
+// openDataSourceSecret opens a value sealed by sealDataSourceSecret.
+func openDataSourceSecret(metaDB *sql.DB, encoded string) (string, error) {
+	gcm, err := dataSourceSecretCipher(metaDB)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("corrupted data source certificate")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("data source certificate cannot be decrypted; was the metadata restored without its secrets?")
+	}
+	return string(plaintext), nil
+}
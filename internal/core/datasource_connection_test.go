@@ -0,0 +1,179 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"Bridgo/internal/models"
+)
+
+// testCA issues certificates for TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+// issue returns a leaf certificate for host and its key, both PEM-encoded.
+func (ca *testCA) issue(t *testing.T, host string, usage x509.ExtKeyUsage) (certPEM, keyPEM string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// handshake runs a TLS handshake over loopback between client and a server presenting serverCert.
+func handshake(t *testing.T, client *tls.Config, serverCert tls.Certificate) error {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return tls.Client(conn, client).Handshake()
+}
+
+func TestMySQLTLSConfig(t *testing.T) {
+	trusted := newTestCA(t, "trusted CA")
+	untrusted := newTestCA(t, "untrusted CA")
+	loadPair := func(certPEM, keyPEM string) tls.Certificate {
+		pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			t.Fatalf("load key pair: %v", err)
+		}
+		return pair
+	}
+	trustedServer := loadPair(trusted.issue(t, "db.example.com", x509.ExtKeyUsageServerAuth))
+	otherHostServer := loadPair(trusted.issue(t, "other.example.com", x509.ExtKeyUsageServerAuth))
+	untrustedServer := loadPair(untrusted.issue(t, "db.example.com", x509.ExtKeyUsageServerAuth))
+
+	conn := func(mode, caCert string) dataSourceConnection {
+		return dataSourceConnection{DBType: "mysql", Host: "db.example.com", Port: 3306, SSLMode: mode, CACert: caCert}
+	}
+
+	if cfg := conn(models.SSLModeDisable, "").mysqlTLSConfig(); cfg != nil {
+		t.Errorf("disable: got a TLS configuration")
+	}
+	if cfg := conn("", "").mysqlTLSConfig(); cfg != nil {
+		t.Errorf("empty SSL mode: got a TLS configuration")
+	}
+
+	tests := []struct {
+		name    string
+		conn    dataSourceConnection
+		server  tls.Certificate
+		wantErr bool
+	}{
+		{"require accepts any certificate", conn(models.SSLModeRequire, ""), untrustedServer, false},
+		{"require with CA verifies the chain", conn(models.SSLModeRequire, trusted.pem), untrustedServer, true},
+		{"require with CA ignores the host", conn(models.SSLModeRequire, trusted.pem), otherHostServer, false},
+		{"verify-ca accepts a trusted chain", conn(models.SSLModeVerifyCA, trusted.pem), trustedServer, false},
+		{"verify-ca ignores the host", conn(models.SSLModeVerifyCA, trusted.pem), otherHostServer, false},
+		{"verify-ca rejects an untrusted chain", conn(models.SSLModeVerifyCA, trusted.pem), untrustedServer, true},
+		{"verify-full accepts the right host", conn(models.SSLModeVerifyFull, trusted.pem), trustedServer, false},
+		{"verify-full rejects another host", conn(models.SSLModeVerifyFull, trusted.pem), otherHostServer, true},
+		{"verify-full rejects an untrusted chain", conn(models.SSLModeVerifyFull, trusted.pem), untrustedServer, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.conn.validate(); err != nil {
+				t.Fatalf("validate: %v", err)
+			}
+			cfg := tt.conn.mysqlTLSConfig()
+			if cfg == nil {
+				t.Fatal("no TLS configuration")
+			}
+			if cfg.MinVersion != tls.VersionTLS12 {
+				t.Errorf("MinVersion = %x, want TLS 1.2", cfg.MinVersion)
+			}
+			err := handshake(t, cfg, tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handshake error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("client certificate", func(t *testing.T) {
+		c := conn(models.SSLModeVerifyFull, trusted.pem)
+		c.ClientCert, c.ClientKey = trusted.issue(t, "bridgo", x509.ExtKeyUsageClientAuth)
+		if err := c.validate(); err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		cfg := c.mysqlTLSConfig()
+		if len(cfg.Certificates) != 1 {
+			t.Fatalf("got %d client certificates, want 1", len(cfg.Certificates))
+		}
+		leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+		if err != nil || leaf.Subject.CommonName != "bridgo" {
+			t.Errorf("client certificate = %v, %v", leaf, err)
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// driverParam is a driver option users may set on a data source. Only allowlisted options are
+// accepted, so options can neither override the connection settings Bridgo manages, such as the
+// host or SSL mode, nor inject further options.
+type driverParam struct {
+	name  string
+	check func(value string) (string, error) // Validates the value and returns its normalized form
+}
+
+// driverParams are the options each database type accepts, documented in the README.
+var driverParams = map[string][]driverParam{
+	"postgresql": {
+		{"application_name", checkApplicationName},
+		{"search_path", checkSearchPath},
+		{"statement_timeout", checkPostgresDuration},
+	},
+	"mysql": {
+		{"charset", checkCharset},
+		{"parseTime", checkBool},
+		{"loc", checkLocation},
+		{"timeout", checkDuration},
+	},
+}
+
+var (
+	searchPathEntryPattern  = regexp.MustCompile(`^(\$user|[A-Za-z_][A-Za-z0-9_$]*)$`)
+	postgresDurationPattern = regexp.MustCompile(`^[0-9]+(ms|s|min|h)?$`)
+	charsetPattern          = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// normalizeDriverParams checks params against the options of dbType and returns them normalized.
+func normalizeDriverParams(dbType string, params map[string]string) (map[string]string, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	allowed, ok := driverParams[dbType]
+	if !ok {
+		return nil, fmt.Errorf("database type '%s' has no driver options", dbType)
+	}
+
+	normalized := make(map[string]string, len(params))
+	for name, value := range params {
+		var param *driverParam
+		for i := range allowed {
+			if allowed[i].name == name {
+				param = &allowed[i]
+				break
+			}
+		}
+		if param == nil {
+			names := make([]string, len(allowed))
+			for i, p := range allowed {
+				names[i] = p.name
+			}
+			return nil, fmt.Errorf("unsupported %s driver option '%s' (use %s)", dbType, name, strings.Join(names, ", "))
+		}
+		v, err := param.check(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for driver option '%s': %w", name, err)
+		}
+		normalized[name] = v
+	}
+	return normalized, nil
+}
+
+// driverParamsColumn validates params and returns them as stored in data_sources.additional_params:
+// a JSON object, or NULL without options.
+func driverParamsColumn(dbType string, params map[string]string) (sql.NullString, error) {
+	normalized, err := normalizeDriverParams(dbType, params)
+	if err != nil || len(normalized) == 0 {
+		return sql.NullString{}, err
+	}
+	encoded, err := json.Marshal(normalized) // Keys are sorted, so equal options encode equally
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode driver options: %w", err)
+	}
+	return sql.NullString{String: string(encoded), Valid: true}, nil
+}
+
+// parseDriverParams reads a data_sources.additional_params value.
+func parseDriverParams(column sql.NullString) (map[string]string, error) {
+	if !column.Valid || column.String == "" {
+		return nil, nil
+	}
+	var params map[string]string
+	if err := json.Unmarshal([]byte(column.String), &params); err != nil {
+		return nil, fmt.Errorf("invalid driver options: %w", err)
+	}
+	return params, nil
+}
+
+// postgresDriverParams returns the options as lib/pq connection string parameters; those that
+// are not connection settings are sent to the server as run-time parameters.
+func postgresDriverParams(params map[string]string, quote *strings.Replacer) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []string
+	for _, name := range names {
+		result = append(result, name+"='"+quote.Replace(params[name])+"'")
+	}
+	return result
+}
+
+// applyMySQLDriverParams sets the options on a go-sql-driver configuration.
+func applyMySQLDriverParams(cfg *mysql.Config, params map[string]string) error {
+	for name, value := range params {
+		switch name {
+		case "charset":
+			if err := cfg.Apply(mysql.Charset(value, "")); err != nil {
+				return err
+			}
+		case "parseTime":
+			cfg.ParseTime = value == "true"
+		case "loc":
+			loc, err := time.LoadLocation(value)
+			if err != nil {
+				return err
+			}
+			cfg.Loc = loc
+		case "timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			cfg.Timeout = timeout
+		}
+	}
+	return nil
+}
+
+func checkApplicationName(value string) (string, error) {
+	if len(value) > 63 {
+		return "", errors.New("at most 63 characters")
+	}
+	for _, r := range value {
+		if r < 0x20 || r > 0x7e {
+			return "", errors.New("only printable ASCII characters are allowed")
+		}
+	}
+	return value, nil
+}
+
+func checkSearchPath(value string) (string, error) {
+	entries := strings.Split(value, ",")
+	for i, entry := range entries {
+		entries[i] = strings.TrimSpace(entry)
+		if !searchPathEntryPattern.MatchString(entries[i]) {
+			return "", fmt.Errorf("'%s' is not a schema name", entries[i])
+		}
+	}
+	return strings.Join(entries, ","), nil
+}
+
+func checkPostgresDuration(value string) (string, error) {
+	if !postgresDurationPattern.MatchString(value) {
+		return "", errors.New("expected milliseconds or a number with unit ms, s, min or h, e.g. 30s")
+	}
+	return value, nil
+}
+
+func checkCharset(value string) (string, error) {
+	if !charsetPattern.MatchString(value) {
+		return "", fmt.Errorf("'%s' is not a character set name", value)
+	}
+	return value, nil
+}
+
+func checkBool(value string) (string, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return "", errors.New("expected true or false")
+	}
+	return strconv.FormatBool(b), nil
+}
+
+func checkLocation(value string) (string, error) {
+	if value == "" {
+		return "", errors.New("expected a time zone name, e.g. UTC or Europe/Berlin")
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		return "", fmt.Errorf("unknown time zone '%s'", value)
+	}
+	return value, nil
+}
+
+func checkDuration(value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return "", errors.New("expected a positive duration, e.g. 10s")
+	}
+	return d.String(), nil
+}
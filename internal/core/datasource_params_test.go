@@ -0,0 +1,71 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDriverParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		dbType  string
+		params  map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{"no options", "postgresql", nil, nil, ""},
+		{
+			"postgres options", "postgresql",
+			map[string]string{"application_name": " reports ", "search_path": "sales, $user ,public", "statement_timeout": "30s"},
+			map[string]string{"application_name": "reports", "search_path": "sales,$user,public", "statement_timeout": "30s"},
+			"",
+		},
+		{
+			"mysql options", "mysql",
+			map[string]string{"charset": "utf8mb4", "parseTime": "1", "loc": "Europe/Berlin", "timeout": "1m30s"},
+			map[string]string{"charset": "utf8mb4", "parseTime": "true", "loc": "Europe/Berlin", "timeout": "1m30s"},
+			"",
+		},
+		{"unsupported database type", "sqlite", map[string]string{"charset": "utf8"}, nil, "has no driver options"},
+		{"unknown option", "postgresql", map[string]string{"sslmode": "disable"}, nil, "unsupported postgresql driver option 'sslmode'"},
+		{"option of another database", "mysql", map[string]string{"search_path": "public"}, nil, "unsupported mysql driver option"},
+		{"injected connection setting", "postgresql", map[string]string{"application_name": "x' host='evil"}, map[string]string{"application_name": "x' host='evil"}, ""},
+		{"control characters", "postgresql", map[string]string{"application_name": "a\nb"}, nil, "printable ASCII"},
+		{"long application name", "postgresql", map[string]string{"application_name": strings.Repeat("a", 64)}, nil, "at most 63"},
+		{"invalid schema", "postgresql", map[string]string{"search_path": "public; DROP TABLE x"}, nil, "is not a schema name"},
+		{"invalid statement timeout", "postgresql", map[string]string{"statement_timeout": "30 seconds"}, nil, "statement_timeout"},
+		{"invalid charset", "mysql", map[string]string{"charset": "utf8&tls=false"}, nil, "is not a character set name"},
+		{"invalid bool", "mysql", map[string]string{"parseTime": "yes"}, nil, "expected true or false"},
+		{"unknown time zone", "mysql", map[string]string{"loc": "Mars/Olympus"}, nil, "unknown time zone"},
+		{"negative timeout", "mysql", map[string]string{"timeout": "-1s"}, nil, "positive duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeDriverParams(tt.dbType, tt.params)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeDriverParams: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresDriverParamsQuoting(t *testing.T) {
+	conn := dataSourceConnection{
+		DBType: "postgresql", Host: "db", Port: 5432, Database: "sales", User: "bridgo",
+		Params: map[string]string{"application_name": `x' host='evil`, "search_path": "public"},
+	}
+	dsn := conn.postgresDSN()
+	if !strings.HasSuffix(dsn, ` application_name='x\' host=\'evil' search_path='public'`) {
+		t.Errorf("driver options are not quoted: %s", dsn)
+	}
+}
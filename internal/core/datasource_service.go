@@ -1,8 +1,11 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
+	"sync"
 
 	"Bridgo/internal/models"
 )
@@ -17,16 +20,18 @@ func NewDataSourceService(metaDB *sql.DB) *DataSourceService {
 	return &DataSourceService{metaDB: metaDB}
 }
 
-// GetUserDataSources retrieves all data sources for a user
+// GetUserDataSources retrieves all data sources a user owns or has been granted READ on
 func (dss *DataSourceService) GetUserDataSources(user_id string) ([]models.DataSource, error) {
+	access_condition, args := dataSourceAccessCondition("id", "user_id", user_id, models.PrivilegeRead)
 	query := `
-        SELECT id, user_id, source_name, db_type, host, port, database_name, db_username, description, created_at, updated_at, last_connection_status, last_connection_at
+        SELECT id, user_id, source_name, db_type, host, port, database_name, db_username, ssl_mode, additional_params, description, created_at, updated_at, last_connection_status, last_connection_at,
+               ` + managedExpr(models.ManagedDataSource, "id") + `
         FROM data_sources 
-        WHERE user_id = ? 
+        WHERE ` + access_condition + `
         ORDER BY created_at DESC
     `
 
-	rows, err := dss.metaDB.Query(query, user_id)
+	rows, err := dss.metaDB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query data sources: %w", err)
 	}
@@ -39,7 +44,7 @@ func (dss *DataSourceService) GetUserDataSources(user_id string) ([]models.DataS
 		var last_connection_status sql.NullString
 		var last_connection_at sql.NullTime
 
-		err = rows.Scan(&ds.ID, &ds.UserID, &ds.SourceName, &ds.DBType, &ds.Host, &ds.Port, &ds.DatabaseName, &ds.DBUsername, &description, &ds.CreatedAt, &ds.UpdatedAt, &last_connection_status, &last_connection_at)
+		err = rows.Scan(&ds.ID, &ds.UserID, &ds.SourceName, &ds.DBType, &ds.Host, &ds.Port, &ds.DatabaseName, &ds.DBUsername, &ds.SSLMode, &ds.AdditionalParams, &description, &ds.CreatedAt, &ds.UpdatedAt, &last_connection_status, &last_connection_at, &ds.Managed)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan data source: %w", err)
 		}
@@ -58,11 +63,59 @@ func (dss *DataSourceService) GetUserDataSources(user_id string) ([]models.DataS
 	return data_sources, nil
 }
 
+// CheckHealth connects to every data source in parallel, giving up on each when ctx is done.
+// Failures are logged with their cause.
+func (dss *DataSourceService) CheckHealth(ctx context.Context) ([]models.DataSourceHealth, error) {
+	rows, err := dss.metaDB.QueryContext(ctx, "SELECT id, source_name, db_type FROM data_sources ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data sources: %w", err)
+	}
+	var health []models.DataSourceHealth
+	var names []string
+	for rows.Next() {
+		var h models.DataSourceHealth
+		var name string
+		if err = rows.Scan(&h.ID, &name, &h.DBType); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan data source: %w", err)
+		}
+		health = append(health, h)
+		names = append(names, name)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating data source rows: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range health {
+		wg.Add(1)
+		go func(h *models.DataSourceHealth, name string) {
+			defer wg.Done()
+			h.Status = "ok"
+			c, err := loadDataSourceConnection(dss.metaDB, h.ID)
+			var db *sql.DB
+			if err == nil {
+				db, err = c.openContext(ctx)
+			}
+			if err != nil {
+				h.Status = "failed"
+				log.Printf("Health check of data source %s failed: %v", name, err)
+				return
+			}
+			db.Close()
+		}(&health[i], names[i])
+	}
+	wg.Wait()
+	return health, nil
+}
+
 // GetDataSourceSchema retrieves schema for a specific data source
 func (dss *DataSourceService) GetDataSourceSchema(data_source_id string, user_id string) ([]models.DataSourceSchema, error) {
-	// First verify the data source belongs to the user
+	// First verify the user owns the data source or has been granted READ on it
 	var count int
-	err := dss.metaDB.QueryRow("SELECT COUNT(*) FROM data_sources WHERE id = ? AND user_id = ?", data_source_id, user_id).Scan(&count)
+	access_condition, args := dataSourceAccessCondition("id", "user_id", user_id, models.PrivilegeRead)
+	err := dss.metaDB.QueryRow("SELECT COUNT(*) FROM data_sources WHERE id = ? AND "+access_condition, append([]interface{}{data_source_id}, args...)...).Scan(&count)
 	if err != nil {
 		return nil, fmt.Errorf("failed to verify data source ownership: %w", err)
 	}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrManagedObject is returned for changes to objects managed by declarative configuration.
+var ErrManagedObject = errors.New("managed by declarative configuration; change its manifest instead")
+
+// isManaged reports whether the object of objectType with the given ID is managed.
+func isManaged(db *sql.DB, objectType, objectID string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM managed_objects WHERE object_type = ? AND object_id = ?", objectType, objectID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether %s is managed: %w", objectType, err)
+	}
+	return count > 0, nil
+}
+
+// requireUnmanaged returns ErrManagedObject if the object is managed.
+func requireUnmanaged(db *sql.DB, objectType, objectID string) error {
+	managed, err := isManaged(db, objectType, objectID)
+	if err != nil {
+		return err
+	}
+	if managed {
+		return fmt.Errorf("%s %s is %w", objectType, objectID, ErrManagedObject)
+	}
+	return nil
+}
+
+// managedExpr returns a SQL expression telling whether the object of objectType whose ID is in
+// idColumn is managed, for listing queries.
+func managedExpr(objectType, idColumn string) string {
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM managed_objects m WHERE m.object_type = '%s' AND m.object_id = %s)", objectType, idColumn)
+}
@@ -0,0 +1,544 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// redactedValue replaces values masked with REDACT.
+const redactedValue = "[REDACTED]"
+
+// partialVisibleChars is how many trailing characters a PARTIAL mask leaves visible.
+const partialVisibleChars = 4
+
+// maskStrictness ranks mask types; when several policies apply to a column the strictest wins.
+var maskStrictness = map[string]int{
+	models.MaskPartial:  1,
+	models.MaskTokenize: 2,
+	models.MaskHash:     3,
+	models.MaskRedact:   4,
+}
+
+// MaskingService manages column masking policies (column_masking_policies).
+// Policies are enforced by columnMasker, which every result path must go through.
+type MaskingService struct {
+	metaDB           *sql.DB
+	privilegeService *PrivilegeService
+}
+
+// NewMaskingService creates a new MaskingService
+func NewMaskingService(metaDB *sql.DB) *MaskingService {
+	return &MaskingService{metaDB: metaDB, privilegeService: NewPrivilegeService(metaDB)}
+}
+
+// resultColumn identifies a column of a query result by the data source column it reads.
+// Policies are matched on the data source column, so aliases in a view cannot hide it.
+type resultColumn struct {
+	Name         string // Column name in the view's results
+	DataSourceID string
+	TableName    string
+	ColumnName   string
+}
+
+// resultMasker masks the values of one query result for one caller.
+type resultMasker struct {
+	masks  []string // Mask type per result column, "" when the column is not masked
+	secret []byte
+}
+
+// columnMasker resolves the masking policies that apply to userID for each result column of a view.
+// Data source column policies always apply; view column policies add to them. A policy is skipped
+// when the caller holds one of its exempt roles, and the strictest remaining policy wins.
+func columnMasker(db *sql.DB, viewType, viewID, userID string, columns []resultColumn) (*resultMasker, error) {
+	masker := &resultMasker{masks: make([]string, len(columns))}
+	if len(columns) == 0 {
+		return masker, nil
+	}
+
+	roles, err := userRoleNames(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index result columns by the data source column they read
+	bySourceColumn := make(map[string][]int)
+	byViewColumn := make(map[string][]int)
+	dataSourceIDs := make(map[string]bool)
+	for i, c := range columns {
+		key := strings.ToLower(c.DataSourceID + "\x00" + c.TableName + "\x00" + c.ColumnName)
+		bySourceColumn[key] = append(bySourceColumn[key], i)
+		byViewColumn[strings.ToLower(c.Name)] = append(byViewColumn[strings.ToLower(c.Name)], i)
+		dataSourceIDs[c.DataSourceID] = true
+	}
+
+	apply := func(indexes []int, maskType, exemptRolesJSON string) error {
+		var exemptRoles []string
+		if err := json.Unmarshal([]byte(exemptRolesJSON), &exemptRoles); err != nil {
+			return fmt.Errorf("failed to parse masking policy exempt roles: %w", err)
+		}
+		for _, role := range exemptRoles {
+			if roles[role] {
+				return nil
+			}
+		}
+		for _, i := range indexes {
+			if maskStrictness[maskType] > maskStrictness[masker.masks[i]] {
+				masker.masks[i] = maskType
+			}
+		}
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(dataSourceIDs))
+	args := make([]interface{}, 0, len(dataSourceIDs))
+	for id := range dataSourceIDs {
+		placeholders = append(placeholders, "?")
+		args = append(args, id)
+	}
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT p.mask_type, p.exempt_roles, s.data_source_id, s.table_name, s.column_name
+		FROM column_masking_policies p
+		JOIN data_source_schemas s ON s.id = p.data_source_schema_id
+		WHERE s.data_source_id IN (%s)
+	`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data source masking policies: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var maskType, exemptRoles, dataSourceID, tableName, columnName string
+		if err = rows.Scan(&maskType, &exemptRoles, &dataSourceID, &tableName, &columnName); err != nil {
+			return nil, fmt.Errorf("failed to scan masking policy: %w", err)
+		}
+		key := strings.ToLower(dataSourceID + "\x00" + tableName + "\x00" + columnName)
+		if err = apply(bySourceColumn[key], maskType, exemptRoles); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating masking policy rows: %w", err)
+	}
+
+	viewRows, err := db.Query(
+		"SELECT mask_type, exempt_roles, column_name FROM column_masking_policies WHERE view_type = ? AND view_id = ?",
+		viewType, viewID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query view masking policies: %w", err)
+	}
+	defer viewRows.Close()
+	for viewRows.Next() {
+		var maskType, exemptRoles, columnName string
+		if err = viewRows.Scan(&maskType, &exemptRoles, &columnName); err != nil {
+			return nil, fmt.Errorf("failed to scan masking policy: %w", err)
+		}
+		if err = apply(byViewColumn[strings.ToLower(columnName)], maskType, exemptRoles); err != nil {
+			return nil, err
+		}
+	}
+	if err = viewRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating masking policy rows: %w", err)
+	}
+
+	for _, maskType := range masker.masks {
+		if maskType == models.MaskHash || maskType == models.MaskTokenize {
+			var secret string
+			err = db.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key = ?", models.SettingMaskingSecret).Scan(&secret)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load masking secret: %w", err)
+			}
+			masker.secret = []byte(secret)
+			break
+		}
+	}
+
+	return masker, nil
+}
+
+// apply returns the value of result column i as the caller may see it.
+func (m *resultMasker) apply(i int, value interface{}) interface{} {
+	if value == nil || m.masks[i] == "" {
+		return value
+	}
+
+	var s string
+	switch v := value.(type) {
+	case []byte:
+		s = string(v)
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	switch m.masks[i] {
+	case models.MaskPartial:
+		return partialMask(s)
+	case models.MaskTokenize:
+		return tokenize(m.secret, s)
+	case models.MaskHash:
+		mac := hmac.New(sha256.New, m.secret)
+		mac.Write([]byte("hash:" + s))
+		return hex.EncodeToString(mac.Sum(nil))
+	default:
+		return redactedValue
+	}
+}
+
+// maskedColumns maps each masked result column name to its mask type.
+func (m *resultMasker) maskedColumns(names []string) map[string]string {
+	masked := make(map[string]string)
+	for i, maskType := range m.masks {
+		if maskType != "" {
+			masked[names[i]] = maskType
+		}
+	}
+	return masked
+}
+
+// partialMask stars out all but the last few characters of s. For e-mail addresses only the
+// first character of the local part and the domain are kept.
+func partialMask(s string) string {
+	if at := strings.LastIndex(s, "@"); at > 0 {
+		local := []rune(s[:at])
+		return string(local[0]) + strings.Repeat("*", len(local)-1) + s[at:]
+	}
+	r := []rune(s)
+	if len(r) <= partialVisibleChars {
+		return strings.Repeat("*", len(r))
+	}
+	return strings.Repeat("*", len(r)-partialVisibleChars) + string(r[len(r)-partialVisibleChars:])
+}
+
+// tokenize replaces every letter and digit of s with one derived from a keyed hash of s,
+// keeping the value's shape (length, separators, letter case) and its equality with other
+// values, so tokenized columns can still be joined and grouped on.
+func tokenize(secret []byte, s string) string {
+	var stream []byte
+	for block := 0; len(stream) < len(s); block++ {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(fmt.Sprintf("token:%d:%s", block, s)))
+		stream = mac.Sum(stream)
+	}
+
+	out := []rune(s)
+	for i, c := range out {
+		b := rune(stream[i%len(stream)])
+		switch {
+		case unicode.IsDigit(c):
+			out[i] = '0' + b%10
+		case unicode.IsUpper(c):
+			out[i] = 'A' + b%26
+		case unicode.IsLetter(c):
+			out[i] = 'a' + b%26
+		}
+	}
+	return string(out)
+}
+
+// userRoleNames returns the set of role names assigned to a user.
+func userRoleNames(db *sql.DB, userID string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT r.role_name FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE ur.user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan user role: %w", err)
+		}
+		roles[name] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user role rows: %w", err)
+	}
+	return roles, nil
+}
+
+// validateRoleNames checks that every named role exists.
+func validateRoleNames(db *sql.DB, roleNames []string) error {
+	for _, role := range roleNames {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM roles WHERE role_name = ?", role).Scan(&count); err != nil {
+			return fmt.Errorf("failed to look up role: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("role '%s' not found", role)
+		}
+	}
+	return nil
+}
+
+// viewResultColumns returns the result columns of a view, resolved to the data source columns they read.
+func viewResultColumns(db *sql.DB, viewType, viewID string) ([]resultColumn, error) {
+	switch viewType {
+	case models.ViewTypeVirtualBaseView:
+		var dataSourceID, tableName, selectedColumnsJSON string
+		err := db.QueryRow("SELECT data_source_id, table_name, selected_columns FROM virtual_base_views WHERE id = ?", viewID).
+			Scan(&dataSourceID, &tableName, &selectedColumnsJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get virtual base view: %w", err)
+		}
+		var definition models.VirtualBaseViewDefinition
+		if err = json.Unmarshal([]byte(selectedColumnsJSON), &definition); err != nil {
+			return nil, fmt.Errorf("failed to parse virtual base view definition: %w", err)
+		}
+		columns := make([]resultColumn, len(definition.ColumnNames))
+		for i, name := range definition.ColumnNames {
+			columns[i] = resultColumn{Name: name, DataSourceID: dataSourceID, TableName: tableName, ColumnName: name}
+		}
+		return columns, nil
+
+	case models.ViewTypeVirtualView:
+		var definitionJSON string
+		if err := db.QueryRow("SELECT definition FROM virtual_views WHERE id = ?", viewID).Scan(&definitionJSON); err != nil {
+			return nil, fmt.Errorf("failed to get virtual view definition: %w", err)
+		}
+		var definition models.VirtualViewDefinition
+		if err := json.Unmarshal([]byte(definitionJSON), &definition); err != nil {
+			return nil, fmt.Errorf("failed to parse virtual view definition: %w", err)
+		}
+		columns := []resultColumn{}
+		for _, selected := range definition.SelectedColumns {
+			var c resultColumn
+			err := db.QueryRow("SELECT data_source_id, table_name, column_name FROM data_source_schemas WHERE id = ?", selected.DataSourceSchemaID).
+				Scan(&c.DataSourceID, &c.TableName, &c.ColumnName)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get virtual view column: %w", err)
+			}
+			c.Name = c.TableName + "." + c.ColumnName
+			columns = append(columns, c)
+		}
+		return columns, nil
+	}
+
+	_, err := viewTable(viewType)
+	return nil, err
+}
+
+// authorizePolicyTarget checks that userID may manage masking policies on a data source column
+// (MANAGE on the data source) or a view column (EDIT on the view).
+func (ms *MaskingService) authorizePolicyTarget(dataSourceSchemaID, viewType, viewID, userID string) error {
+	if dataSourceSchemaID != "" {
+		var dataSourceID string
+		err := ms.metaDB.QueryRow("SELECT data_source_id FROM data_source_schemas WHERE id = ?", dataSourceSchemaID).Scan(&dataSourceID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("data source column not found")
+			}
+			return fmt.Errorf("failed to look up data source column: %w", err)
+		}
+		allowed, err := ms.privilegeService.HasPrivilege(dataSourceID, userID, models.PrivilegeManage)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrPrivilegeDenied
+		}
+		return nil
+	}
+
+	_, err := requireViewAccess(ms.metaDB, viewType, viewID, userID, models.ViewAccessEdit)
+	return err
+}
+
+// SetPolicy creates a masking policy, or replaces the one already set on the same column.
+func (ms *MaskingService) SetPolicy(input models.SetMaskingPolicyInput) (*models.MaskingPolicy, error) {
+	input.MaskType = strings.ToUpper(input.MaskType)
+	if _, ok := maskStrictness[input.MaskType]; !ok {
+		return nil, fmt.Errorf("invalid mask type '%s' (expected PARTIAL, TOKENIZE, HASH or REDACT)", input.MaskType)
+	}
+	if input.ExemptRoles == nil {
+		input.ExemptRoles = []string{}
+	}
+	if err := validateRoleNames(ms.metaDB, input.ExemptRoles); err != nil {
+		return nil, err
+	}
+
+	if err := ms.authorizePolicyTarget(input.DataSourceSchemaID, input.ViewType, input.ViewID, input.UserID); err != nil {
+		return nil, err
+	}
+
+	policy := &models.MaskingPolicy{
+		MaskType:        input.MaskType,
+		ExemptRoles:     input.ExemptRoles,
+		CreatedByUserID: &input.UserID,
+		CreatedAt:       time.Now().UTC(),
+	}
+
+	var existingID string
+	var err error
+	if input.DataSourceSchemaID != "" {
+		err = ms.metaDB.QueryRow("SELECT table_name, column_name FROM data_source_schemas WHERE id = ?", input.DataSourceSchemaID).
+			Scan(&policy.TableName, &policy.ColumnName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up data source column: %w", err)
+		}
+		policy.DataSourceSchemaID = &input.DataSourceSchemaID
+		err = ms.metaDB.QueryRow("SELECT id FROM column_masking_policies WHERE data_source_schema_id = ?", input.DataSourceSchemaID).Scan(&existingID)
+	} else {
+		var columns []resultColumn
+		columns, err = viewResultColumns(ms.metaDB, input.ViewType, input.ViewID)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, c := range columns {
+			if strings.EqualFold(c.Name, input.ColumnName) {
+				policy.ColumnName = c.Name
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column '%s' is not part of the view", input.ColumnName)
+		}
+		policy.ViewType = &input.ViewType
+		policy.ViewID = &input.ViewID
+		err = ms.metaDB.QueryRow(
+			"SELECT id FROM column_masking_policies WHERE view_type = ? AND view_id = ? AND column_name = ?",
+			input.ViewType, input.ViewID, policy.ColumnName,
+		).Scan(&existingID)
+	}
+
+	exemptRolesJSON, jsonErr := json.Marshal(input.ExemptRoles)
+	if jsonErr != nil {
+		return nil, fmt.Errorf("failed to encode exempt roles: %w", jsonErr)
+	}
+
+	switch {
+	case err == sql.ErrNoRows:
+		policy.ID = uuid.NewString()
+		var columnName interface{}
+		if policy.ViewID != nil {
+			columnName = policy.ColumnName
+		}
+		_, err = ms.metaDB.Exec(`
+			INSERT INTO column_masking_policies (id, data_source_schema_id, view_type, view_id, column_name, mask_type, exempt_roles, created_by_user_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, policy.ID, policy.DataSourceSchemaID, policy.ViewType, policy.ViewID, columnName, policy.MaskType, string(exemptRolesJSON), input.UserID, policy.CreatedAt)
+	case err == nil:
+		policy.ID = existingID
+		_, err = ms.metaDB.Exec(
+			"UPDATE column_masking_policies SET mask_type = ?, exempt_roles = ?, created_by_user_id = ?, created_at = ? WHERE id = ?",
+			policy.MaskType, string(exemptRolesJSON), input.UserID, policy.CreatedAt, existingID,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save masking policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// DeletePolicy removes a masking policy. The caller needs the same rights as to set it.
+func (ms *MaskingService) DeletePolicy(policyID, userID string) error {
+	var dataSourceSchemaID, viewType, viewID sql.NullString
+	err := ms.metaDB.QueryRow("SELECT data_source_schema_id, view_type, view_id FROM column_masking_policies WHERE id = ?", policyID).
+		Scan(&dataSourceSchemaID, &viewType, &viewID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("masking policy not found")
+		}
+		return fmt.Errorf("failed to look up masking policy: %w", err)
+	}
+
+	if err = ms.authorizePolicyTarget(dataSourceSchemaID.String, viewType.String, viewID.String, userID); err != nil {
+		return err
+	}
+
+	if _, err = ms.metaDB.Exec("DELETE FROM column_masking_policies WHERE id = ?", policyID); err != nil {
+		return fmt.Errorf("failed to delete masking policy: %w", err)
+	}
+	return nil
+}
+
+// ListPolicies returns the masking policies on a data source's columns (when dataSourceID is set)
+// or on a view's columns. The caller must be able to read the data source or the view.
+func (ms *MaskingService) ListPolicies(dataSourceID, viewType, viewID, userID string) ([]models.MaskingPolicy, error) {
+	var query string
+	var args []interface{}
+	if dataSourceID != "" {
+		allowed, err := ms.privilegeService.HasPrivilege(dataSourceID, userID, models.PrivilegeRead)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fmt.Errorf("data source not found or access denied")
+		}
+		query = `
+			SELECT p.id, p.data_source_schema_id, p.view_type, p.view_id, s.table_name, s.column_name, p.mask_type, p.exempt_roles, p.created_by_user_id, p.created_at
+			FROM column_masking_policies p
+			JOIN data_source_schemas s ON s.id = p.data_source_schema_id
+			WHERE s.data_source_id = ?
+			ORDER BY s.table_name, s.column_name`
+		args = []interface{}{dataSourceID}
+	} else {
+		if _, err := requireViewAccess(ms.metaDB, viewType, viewID, userID, models.ViewAccessView); err != nil {
+			return nil, err
+		}
+		query = `
+			SELECT id, data_source_schema_id, view_type, view_id, '', column_name, mask_type, exempt_roles, created_by_user_id, created_at
+			FROM column_masking_policies
+			WHERE view_type = ? AND view_id = ?
+			ORDER BY column_name`
+		args = []interface{}{viewType, viewID}
+	}
+
+	rows, err := ms.metaDB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query masking policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []models.MaskingPolicy{}
+	for rows.Next() {
+		var p models.MaskingPolicy
+		var dataSourceSchemaID, policyViewType, policyViewID, createdBy sql.NullString
+		var exemptRolesJSON string
+		err = rows.Scan(&p.ID, &dataSourceSchemaID, &policyViewType, &policyViewID, &p.TableName, &p.ColumnName,
+			&p.MaskType, &exemptRolesJSON, &createdBy, &p.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan masking policy: %w", err)
+		}
+		if dataSourceSchemaID.Valid {
+			p.DataSourceSchemaID = &dataSourceSchemaID.String
+		}
+		if policyViewType.Valid {
+			p.ViewType = &policyViewType.String
+		}
+		if policyViewID.Valid {
+			p.ViewID = &policyViewID.String
+		}
+		if createdBy.Valid {
+			p.CreatedByUserID = &createdBy.String
+		}
+		if err = json.Unmarshal([]byte(exemptRolesJSON), &p.ExemptRoles); err != nil {
+			return nil, fmt.Errorf("failed to parse masking policy exempt roles: %w", err)
+		}
+		policies = append(policies, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating masking policy rows: %w", err)
+	}
+
+	return policies, nil
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"regexp"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestPartialMask(t *testing.T) {
+	tests := map[string]string{
+		"4111111111111111":  "************1111",
+		"1234":              "****",
+		"":                  "",
+		"alice@example.com": "a****@example.com",
+		"zoë-müller":        "******ller",
+	}
+	for in, want := range tests {
+		if got := partialMask(in); got != want {
+			t.Errorf("partialMask(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	secret := []byte("secret")
+	in := "AB-1234-cd"
+	token := tokenize(secret, in)
+	if !regexp.MustCompile(`^[A-Z]{2}-[0-9]{4}-[a-z]{2}$`).MatchString(token) {
+		t.Errorf("tokenize(%q) = %q, want the same shape", in, token)
+	}
+	if token == in {
+		t.Errorf("tokenize(%q) returned the value unchanged", in)
+	}
+	if again := tokenize(secret, in); again != token {
+		t.Errorf("tokenize is not deterministic: %q, then %q", token, again)
+	}
+	if other := tokenize([]byte("other"), in); other == token {
+		t.Errorf("tokenize gave %q under two different secrets", token)
+	}
+}
+
+func TestColumnMasker(t *testing.T) {
+	db := metadatatest.NewDB(t)
+	owner := metadatatest.InsertUser(t, db, "owner", "password")
+	admin := metadatatest.InsertUser(t, db, "admin", "password")
+	ds := metadatatest.InsertDataSource(t, db, owner, "hr")
+	_, err := db.Exec("INSERT INTO user_roles (user_id, role_id) SELECT ?, id FROM roles WHERE role_name = ?", admin, models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+
+	columnIDs := map[string]string{}
+	for _, column := range []string{"region", "email", "ssn"} {
+		columnIDs[column] = uuid.NewString()
+		_, err = db.Exec("INSERT INTO data_source_schemas (id, data_source_id, table_name, column_name, column_type) VALUES (?, ?, 'employees', ?, 'text')",
+			columnIDs[column], ds, column)
+		if err != nil {
+			t.Fatalf("insert column: %v", err)
+		}
+	}
+	viewID := uuid.NewString()
+	_, err = db.Exec(`INSERT INTO virtual_base_views (id, user_id, name, data_source_id, table_name, selected_columns)
+		VALUES (?, ?, 'staff', ?, 'employees', '{"column_names":["region","email","ssn"]}')`, viewID, owner, ds)
+	if err != nil {
+		t.Fatalf("insert view: %v", err)
+	}
+
+	ms := NewMaskingService(db)
+	policies := []models.SetMaskingPolicyInput{
+		{DataSourceSchemaID: columnIDs["ssn"], MaskType: models.MaskRedact, ExemptRoles: []string{models.RoleAdmin}},
+		{DataSourceSchemaID: columnIDs["email"], MaskType: "partial"},
+		// The view policy is stricter than the data source policy on the same column, so it wins
+		{ViewType: models.ViewTypeVirtualBaseView, ViewID: viewID, ColumnName: "EMAIL", MaskType: models.MaskHash},
+	}
+	for _, policy := range policies {
+		policy.UserID = owner
+		if _, err = ms.SetPolicy(policy); err != nil {
+			t.Fatalf("SetPolicy(%+v): %v", policy, err)
+		}
+	}
+	if _, err = ms.SetPolicy(models.SetMaskingPolicyInput{UserID: owner, DataSourceSchemaID: columnIDs["region"], MaskType: "BLUR"}); err == nil {
+		t.Error("SetPolicy accepted an unknown mask type")
+	}
+	if _, err = ms.SetPolicy(models.SetMaskingPolicyInput{UserID: admin, DataSourceSchemaID: columnIDs["region"], MaskType: models.MaskRedact}); err == nil {
+		t.Error("SetPolicy succeeded without MANAGE on the data source")
+	}
+
+	columns, err := viewResultColumns(db, models.ViewTypeVirtualBaseView, viewID)
+	if err != nil {
+		t.Fatalf("viewResultColumns: %v", err)
+	}
+	masked := func(userID string) []interface{} {
+		t.Helper()
+		masker, err := columnMasker(db, models.ViewTypeVirtualBaseView, viewID, userID, columns)
+		if err != nil {
+			t.Fatalf("columnMasker: %v", err)
+		}
+		return []interface{}{masker.apply(0, "EU"), masker.apply(1, "alice@example.com"), masker.apply(2, []byte("123-45-6789")), masker.apply(2, nil)}
+	}
+
+	row := masked(owner)
+	if row[0] != "EU" || row[2] != redactedValue || row[3] != nil {
+		t.Errorf("masked row = %v, want region unmasked, ssn redacted and NULL kept", row)
+	}
+	hash, _ := row[1].(string)
+	if !regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString(hash) {
+		t.Errorf("email = %v, want a hex HASH", row[1])
+	}
+	if again := masked(owner)[1]; again != hash {
+		t.Errorf("hashing is not deterministic: %v, then %v", hash, again)
+	}
+
+	// Exempt roles skip the policy; the e-mail policies have none
+	row = masked(admin)
+	if row[1] != hash || string(row[2].([]byte)) != "123-45-6789" {
+		t.Errorf("admin's row = %v, want the e-mail hashed and ssn unmasked", row)
+	}
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/models"
+)
+
+// OwnershipService moves everything a user owns to another user, e.g. before the user is deleted.
+type OwnershipService struct {
+	metaDB *sql.DB
+}
+
+// NewOwnershipService creates a new OwnershipService
+func NewOwnershipService(metaDB *sql.DB) *OwnershipService {
+	return &OwnershipService{metaDB: metaDB}
+}
+
+// ReassignOwnedResources makes toUserID the owner of every data source and view fromUserID owns,
+// and returns how many of each were moved, keyed by table. Privileges and shares the new owner
+// held on them become redundant and are removed. Everything is moved or nothing is; it fails
+// early if the new owner already has a view with the same name as one being moved.
+func (ows *OwnershipService) ReassignOwnedResources(fromUserID, toUserID string) (map[string]int, error) {
+	if fromUserID == toUserID {
+		return nil, fmt.Errorf("cannot reassign resources to the same user")
+	}
+	var exists int
+	if err := ows.metaDB.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", toUserID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to look up new owner: %w", err)
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("new owner not found")
+	}
+
+	viewTables := []string{"virtual_views", "virtual_base_views"}
+	for _, table := range viewTables {
+		if err := ows.checkNameConflicts(table, fromUserID, toUserID); err != nil {
+			return nil, err
+		}
+	}
+
+	change, err := metadata.BeginChange(ows.metaDB)
+	if err != nil {
+		return nil, err
+	}
+	defer change.Rollback()
+
+	now := time.Now().UTC()
+	moved := map[string]int{}
+	changes := map[string]interface{}{"user_id": toUserID, "updated_at": now}
+	for _, table := range append([]string{"data_sources"}, viewTables...) {
+		count, err := change.ReplaceRows(table, "user_id = ?", []interface{}{fromUserID}, changes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reassign %s: %w", table, err)
+		}
+		moved[table] = count
+	}
+
+	// The new owner implicitly has every privilege on its data sources and full access to its views
+	_, err = change.Delete("user_datasource_privileges",
+		"user_id = ? AND data_source_id IN (SELECT id FROM data_sources WHERE user_id = ?)",
+		toUserID, toUserID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean up data source privileges: %w", err)
+	}
+	for viewType, table := range map[string]string{models.ViewTypeVirtualView: "virtual_views", models.ViewTypeVirtualBaseView: "virtual_base_views"} {
+		_, err = change.Delete("view_shares",
+			fmt.Sprintf("view_type = ? AND grantee_type = ? AND grantee_id = ? AND view_id IN (SELECT id FROM %s WHERE user_id = ?)", table),
+			viewType, models.GranteeTypeUser, toUserID, toUserID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to clean up view shares: %w", err)
+		}
+	}
+	if err = change.Commit(); err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// checkNameConflicts fails if both users own a view with the same name in table, since view names
+// are unique per owner.
+func (ows *OwnershipService) checkNameConflicts(table, fromUserID, toUserID string) error {
+	rows, err := ows.metaDB.Query(
+		fmt.Sprintf("SELECT name FROM %s WHERE user_id = ? AND name IN (SELECT name FROM %s WHERE user_id = ?) ORDER BY name", table, table),
+		fromUserID, toUserID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check view names: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan view name: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating view names: %w", err)
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("the new owner already has views named %s; rename them first", strings.Join(names, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrPrivilegeDenied is returned when the caller lacks the privilege required for an operation.
+var ErrPrivilegeDenied = errors.New("insufficient privileges on data source")
+
+// PrivilegeService manages per-user privileges on data sources (user_datasource_privileges).
+type PrivilegeService struct {
+	metaDB *sql.DB
+}
+
+// NewPrivilegeService creates a new PrivilegeService
+func NewPrivilegeService(metaDB *sql.DB) *PrivilegeService {
+	return &PrivilegeService{metaDB: metaDB}
+}
+
+// satisfyingPrivileges returns the privilege types that include the required one.
+func satisfyingPrivileges(required string) []string {
+	switch required {
+	case models.PrivilegeRead:
+		return []string{models.PrivilegeRead, models.PrivilegeQuery, models.PrivilegeManage}
+	case models.PrivilegeQuery:
+		return []string{models.PrivilegeQuery, models.PrivilegeManage}
+	default:
+		return []string{models.PrivilegeManage}
+	}
+}
+
+// isValidPrivilege reports whether privilegeType is one of the known privilege types.
+func isValidPrivilege(privilegeType string) bool {
+	switch privilegeType {
+	case models.PrivilegeRead, models.PrivilegeQuery, models.PrivilegeManage:
+		return true
+	}
+	return false
+}
+
+// dataSourceAccessCondition returns a SQL condition, and its arguments, matching data sources
+// (referenced through idColumn/ownerColumn) that userID owns or holds an unexpired privilege
+// including the required one on.
+func dataSourceAccessCondition(idColumn, ownerColumn, userID, required string) (string, []interface{}) {
+	privileges := satisfyingPrivileges(required)
+	placeholders := make([]string, len(privileges))
+	args := []interface{}{userID, userID}
+	for i, p := range privileges {
+		placeholders[i] = "?"
+		args = append(args, p)
+	}
+	args = append(args, time.Now().UTC())
+
+	condition := fmt.Sprintf(`(%s = ? OR %s IN (
+		SELECT data_source_id FROM user_datasource_privileges
+		WHERE user_id = ? AND privilege_type IN (%s) AND (expires_at IS NULL OR expires_at > ?)
+	))`, ownerColumn, idColumn, strings.Join(placeholders, ","))
+	return condition, args
+}
+
+// HasPrivilege reports whether userID owns the data source or holds an unexpired privilege including the required one.
+func (ps *PrivilegeService) HasPrivilege(dataSourceID, userID, required string) (bool, error) {
+	condition, args := dataSourceAccessCondition("id", "user_id", userID, required)
+	var count int
+	err := ps.metaDB.QueryRow("SELECT COUNT(*) FROM data_sources WHERE id = ? AND "+condition, append([]interface{}{dataSourceID}, args...)...).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check data source privilege: %w", err)
+	}
+	return count > 0, nil
+}
+
+// grantAuthority describes what a grantor may hand out on a data source.
+type grantAuthority struct {
+	allowed  bool       // The grantor may grant the privilege
+	manage   bool       // The grantor owns the data source or holds MANAGE
+	notAfter *time.Time // Latest expiry the grantor may set; nil without limit
+}
+
+// canGrant reports what grantorID may grant of privilegeType on a data source.
+// Owners and MANAGE holders may grant anything, including can_grant; other users only what they
+// hold with can_grant, and no longer than they hold it themselves.
+func (ps *PrivilegeService) canGrant(dataSourceID, grantorID, privilegeType string) (grantAuthority, error) {
+	manage, err := ps.HasPrivilege(dataSourceID, grantorID, models.PrivilegeManage)
+	if err != nil {
+		return grantAuthority{}, err
+	}
+	if manage {
+		return grantAuthority{allowed: true, manage: true}, nil
+	}
+
+	privileges := satisfyingPrivileges(privilegeType)
+	placeholders := make([]string, len(privileges))
+	args := []interface{}{dataSourceID, grantorID}
+	for i, p := range privileges {
+		placeholders[i] = "?"
+		args = append(args, p)
+	}
+	args = append(args, time.Now().UTC())
+
+	var expiresAt sql.NullTime
+	err = ps.metaDB.QueryRow(fmt.Sprintf(`
+		SELECT expires_at FROM user_datasource_privileges
+		WHERE data_source_id = ? AND user_id = ? AND can_grant = TRUE AND privilege_type IN (%s)
+		  AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY expires_at DESC NULLS FIRST
+		LIMIT 1
+	`, strings.Join(placeholders, ",")), args...).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return grantAuthority{}, nil
+	}
+	if err != nil {
+		return grantAuthority{}, fmt.Errorf("failed to check grant option: %w", err)
+	}
+	authority := grantAuthority{allowed: true}
+	if expiresAt.Valid {
+		authority.notAfter = &expiresAt.Time
+	}
+	return authority, nil
+}
+
+// GrantPrivilege grants (or updates) a privilege on a data source to another user. Grantors
+// without MANAGE may not grant to themselves, grant beyond their own expiry or change grants made
+// by someone else.
+func (ps *PrivilegeService) GrantPrivilege(input models.GrantDataSourcePrivilegeInput) (*models.DataSourcePrivilege, error) {
+	input.PrivilegeType = strings.ToUpper(input.PrivilegeType)
+	if !isValidPrivilege(input.PrivilegeType) {
+		return nil, fmt.Errorf("invalid privilege type '%s' (expected READ, QUERY or MANAGE)", input.PrivilegeType)
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	granteeID := input.UserID
+	if granteeID == "" {
+		err := ps.metaDB.QueryRow("SELECT id FROM users WHERE username = ?", input.Username).Scan(&granteeID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("user '%s' not found", input.Username)
+			}
+			return nil, fmt.Errorf("failed to look up user: %w", err)
+		}
+	}
+
+	var ownerID string
+	err := ps.metaDB.QueryRow("SELECT user_id FROM data_sources WHERE id = ?", input.DataSourceID).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("data source not found or access denied")
+		}
+		return nil, fmt.Errorf("failed to look up data source: %w", err)
+	}
+	if ownerID == granteeID {
+		return nil, fmt.Errorf("the owner already has all privileges on this data source")
+	}
+	if err = requireUnmanaged(ps.metaDB, models.ManagedDataSource, input.DataSourceID); err != nil {
+		return nil, err
+	}
+
+	authority, err := ps.canGrant(input.DataSourceID, input.GrantorUserID, input.PrivilegeType)
+	if err != nil {
+		return nil, err
+	}
+	if !authority.allowed || (input.CanGrant && !authority.manage) {
+		return nil, ErrPrivilegeDenied
+	}
+	if !authority.manage && granteeID == input.GrantorUserID {
+		return nil, ErrPrivilegeDenied
+	}
+	if authority.notAfter != nil && (input.ExpiresAt == nil || input.ExpiresAt.After(*authority.notAfter)) {
+		input.ExpiresAt = authority.notAfter
+	}
+
+	now := time.Now().UTC()
+	privilege := &models.DataSourcePrivilege{
+		UserID:          granteeID,
+		DataSourceID:    input.DataSourceID,
+		PrivilegeType:   input.PrivilegeType,
+		CanGrant:        input.CanGrant,
+		GrantedByUserID: &input.GrantorUserID,
+		GrantedAt:       now,
+		ExpiresAt:       input.ExpiresAt,
+	}
+
+	var existingID string
+	var existingGrantor sql.NullString
+	err = ps.metaDB.QueryRow(
+		"SELECT id, granted_by_user_id FROM user_datasource_privileges WHERE user_id = ? AND data_source_id = ? AND privilege_type = ?",
+		granteeID, input.DataSourceID, input.PrivilegeType,
+	).Scan(&existingID, &existingGrantor)
+	if err == nil && !authority.manage && existingGrantor.String != input.GrantorUserID {
+		return nil, ErrPrivilegeDenied
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		privilege.ID = uuid.NewString()
+		_, err = ps.metaDB.Exec(`
+			INSERT INTO user_datasource_privileges (id, user_id, data_source_id, privilege_type, can_grant, granted_by_user_id, granted_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, privilege.ID, privilege.UserID, privilege.DataSourceID, privilege.PrivilegeType, privilege.CanGrant, input.GrantorUserID, now, input.ExpiresAt)
+	case err == nil:
+		privilege.ID = existingID
+		err = metadata.ReplaceRow(ps.metaDB, "user_datasource_privileges", existingID, map[string]interface{}{
+			"can_grant": privilege.CanGrant, "granted_by_user_id": input.GrantorUserID, "granted_at": now, "expires_at": input.ExpiresAt,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save data source privilege: %w", err)
+	}
+
+	return privilege, nil
+}
+
+// RevokePrivilege removes a privilege from a user. Owners and MANAGE holders may revoke any
+// privilege; other users only the ones they granted themselves.
+func (ps *PrivilegeService) RevokePrivilege(dataSourceID, granteeID, privilegeType, revokerID string) error {
+	privilegeType = strings.ToUpper(privilegeType)
+
+	var grantedBy sql.NullString
+	err := ps.metaDB.QueryRow(
+		"SELECT granted_by_user_id FROM user_datasource_privileges WHERE user_id = ? AND data_source_id = ? AND privilege_type = ?",
+		granteeID, dataSourceID, privilegeType,
+	).Scan(&grantedBy)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("privilege not found")
+		}
+		return fmt.Errorf("failed to look up privilege: %w", err)
+	}
+
+	manage, err := ps.HasPrivilege(dataSourceID, revokerID, models.PrivilegeManage)
+	if err != nil {
+		return err
+	}
+	if !manage && !(grantedBy.Valid && grantedBy.String == revokerID) {
+		return ErrPrivilegeDenied
+	}
+	if err = requireUnmanaged(ps.metaDB, models.ManagedDataSource, dataSourceID); err != nil {
+		return err
+	}
+
+	_, err = ps.metaDB.Exec(
+		"DELETE FROM user_datasource_privileges WHERE user_id = ? AND data_source_id = ? AND privilege_type = ?",
+		granteeID, dataSourceID, privilegeType,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke privilege: %w", err)
+	}
+	return nil
+}
+
+// ListPrivileges returns all privileges granted on a data source, including expired ones.
+// The caller must be able to read the data source.
+func (ps *PrivilegeService) ListPrivileges(dataSourceID, userID string) ([]models.DataSourcePrivilege, error) {
+	allowed, err := ps.HasPrivilege(dataSourceID, userID, models.PrivilegeRead)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("data source not found or access denied")
+	}
+
+	rows, err := ps.metaDB.Query(`
+		SELECT p.id, p.user_id, u.username, p.data_source_id, p.privilege_type, p.can_grant, p.granted_by_user_id, p.granted_at, p.expires_at
+		FROM user_datasource_privileges p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.data_source_id = ?
+		ORDER BY u.username, p.privilege_type
+	`, dataSourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query data source privileges: %w", err)
+	}
+	defer rows.Close()
+
+	privileges := []models.DataSourcePrivilege{}
+	for rows.Next() {
+		var p models.DataSourcePrivilege
+		var grantedBy sql.NullString
+		var expiresAt sql.NullTime
+		err = rows.Scan(&p.ID, &p.UserID, &p.Username, &p.DataSourceID, &p.PrivilegeType, &p.CanGrant, &grantedBy, &p.GrantedAt, &expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan data source privilege: %w", err)
+		}
+		if grantedBy.Valid {
+			p.GrantedByUserID = &grantedBy.String
+		}
+		if expiresAt.Valid {
+			p.ExpiresAt = &expiresAt.Time
+		}
+		privileges = append(privileges, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating privilege rows: %w", err)
+	}
+
+	return privileges, nil
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+)
+
+func TestGrantPrivilegeLimitsDelegatedGrants(t *testing.T) {
+	db := metadatatest.NewDB(t)
+	ps := NewPrivilegeService(db)
+	owner := metadatatest.InsertUser(t, db, "owner", "password")
+	alice := metadatatest.InsertUser(t, db, "alice", "password")
+	bob := metadatatest.InsertUser(t, db, "bob", "password")
+	carol := metadatatest.InsertUser(t, db, "carol", "password")
+	ds := metadatatest.InsertDataSource(t, db, owner, "sales")
+
+	aliceExpiry := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	grant := func(grantor, grantee, privilege string, canGrant bool, expiresAt *time.Time) (*models.DataSourcePrivilege, error) {
+		return ps.GrantPrivilege(models.GrantDataSourcePrivilegeInput{
+			DataSourceID: ds, UserID: grantee, PrivilegeType: privilege,
+			CanGrant: canGrant, ExpiresAt: expiresAt, GrantorUserID: grantor,
+		})
+	}
+
+	if _, err := grant(owner, alice, models.PrivilegeQuery, true, &aliceExpiry); err != nil {
+		t.Fatalf("owner grant: %v", err)
+	}
+	for i := 0; i < 2; i++ { // The second grant updates the first
+		if _, err := grant(owner, carol, models.PrivilegeRead, false, nil); err != nil {
+			t.Fatalf("owner grant: %v", err)
+		}
+	}
+
+	if _, err := grant(alice, alice, models.PrivilegeRead, false, nil); !errors.Is(err, ErrPrivilegeDenied) {
+		t.Errorf("self-grant: got %v, want ErrPrivilegeDenied", err)
+	}
+	if _, err := grant(alice, bob, models.PrivilegeManage, false, nil); !errors.Is(err, ErrPrivilegeDenied) {
+		t.Errorf("grant beyond own privilege: got %v, want ErrPrivilegeDenied", err)
+	}
+	if _, err := grant(alice, bob, models.PrivilegeRead, true, nil); !errors.Is(err, ErrPrivilegeDenied) {
+		t.Errorf("delegating can_grant: got %v, want ErrPrivilegeDenied", err)
+	}
+	if _, err := grant(alice, carol, models.PrivilegeRead, false, nil); !errors.Is(err, ErrPrivilegeDenied) {
+		t.Errorf("updating the owner's grant: got %v, want ErrPrivilegeDenied", err)
+	}
+
+	later := aliceExpiry.Add(30 * 24 * time.Hour)
+	for _, expiresAt := range []*time.Time{nil, &later} {
+		privilege, err := grant(alice, bob, models.PrivilegeRead, false, expiresAt)
+		if err != nil {
+			t.Fatalf("delegated grant: %v", err)
+		}
+		if privilege.ExpiresAt == nil || !privilege.ExpiresAt.Equal(aliceExpiry) {
+			t.Errorf("delegated grant with expires_at %v expires at %v, want %v", expiresAt, privilege.ExpiresAt, aliceExpiry)
+		}
+	}
+
+	sooner := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	privilege, err := grant(alice, bob, models.PrivilegeRead, false, &sooner)
+	if err != nil {
+		t.Fatalf("delegated grant: %v", err)
+	}
+	if !privilege.ExpiresAt.Equal(sooner) {
+		t.Errorf("delegated grant expires at %v, want %v", privilege.ExpiresAt, sooner)
+	}
+}
@@ -0,0 +1,1386 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// reconcilePlan is a plan being computed: the changes, and the writes that make them.
+type reconcilePlan struct {
+	models.ReconcilePlan
+	steps   []func(tx *sql.Tx) error // Writes of the main transaction
+	deletes []func(tx *sql.Tx) error // Deletes of rows whose dependents the main transaction deletes
+	now     time.Time
+	ownerID string
+	managed map[string]map[string]string // Object type -> object ID -> manifest
+
+	targets        map[string]*bundleTarget     // Data source name -> data source views resolve to
+	declared       map[string]string            // Data source name -> ID, for data sources in the manifests
+	views          map[string]map[string]string // View type -> name -> ID, for views in the manifests
+	roles          map[string]string            // Role name -> ID, for roles in the manifests
+	rewritten      map[string]bool              // Managed views the plan redefines or deletes
+	removedColumns []removedColumn
+	prunedSources  map[string]string // ID -> name of data sources the plan deletes
+}
+
+// removedColumn is a column of a managed data source that is no longer in its manifest.
+type removedColumn struct {
+	id, dataSource, table, column, path string
+}
+
+func (p *reconcilePlan) errorf(format string, args ...interface{}) {
+	p.Errors = append(p.Errors, fmt.Sprintf(format, args...))
+}
+
+func (p *reconcilePlan) change(kind, name, id, action, manifest string, diff []string) {
+	p.Changes = append(p.Changes, models.ReconcileChange{Kind: kind, Name: name, ID: id, Action: action, Manifest: manifest, Diff: diff})
+}
+
+// exec adds a statement to the main transaction; what describes it in errors.
+func (p *reconcilePlan) exec(what, query string, args ...interface{}) {
+	p.steps = append(p.steps, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to %s: %w", what, err)
+		}
+		return nil
+	})
+}
+
+// execLater adds a statement to the second transaction.
+func (p *reconcilePlan) execLater(what, query string, args ...interface{}) {
+	p.deletes = append(p.deletes, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to %s: %w", what, err)
+		}
+		return nil
+	})
+}
+
+// mark records an object as managed by manifest.
+func (p *reconcilePlan) mark(objectType, objectID, manifest string) {
+	if _, ok := p.managed[objectType][objectID]; ok {
+		p.exec("record managed "+objectType, "UPDATE managed_objects SET manifest = ?, reconciled_at = ? WHERE object_type = ? AND object_id = ?",
+			manifest, p.now, objectType, objectID)
+		return
+	}
+	p.exec("record managed "+objectType, "INSERT INTO managed_objects (object_type, object_id, manifest, reconciled_at) VALUES (?, ?, ?, ?)",
+		objectType, objectID, manifest, p.now)
+}
+
+// unmark stops managing an object.
+func (p *reconcilePlan) unmark(objectType, objectID string) {
+	p.exec("release managed "+objectType, "DELETE FROM managed_objects WHERE object_type = ? AND object_id = ?", objectType, objectID)
+}
+
+// matchExisting picks the existing object a manifest object stands for among those with its name:
+// the managed one or, failing that, an unmanaged one to adopt. Conflicts are reported as errors.
+func (p *reconcilePlan) matchExisting(kind, name, file string, candidates []string, adopt bool) (string, string, bool) {
+	var unmanaged []string
+	for _, id := range candidates {
+		if _, ok := p.managed[kind][id]; ok {
+			return id, models.ReconcileUpdate, true
+		}
+		unmanaged = append(unmanaged, id)
+	}
+	switch {
+	case len(unmanaged) == 0:
+		return "", models.ReconcileCreate, true
+	case len(unmanaged) > 1:
+		p.errorf("%s: %d existing objects of type %s are named '%s'; rename all but one", file, len(unmanaged), kind, name)
+		return "", "", false
+	case !adopt:
+		p.errorf("%s: %s '%s' already exists and is not managed; rename it, or set BRIDGO_GITOPS_ADOPT=true to take it over", file, kind, name)
+		return "", "", false
+	}
+	return unmanaged[0], models.ReconcileAdopt, true
+}
+
+// finish records a change to an existing object if it differs from its manifest, and reports
+// whether it does. Moving an object to another manifest file is a change too.
+func (p *reconcilePlan) finish(kind, name, id, action, file string, diff []string) bool {
+	if action == models.ReconcileUpdate {
+		if previous := p.managed[kind][id]; previous != file {
+			diff = append(diff, fmt.Sprintf("manifest: %s -> %s", previous, file))
+		}
+		if len(diff) == 0 {
+			p.Unchanged++
+			return false
+		}
+	}
+	p.change(kind, name, id, action, file, diff)
+	return true
+}
+
+// diffField appends a line to diff if current and desired differ.
+func diffField(diff []string, name, current, desired string) []string {
+	if current != desired {
+		return append(diff, fmt.Sprintf("%s: %q -> %q", name, current, desired))
+	}
+	return diff
+}
+
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// queryIDs returns the first column of the rows of a query.
+func queryIDs(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// plan reads the manifests and the metadata and computes the plan.
+func (rs *ReconcileService) plan() (*reconcilePlan, error) {
+	if !rs.cfg.Enabled() {
+		return nil, errors.New("declarative configuration is disabled; set BRIDGO_GITOPS_DIR")
+	}
+	p := &reconcilePlan{
+		ReconcilePlan: models.ReconcilePlan{Changes: []models.ReconcileChange{}},
+		now:           time.Now().UTC(),
+		managed:       map[string]map[string]string{},
+		targets:       map[string]*bundleTarget{},
+		declared:      map[string]string{},
+		views:         map[string]map[string]string{models.ViewTypeVirtualView: {}, models.ViewTypeVirtualBaseView: {}},
+		roles:         map[string]string{},
+		rewritten:     map[string]bool{},
+		prunedSources: map[string]string{},
+	}
+
+	err := rs.metaDB.QueryRow("SELECT id FROM users WHERE username = ?", rs.cfg.Owner).Scan(&p.ownerID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user '%s', the owner of declaratively configured objects, does not exist", rs.cfg.Owner)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up owner: %w", err)
+	}
+
+	manifests, err := rs.loadManifests(p)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := rs.metaDB.Query("SELECT object_type, object_id, manifest FROM managed_objects")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read managed objects: %w", err)
+	}
+	for rows.Next() {
+		var objectType, objectID, manifest string
+		if err = rows.Scan(&objectType, &objectID, &manifest); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan managed object: %w", err)
+		}
+		if p.managed[objectType] == nil {
+			p.managed[objectType] = map[string]string{}
+		}
+		p.managed[objectType][objectID] = manifest
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read managed objects: %w", err)
+	}
+
+	for _, step := range []func(*reconcilePlan, *manifestSet) error{
+		rs.planDataSources,
+		rs.planVirtualBaseViews,
+		rs.planVirtualViews,
+		rs.planRoles,
+		rs.planDataSourceGrants,
+		rs.planViewGrants,
+		rs.checkRemovedReferences,
+	} {
+		if err = step(p, manifests); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(p.Changes) > 0 {
+		// Grants deleted along with their view, data source or role are no longer managed
+		p.exec("clean up managed grants", "DELETE FROM managed_objects WHERE object_type = ? AND object_id NOT IN (SELECT id FROM user_datasource_privileges)", models.ManagedDataSourceGrant)
+		p.exec("clean up managed grants", "DELETE FROM managed_objects WHERE object_type = ? AND object_id NOT IN (SELECT id FROM view_shares)", models.ManagedViewGrant)
+	}
+	return p, nil
+}
+
+// sortedIDs returns the keys of a managed object map in a stable order.
+func sortedIDs(objects map[string]string) []string {
+	ids := make([]string, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// currentDataSource is a data source row as reconciliation compares it.
+type currentDataSource struct {
+	id, name, dbType                                                           string
+	host, database, username, password, sslMode, additionalParams, description sql.NullString
+	port                                                                       sql.NullInt64
+}
+
+// currentColumn is a data_source_schemas row as reconciliation compares it.
+type currentColumn struct {
+	id, table, column, columnType string
+	schema                        sql.NullString
+	nullable, primaryKey          sql.NullBool
+}
+
+// planDataSources plans the data sources of the manifests and prunes managed ones not in them.
+func (rs *ReconcileService) planDataSources(p *reconcilePlan, m *manifestSet) error {
+	rows, err := rs.metaDB.Query(`
+		SELECT id, source_name, db_type, host, port, database_name, db_username, password_encrypted, ssl_mode, additional_params, description
+		FROM data_sources
+		WHERE user_id = ? OR id IN (SELECT object_id FROM managed_objects WHERE object_type = ?)
+		ORDER BY created_at
+	`, p.ownerID, models.ManagedDataSource)
+	if err != nil {
+		return fmt.Errorf("failed to read data sources: %w", err)
+	}
+	byID := map[string]*currentDataSource{}
+	byName := map[string][]string{}
+	for rows.Next() {
+		ds := &currentDataSource{}
+		err = rows.Scan(&ds.id, &ds.name, &ds.dbType, &ds.host, &ds.port, &ds.database, &ds.username, &ds.password, &ds.sslMode, &ds.additionalParams, &ds.description)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan data source: %w", err)
+		}
+		byID[ds.id] = ds
+		byName[ds.name] = append(byName[ds.name], ds.id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to read data sources: %w", err)
+	}
+
+	desired := append([]models.BundleDataSource(nil), m.DataSources...)
+	sort.Slice(desired, func(i, j int) bool { return desired[i].Name < desired[j].Name })
+	seen := map[string]bool{}
+	for _, ds := range desired {
+		file := m.file(models.ManagedDataSource, ds.Name)
+		if ds.Name == "" || ds.DBType == "" {
+			p.errorf("%s: data sources need a name and a db_type", file)
+			continue
+		}
+		if err := (dataSourceConnection{DBType: ds.DBType, SSLMode: ds.SSLMode}).validate(); err != nil {
+			p.errorf("%s: %v", file, err)
+			continue
+		}
+		additionalParams, err := driverParamsColumn(ds.DBType, ds.AdditionalParams)
+		if err != nil {
+			p.errorf("%s: %v", file, err)
+			continue
+		}
+		id, action, ok := p.matchExisting(models.ManagedDataSource, ds.Name, file, byName[ds.Name], rs.cfg.Adopt)
+		if !ok {
+			continue
+		}
+		seen[id] = true
+
+		password := sql.NullString{}
+		if ds.PasswordEncrypted != "" {
+			if rs.cfg.SecretsKey == "" {
+				p.errorf("%s: data source '%s' has an encrypted password, but BRIDGO_GITOPS_SECRETS_KEY is not set", file, ds.Name)
+				continue
+			}
+			plaintext, err := decryptBundleSecret(ds.PasswordEncrypted, rs.cfg.SecretsKey)
+			if err != nil {
+				p.errorf("%s: data source '%s': %v", file, ds.Name, err)
+				continue
+			}
+			password = sql.NullString{String: plaintext, Valid: true}
+		}
+
+		current := map[string]currentColumn{}
+		if action != models.ReconcileCreate {
+			if current, err = rs.currentColumns(id); err != nil {
+				return err
+			}
+		} else {
+			id = uuid.NewString()
+		}
+		target := newBundleTarget(id)
+		p.targets[ds.Name] = target
+		p.declared[ds.Name] = id
+
+		var diff, added, changed []string
+		var newColumns []currentColumn
+		var changedColumns []currentColumn
+		for _, table := range ds.Tables {
+			schemaName := nullString(table.Schema)
+			for _, column := range table.Columns {
+				path := bundleColumnPath(schemaName, table.Name, column.Name)
+				desiredColumn := currentColumn{table: table.Name, column: column.Name, columnType: column.Type, schema: schemaName,
+					primaryKey: sql.NullBool{Bool: column.PrimaryKey, Valid: true}}
+				if column.Nullable != nil {
+					desiredColumn.nullable = sql.NullBool{Bool: *column.Nullable, Valid: true}
+				}
+				existing, ok := current[path]
+				if !ok {
+					desiredColumn.id = uuid.NewString()
+					newColumns = append(newColumns, desiredColumn)
+					added = append(added, "+ column "+path)
+				} else {
+					desiredColumn.id = existing.id
+					delete(current, path)
+					if existing.columnType != desiredColumn.columnType || existing.nullable != desiredColumn.nullable || existing.primaryKey.Bool != desiredColumn.primaryKey.Bool {
+						changedColumns = append(changedColumns, desiredColumn)
+						changed = append(changed, "~ column "+path)
+					}
+				}
+				target.addColumn(schemaName, table.Name, column.Name, desiredColumn.id)
+			}
+		}
+
+		var removed []string
+		for path, column := range current {
+			removed = append(removed, path)
+			p.removedColumns = append(p.removedColumns, removedColumn{id: column.id, dataSource: ds.Name, table: column.table, column: column.column, path: path})
+		}
+		sort.Strings(removed)
+
+		port := sql.NullInt64{Int64: int64(ds.Port), Valid: ds.Port != 0}
+		if action == models.ReconcileCreate {
+			diff = append(diff, fmt.Sprintf("%d table(s), %d column(s)", len(ds.Tables), len(newColumns)))
+		} else {
+			cur := byID[id]
+			diff = diffField(diff, "db_type", cur.dbType, ds.DBType)
+			diff = diffField(diff, "host", cur.host.String, ds.Host)
+			diff = diffField(diff, "port", fmt.Sprint(cur.port.Int64), fmt.Sprint(port.Int64))
+			diff = diffField(diff, "database", cur.database.String, ds.Database)
+			diff = diffField(diff, "username", cur.username.String, ds.Username)
+			diff = diffField(diff, "ssl_mode", cur.sslMode.String, ds.SSLMode)
+			diff = diffField(diff, "additional_params", cur.additionalParams.String, additionalParams.String)
+			diff = diffField(diff, "description", cur.description.String, ds.Description)
+			if password.Valid && password.String != cur.password.String {
+				diff = append(diff, "password: changed")
+			}
+			diff = append(diff, added...)
+			diff = append(diff, changed...)
+			for _, path := range removed {
+				diff = append(diff, "- column "+path)
+			}
+		}
+		if !p.finish(models.ManagedDataSource, ds.Name, id, action, file, diff) {
+			continue
+		}
+
+		if action == models.ReconcileCreate {
+			p.exec("create data source "+ds.Name, `
+				INSERT INTO data_sources (id, user_id, source_name, db_type, host, port, database_name, db_username, password_encrypted, ssl_mode, additional_params, description, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, id, p.ownerID, ds.Name, ds.DBType, nullString(ds.Host), port, nullString(ds.Database), nullString(ds.Username),
+				password, nullString(ds.SSLMode), additionalParams, nullString(ds.Description), p.now, p.now)
+		} else {
+			p.exec("update data source "+ds.Name, `
+				UPDATE data_sources SET db_type = ?, host = ?, port = ?, database_name = ?, db_username = ?, ssl_mode = ?, additional_params = ?, description = ?, updated_at = ?
+				WHERE id = ?
+			`, ds.DBType, nullString(ds.Host), port, nullString(ds.Database), nullString(ds.Username),
+				nullString(ds.SSLMode), additionalParams, nullString(ds.Description), p.now, id)
+			if password.Valid {
+				p.exec("update data source "+ds.Name, "UPDATE data_sources SET password_encrypted = ? WHERE id = ?", password, id)
+			}
+		}
+		for _, c := range newColumns {
+			p.exec("add column to data source "+ds.Name, `
+				INSERT INTO data_source_schemas (id, data_source_id, schema_name, table_name, column_name, column_type, is_nullable, is_primary_key, retrieved_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, c.id, id, c.schema, c.table, c.column, c.columnType, c.nullable, c.primaryKey, p.now)
+		}
+		for _, c := range changedColumns {
+			p.exec("update column of data source "+ds.Name, "UPDATE data_source_schemas SET column_type = ?, is_nullable = ?, is_primary_key = ?, retrieved_at = ? WHERE id = ?",
+				c.columnType, c.nullable, c.primaryKey, p.now, c.id)
+		}
+		for _, column := range p.removedColumns {
+			if column.dataSource != ds.Name {
+				continue
+			}
+			p.exec("remove column of data source "+ds.Name, "DELETE FROM column_masking_policies WHERE data_source_schema_id = ?", column.id)
+			p.exec("remove column of data source "+ds.Name, "DELETE FROM data_source_schemas WHERE id = ?", column.id)
+		}
+		p.mark(models.ManagedDataSource, id, file)
+	}
+
+	for _, id := range sortedIDs(p.managed[models.ManagedDataSource]) {
+		if seen[id] {
+			continue
+		}
+		ds, ok := byID[id]
+		if !ok {
+			p.unmark(models.ManagedDataSource, id) // Deleted outside reconciliation
+			continue
+		}
+		if !rs.cfg.Prune {
+			p.change(models.ManagedDataSource, ds.name, id, models.ReconcileRelease, "", nil)
+			p.unmark(models.ManagedDataSource, id)
+			continue
+		}
+		p.change(models.ManagedDataSource, ds.name, id, models.ReconcileDelete, p.managed[models.ManagedDataSource][id], nil)
+		p.prunedSources[id] = ds.name
+		p.exec("delete data source "+ds.name, "DELETE FROM column_masking_policies WHERE data_source_schema_id IN (SELECT id FROM data_source_schemas WHERE data_source_id = ?)", id)
+		p.exec("delete data source "+ds.name, "DELETE FROM user_datasource_privileges WHERE data_source_id = ?", id)
+		p.exec("delete data source "+ds.name, "DELETE FROM data_source_schemas WHERE data_source_id = ?", id)
+		p.exec("delete data source "+ds.name, "DELETE FROM data_source_tls WHERE data_source_id = ?", id)
+		p.execLater("delete data source "+ds.name, "DELETE FROM data_sources WHERE id = ?", id)
+		p.execLater("release data source "+ds.name, "DELETE FROM managed_objects WHERE object_type = ? AND object_id = ?", models.ManagedDataSource, id)
+	}
+	return nil
+}
+
+// currentColumns reads the cached schema of a data source, keyed by column path.
+func (rs *ReconcileService) currentColumns(dataSourceID string) (map[string]currentColumn, error) {
+	rows, err := rs.metaDB.Query(`
+		SELECT id, schema_name, table_name, column_name, column_type, is_nullable, is_primary_key
+		FROM data_source_schemas WHERE data_source_id = ?
+	`, dataSourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data source schema: %w", err)
+	}
+	defer rows.Close()
+
+	columns := map[string]currentColumn{}
+	for rows.Next() {
+		var c currentColumn
+		if err = rows.Scan(&c.id, &c.schema, &c.table, &c.column, &c.columnType, &c.nullable, &c.primaryKey); err != nil {
+			return nil, fmt.Errorf("failed to scan data source schema: %w", err)
+		}
+		columns[bundleColumnPath(c.schema, c.table, c.column)] = c
+	}
+	return columns, rows.Err()
+}
+
+// resolveDataSource returns the data source a view's reference resolves to: one of the manifests,
+// or else an unmanaged one the owner can QUERY. It returns nil if there is none.
+func (rs *ReconcileService) resolveDataSource(p *reconcilePlan, name string) (*bundleTarget, error) {
+	if target, ok := p.targets[name]; ok {
+		return target, nil
+	}
+	condition, args := dataSourceAccessCondition("id", "user_id", p.ownerID, models.PrivilegeQuery)
+	ids, err := queryIDs(rs.metaDB, `
+		SELECT id FROM data_sources
+		WHERE source_name = ? AND id NOT IN (SELECT object_id FROM managed_objects WHERE object_type = ?) AND `+condition,
+		append([]interface{}{name, models.ManagedDataSource}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up data source '%s': %w", name, err)
+	}
+	switch len(ids) {
+	case 0:
+		p.targets[name] = nil
+	case 1:
+		if p.targets[name], err = loadBundleTarget(rs.metaDB, ids[0]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("data source name '%s' is ambiguous: the owner can query %d data sources with it", name, len(ids))
+	}
+	return p.targets[name], nil
+}
+
+// currentView is a view row as reconciliation compares it.
+type currentView struct {
+	id, name, dataSourceID, tableName, definition string
+	description                                   sql.NullString
+}
+
+// currentViews reads the owner's and the managed views of a type, by ID and by name.
+func (rs *ReconcileService) currentViews(p *reconcilePlan, viewType string) (map[string]*currentView, map[string][]string, error) {
+	query := "SELECT id, name, description, '', '', definition FROM virtual_views"
+	if viewType == models.ViewTypeVirtualBaseView {
+		query = "SELECT id, name, description, data_source_id, table_name, selected_columns FROM virtual_base_views"
+	}
+	rows, err := rs.metaDB.Query(query+" WHERE user_id = ? OR id IN (SELECT object_id FROM managed_objects WHERE object_type = ?) ORDER BY created_at",
+		p.ownerID, viewType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read views: %w", err)
+	}
+	defer rows.Close()
+
+	byID := map[string]*currentView{}
+	byName := map[string][]string{}
+	for rows.Next() {
+		v := &currentView{}
+		if err = rows.Scan(&v.id, &v.name, &v.description, &v.dataSourceID, &v.tableName, &v.definition); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan view: %w", err)
+		}
+		byID[v.id] = v
+		byName[v.name] = append(byName[v.name], v.id)
+	}
+	return byID, byName, rows.Err()
+}
+
+// pruneViews deletes, or releases, the managed views of a type that are not in the manifests,
+// along with their shares and policies.
+func (rs *ReconcileService) pruneViews(p *reconcilePlan, viewType, table string, byID map[string]*currentView, seen map[string]bool) {
+	for _, id := range sortedIDs(p.managed[viewType]) {
+		if seen[id] {
+			continue
+		}
+		view, ok := byID[id]
+		if !ok {
+			p.unmark(viewType, id)
+			continue
+		}
+		if !rs.cfg.Prune {
+			p.change(viewType, view.name, id, models.ReconcileRelease, "", nil)
+			p.unmark(viewType, id)
+			continue
+		}
+		p.change(viewType, view.name, id, models.ReconcileDelete, p.managed[viewType][id], nil)
+		p.rewritten[id] = true
+		what := "delete " + viewType + " " + view.name
+		p.exec(what, "DELETE FROM view_shares WHERE view_type = ? AND view_id = ?", viewType, id)
+		p.exec(what, "DELETE FROM column_masking_policies WHERE view_type = ? AND view_id = ?", viewType, id)
+		p.exec(what, "DELETE FROM row_security_policies WHERE view_type = ? AND view_id = ?", viewType, id)
+		p.exec(what, fmt.Sprintf("DELETE FROM %s WHERE id = ?", table), id)
+		p.unmark(viewType, id)
+	}
+}
+
+// planVirtualBaseViews plans the virtual base views of the manifests and prunes managed ones not
+// in them.
+func (rs *ReconcileService) planVirtualBaseViews(p *reconcilePlan, m *manifestSet) error {
+	byID, byName, err := rs.currentViews(p, models.ViewTypeVirtualBaseView)
+	if err != nil {
+		return err
+	}
+
+	desired := append([]models.BundleVirtualBaseView(nil), m.VirtualBaseViews...)
+	sort.Slice(desired, func(i, j int) bool { return desired[i].Name < desired[j].Name })
+	seen := map[string]bool{}
+	for _, view := range desired {
+		file := m.file(models.ManagedVirtualBaseView, view.Name)
+		if view.Name == "" || view.DataSource == "" || view.Table == "" || len(view.Columns) == 0 {
+			p.errorf("%s: virtual base view '%s' needs a name, data_source, table and at least one column", file, view.Name)
+			continue
+		}
+		id, action, ok := p.matchExisting(models.ManagedVirtualBaseView, view.Name, file, byName[view.Name], rs.cfg.Adopt)
+		if !ok {
+			continue
+		}
+		seen[id] = true
+
+		target, err := rs.resolveDataSource(p, view.DataSource)
+		if err != nil {
+			p.errorf("%s: virtual base view '%s': %v", file, view.Name, err)
+			continue
+		}
+		if target == nil {
+			p.errorf("%s: virtual base view '%s': data source '%s' is neither in the manifests nor one the owner can query", file, view.Name, view.DataSource)
+			continue
+		}
+		tableColumns, ok := target.tables[view.Table]
+		if !ok {
+			p.errorf("%s: virtual base view '%s': table '%s' not found in data source '%s'", file, view.Name, view.Table, view.DataSource)
+			continue
+		}
+		missing := ""
+		for _, column := range view.Columns {
+			if !tableColumns[column] {
+				missing = column
+				break
+			}
+		}
+		if missing != "" {
+			p.errorf("%s: virtual base view '%s': column '%s' not found in table '%s'", file, view.Name, missing, view.Table)
+			continue
+		}
+
+		definitionJSON, err := json.Marshal(models.VirtualBaseViewDefinition{ColumnNames: view.Columns})
+		if err != nil {
+			return fmt.Errorf("failed to marshal virtual base view definition: %w", err)
+		}
+
+		var diff []string
+		if action == models.ReconcileCreate {
+			id = uuid.NewString()
+		} else {
+			cur := byID[id]
+			if cur.dataSourceID != target.id {
+				p.errorf("%s: virtual base view '%s' would move to another data source; give it a new name instead", file, view.Name)
+				continue
+			}
+			var currentDefinition models.VirtualBaseViewDefinition
+			json.Unmarshal([]byte(cur.definition), &currentDefinition)
+			diff = diffField(diff, "description", cur.description.String, view.Description)
+			diff = diffField(diff, "table", cur.tableName, view.Table)
+			diff = diffField(diff, "columns", strings.Join(currentDefinition.ColumnNames, ", "), strings.Join(view.Columns, ", "))
+			p.rewritten[id] = true
+		}
+		p.views[models.ViewTypeVirtualBaseView][view.Name] = id
+		if !p.finish(models.ManagedVirtualBaseView, view.Name, id, action, file, diff) {
+			continue
+		}
+
+		if action == models.ReconcileCreate {
+			p.exec("create virtual base view "+view.Name, `
+				INSERT INTO virtual_base_views (id, user_id, name, description, data_source_id, table_name, selected_columns, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, id, p.ownerID, view.Name, nullString(view.Description), target.id, view.Table, string(definitionJSON), p.now, p.now)
+		} else {
+			p.exec("update virtual base view "+view.Name, "UPDATE virtual_base_views SET description = ?, table_name = ?, selected_columns = ?, updated_at = ? WHERE id = ?",
+				nullString(view.Description), view.Table, string(definitionJSON), p.now, id)
+		}
+		p.mark(models.ManagedVirtualBaseView, id, file)
+	}
+
+	rs.pruneViews(p, models.ViewTypeVirtualBaseView, "virtual_base_views", byID, seen)
+	return nil
+}
+
+// planVirtualViews plans the virtual views of the manifests and prunes managed ones not in them.
+func (rs *ReconcileService) planVirtualViews(p *reconcilePlan, m *manifestSet) error {
+	byID, byName, err := rs.currentViews(p, models.ViewTypeVirtualView)
+	if err != nil {
+		return err
+	}
+
+	desired := append([]models.BundleVirtualView(nil), m.VirtualViews...)
+	sort.Slice(desired, func(i, j int) bool { return desired[i].Name < desired[j].Name })
+	seen := map[string]bool{}
+	for _, view := range desired {
+		file := m.file(models.ManagedVirtualView, view.Name)
+		if view.Name == "" || len(view.Columns) == 0 {
+			p.errorf("%s: virtual view '%s' needs a name and at least one column", file, view.Name)
+			continue
+		}
+		id, action, ok := p.matchExisting(models.ManagedVirtualView, view.Name, file, byName[view.Name], rs.cfg.Adopt)
+		if !ok {
+			continue
+		}
+		seen[id] = true
+
+		definition := models.VirtualViewDefinition{SelectedColumns: make([]models.SelectedColumn, 0, len(view.Columns))}
+		labels := make([]string, 0, len(view.Columns))
+		resolved := true
+		for _, ref := range view.Columns {
+			target, err := rs.resolveDataSource(p, ref.DataSource)
+			if err != nil {
+				p.errorf("%s: virtual view '%s': %v", file, view.Name, err)
+				resolved = false
+				break
+			}
+			if target == nil {
+				p.errorf("%s: virtual view '%s': data source '%s' is neither in the manifests nor one the owner can query", file, view.Name, ref.DataSource)
+				resolved = false
+				break
+			}
+			schemaID, ok := target.columns[ref.Column]
+			if !ok {
+				p.errorf("%s: virtual view '%s': column '%s' not found in data source '%s'", file, view.Name, ref.Column, ref.DataSource)
+				resolved = false
+				break
+			}
+			column := models.SelectedColumn{DataSourceSchemaID: schemaID}
+			label := ref.DataSource + ":" + ref.Column
+			if ref.Alias != "" {
+				alias := ref.Alias
+				column.Alias = &alias
+				label += " as " + alias
+			}
+			definition.SelectedColumns = append(definition.SelectedColumns, column)
+			labels = append(labels, label)
+		}
+		if !resolved {
+			continue
+		}
+		definitionJSON, err := json.Marshal(definition)
+		if err != nil {
+			return fmt.Errorf("failed to marshal virtual view definition: %w", err)
+		}
+
+		var diff []string
+		if action == models.ReconcileCreate {
+			id = uuid.NewString()
+		} else {
+			cur := byID[id]
+			diff = diffField(diff, "description", cur.description.String, view.Description)
+			var currentDefinition models.VirtualViewDefinition
+			json.Unmarshal([]byte(cur.definition), &currentDefinition)
+			if !sameSelectedColumns(currentDefinition.SelectedColumns, definition.SelectedColumns) {
+				currentLabels, err := rs.columnLabels(currentDefinition.SelectedColumns)
+				if err != nil {
+					return err
+				}
+				diff = diffField(diff, "columns", strings.Join(currentLabels, ", "), strings.Join(labels, ", "))
+			}
+			p.rewritten[id] = true
+		}
+		p.views[models.ViewTypeVirtualView][view.Name] = id
+		if !p.finish(models.ManagedVirtualView, view.Name, id, action, file, diff) {
+			continue
+		}
+
+		if action == models.ReconcileCreate {
+			p.exec("create virtual view "+view.Name, `
+				INSERT INTO virtual_views (id, user_id, name, description, definition, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, id, p.ownerID, view.Name, nullString(view.Description), string(definitionJSON), p.now, p.now)
+		} else {
+			p.exec("update virtual view "+view.Name, "UPDATE virtual_views SET description = ?, definition = ?, updated_at = ? WHERE id = ?",
+				nullString(view.Description), string(definitionJSON), p.now, id)
+		}
+		p.mark(models.ManagedVirtualView, id, file)
+	}
+
+	rs.pruneViews(p, models.ViewTypeVirtualView, "virtual_views", byID, seen)
+	return nil
+}
+
+// sameSelectedColumns reports whether two virtual view definitions select the same columns.
+func sameSelectedColumns(a, b []models.SelectedColumn) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		aliasA, aliasB := "", ""
+		if a[i].Alias != nil {
+			aliasA = *a[i].Alias
+		}
+		if b[i].Alias != nil {
+			aliasB = *b[i].Alias
+		}
+		if a[i].DataSourceSchemaID != b[i].DataSourceSchemaID || aliasA != aliasB {
+			return false
+		}
+	}
+	return true
+}
+
+// columnLabels describes the columns of a virtual view definition as data_source:column path.
+func (rs *ReconcileService) columnLabels(columns []models.SelectedColumn) ([]string, error) {
+	labels := make([]string, 0, len(columns))
+	for _, column := range columns {
+		var dataSource, table, name string
+		var schemaName sql.NullString
+		err := rs.metaDB.QueryRow(`
+			SELECT ds.source_name, dss.schema_name, dss.table_name, dss.column_name
+			FROM data_source_schemas dss JOIN data_sources ds ON ds.id = dss.data_source_id
+			WHERE dss.id = ?
+		`, column.DataSourceSchemaID).Scan(&dataSource, &schemaName, &table, &name)
+		label := "(deleted column)"
+		switch {
+		case err == nil:
+			label = dataSource + ":" + bundleColumnPath(schemaName, table, name)
+		case err != sql.ErrNoRows:
+			return nil, fmt.Errorf("failed to describe view column: %w", err)
+		}
+		if column.Alias != nil && *column.Alias != "" {
+			label += " as " + *column.Alias
+		}
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+// currentRole is a role as reconciliation compares it.
+type currentRole struct {
+	id, name    string
+	description sql.NullString
+	system      bool
+	permissions map[string]bool
+	members     map[string]bool // Usernames
+}
+
+// planRoles plans the custom roles of the manifests and prunes managed ones not in them.
+func (rs *ReconcileService) planRoles(p *reconcilePlan, m *manifestSet) error {
+	roles := map[string]*currentRole{}
+	byID := map[string]*currentRole{}
+	rows, err := rs.metaDB.Query("SELECT id, role_name, description, is_system_role FROM roles")
+	if err != nil {
+		return fmt.Errorf("failed to read roles: %w", err)
+	}
+	for rows.Next() {
+		r := &currentRole{permissions: map[string]bool{}, members: map[string]bool{}}
+		if err = rows.Scan(&r.id, &r.name, &r.description, &r.system); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles[r.name] = r
+		byID[r.id] = r
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to read roles: %w", err)
+	}
+
+	for _, q := range []struct {
+		query string
+		add   func(r *currentRole, name string)
+	}{
+		{"SELECT rp.role_id, p.permission_name FROM role_permissions rp JOIN permissions p ON p.id = rp.permission_id",
+			func(r *currentRole, name string) { r.permissions[name] = true }},
+		{"SELECT ur.role_id, u.username FROM user_roles ur JOIN users u ON u.id = ur.user_id",
+			func(r *currentRole, name string) { r.members[name] = true }},
+	} {
+		rows, err = rs.metaDB.Query(q.query)
+		if err != nil {
+			return fmt.Errorf("failed to read roles: %w", err)
+		}
+		for rows.Next() {
+			var roleID, name string
+			if err = rows.Scan(&roleID, &name); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan role: %w", err)
+			}
+			if r, ok := byID[roleID]; ok {
+				q.add(r, name)
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("failed to read roles: %w", err)
+		}
+	}
+
+	permissionIDs, err := rs.nameIndex("SELECT permission_name, id FROM permissions")
+	if err != nil {
+		return err
+	}
+	userIDs, err := rs.nameIndex("SELECT username, id FROM users")
+	if err != nil {
+		return err
+	}
+
+	desired := append([]models.BundleRole(nil), m.Roles...)
+	sort.Slice(desired, func(i, j int) bool { return desired[i].Name < desired[j].Name })
+	seen := map[string]bool{}
+	for _, role := range desired {
+		file := m.file(models.ManagedRole, role.Name)
+		if role.Name == "" {
+			p.errorf("%s: roles need a name", file)
+			continue
+		}
+		cur := roles[role.Name]
+		if cur != nil && cur.system {
+			p.errorf("%s: '%s' is a system role and cannot be declared", file, role.Name)
+			continue
+		}
+		var candidates []string
+		if cur != nil {
+			candidates = []string{cur.id}
+		}
+		id, action, ok := p.matchExisting(models.ManagedRole, role.Name, file, candidates, rs.cfg.Adopt)
+		if !ok {
+			continue
+		}
+		seen[id] = true
+
+		valid := true
+		for _, permission := range role.Permissions {
+			if _, ok := permissionIDs[permission]; !ok {
+				p.errorf("%s: role '%s': unknown permission '%s'", file, role.Name, permission)
+				valid = false
+			}
+		}
+		for _, member := range role.Members {
+			if _, ok := userIDs[member]; !ok {
+				p.errorf("%s: role '%s': user '%s' does not exist", file, role.Name, member)
+				valid = false
+			}
+		}
+		if !valid {
+			continue
+		}
+
+		if action == models.ReconcileCreate {
+			id = uuid.NewString()
+			cur = &currentRole{permissions: map[string]bool{}, members: map[string]bool{}}
+		}
+		p.roles[role.Name] = id
+
+		_, membersManaged := p.managed[models.ManagedRoleMembers][id]
+		manageMembers := role.Members != nil
+		var diff []string
+		if action != models.ReconcileCreate {
+			diff = diffField(diff, "description", cur.description.String, role.Description)
+		}
+		addedPermissions, removedPermissions := setDifference(cur.permissions, role.Permissions)
+		for _, name := range addedPermissions {
+			diff = append(diff, "+ permission "+name)
+		}
+		for _, name := range removedPermissions {
+			diff = append(diff, "- permission "+name)
+		}
+		var addedMembers, removedMembers []string
+		if manageMembers {
+			addedMembers, removedMembers = setDifference(cur.members, role.Members)
+			for _, name := range addedMembers {
+				diff = append(diff, "+ member "+name)
+			}
+			for _, name := range removedMembers {
+				diff = append(diff, "- member "+name)
+			}
+			if !membersManaged && action != models.ReconcileCreate {
+				diff = append(diff, "members: now managed")
+			}
+		} else if membersManaged {
+			diff = append(diff, "members: no longer managed")
+		}
+		if !p.finish(models.ManagedRole, role.Name, id, action, file, diff) {
+			continue
+		}
+
+		if action == models.ReconcileCreate {
+			p.exec("create role "+role.Name, "INSERT INTO roles (id, role_name, description, is_system_role, created_at, updated_at) VALUES (?, ?, ?, FALSE, ?, ?)",
+				id, role.Name, nullString(role.Description), p.now, p.now)
+		} else {
+			p.exec("update role "+role.Name, "UPDATE roles SET description = ?, updated_at = ? WHERE id = ?", nullString(role.Description), p.now, id)
+		}
+		for _, name := range addedPermissions {
+			p.exec("grant permission to role "+role.Name, "INSERT INTO role_permissions (role_id, permission_id, assigned_at) VALUES (?, ?, ?)", id, permissionIDs[name], p.now)
+		}
+		for _, name := range removedPermissions {
+			p.exec("revoke permission from role "+role.Name, "DELETE FROM role_permissions WHERE role_id = ? AND permission_id = ?", id, permissionIDs[name])
+		}
+		for _, name := range addedMembers {
+			p.exec("add member to role "+role.Name, "INSERT INTO user_roles (user_id, role_id, assigned_at) VALUES (?, ?, ?)", userIDs[name], id, p.now)
+		}
+		for _, name := range removedMembers {
+			p.exec("remove member from role "+role.Name, "DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userIDs[name], id)
+		}
+		p.mark(models.ManagedRole, id, file)
+		switch {
+		case manageMembers:
+			p.mark(models.ManagedRoleMembers, id, file)
+		case membersManaged:
+			p.unmark(models.ManagedRoleMembers, id)
+		}
+	}
+
+	for _, id := range sortedIDs(p.managed[models.ManagedRole]) {
+		if seen[id] {
+			continue
+		}
+		role, ok := byID[id]
+		if !ok {
+			p.unmark(models.ManagedRole, id)
+			p.unmark(models.ManagedRoleMembers, id)
+			continue
+		}
+		if !rs.cfg.Prune {
+			p.change(models.ManagedRole, role.name, id, models.ReconcileRelease, "", nil)
+			p.unmark(models.ManagedRole, id)
+			p.unmark(models.ManagedRoleMembers, id)
+			continue
+		}
+		p.change(models.ManagedRole, role.name, id, models.ReconcileDelete, p.managed[models.ManagedRole][id], nil)
+		p.exec("delete role "+role.name, "DELETE FROM view_shares WHERE grantee_type = ? AND grantee_id = ?", models.GranteeTypeRole, id)
+		p.exec("delete role "+role.name, "DELETE FROM role_permissions WHERE role_id = ?", id)
+		p.exec("delete role "+role.name, "DELETE FROM user_roles WHERE role_id = ?", id)
+		p.execLater("delete role "+role.name, "DELETE FROM roles WHERE id = ?", id)
+		p.execLater("release role "+role.name, "DELETE FROM managed_objects WHERE object_type IN (?, ?) AND object_id = ?", models.ManagedRole, models.ManagedRoleMembers, id)
+	}
+
+	// Roles not in the manifests can still be granted views, unless they are being pruned
+	for name, role := range roles {
+		if _, declared := p.roles[name]; !declared {
+			if _, managed := p.managed[models.ManagedRole][role.id]; !managed {
+				p.roles[name] = role.id
+			}
+		}
+	}
+	return nil
+}
+
+// nameIndex maps the first column of a query's rows to the second.
+func (rs *ReconcileService) nameIndex(query string) (map[string]string, error) {
+	rows, err := rs.metaDB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	defer rows.Close()
+	index := map[string]string{}
+	for rows.Next() {
+		var name, id string
+		if err = rows.Scan(&name, &id); err != nil {
+			return nil, fmt.Errorf("failed to scan metadata: %w", err)
+		}
+		index[name] = id
+	}
+	return index, rows.Err()
+}
+
+// setDifference returns the desired names missing from current, and the current names not desired,
+// both sorted.
+func setDifference(current map[string]bool, desired []string) ([]string, []string) {
+	want := map[string]bool{}
+	var added, removed []string
+	for _, name := range desired {
+		if !want[name] && !current[name] {
+			added = append(added, name)
+		}
+		want[name] = true
+	}
+	for name := range current {
+		if !want[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// planDataSourceGrants plans the data source privileges of the manifests and prunes managed ones
+// not in them. Privileges that already exist are adopted, since they state the same thing.
+func (rs *ReconcileService) planDataSourceGrants(p *reconcilePlan, m *manifestSet) error {
+	type currentGrant struct {
+		id, name string
+		canGrant bool
+		expires  sql.NullTime
+	}
+	byKey := map[string]*currentGrant{}
+	byID := map[string]*currentGrant{}
+	rows, err := rs.metaDB.Query(`
+		SELECT p.id, p.user_id, u.username, p.data_source_id, ds.source_name, p.privilege_type, p.can_grant, p.expires_at
+		FROM user_datasource_privileges p
+		JOIN users u ON u.id = p.user_id
+		JOIN data_sources ds ON ds.id = p.data_source_id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to read data source privileges: %w", err)
+	}
+	for rows.Next() {
+		g := &currentGrant{}
+		var userID, username, dataSourceID, dataSource, privilege string
+		if err = rows.Scan(&g.id, &userID, &username, &dataSourceID, &dataSource, &privilege, &g.canGrant, &g.expires); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan data source privilege: %w", err)
+		}
+		g.name = dataSourceGrantName(models.BundleDataSourceGrant{DataSource: dataSource, User: username, Privilege: privilege})
+		byKey[dataSourceID+"\x00"+userID+"\x00"+privilege] = g
+		byID[g.id] = g
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to read data source privileges: %w", err)
+	}
+	userIDs, err := rs.nameIndex("SELECT username, id FROM users")
+	if err != nil {
+		return err
+	}
+
+	desired := append([]models.BundleDataSourceGrant(nil), m.DataSourceGrants...)
+	sort.Slice(desired, func(i, j int) bool { return dataSourceGrantName(desired[i]) < dataSourceGrantName(desired[j]) })
+	seen := map[string]bool{}
+	for _, grant := range desired {
+		name := dataSourceGrantName(grant)
+		file := m.file(models.ManagedDataSourceGrant, name)
+		privilege := strings.ToUpper(grant.Privilege)
+		if !isValidPrivilege(privilege) {
+			p.errorf("%s: grant %s: privilege must be READ, QUERY or MANAGE", file, name)
+			continue
+		}
+		userID, ok := userIDs[grant.User]
+		if !ok {
+			p.errorf("%s: grant %s: user '%s' does not exist", file, name, grant.User)
+			continue
+		}
+		if userID == p.ownerID {
+			p.errorf("%s: grant %s: the owner already has full access", file, name)
+			continue
+		}
+		dataSourceID, ok := p.declared[grant.DataSource]
+		if !ok {
+			ids, err := queryIDs(rs.metaDB, `
+				SELECT id FROM data_sources
+				WHERE user_id = ? AND source_name = ? AND id NOT IN (SELECT object_id FROM managed_objects WHERE object_type = ?)
+			`, p.ownerID, grant.DataSource, models.ManagedDataSource)
+			if err != nil {
+				return fmt.Errorf("failed to look up data source '%s': %w", grant.DataSource, err)
+			}
+			if len(ids) != 1 {
+				p.errorf("%s: grant %s: data source '%s' is neither in the manifests nor owned by the owner, or is ambiguous", file, name, grant.DataSource)
+				continue
+			}
+			dataSourceID = ids[0]
+		}
+
+		cur := byKey[dataSourceID+"\x00"+userID+"\x00"+privilege]
+		id, action := uuid.NewString(), models.ReconcileCreate
+		var diff []string
+		if cur != nil {
+			id, action = cur.id, models.ReconcileUpdate
+			if _, managed := p.managed[models.ManagedDataSourceGrant][id]; !managed {
+				action = models.ReconcileAdopt
+			}
+			diff = diffField(diff, "can_grant", fmt.Sprint(cur.canGrant), fmt.Sprint(grant.CanGrant))
+			if cur.expires.Valid {
+				diff = append(diff, fmt.Sprintf("expires_at: %s -> never", cur.expires.Time.Format(time.RFC3339)))
+			}
+		}
+		seen[id] = true
+		if !p.finish(models.ManagedDataSourceGrant, name, id, action, file, diff) {
+			continue
+		}
+
+		if action == models.ReconcileCreate {
+			p.exec("grant "+name, `
+				INSERT INTO user_datasource_privileges (id, user_id, data_source_id, privilege_type, can_grant, granted_by_user_id, granted_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, id, userID, dataSourceID, privilege, grant.CanGrant, p.ownerID, p.now)
+		} else if len(diff) > 0 {
+			p.exec("update grant "+name, "UPDATE user_datasource_privileges SET can_grant = ?, expires_at = NULL WHERE id = ?", grant.CanGrant, id)
+		}
+		p.mark(models.ManagedDataSourceGrant, id, file)
+	}
+
+	for _, id := range sortedIDs(p.managed[models.ManagedDataSourceGrant]) {
+		if seen[id] {
+			continue
+		}
+		grant, ok := byID[id]
+		if !ok {
+			p.unmark(models.ManagedDataSourceGrant, id)
+			continue
+		}
+		if !rs.cfg.Prune {
+			p.change(models.ManagedDataSourceGrant, grant.name, id, models.ReconcileRelease, "", nil)
+		} else {
+			p.change(models.ManagedDataSourceGrant, grant.name, id, models.ReconcileDelete, p.managed[models.ManagedDataSourceGrant][id], nil)
+			p.exec("revoke "+grant.name, "DELETE FROM user_datasource_privileges WHERE id = ?", id)
+		}
+		p.unmark(models.ManagedDataSourceGrant, id)
+	}
+	return nil
+}
+
+// planViewGrants plans the view shares of the manifests and prunes managed ones not in them.
+// Shares that already exist are adopted, since they state the same thing.
+func (rs *ReconcileService) planViewGrants(p *reconcilePlan, m *manifestSet) error {
+	type currentShare struct {
+		id, name, access string
+	}
+	byKey := map[string]*currentShare{}
+	byID := map[string]*currentShare{}
+	rows, err := rs.metaDB.Query(`
+		SELECT s.id, s.view_type, s.view_id, COALESCE(vv.name, vbv.name, s.view_id), s.grantee_type, s.grantee_id,
+		       COALESCE(u.username, r.role_name, s.grantee_id), s.access_level
+		FROM view_shares s
+		LEFT JOIN virtual_views vv ON s.view_type = 'virtual_view' AND vv.id = s.view_id
+		LEFT JOIN virtual_base_views vbv ON s.view_type = 'virtual_base_view' AND vbv.id = s.view_id
+		LEFT JOIN users u ON s.grantee_type = 'user' AND u.id = s.grantee_id
+		LEFT JOIN roles r ON s.grantee_type = 'role' AND r.id = s.grantee_id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to read view shares: %w", err)
+	}
+	for rows.Next() {
+		s := &currentShare{}
+		var viewType, viewID, viewName, granteeType, granteeID, granteeName string
+		if err = rows.Scan(&s.id, &viewType, &viewID, &viewName, &granteeType, &granteeID, &granteeName, &s.access); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan view share: %w", err)
+		}
+		grant := models.BundleViewGrant{ViewType: viewType, View: viewName}
+		switch granteeType {
+		case models.GranteeTypeUser:
+			grant.User = granteeName
+		case models.GranteeTypeRole:
+			grant.Role = granteeName
+		}
+		s.name = viewGrantName(grant)
+		byKey[viewType+"\x00"+viewID+"\x00"+granteeType+"\x00"+granteeID] = s
+		byID[s.id] = s
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to read view shares: %w", err)
+	}
+	userIDs, err := rs.nameIndex("SELECT username, id FROM users")
+	if err != nil {
+		return err
+	}
+
+	desired := append([]models.BundleViewGrant(nil), m.ViewGrants...)
+	sort.Slice(desired, func(i, j int) bool { return viewGrantName(desired[i]) < viewGrantName(desired[j]) })
+	seen := map[string]bool{}
+	for _, grant := range desired {
+		name := viewGrantName(grant)
+		file := m.file(models.ManagedViewGrant, name)
+		access := strings.ToUpper(grant.Access)
+		if access != models.ViewAccessView && access != models.ViewAccessEdit {
+			p.errorf("%s: grant %s: access must be VIEW or EDIT", file, name)
+			continue
+		}
+		table, err := viewTable(grant.ViewType)
+		if err != nil {
+			p.errorf("%s: grant %s: view_type must be %s or %s", file, name, models.ViewTypeVirtualView, models.ViewTypeVirtualBaseView)
+			continue
+		}
+
+		var granteeType, granteeID string
+		var ok bool
+		switch {
+		case grant.User != "" && grant.Role == "" && !grant.Everyone:
+			granteeType = models.GranteeTypeUser
+			if granteeID, ok = userIDs[grant.User]; !ok {
+				p.errorf("%s: grant %s: user '%s' does not exist", file, name, grant.User)
+				continue
+			}
+			if granteeID == p.ownerID {
+				p.errorf("%s: grant %s: the owner already has full access", file, name)
+				continue
+			}
+		case grant.Role != "" && grant.User == "" && !grant.Everyone:
+			granteeType = models.GranteeTypeRole
+			if granteeID, ok = p.roles[grant.Role]; !ok {
+				p.errorf("%s: grant %s: role '%s' is neither in the manifests nor an existing role", file, name, grant.Role)
+				continue
+			}
+		case grant.Everyone && grant.User == "" && grant.Role == "":
+			granteeType, granteeID = models.GranteeTypeEveryone, "*"
+			if access != models.ViewAccessView {
+				p.errorf("%s: grant %s: views are published with VIEW access only", file, name)
+				continue
+			}
+		default:
+			p.errorf("%s: grant %s: set exactly one of user, role or everyone", file, name)
+			continue
+		}
+
+		viewID, ok := p.views[grant.ViewType][grant.View]
+		if !ok {
+			ids, err := queryIDs(rs.metaDB, fmt.Sprintf(`
+				SELECT id FROM %s
+				WHERE user_id = ? AND name = ? AND id NOT IN (SELECT object_id FROM managed_objects WHERE object_type = ?)
+			`, table), p.ownerID, grant.View, grant.ViewType)
+			if err != nil {
+				return fmt.Errorf("failed to look up view '%s': %w", grant.View, err)
+			}
+			if len(ids) != 1 {
+				p.errorf("%s: grant %s: view '%s' is neither in the manifests nor owned by the owner", file, name, grant.View)
+				continue
+			}
+			viewID = ids[0]
+		}
+
+		cur := byKey[grant.ViewType+"\x00"+viewID+"\x00"+granteeType+"\x00"+granteeID]
+		id, action := uuid.NewString(), models.ReconcileCreate
+		var diff []string
+		if cur != nil {
+			id, action = cur.id, models.ReconcileUpdate
+			if _, managed := p.managed[models.ManagedViewGrant][id]; !managed {
+				action = models.ReconcileAdopt
+			}
+			diff = diffField(diff, "access", cur.access, access)
+		}
+		seen[id] = true
+		if !p.finish(models.ManagedViewGrant, name, id, action, file, diff) {
+			continue
+		}
+
+		if action == models.ReconcileCreate {
+			p.exec("grant "+name, `
+				INSERT INTO view_shares (id, view_type, view_id, grantee_type, grantee_id, access_level, granted_by_user_id, granted_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, id, grant.ViewType, viewID, granteeType, granteeID, access, p.ownerID, p.now)
+		} else if len(diff) > 0 {
+			p.exec("update grant "+name, "UPDATE view_shares SET access_level = ?, granted_at = ? WHERE id = ?", access, p.now, id)
+		}
+		p.mark(models.ManagedViewGrant, id, file)
+	}
+
+	for _, id := range sortedIDs(p.managed[models.ManagedViewGrant]) {
+		if seen[id] {
+			continue
+		}
+		share, ok := byID[id]
+		if !ok {
+			p.unmark(models.ManagedViewGrant, id)
+			continue
+		}
+		if !rs.cfg.Prune {
+			p.change(models.ManagedViewGrant, share.name, id, models.ReconcileRelease, "", nil)
+		} else {
+			p.change(models.ManagedViewGrant, share.name, id, models.ReconcileDelete, p.managed[models.ManagedViewGrant][id], nil)
+			p.exec("revoke "+share.name, "DELETE FROM view_shares WHERE id = ?", id)
+		}
+		p.unmark(models.ManagedViewGrant, id)
+	}
+	return nil
+}
+
+// checkRemovedReferences reports views outside the plan's control that still use the columns
+// and data sources the plan removes.
+func (rs *ReconcileService) checkRemovedReferences(p *reconcilePlan, m *manifestSet) error {
+	type reference struct{ id, name string }
+	usersOf := func(query string, args ...interface{}) ([]reference, error) {
+		rows, err := rs.metaDB.Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up views using removed objects: %w", err)
+		}
+		defer rows.Close()
+		var refs []reference
+		for rows.Next() {
+			var ref reference
+			if err = rows.Scan(&ref.id, &ref.name); err != nil {
+				return nil, fmt.Errorf("failed to scan view: %w", err)
+			}
+			if !p.rewritten[ref.id] {
+				refs = append(refs, ref)
+			}
+		}
+		return refs, rows.Err()
+	}
+
+	for _, column := range p.removedColumns {
+		views, err := usersOf("SELECT id, name FROM virtual_views WHERE definition LIKE ?", "%\""+column.id+"\"%")
+		if err != nil {
+			return err
+		}
+		for _, view := range views {
+			p.errorf("column %s is removed from data source '%s', but virtual view '%s' still uses it", column.path, column.dataSource, view.name)
+		}
+		baseViews, err := usersOf(`
+			SELECT v.id, v.name FROM virtual_base_views v JOIN data_sources ds ON ds.id = v.data_source_id
+			WHERE ds.source_name = ? AND v.table_name = ? AND v.selected_columns LIKE ?
+		`, column.dataSource, column.table, "%\""+column.column+"\"%")
+		if err != nil {
+			return err
+		}
+		for _, view := range baseViews {
+			p.errorf("column %s is removed from data source '%s', but virtual base view '%s' still uses it", column.path, column.dataSource, view.name)
+		}
+	}
+
+	for _, id := range sortedIDs(p.prunedSources) {
+		views, err := usersOf(`
+			SELECT DISTINCT v.id, v.name FROM virtual_views v, data_source_schemas dss
+			WHERE dss.data_source_id = ? AND v.definition LIKE '%"' || dss.id || '"%'
+		`, id)
+		if err != nil {
+			return err
+		}
+		baseViews, err := usersOf("SELECT id, name FROM virtual_base_views WHERE data_source_id = ?", id)
+		if err != nil {
+			return err
+		}
+		for _, view := range append(views, baseViews...) {
+			p.errorf("data source '%s' is removed from the manifests, but view '%s' still uses it", p.prunedSources[id], view.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package core
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reconcileLockID is the PostgreSQL advisory lock held while a replica reconciles, so replicas
+// sharing the metadata database do not apply the same plan twice.
+const reconcileLockID int64 = 0x42726964676f01
+
+// GitOpsConfig controls declarative configuration: a directory of manifests the metadata is
+// continuously reconciled with.
+type GitOpsConfig struct {
+	Dir        string        // Directory of YAML/JSON manifests; empty disables reconciliation
+	Interval   time.Duration // Time between reconciliations
+	Owner      string        // Username that owns the data sources and views created from manifests
+	Prune      bool          // Delete managed objects removed from the manifests; otherwise they are released
+	Adopt      bool          // Take over existing objects named in a manifest instead of reporting a conflict
+	SecretsKey string        // Passphrase the manifests' data source passwords are encrypted with
+}
+
+// DefaultGitOpsConfig reconciles every minute as the admin user, pruning removed objects.
+var DefaultGitOpsConfig = GitOpsConfig{Interval: time.Minute, Owner: "admin", Prune: true}
+
+// Enabled reports whether a manifest directory is configured.
+func (c GitOpsConfig) Enabled() bool {
+	return c.Dir != ""
+}
+
+// ReconcileService keeps data sources, views, roles and grants in line with the manifests in the
+// configured directory. Objects it creates or adopts are recorded in 'managed_objects'; the API
+// refuses to change them, so the manifests stay the single source of truth.
+type ReconcileService struct {
+	metaDB *sql.DB
+	cfg    GitOpsConfig
+	runMu  sync.Mutex // Serializes plans and runs within this process
+	lastMu sync.Mutex
+	last   *models.ReconcileResult
+
+	onScheduledApply func(models.ReconcileResult)
+}
+
+// NewReconcileService creates a ReconcileService for the manifests described by cfg.
+func NewReconcileService(metaDB *sql.DB, cfg GitOpsConfig) *ReconcileService {
+	return &ReconcileService{metaDB: metaDB, cfg: cfg}
+}
+
+// Config returns the service's configuration.
+func (rs *ReconcileService) Config() GitOpsConfig {
+	return rs.cfg
+}
+
+// OnScheduledApply sets a function Run calls after each scheduled run that applied changes, e.g.
+// to audit them. Set it before Run starts.
+func (rs *ReconcileService) OnScheduledApply(fn func(models.ReconcileResult)) {
+	rs.onScheduledApply = fn
+}
+
+// LastResult returns the outcome of the latest reconciliation, or nil before the first one.
+func (rs *ReconcileService) LastResult() *models.ReconcileResult {
+	rs.lastMu.Lock()
+	defer rs.lastMu.Unlock()
+	return rs.last
+}
+
+// Plan computes the changes a reconciliation would make now, without making them.
+func (rs *ReconcileService) Plan() (*models.ReconcilePlan, error) {
+	rs.runMu.Lock()
+	defer rs.runMu.Unlock()
+
+	var plan *reconcilePlan
+	err := metadata.WithLock(rs.metaDB, reconcileLockID, func() error {
+		var err error
+		plan, err = rs.plan()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &plan.ReconcilePlan, nil
+}
+
+// Reconcile plans and applies the changes that bring the metadata in line with the manifests.
+// Nothing is applied while the plan has errors. The result is kept for LastResult.
+func (rs *ReconcileService) Reconcile() models.ReconcileResult {
+	rs.runMu.Lock()
+	defer rs.runMu.Unlock()
+
+	result := models.ReconcileResult{StartedAt: time.Now().UTC()}
+	err := metadata.WithLock(rs.metaDB, reconcileLockID, func() error {
+		plan, err := rs.plan()
+		if err != nil {
+			return err
+		}
+		result.Plan = plan.ReconcilePlan
+		if len(plan.Errors) > 0 || len(plan.Changes) == 0 {
+			return nil
+		}
+		if err = rs.apply(plan); err != nil {
+			return err
+		}
+		result.Applied = true
+		return nil
+	})
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.FinishedAt = time.Now().UTC()
+
+	rs.lastMu.Lock()
+	rs.last = &result
+	rs.lastMu.Unlock()
+	return result
+}
+
+// Run reconciles now and then every Interval, until stop is closed. It returns immediately if
+// no manifest directory is configured.
+func (rs *ReconcileService) Run(stop <-chan struct{}) {
+	if !rs.cfg.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(rs.cfg.Interval)
+	defer ticker.Stop()
+
+	lastProblem := ""
+	for {
+		result := rs.Reconcile()
+		problem := result.Error + strings.Join(result.Plan.Errors, "\n")
+		switch {
+		case problem != "" && problem != lastProblem:
+			// Logged once until the problem changes, rather than on every tick
+			log.Printf("Declarative configuration not applied: %s", problem)
+		case result.Applied:
+			log.Printf("Declarative configuration applied: %d change(s)", len(result.Plan.Changes))
+		}
+		if result.Applied && rs.onScheduledApply != nil {
+			rs.onScheduledApply(result)
+		}
+		lastProblem = problem
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// apply makes the planned changes. Rows whose dependents the main transaction deletes are
+// deleted in a second one, since DuckDB checks foreign keys against the state before the
+// transaction; if that one fails, the next run retries it.
+func (rs *ReconcileService) apply(p *reconcilePlan) error {
+	for _, steps := range [][]func(tx *sql.Tx) error{p.steps, p.deletes} {
+		if len(steps) == 0 {
+			continue
+		}
+		tx, err := rs.metaDB.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin metadata transaction: %w", err)
+		}
+		for _, step := range steps {
+			if err = step(tx); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit metadata transaction: %w", err)
+		}
+	}
+	return nil
+}
+
+// manifestSet is the content of the manifest directory, merged into one bundle.
+type manifestSet struct {
+	models.Bundle
+	files map[string]string // manifestKey(kind, name) -> manifest file declaring the object
+}
+
+// manifestKey identifies an object of the manifests.
+func manifestKey(kind, name string) string {
+	return kind + "\x00" + name
+}
+
+// loadManifests reads every .yaml, .yml and .json file under the manifest directory. A file may
+// hold several YAML documents. Objects declared more than once are reported as errors.
+func (rs *ReconcileService) loadManifests(p *reconcilePlan) (*manifestSet, error) {
+	var paths []string
+	err := filepath.WalkDir(rs.cfg.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && path != rs.cfg.Dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir // e.g. .git
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				paths = append(paths, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest directory: %w", err)
+	}
+	sort.Strings(paths)
+
+	set := &manifestSet{files: map[string]string{}}
+	declare := func(kind, name, file string) bool {
+		key := manifestKey(kind, name)
+		if previous, ok := set.files[key]; ok {
+			p.errorf("%s '%s' is declared in both %s and %s", kind, name, previous, file)
+			return false
+		}
+		set.files[key] = file
+		return true
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+		}
+		file, _ := filepath.Rel(rs.cfg.Dir, path)
+		file = filepath.ToSlash(file)
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		for {
+			var doc models.Bundle
+			if err = decoder.Decode(&doc); err == io.EOF {
+				break
+			}
+			if err == nil {
+				err = checkBundleHeader(&doc)
+			}
+			if err != nil {
+				p.errorf("%s: %v", file, err)
+				break
+			}
+
+			for _, ds := range doc.DataSources {
+				if declare(models.ManagedDataSource, ds.Name, file) {
+					set.DataSources = append(set.DataSources, ds)
+				}
+			}
+			for _, view := range doc.VirtualBaseViews {
+				if declare(models.ManagedVirtualBaseView, view.Name, file) {
+					set.VirtualBaseViews = append(set.VirtualBaseViews, view)
+				}
+			}
+			for _, view := range doc.VirtualViews {
+				if declare(models.ManagedVirtualView, view.Name, file) {
+					set.VirtualViews = append(set.VirtualViews, view)
+				}
+			}
+			for _, role := range doc.Roles {
+				if declare(models.ManagedRole, role.Name, file) {
+					set.Roles = append(set.Roles, role)
+				}
+			}
+			for _, grant := range doc.DataSourceGrants {
+				if declare(models.ManagedDataSourceGrant, dataSourceGrantName(grant), file) {
+					set.DataSourceGrants = append(set.DataSourceGrants, grant)
+				}
+			}
+			for _, grant := range doc.ViewGrants {
+				if declare(models.ManagedViewGrant, viewGrantName(grant), file) {
+					set.ViewGrants = append(set.ViewGrants, grant)
+				}
+			}
+		}
+	}
+	return set, nil
+}
+
+// file returns the manifest declaring an object.
+func (m *manifestSet) file(kind, name string) string {
+	return m.files[manifestKey(kind, name)]
+}
+
+// dataSourceGrantName names a data source grant in plans, e.g. "sales -> carol QUERY".
+func dataSourceGrantName(grant models.BundleDataSourceGrant) string {
+	return fmt.Sprintf("%s -> %s %s", grant.DataSource, grant.User, strings.ToUpper(grant.Privilege))
+}
+
+// viewGrantName names a view grant in plans, e.g. "virtual_view/report -> role:analysts".
+func viewGrantName(grant models.BundleViewGrant) string {
+	grantee := "everyone"
+	switch {
+	case grant.User != "":
+		grantee = "user:" + grant.User
+	case grant.Role != "":
+		grantee = "role:" + grant.Role
+	}
+	return fmt.Sprintf("%s/%s -> %s", grant.ViewType, grant.View, grantee)
+}
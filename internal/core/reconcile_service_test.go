@@ -0,0 +1,207 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+)
+
+const reconcileTestManifest = `kind: BridgoBundle
+version: 1
+data_sources:
+  - name: sales
+    db_type: postgresql
+    host: %HOST%
+    tables:
+      - schema: public
+        name: orders
+        columns:
+          - {name: id, type: integer}
+          - {name: region, type: text}
+virtual_base_views:
+  - name: orders
+    data_source: sales
+    table: orders
+    columns: [id, region]
+`
+
+// reconcileTestChanges summarises the changes of a plan as "kind name:action" pairs.
+func reconcileTestChanges(plan models.ReconcilePlan) string {
+	changes := make([]string, 0, len(plan.Changes))
+	for _, c := range plan.Changes {
+		changes = append(changes, c.Kind+" "+c.Name+":"+c.Action)
+	}
+	return strings.Join(changes, ",")
+}
+
+func TestReconcile(t *testing.T) {
+	db := metadatatest.NewDB(t)
+	owner := metadatatest.InsertUser(t, db, "admin", "password")
+	alice := metadatatest.InsertUser(t, db, "alice", "password")
+	dir := t.TempDir()
+	write := func(host string) {
+		t.Helper()
+		manifest := strings.ReplaceAll(reconcileTestManifest, "%HOST%", host)
+		if err := os.WriteFile(filepath.Join(dir, "sales.yaml"), []byte(manifest), 0o600); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+	}
+	count := func(query string, args ...interface{}) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		return n
+	}
+	reconcile := func(rs *ReconcileService) models.ReconcileResult {
+		t.Helper()
+		result := rs.Reconcile()
+		if !result.Applied || result.Error != "" {
+			t.Fatalf("Reconcile = %+v, want it applied", result)
+		}
+		return result
+	}
+	rs := NewReconcileService(db, GitOpsConfig{Dir: dir, Interval: time.Hour, Owner: "admin", Prune: true})
+	write("a.example.com")
+
+	t.Run("plan and apply", func(t *testing.T) {
+		plan, err := rs.Plan()
+		if err != nil {
+			t.Fatalf("Plan: %v", err)
+		}
+		if got, want := reconcileTestChanges(*plan), "data_source sales:create,virtual_base_view orders:create"; got != want {
+			t.Errorf("planned changes = %q, want %q", got, want)
+		}
+		if n := count("SELECT COUNT(*) FROM data_sources"); n != 0 {
+			t.Errorf("Plan wrote %d data sources", n)
+		}
+
+		reconcile(rs)
+		if n := count("SELECT COUNT(*) FROM data_sources WHERE source_name = 'sales' AND user_id = ?", owner); n != 1 {
+			t.Errorf("%d data sources named sales owned by admin, want 1", n)
+		}
+		if n := count("SELECT COUNT(*) FROM managed_objects"); n != 2 {
+			t.Errorf("%d managed objects, want 2", n)
+		}
+		if plan, err = rs.Plan(); err != nil || len(plan.Changes) != 0 || plan.Unchanged != 2 {
+			t.Errorf("Plan after applying = %+v (%v), want 2 unchanged objects", plan, err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		write("b.example.com")
+		result := reconcile(rs)
+		if got := reconcileTestChanges(result.Plan); got != "data_source sales:update" {
+			t.Fatalf("changes = %q, want an update of sales", got)
+		}
+		if diff := strings.Join(result.Plan.Changes[0].Diff, "\n"); !strings.Contains(diff, "a.example.com") || !strings.Contains(diff, "b.example.com") {
+			t.Errorf("diff = %q, want the changed host", diff)
+		}
+		if n := count("SELECT COUNT(*) FROM data_sources WHERE host = 'b.example.com'"); n != 1 {
+			t.Error("the new host was not applied")
+		}
+	})
+
+	t.Run("managed objects are blocked", func(t *testing.T) {
+		var dataSourceID, viewID string
+		if err := db.QueryRow("SELECT id FROM data_sources WHERE source_name = 'sales'").Scan(&dataSourceID); err != nil {
+			t.Fatalf("look up data source: %v", err)
+		}
+		if err := db.QueryRow("SELECT id FROM virtual_base_views WHERE name = 'orders'").Scan(&viewID); err != nil {
+			t.Fatalf("look up view: %v", err)
+		}
+
+		_, err := NewViewSharingService(db).ShareView(models.ShareViewInput{
+			UserID: owner, ViewType: models.ViewTypeVirtualBaseView, ViewID: viewID,
+			GranteeType: models.GranteeTypeUser, Grantee: "alice", AccessLevel: models.ViewAccessView,
+		})
+		if !errors.Is(err, ErrManagedObject) {
+			t.Errorf("ShareView of a managed view = %v, want ErrManagedObject", err)
+		}
+		_, err = NewPrivilegeService(db).GrantPrivilege(models.GrantDataSourcePrivilegeInput{
+			DataSourceID: dataSourceID, UserID: alice, PrivilegeType: models.PrivilegeQuery, GrantorUserID: owner,
+		})
+		if !errors.Is(err, ErrManagedObject) {
+			t.Errorf("GrantPrivilege on a managed data source = %v, want ErrManagedObject", err)
+		}
+
+		report, err := NewBundleService(db).Import(models.ImportBundleInput{
+			UserID:     owner,
+			Bundle:     models.Bundle{Kind: models.BundleKind, Version: 1, DataSources: []models.BundleDataSource{{Name: "sales", DBType: "postgresql", Host: "c.example.com"}}},
+			OnConflict: models.BundleConflictOverwrite,
+		})
+		if err != nil {
+			t.Fatalf("Import: %v", err)
+		}
+		if report.Applied || len(report.Errors) != 1 || !strings.Contains(report.Errors[0], ErrManagedObject.Error()) {
+			t.Errorf("overwriting a managed data source reported %+v, want a managed object error", report)
+		}
+		if n := count("SELECT COUNT(*) FROM data_sources WHERE host = 'b.example.com'"); n != 1 {
+			t.Error("the import changed the managed data source")
+		}
+	})
+
+	t.Run("invalid manifest", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("kind: Something\nversion: 1\n"), 0o600); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+		write("d.example.com")
+		if result := rs.Reconcile(); result.Applied || (result.Error == "" && len(result.Plan.Errors) == 0) {
+			t.Errorf("Reconcile with an invalid manifest = %+v, want an error", result)
+		}
+		if n := count("SELECT COUNT(*) FROM data_sources WHERE host = 'd.example.com'"); n != 0 {
+			t.Error("a run with an invalid manifest applied changes")
+		}
+		if err := os.Remove(filepath.Join(dir, "broken.yaml")); err != nil {
+			t.Fatalf("remove manifest: %v", err)
+		}
+	})
+
+	t.Run("prune and release", func(t *testing.T) {
+		// Without pruning, a removed object is released and kept
+		if err := os.WriteFile(filepath.Join(dir, "sales.yaml"), []byte("kind: BridgoBundle\nversion: 1\n"), 0o600); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+		keep := NewReconcileService(db, GitOpsConfig{Dir: dir, Interval: time.Hour, Owner: "admin"})
+		result := reconcile(keep)
+		if got, want := reconcileTestChanges(result.Plan), "data_source sales:release,virtual_base_view orders:release"; got != want {
+			t.Errorf("changes = %q, want %q", got, want)
+		}
+		if n := count("SELECT COUNT(*) FROM virtual_base_views WHERE name = 'orders'"); n != 1 {
+			t.Error("a released view was deleted")
+		}
+		if n := count("SELECT COUNT(*) FROM managed_objects"); n != 0 {
+			t.Errorf("%d managed objects after release, want 0", n)
+		}
+
+		// The objects now exist unmanaged, so declaring them again conflicts unless adopted
+		write("b.example.com")
+		if plan, err := rs.Plan(); err != nil || len(plan.Errors) == 0 || !strings.Contains(strings.Join(plan.Errors, "\n"), "not managed") {
+			t.Errorf("Plan over unmanaged objects = %+v (%v), want a conflict", plan, err)
+		}
+		adopt := NewReconcileService(db, GitOpsConfig{Dir: dir, Interval: time.Hour, Owner: "admin", Prune: true, Adopt: true})
+		result = reconcile(adopt)
+		if got, want := reconcileTestChanges(result.Plan), "data_source sales:adopt,virtual_base_view orders:adopt"; got != want {
+			t.Errorf("changes = %q, want %q", got, want)
+		}
+
+		// With pruning, a removed object is deleted
+		if err := os.WriteFile(filepath.Join(dir, "sales.yaml"), []byte("kind: BridgoBundle\nversion: 1\n"), 0o600); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+		result = reconcile(rs)
+		if got, want := reconcileTestChanges(result.Plan), "data_source sales:delete,virtual_base_view orders:delete"; got != want {
+			t.Errorf("changes = %q, want %q", got, want)
+		}
+		if n := count("SELECT COUNT(*) FROM data_sources") + count("SELECT COUNT(*) FROM virtual_base_views"); n != 0 {
+			t.Errorf("%d objects left after pruning, want none", n)
+		}
+	})
+}
@@ -0,0 +1,470 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// predicateKeywords are the SQL words a row-level security predicate may use besides column names.
+var predicateKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "IS": true, "NULL": true,
+	"LIKE": true, "BETWEEN": true, "TRUE": true, "FALSE": true,
+}
+
+var (
+	predicatePlaceholder = regexp.MustCompile(`^\{\{\s*user\.(id|username|roles|attr\.[A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	predicateIdentifier  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?`)
+	predicateNumber      = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?`)
+	predicateOperator    = regexp.MustCompile(`^(<=|>=|<>|!=|=|<|>)`)
+)
+
+// RowSecurityService manages row-level security policies (row_security_policies).
+// Policies are enforced by rowSecurityFilter, which every query against a view must go through.
+type RowSecurityService struct {
+	metaDB *sql.DB
+}
+
+// NewRowSecurityService creates a new RowSecurityService
+func NewRowSecurityService(metaDB *sql.DB) *RowSecurityService {
+	return &RowSecurityService{metaDB: metaDB}
+}
+
+// callerAttributes holds the values the {{user.*}} placeholders of a predicate resolve to.
+type callerAttributes struct {
+	UserID     string
+	Username   string
+	Roles      []string
+	Attributes map[string]string
+}
+
+// loadCallerAttributes reads the identity, roles and custom attributes of a user.
+func loadCallerAttributes(db *sql.DB, userID string) (*callerAttributes, error) {
+	caller := &callerAttributes{UserID: userID, Roles: []string{}, Attributes: make(map[string]string)}
+
+	if err := db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&caller.Username); err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	roles, err := userRoleNames(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for role := range roles {
+		caller.Roles = append(caller.Roles, role)
+	}
+
+	rows, err := db.Query("SELECT attribute_key, attribute_value FROM user_attributes WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user attributes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		if err = rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan user attribute: %w", err)
+		}
+		caller.Attributes[key] = value
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user attribute rows: %w", err)
+	}
+
+	return caller, nil
+}
+
+// bindVarFor returns the query placeholder style of a data source type, given the 1-based argument position.
+func bindVarFor(dbType string) func(int) string {
+	if dbType == "postgresql" {
+		return func(n int) string { return fmt.Sprintf("$%d", n) }
+	}
+	return func(int) string { return "?" }
+}
+
+// compilePredicate turns a predicate template into a SQL condition and its arguments.
+// Only column names (from columns, keyed by lower-cased reference), comparison operators,
+// predicateKeywords, parentheses, commas, numbers, quoted strings and {{user.*}} placeholders
+// are accepted; strings and placeholders are always bound as arguments. References in masked
+// (lower-cased) are rejected. argOffset is the number of query arguments that precede the condition.
+func compilePredicate(predicate string, columns map[string]string, masked map[string]bool, caller *callerAttributes, bindVar func(int) string, argOffset int) (string, []interface{}, error) {
+	var parts []string
+	var args []interface{}
+	bind := func(value interface{}) string {
+		args = append(args, value)
+		return bindVar(argOffset + len(args))
+	}
+
+	depth := 0
+	rest := strings.TrimSpace(predicate)
+	for rest != "" {
+		var part string
+		consumed := 0
+
+		if m := predicatePlaceholder.FindStringSubmatch(rest); m != nil {
+			consumed = len(m[0])
+			switch {
+			case m[1] == "id":
+				part = bind(caller.UserID)
+			case m[1] == "username":
+				part = bind(caller.Username)
+			case m[1] == "roles":
+				if len(caller.Roles) == 0 {
+					part = "(NULL)"
+				} else {
+					binds := make([]string, len(caller.Roles))
+					for i, role := range caller.Roles {
+						binds[i] = bind(role)
+					}
+					part = "(" + strings.Join(binds, ", ") + ")"
+				}
+			default:
+				// A missing attribute binds NULL, which matches no row
+				if value, ok := caller.Attributes[strings.TrimPrefix(m[1], "attr.")]; ok {
+					part = bind(value)
+				} else {
+					part = bind(nil)
+				}
+			}
+		} else if rest[0] == '\'' {
+			var literal strings.Builder
+			closed := false
+			for i := 1; i < len(rest); i++ {
+				if rest[i] != '\'' {
+					literal.WriteByte(rest[i])
+					continue
+				}
+				if i+1 < len(rest) && rest[i+1] == '\'' {
+					literal.WriteByte('\'')
+					i++
+					continue
+				}
+				consumed = i + 1
+				closed = true
+				break
+			}
+			if !closed {
+				return "", nil, fmt.Errorf("unterminated string in predicate")
+			}
+			part = bind(literal.String())
+		} else if rest[0] == '(' || rest[0] == ')' || rest[0] == ',' {
+			consumed = 1
+			part = rest[:1]
+			if rest[0] == '(' {
+				depth++
+			} else if rest[0] == ')' {
+				depth--
+				if depth < 0 {
+					return "", nil, fmt.Errorf("unbalanced parentheses in predicate")
+				}
+			}
+		} else if m := predicateOperator.FindString(rest); m != "" {
+			consumed = len(m)
+			part = m
+		} else if m := predicateNumber.FindString(rest); m != "" {
+			consumed = len(m)
+			part = m
+		} else if m := predicateIdentifier.FindString(rest); m != "" {
+			consumed = len(m)
+			if predicateKeywords[strings.ToUpper(m)] {
+				part = strings.ToUpper(m)
+			} else if masked[strings.ToLower(m)] {
+				return "", nil, fmt.Errorf("column '%s' is masked and cannot be used in a predicate", m)
+			} else if column, ok := columns[strings.ToLower(m)]; ok {
+				part = column
+			} else {
+				return "", nil, fmt.Errorf("unknown column '%s' in predicate", m)
+			}
+		} else {
+			return "", nil, fmt.Errorf("unexpected '%c' in predicate", rest[0])
+		}
+
+		parts = append(parts, part)
+		rest = strings.TrimSpace(rest[consumed:])
+	}
+
+	if len(parts) == 0 {
+		return "", nil, fmt.Errorf("predicate is empty")
+	}
+	if depth != 0 {
+		return "", nil, fmt.Errorf("unbalanced parentheses in predicate")
+	}
+	return strings.Join(parts, " "), args, nil
+}
+
+// viewTableColumns returns every column of the tables a view reads (not only the selected ones),
+// named as the view's results name them.
+func viewTableColumns(db *sql.DB, viewType, viewID string) ([]resultColumn, error) {
+	resultColumns, err := viewResultColumns(db, viewType, viewID)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []resultColumn
+	seen := make(map[string]bool)
+	for _, c := range resultColumns {
+		if seen[c.DataSourceID+"\x00"+c.TableName] {
+			continue
+		}
+		seen[c.DataSourceID+"\x00"+c.TableName] = true
+
+		rows, err := db.Query("SELECT column_name FROM data_source_schemas WHERE data_source_id = ? AND table_name = ?", c.DataSourceID, c.TableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query view table columns: %w", err)
+		}
+		for rows.Next() {
+			column := resultColumn{DataSourceID: c.DataSourceID, TableName: c.TableName}
+			if err = rows.Scan(&column.ColumnName); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan column name: %w", err)
+			}
+			column.Name = column.ColumnName
+			if viewType == models.ViewTypeVirtualView {
+				column.Name = c.TableName + "." + column.ColumnName
+			}
+			columns = append(columns, column)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error iterating column rows: %w", err)
+		}
+	}
+	return columns, nil
+}
+
+// viewFilterColumns returns the columns a predicate on a view may reference: every column of the
+// tables the view reads, by name and by table.column.
+func viewFilterColumns(db *sql.DB, viewType, viewID string) (map[string]string, error) {
+	tableColumns, err := viewTableColumns(db, viewType, viewID)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]string)
+	for _, c := range tableColumns {
+		columns[strings.ToLower(c.ColumnName)] = c.ColumnName
+		columns[strings.ToLower(c.TableName+"."+c.ColumnName)] = c.TableName + "." + c.ColumnName
+	}
+	return columns, nil
+}
+
+// maskedFilterColumns returns the references of viewFilterColumns (lower-cased) to columns masked
+// for userID. A predicate on such a column would reveal its values through the rows it lets through.
+func maskedFilterColumns(db *sql.DB, viewType, viewID, userID string) (map[string]bool, error) {
+	tableColumns, err := viewTableColumns(db, viewType, viewID)
+	if err != nil {
+		return nil, err
+	}
+	masker, err := columnMasker(db, viewType, viewID, userID, tableColumns)
+	if err != nil {
+		return nil, err
+	}
+	masked := make(map[string]bool)
+	for i, c := range tableColumns {
+		if masker.masks[i] != "" {
+			masked[strings.ToLower(c.ColumnName)] = true
+			masked[strings.ToLower(c.TableName+"."+c.ColumnName)] = true
+		}
+	}
+	return masked, nil
+}
+
+// rowSecurityFilter returns the SQL condition, and its arguments, restricting a query against a
+// view to the rows userID may see: every policy on the view the caller is not exempt from, ANDed.
+// It returns an empty condition when no policy applies.
+func rowSecurityFilter(db *sql.DB, viewType, viewID, userID string, bindVar func(int) string, argOffset int) (string, []interface{}, error) {
+	rows, err := db.Query("SELECT predicate, exempt_roles FROM row_security_policies WHERE view_type = ? AND view_id = ? ORDER BY name", viewType, viewID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to query row security policies: %w", err)
+	}
+	defer rows.Close()
+
+	type policy struct{ predicate, exemptRoles string }
+	var policies []policy
+	for rows.Next() {
+		var p policy
+		if err = rows.Scan(&p.predicate, &p.exemptRoles); err != nil {
+			return "", nil, fmt.Errorf("failed to scan row security policy: %w", err)
+		}
+		policies = append(policies, p)
+	}
+	if err = rows.Err(); err != nil {
+		return "", nil, fmt.Errorf("error iterating row security policy rows: %w", err)
+	}
+	if len(policies) == 0 {
+		return "", nil, nil
+	}
+
+	caller, err := loadCallerAttributes(db, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	columns, err := viewFilterColumns(db, viewType, viewID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var conditions []string
+	var args []interface{}
+	for _, p := range policies {
+		var exemptRoles []string
+		if err = json.Unmarshal([]byte(p.exemptRoles), &exemptRoles); err != nil {
+			return "", nil, fmt.Errorf("failed to parse row security policy exempt roles: %w", err)
+		}
+		exempt := false
+		for _, role := range exemptRoles {
+			for _, callerRole := range caller.Roles {
+				exempt = exempt || role == callerRole
+			}
+		}
+		if exempt {
+			continue
+		}
+
+		condition, conditionArgs, err := compilePredicate(p.predicate, columns, nil, caller, bindVar, argOffset+len(args))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid row security policy: %w", err)
+		}
+		conditions = append(conditions, "("+condition+")")
+		args = append(args, conditionArgs...)
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+// SetPolicy creates a named row-level security policy on a view, or replaces the one with the same name.
+// The caller needs EDIT access on the view, and the predicate may not use columns masked for them.
+func (rss *RowSecurityService) SetPolicy(input models.SetRowSecurityPolicyInput) (*models.RowSecurityPolicy, error) {
+	if _, err := requireViewAccess(rss.metaDB, input.ViewType, input.ViewID, input.UserID, models.ViewAccessEdit); err != nil {
+		return nil, err
+	}
+	if input.ExemptRoles == nil {
+		input.ExemptRoles = []string{}
+	}
+	if err := validateRoleNames(rss.metaDB, input.ExemptRoles); err != nil {
+		return nil, err
+	}
+
+	// Check the predicate compiles against the view's columns
+	columns, err := viewFilterColumns(rss.metaDB, input.ViewType, input.ViewID)
+	if err != nil {
+		return nil, err
+	}
+	masked, err := maskedFilterColumns(rss.metaDB, input.ViewType, input.ViewID, input.UserID)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = compilePredicate(input.Predicate, columns, masked, &callerAttributes{}, bindVarFor(""), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	exemptRolesJSON, err := json.Marshal(input.ExemptRoles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode exempt roles: %w", err)
+	}
+
+	policy := &models.RowSecurityPolicy{
+		ViewType:        input.ViewType,
+		ViewID:          input.ViewID,
+		Name:            input.Name,
+		Predicate:       input.Predicate,
+		ExemptRoles:     input.ExemptRoles,
+		CreatedByUserID: &input.UserID,
+		CreatedAt:       time.Now().UTC(),
+	}
+
+	var existingID string
+	err = rss.metaDB.QueryRow(
+		"SELECT id FROM row_security_policies WHERE view_type = ? AND view_id = ? AND name = ?",
+		input.ViewType, input.ViewID, input.Name,
+	).Scan(&existingID)
+	switch {
+	case err == sql.ErrNoRows:
+		policy.ID = uuid.NewString()
+		_, err = rss.metaDB.Exec(`
+			INSERT INTO row_security_policies (id, view_type, view_id, name, predicate, exempt_roles, created_by_user_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, policy.ID, policy.ViewType, policy.ViewID, policy.Name, policy.Predicate, string(exemptRolesJSON), input.UserID, policy.CreatedAt)
+	case err == nil:
+		policy.ID = existingID
+		_, err = rss.metaDB.Exec(
+			"UPDATE row_security_policies SET predicate = ?, exempt_roles = ?, created_by_user_id = ?, created_at = ? WHERE id = ?",
+			policy.Predicate, string(exemptRolesJSON), input.UserID, policy.CreatedAt, existingID,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save row security policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// DeletePolicy removes a row-level security policy. The caller needs EDIT access on its view.
+func (rss *RowSecurityService) DeletePolicy(policyID, userID string) error {
+	var viewType, viewID string
+	err := rss.metaDB.QueryRow("SELECT view_type, view_id FROM row_security_policies WHERE id = ?", policyID).Scan(&viewType, &viewID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("row security policy not found")
+		}
+		return fmt.Errorf("failed to look up row security policy: %w", err)
+	}
+
+	if _, err = requireViewAccess(rss.metaDB, viewType, viewID, userID, models.ViewAccessEdit); err != nil {
+		return err
+	}
+
+	if _, err = rss.metaDB.Exec("DELETE FROM row_security_policies WHERE id = ?", policyID); err != nil {
+		return fmt.Errorf("failed to delete row security policy: %w", err)
+	}
+	return nil
+}
+
+// ListPolicies returns the row-level security policies on a view. The caller must be able to read the view.
+func (rss *RowSecurityService) ListPolicies(viewType, viewID, userID string) ([]models.RowSecurityPolicy, error) {
+	if _, err := requireViewAccess(rss.metaDB, viewType, viewID, userID, models.ViewAccessView); err != nil {
+		return nil, err
+	}
+
+	rows, err := rss.metaDB.Query(`
+		SELECT id, view_type, view_id, name, predicate, exempt_roles, created_by_user_id, created_at
+		FROM row_security_policies
+		WHERE view_type = ? AND view_id = ?
+		ORDER BY name
+	`, viewType, viewID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query row security policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []models.RowSecurityPolicy{}
+	for rows.Next() {
+		var p models.RowSecurityPolicy
+		var exemptRolesJSON string
+		var createdBy sql.NullString
+		err = rows.Scan(&p.ID, &p.ViewType, &p.ViewID, &p.Name, &p.Predicate, &exemptRolesJSON, &createdBy, &p.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row security policy: %w", err)
+		}
+		if createdBy.Valid {
+			p.CreatedByUserID = &createdBy.String
+		}
+		if err = json.Unmarshal([]byte(exemptRolesJSON), &p.ExemptRoles); err != nil {
+			return nil, fmt.Errorf("failed to parse row security policy exempt roles: %w", err)
+		}
+		policies = append(policies, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating row security policy rows: %w", err)
+	}
+
+	return policies, nil
+}
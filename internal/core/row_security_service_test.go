@@ -0,0 +1,152 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCompilePredicate(t *testing.T) {
+	columns := map[string]string{
+		"region":        "region",
+		"orders.region": "orders.region",
+		"amount":        "amount",
+		"ssn":           "ssn",
+	}
+	caller := &callerAttributes{
+		UserID:     "u1",
+		Username:   "alice",
+		Roles:      []string{"analyst", "viewer"},
+		Attributes: map[string]string{"region": "EU"},
+	}
+
+	tests := []struct {
+		name      string
+		predicate string
+		bindVar   func(int) string
+		offset    int
+		want      string
+		wantArgs  []interface{}
+		wantErr   string
+	}{
+		{
+			name:      "unknown column",
+			predicate: "region = {{ user.attr.region }} AND amount < 100 OR name_of = 'x'",
+			wantErr:   "unknown column 'name_of'",
+		},
+		{
+			name:      "attribute and number",
+			predicate: "Orders.Region = {{user.attr.region}} and amount >= -1.5",
+			want:      "orders.region = ? AND amount >= -1.5",
+			wantArgs:  []interface{}{"EU"},
+		},
+		{
+			name:      "roles expand to a list",
+			predicate: "region IN {{user.roles}}",
+			want:      "region IN (?, ?)",
+			wantArgs:  []interface{}{"analyst", "viewer"},
+		},
+		{
+			name:      "postgres placeholders continue after the offset",
+			predicate: "region = {{user.username}} OR region = 'it''s'",
+			bindVar:   bindVarFor("postgresql"),
+			offset:    2,
+			want:      "region = $3 OR region = $4",
+			wantArgs:  []interface{}{"alice", "it's"},
+		},
+		{
+			name:      "missing attribute binds NULL",
+			predicate: "region = {{user.attr.team}}",
+			want:      "region = ?",
+			wantArgs:  []interface{}{nil},
+		},
+		{name: "masked column", predicate: "ssn LIKE '1%'", wantErr: "column 'ssn' is masked"},
+		{name: "subquery", predicate: "region IN (SELECT region FROM x)", wantErr: "unknown column 'SELECT'"},
+		{name: "comment", predicate: "region = 'a' -- x", wantErr: "unexpected '-'"},
+		{name: "semicolon", predicate: "region = 'a'; DROP TABLE x", wantErr: "unexpected ';'"},
+		{name: "unterminated string", predicate: "region = 'a", wantErr: "unterminated string"},
+		{name: "unbalanced parentheses", predicate: "(region = 'a'", wantErr: "unbalanced parentheses"},
+		{name: "closing parenthesis first", predicate: ") region = 'a' (", wantErr: "unbalanced parentheses"},
+		{name: "empty", predicate: "  ", wantErr: "predicate is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bindVar := tt.bindVar
+			if bindVar == nil {
+				bindVar = bindVarFor("mysql")
+			}
+			got, args, err := compilePredicate(tt.predicate, columns, map[string]bool{"ssn": true}, caller, bindVar, tt.offset)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("got %q %v, want %q %v", got, args, tt.want, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSetPolicyRejectsMaskedColumns(t *testing.T) {
+	db := metadatatest.NewDB(t)
+	owner := metadatatest.InsertUser(t, db, "owner", "password")
+	ds := metadatatest.InsertDataSource(t, db, owner, "hr")
+
+	var ssnColumnID string
+	for _, column := range []string{"region", "ssn"} {
+		id := uuid.NewString()
+		if column == "ssn" {
+			ssnColumnID = id
+		}
+		_, err := db.Exec("INSERT INTO data_source_schemas (id, data_source_id, table_name, column_name, column_type) VALUES (?, ?, 'employees', ?, 'text')", id, ds, column)
+		if err != nil {
+			t.Fatalf("insert column: %v", err)
+		}
+	}
+	viewID := uuid.NewString()
+	_, err := db.Exec(`INSERT INTO virtual_base_views (id, user_id, name, data_source_id, table_name, selected_columns)
+		VALUES (?, ?, 'staff', ?, 'employees', '{"column_names":["region"]}')`, viewID, owner, ds)
+	if err != nil {
+		t.Fatalf("insert view: %v", err)
+	}
+	_, err = db.Exec("INSERT INTO column_masking_policies (id, data_source_schema_id, mask_type, exempt_roles) VALUES (?, ?, ?, '[\"admin\"]')",
+		uuid.NewString(), ssnColumnID, models.MaskRedact)
+	if err != nil {
+		t.Fatalf("insert masking policy: %v", err)
+	}
+
+	rss := NewRowSecurityService(db)
+	setPolicy := func(predicate string) error {
+		_, err := rss.SetPolicy(models.SetRowSecurityPolicyInput{
+			UserID: owner, ViewType: models.ViewTypeVirtualBaseView, ViewID: viewID, Name: "p", Predicate: predicate,
+		})
+		return err
+	}
+
+	// The masked column is not selected by the view, yet may not be filtered on either
+	if err = setPolicy("employees.ssn LIKE '1%'"); err == nil || !strings.Contains(err.Error(), "is masked") {
+		t.Fatalf("predicate on masked column: got %v, want masked column error", err)
+	}
+	if err = setPolicy("region = {{user.attr.region}}"); err != nil {
+		t.Fatalf("predicate on unmasked column: %v", err)
+	}
+
+	_, err = db.Exec("INSERT INTO user_roles (user_id, role_id) SELECT ?, id FROM roles WHERE role_name = ?", owner, models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+	if err = setPolicy("ssn LIKE '1%'"); err != nil {
+		t.Fatalf("predicate on column the caller is exempt from masking: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 
 	"Bridgo/internal/models"
@@ -14,7 +15,13 @@ type CoreService struct {
 	virtualViewService     *VirtualViewService
 	virtualBaseViewService *VirtualBaseViewService
 	dataSourceService      *DataSourceService
+	privilegeService       *PrivilegeService
+	viewSharingService     *ViewSharingService
+	maskingService         *MaskingService
+	rowSecurityService     *RowSecurityService
 	queryService           *QueryService
+	ownershipService       *OwnershipService
+	bundleService          *BundleService
 }
 
 // NewCoreService creates a new core Service.
@@ -23,7 +30,13 @@ func NewCoreService(metaDB *sql.DB) *CoreService {
 	virtualViewService := NewVirtualViewService(metaDB)
 	virtualBaseViewService := NewVirtualBaseViewService(metaDB)
 	dataSourceService := NewDataSourceService(metaDB)
+	privilegeService := NewPrivilegeService(metaDB)
+	viewSharingService := NewViewSharingService(metaDB)
+	maskingService := NewMaskingService(metaDB)
+	rowSecurityService := NewRowSecurityService(metaDB)
 	queryService := NewQueryService(connectionService)
+	ownershipService := NewOwnershipService(metaDB)
+	bundleService := NewBundleService(metaDB)
 
 	return &CoreService{
 		metaDB:                 metaDB,
@@ -31,7 +44,13 @@ func NewCoreService(metaDB *sql.DB) *CoreService {
 		virtualViewService:     virtualViewService,
 		virtualBaseViewService: virtualBaseViewService,
 		dataSourceService:      dataSourceService,
+		privilegeService:       privilegeService,
+		viewSharingService:     viewSharingService,
+		maskingService:         maskingService,
+		rowSecurityService:     rowSecurityService,
 		queryService:           queryService,
+		ownershipService:       ownershipService,
+		bundleService:          bundleService,
 	}
 }
 
@@ -40,7 +59,7 @@ func (s *CoreService) ConnectAndFetchSchema(input ConnectAndFetchSchemaInput) ([
 	return s.connectionService.ConnectAndFetchSchema(input)
 }
 
-func (s *CoreService) TestConnectionAndFetchSchema(input ConnectAndFetchSchemaInput) ([]models.DataSourceSchema, error) {
+func (s *CoreService) TestConnectionAndFetchSchema(input ConnectAndFetchSchemaInput) ([]models.DataSourceSchema, *models.DataSourceTLSState, error) {
 	return s.connectionService.TestConnectionAndFetchSchema(input)
 }
 
@@ -53,6 +72,10 @@ func (s *CoreService) CreateVirtualView(input CreateVirtualViewInput) (*models.V
 	return s.virtualViewService.CreateVirtualView(input)
 }
 
+func (s *CoreService) UpdateVirtualView(input UpdateVirtualViewInput) (*models.VirtualView, error) {
+	return s.virtualViewService.UpdateVirtualView(input)
+}
+
 func (s *CoreService) GetUserVirtualViews(user_id string) ([]models.VirtualView, error) {
 	return s.virtualViewService.GetUserVirtualViews(user_id)
 }
@@ -70,6 +93,10 @@ func (s *CoreService) CreateVirtualBaseView(input models.CreateVirtualBaseViewIn
 	return s.virtualBaseViewService.CreateVirtualBaseView(input)
 }
 
+func (s *CoreService) UpdateVirtualBaseView(input models.UpdateVirtualBaseViewInput) (*models.VirtualBaseView, error) {
+	return s.virtualBaseViewService.UpdateVirtualBaseView(input)
+}
+
 func (s *CoreService) GetUserVirtualBaseViews(userID string) ([]models.VirtualBaseView, error) {
 	return s.virtualBaseViewService.GetUserVirtualBaseViews(userID)
 }
@@ -82,15 +109,96 @@ func (s *CoreService) GetVirtualBaseViewSampleData(virtualBaseViewID string, use
 	return s.virtualBaseViewService.GetVirtualBaseViewSampleData(virtualBaseViewID, userID)
 }
 
+// View sharing related methods
+func (s *CoreService) ShareView(input models.ShareViewInput) (*models.ViewShare, error) {
+	return s.viewSharingService.ShareView(input)
+}
+
+func (s *CoreService) UnshareView(viewType string, viewID string, granteeType string, grantee string, userID string) error {
+	return s.viewSharingService.UnshareView(viewType, viewID, granteeType, grantee, userID)
+}
+
+func (s *CoreService) GetViewShares(viewType string, viewID string, userID string) ([]models.ViewShare, error) {
+	return s.viewSharingService.ListViewShares(viewType, viewID, userID)
+}
+
+func (s *CoreService) SetViewPublished(viewType string, viewID string, published bool, userID string) error {
+	return s.viewSharingService.SetViewPublished(viewType, viewID, published, userID)
+}
+
+func (s *CoreService) TransferViewOwnership(viewType string, viewID string, newOwnerUsername string, userID string) error {
+	return s.viewSharingService.TransferViewOwnership(viewType, viewID, newOwnerUsername, userID)
+}
+
+func (s *CoreService) GetPublishedCatalog() ([]models.CatalogEntry, error) {
+	return s.viewSharingService.GetPublishedCatalog()
+}
+
+func (s *CoreService) ReassignOwnedResources(fromUserID string, toUserID string) (map[string]int, error) {
+	return s.ownershipService.ReassignOwnedResources(fromUserID, toUserID)
+}
+
+// Bundle related methods
+func (s *CoreService) ExportBundle(input models.ExportBundleInput) (*models.Bundle, error) {
+	return s.bundleService.Export(input)
+}
+
+func (s *CoreService) ImportBundle(input models.ImportBundleInput) (*models.BundleImportReport, error) {
+	return s.bundleService.Import(input)
+}
+
 // Data Source related methods
 func (s *CoreService) GetUserDataSources(user_id string) ([]models.DataSource, error) {
 	return s.dataSourceService.GetUserDataSources(user_id)
 }
 
+func (s *CoreService) CheckDataSourceHealth(ctx context.Context) ([]models.DataSourceHealth, error) {
+	return s.dataSourceService.CheckHealth(ctx)
+}
+
 func (s *CoreService) GetDataSourceSchema(data_source_id string, user_id string) ([]models.DataSourceSchema, error) {
 	return s.dataSourceService.GetDataSourceSchema(data_source_id, user_id)
 }
 
+// Data Source privilege related methods
+func (s *CoreService) GrantDataSourcePrivilege(input models.GrantDataSourcePrivilegeInput) (*models.DataSourcePrivilege, error) {
+	return s.privilegeService.GrantPrivilege(input)
+}
+
+func (s *CoreService) RevokeDataSourcePrivilege(data_source_id string, grantee_user_id string, privilege_type string, revoker_user_id string) error {
+	return s.privilegeService.RevokePrivilege(data_source_id, grantee_user_id, privilege_type, revoker_user_id)
+}
+
+func (s *CoreService) GetDataSourcePrivileges(data_source_id string, user_id string) ([]models.DataSourcePrivilege, error) {
+	return s.privilegeService.ListPrivileges(data_source_id, user_id)
+}
+
+// Masking policy related methods
+func (s *CoreService) SetMaskingPolicy(input models.SetMaskingPolicyInput) (*models.MaskingPolicy, error) {
+	return s.maskingService.SetPolicy(input)
+}
+
+func (s *CoreService) DeleteMaskingPolicy(policyID string, userID string) error {
+	return s.maskingService.DeletePolicy(policyID, userID)
+}
+
+func (s *CoreService) GetMaskingPolicies(dataSourceID string, viewType string, viewID string, userID string) ([]models.MaskingPolicy, error) {
+	return s.maskingService.ListPolicies(dataSourceID, viewType, viewID, userID)
+}
+
+// Row-level security related methods
+func (s *CoreService) SetRowSecurityPolicy(input models.SetRowSecurityPolicyInput) (*models.RowSecurityPolicy, error) {
+	return s.rowSecurityService.SetPolicy(input)
+}
+
+func (s *CoreService) DeleteRowSecurityPolicy(policyID string, userID string) error {
+	return s.rowSecurityService.DeletePolicy(policyID, userID)
+}
+
+func (s *CoreService) GetRowSecurityPolicies(viewType string, viewID string, userID string) ([]models.RowSecurityPolicy, error) {
+	return s.rowSecurityService.ListPolicies(viewType, viewID, userID)
+}
+
 // Query related methods
 func (s *CoreService) QueryData(user_id string, data_source_id string, query string) (interface{}, error) {
 	return s.queryService.QueryData(user_id, data_source_id, query)
@@ -0,0 +1,493 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrViewAccessDenied is returned when the caller lacks the access required on a view.
+var ErrViewAccessDenied = errors.New("insufficient access to view")
+
+// ViewSharingService handles sharing, publishing and ownership transfer of
+// virtual views and virtual base views.
+type ViewSharingService struct {
+	metaDB *sql.DB
+}
+
+// NewViewSharingService creates a new ViewSharingService
+func NewViewSharingService(metaDB *sql.DB) *ViewSharingService {
+	return &ViewSharingService{metaDB: metaDB}
+}
+
+// viewTable returns the metadata table holding views of the given type.
+func viewTable(viewType string) (string, error) {
+	switch viewType {
+	case models.ViewTypeVirtualView:
+		return "virtual_views", nil
+	case models.ViewTypeVirtualBaseView:
+		return "virtual_base_views", nil
+	}
+	return "", fmt.Errorf("invalid view type '%s' (expected %s or %s)", viewType, models.ViewTypeVirtualView, models.ViewTypeVirtualBaseView)
+}
+
+// viewShareGranteeCondition returns a SQL condition, and its arguments, matching view_shares rows
+// (aliased as alias) that apply to userID directly or through one of the user's roles.
+// Published shares are included only when includeEveryone is set.
+func viewShareGranteeCondition(alias, userID string, includeEveryone bool) (string, []interface{}) {
+	condition := fmt.Sprintf(`(%[1]s.grantee_type = '%[2]s' AND %[1]s.grantee_id = ?)
+		OR (%[1]s.grantee_type = '%[3]s' AND %[1]s.grantee_id IN (SELECT role_id FROM user_roles WHERE user_id = ?))`,
+		alias, models.GranteeTypeUser, models.GranteeTypeRole)
+	if includeEveryone {
+		condition += fmt.Sprintf(" OR %s.grantee_type = '%s'", alias, models.GranteeTypeEveryone)
+	}
+	return "(" + condition + ")", []interface{}{userID, userID}
+}
+
+// viewAccessLevel returns the owner of a view and the access userID has on it:
+// OWNER, EDIT, VIEW, or "" when the view is not shared with the user at all.
+func viewAccessLevel(db *sql.DB, viewType, viewID, userID string) (string, string, error) {
+	table, err := viewTable(viewType)
+	if err != nil {
+		return "", "", err
+	}
+
+	var ownerID string
+	err = db.QueryRow(fmt.Sprintf("SELECT user_id FROM %s WHERE id = ?", table), viewID).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", fmt.Errorf("view not found or access denied")
+		}
+		return "", "", fmt.Errorf("failed to look up view owner: %w", err)
+	}
+	if ownerID == userID {
+		return ownerID, models.ViewAccessOwner, nil
+	}
+
+	granteeCondition, args := viewShareGranteeCondition("s", userID, true)
+	args = append([]interface{}{viewType, viewID}, args...)
+	rows, err := db.Query(`
+		SELECT s.access_level FROM view_shares s
+		WHERE s.view_type = ? AND s.view_id = ? AND `+granteeCondition, args...)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up view shares: %w", err)
+	}
+	defer rows.Close()
+
+	access := ""
+	for rows.Next() {
+		var level string
+		if err = rows.Scan(&level); err != nil {
+			return "", "", fmt.Errorf("failed to scan view share: %w", err)
+		}
+		if level == models.ViewAccessEdit || access == "" {
+			access = level
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return "", "", fmt.Errorf("error iterating view share rows: %w", err)
+	}
+
+	return ownerID, access, nil
+}
+
+// requireViewAccess returns the owner of a view if userID has at least the required access on it.
+func requireViewAccess(db *sql.DB, viewType, viewID, userID, required string) (string, error) {
+	ownerID, access, err := viewAccessLevel(db, viewType, viewID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	allowed := false
+	switch required {
+	case models.ViewAccessView:
+		allowed = access != ""
+	case models.ViewAccessEdit:
+		allowed = access == models.ViewAccessEdit || access == models.ViewAccessOwner
+	case models.ViewAccessOwner:
+		allowed = access == models.ViewAccessOwner
+	}
+	if !allowed {
+		if access == "" {
+			return "", fmt.Errorf("view not found or access denied")
+		}
+		return "", ErrViewAccessDenied
+	}
+	return ownerID, nil
+}
+
+// resolveGrantee turns a username or role name into the ID stored in view_shares.grantee_id.
+func (vss *ViewSharingService) resolveGrantee(granteeType, grantee string) (string, error) {
+	var query string
+	switch granteeType {
+	case models.GranteeTypeUser:
+		query = "SELECT id FROM users WHERE username = ?"
+	case models.GranteeTypeRole:
+		query = "SELECT id FROM roles WHERE role_name = ?"
+	default:
+		return "", fmt.Errorf("invalid grantee type '%s' (expected %s or %s)", granteeType, models.GranteeTypeUser, models.GranteeTypeRole)
+	}
+
+	var granteeID string
+	err := vss.metaDB.QueryRow(query, grantee).Scan(&granteeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%s '%s' not found", granteeType, grantee)
+		}
+		return "", fmt.Errorf("failed to look up %s: %w", granteeType, err)
+	}
+	return granteeID, nil
+}
+
+// saveShare inserts a share, or updates the access level of an existing one.
+func (vss *ViewSharingService) saveShare(share *models.ViewShare) error {
+	var existingID string
+	err := vss.metaDB.QueryRow(
+		"SELECT id FROM view_shares WHERE view_type = ? AND view_id = ? AND grantee_type = ? AND grantee_id = ?",
+		share.ViewType, share.ViewID, share.GranteeType, share.GranteeID,
+	).Scan(&existingID)
+	switch {
+	case err == sql.ErrNoRows:
+		share.ID = uuid.NewString()
+		_, err = vss.metaDB.Exec(`
+			INSERT INTO view_shares (id, view_type, view_id, grantee_type, grantee_id, access_level, granted_by_user_id, granted_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, share.ID, share.ViewType, share.ViewID, share.GranteeType, share.GranteeID, share.AccessLevel, share.GrantedByUserID, share.GrantedAt)
+	case err == nil:
+		share.ID = existingID
+		_, err = vss.metaDB.Exec(
+			"UPDATE view_shares SET access_level = ?, granted_by_user_id = ?, granted_at = ? WHERE id = ?",
+			share.AccessLevel, share.GrantedByUserID, share.GrantedAt, existingID,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save view share: %w", err)
+	}
+	return nil
+}
+
+// ShareView shares a view with a user or a role. Only the owner may share a view.
+func (vss *ViewSharingService) ShareView(input models.ShareViewInput) (*models.ViewShare, error) {
+	input.AccessLevel = strings.ToUpper(input.AccessLevel)
+	if input.AccessLevel != models.ViewAccessView && input.AccessLevel != models.ViewAccessEdit {
+		return nil, fmt.Errorf("invalid access level '%s' (expected VIEW or EDIT)", input.AccessLevel)
+	}
+
+	ownerID, err := requireViewAccess(vss.metaDB, input.ViewType, input.ViewID, input.UserID, models.ViewAccessOwner)
+	if err != nil {
+		return nil, err
+	}
+	if err = requireUnmanaged(vss.metaDB, input.ViewType, input.ViewID); err != nil {
+		return nil, err
+	}
+
+	granteeID, err := vss.resolveGrantee(input.GranteeType, input.Grantee)
+	if err != nil {
+		return nil, err
+	}
+	if input.GranteeType == models.GranteeTypeUser && granteeID == ownerID {
+		return nil, fmt.Errorf("the owner already has full access to this view")
+	}
+
+	share := &models.ViewShare{
+		ViewType:        input.ViewType,
+		ViewID:          input.ViewID,
+		GranteeType:     input.GranteeType,
+		GranteeID:       granteeID,
+		GranteeName:     input.Grantee,
+		AccessLevel:     input.AccessLevel,
+		GrantedByUserID: &input.UserID,
+		GrantedAt:       time.Now().UTC(),
+	}
+	if err = vss.saveShare(share); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// UnshareView removes a user's or role's share on a view. Only the owner may unshare a view.
+func (vss *ViewSharingService) UnshareView(viewType, viewID, granteeType, grantee, userID string) error {
+	if _, err := requireViewAccess(vss.metaDB, viewType, viewID, userID, models.ViewAccessOwner); err != nil {
+		return err
+	}
+	if err := requireUnmanaged(vss.metaDB, viewType, viewID); err != nil {
+		return err
+	}
+
+	granteeID, err := vss.resolveGrantee(granteeType, grantee)
+	if err != nil {
+		return err
+	}
+
+	_, err = vss.metaDB.Exec(
+		"DELETE FROM view_shares WHERE view_type = ? AND view_id = ? AND grantee_type = ? AND grantee_id = ?",
+		viewType, viewID, granteeType, granteeID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove view share: %w", err)
+	}
+	return nil
+}
+
+// ListViewShares lists the shares on a view, including its published state.
+// Users with EDIT access may see who else has access.
+func (vss *ViewSharingService) ListViewShares(viewType, viewID, userID string) ([]models.ViewShare, error) {
+	if _, err := requireViewAccess(vss.metaDB, viewType, viewID, userID, models.ViewAccessEdit); err != nil {
+		return nil, err
+	}
+
+	rows, err := vss.metaDB.Query(`
+		SELECT s.id, s.view_type, s.view_id, s.grantee_type, s.grantee_id, COALESCE(u.username, r.role_name, s.grantee_id),
+		       s.access_level, s.granted_by_user_id, s.granted_at
+		FROM view_shares s
+		LEFT JOIN users u ON s.grantee_type = 'user' AND u.id = s.grantee_id
+		LEFT JOIN roles r ON s.grantee_type = 'role' AND r.id = s.grantee_id
+		WHERE s.view_type = ? AND s.view_id = ?
+		ORDER BY s.grantee_type, s.granted_at
+	`, viewType, viewID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query view shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []models.ViewShare{}
+	for rows.Next() {
+		var share models.ViewShare
+		var grantedBy sql.NullString
+		err = rows.Scan(&share.ID, &share.ViewType, &share.ViewID, &share.GranteeType, &share.GranteeID, &share.GranteeName,
+			&share.AccessLevel, &grantedBy, &share.GrantedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan view share: %w", err)
+		}
+		if grantedBy.Valid {
+			share.GrantedByUserID = &grantedBy.String
+		}
+		shares = append(shares, share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating view share rows: %w", err)
+	}
+
+	return shares, nil
+}
+
+// SetViewPublished publishes a view to (or withdraws it from) the organization-wide catalog.
+// Published views are readable by every user. Only the owner may publish a view.
+func (vss *ViewSharingService) SetViewPublished(viewType, viewID string, published bool, userID string) error {
+	if _, err := requireViewAccess(vss.metaDB, viewType, viewID, userID, models.ViewAccessOwner); err != nil {
+		return err
+	}
+	if err := requireUnmanaged(vss.metaDB, viewType, viewID); err != nil {
+		return err
+	}
+
+	if !published {
+		_, err := vss.metaDB.Exec(
+			"DELETE FROM view_shares WHERE view_type = ? AND view_id = ? AND grantee_type = ?",
+			viewType, viewID, models.GranteeTypeEveryone,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to unpublish view: %w", err)
+		}
+		return nil
+	}
+
+	return vss.saveShare(&models.ViewShare{
+		ViewType:        viewType,
+		ViewID:          viewID,
+		GranteeType:     models.GranteeTypeEveryone,
+		GranteeID:       "*",
+		AccessLevel:     models.ViewAccessView,
+		GrantedByUserID: &userID,
+		GrantedAt:       time.Now().UTC(),
+	})
+}
+
+// GetPublishedCatalog lists every published view. Entries expose no data source details.
+func (vss *ViewSharingService) GetPublishedCatalog() ([]models.CatalogEntry, error) {
+	rows, err := vss.metaDB.Query(`
+		SELECT s.view_type, v.id, v.name, v.description, u.username, s.granted_at
+		FROM view_shares s
+		JOIN virtual_views v ON s.view_type = 'virtual_view' AND v.id = s.view_id
+		JOIN users u ON u.id = v.user_id
+		WHERE s.grantee_type = 'everyone'
+		UNION ALL
+		SELECT s.view_type, v.id, v.name, v.description, u.username, s.granted_at
+		FROM view_shares s
+		JOIN virtual_base_views v ON s.view_type = 'virtual_base_view' AND v.id = s.view_id
+		JOIN users u ON u.id = v.user_id
+		WHERE s.grantee_type = 'everyone'
+		ORDER BY 3
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query published views: %w", err)
+	}
+	defer rows.Close()
+
+	catalog := []models.CatalogEntry{}
+	for rows.Next() {
+		var entry models.CatalogEntry
+		var description sql.NullString
+		err = rows.Scan(&entry.ViewType, &entry.ID, &entry.Name, &description, &entry.OwnerUsername, &entry.PublishedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan published view: %w", err)
+		}
+		if description.Valid {
+			entry.Description = &description.String
+		}
+		catalog = append(catalog, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating published view rows: %w", err)
+	}
+
+	return catalog, nil
+}
+
+// TransferViewOwnership makes another user the owner of a view. The new owner must be able to
+// QUERY every data source the view reads from, since views run with their owner's privileges.
+// The previous owner keeps EDIT access through a share.
+func (vss *ViewSharingService) TransferViewOwnership(viewType, viewID, newOwnerUsername, userID string) error {
+	if _, err := requireViewAccess(vss.metaDB, viewType, viewID, userID, models.ViewAccessOwner); err != nil {
+		return err
+	}
+	if err := requireUnmanaged(vss.metaDB, viewType, viewID); err != nil {
+		return err
+	}
+	table, _ := viewTable(viewType)
+
+	newOwnerID, err := vss.resolveGrantee(models.GranteeTypeUser, newOwnerUsername)
+	if err != nil {
+		return err
+	}
+	if newOwnerID == userID {
+		return fmt.Errorf("user '%s' already owns this view", newOwnerUsername)
+	}
+
+	dataSourceIDs, err := vss.viewDataSourceIDs(viewType, viewID)
+	if err != nil {
+		return err
+	}
+	privileges := NewPrivilegeService(vss.metaDB)
+	for _, dataSourceID := range dataSourceIDs {
+		allowed, err := privileges.HasPrivilege(dataSourceID, newOwnerID, models.PrivilegeQuery)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("user '%s' needs QUERY privilege on data source %s to own this view", newOwnerUsername, dataSourceID)
+		}
+	}
+
+	change, err := metadata.BeginChange(vss.metaDB)
+	if err != nil {
+		return err
+	}
+	defer change.Rollback()
+
+	now := time.Now().UTC()
+	err = change.ReplaceRow(table, viewID, map[string]interface{}{"user_id": newOwnerID, "updated_at": now})
+	if err != nil {
+		return fmt.Errorf("failed to transfer view ownership (the new owner may already have a view with this name): %w", err)
+	}
+
+	// The new owner no longer needs a share; the previous owner keeps EDIT access
+	_, err = change.Delete("view_shares",
+		"view_type = ? AND view_id = ? AND grantee_type = ? AND grantee_id IN (?, ?)",
+		viewType, viewID, models.GranteeTypeUser, newOwnerID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to clean up view shares: %w", err)
+	}
+	err = change.Insert("view_shares", map[string]interface{}{
+		"id": uuid.NewString(), "view_type": viewType, "view_id": viewID, "grantee_type": models.GranteeTypeUser,
+		"grantee_id": userID, "access_level": models.ViewAccessEdit, "granted_by_user_id": newOwnerID, "granted_at": now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save view share: %w", err)
+	}
+	return change.Commit()
+}
+
+// viewDataSourceIDs returns the IDs of the data sources a view reads from.
+func (vss *ViewSharingService) viewDataSourceIDs(viewType, viewID string) ([]string, error) {
+	if viewType == models.ViewTypeVirtualBaseView {
+		var dataSourceID string
+		err := vss.metaDB.QueryRow("SELECT data_source_id FROM virtual_base_views WHERE id = ?", viewID).Scan(&dataSourceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up view data source: %w", err)
+		}
+		return []string{dataSourceID}, nil
+	}
+
+	var definitionJSON string
+	err := vss.metaDB.QueryRow("SELECT definition FROM virtual_views WHERE id = ?", viewID).Scan(&definitionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get virtual view definition: %w", err)
+	}
+	var definition models.VirtualViewDefinition
+	if err = json.Unmarshal([]byte(definitionJSON), &definition); err != nil {
+		return nil, fmt.Errorf("failed to parse virtual view definition: %w", err)
+	}
+	if len(definition.SelectedColumns) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(definition.SelectedColumns))
+	args := make([]interface{}, len(definition.SelectedColumns))
+	for i, col := range definition.SelectedColumns {
+		placeholders[i] = "?"
+		args[i] = col.DataSourceSchemaID
+	}
+
+	rows, err := vss.metaDB.Query(fmt.Sprintf(
+		"SELECT DISTINCT data_source_id FROM data_source_schemas WHERE id IN (%s)", strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up view data sources: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan data source id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating data source rows: %w", err)
+	}
+	return ids, nil
+}
+
+// viewListingSQL returns the access-level expression and the WHERE condition, each with its
+// arguments, used to list the views in table that userID owns or that are shared with the
+// user directly or through one of their roles. Published views are listed in the catalog instead.
+func viewListingSQL(table, viewType, userID string) (string, []interface{}, string, []interface{}) {
+	editCondition, editArgs := viewShareGranteeCondition("s", userID, false)
+	accessExpr := fmt.Sprintf(`CASE
+			WHEN %[1]s.user_id = ? THEN '%[2]s'
+			WHEN EXISTS (SELECT 1 FROM view_shares s WHERE s.view_type = '%[3]s' AND s.view_id = %[1]s.id AND s.access_level = '%[4]s' AND %[5]s) THEN '%[4]s'
+			ELSE '%[6]s'
+		END`, table, models.ViewAccessOwner, viewType, models.ViewAccessEdit, editCondition, models.ViewAccessView)
+	accessArgs := append([]interface{}{userID}, editArgs...)
+
+	shareCondition, shareArgs := viewShareGranteeCondition("s", userID, false)
+	whereExpr := fmt.Sprintf(`(%[1]s.user_id = ? OR %[1]s.id IN (
+			SELECT s.view_id FROM view_shares s WHERE s.view_type = '%[2]s' AND %[3]s
+		))`, table, viewType, shareCondition)
+	whereArgs := append([]interface{}{userID}, shareArgs...)
+
+	return accessExpr, accessArgs, whereExpr, whereArgs
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestViewSharing(t *testing.T) {
+	db := metadatatest.NewDB(t)
+	vss := NewViewSharingService(db)
+	owner := metadatatest.InsertUser(t, db, "owner", "password")
+	alice := metadatatest.InsertUser(t, db, "alice", "password")
+	bob := metadatatest.InsertUser(t, db, "bob", "password")
+	ds := metadatatest.InsertDataSource(t, db, owner, "sales")
+
+	viewID := uuid.NewString()
+	_, err := db.Exec(`INSERT INTO virtual_base_views (id, user_id, name, data_source_id, table_name, selected_columns)
+		VALUES (?, ?, 'orders', ?, 'orders', '{"column_names":["region"]}')`, viewID, owner, ds)
+	if err != nil {
+		t.Fatalf("insert view: %v", err)
+	}
+	_, err = db.Exec("INSERT INTO user_roles (user_id, role_id) SELECT ?, id FROM roles WHERE role_name = ?", bob, models.RoleViewer)
+	if err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+
+	access := func(userID string) string {
+		t.Helper()
+		_, level, err := viewAccessLevel(db, models.ViewTypeVirtualBaseView, viewID, userID)
+		if err != nil {
+			t.Fatalf("viewAccessLevel: %v", err)
+		}
+		return level
+	}
+	share := func(userID, granteeType, grantee, level string) error {
+		_, err := vss.ShareView(models.ShareViewInput{
+			UserID: userID, ViewType: models.ViewTypeVirtualBaseView, ViewID: viewID,
+			GranteeType: granteeType, Grantee: grantee, AccessLevel: level,
+		})
+		return err
+	}
+
+	t.Run("share and unshare", func(t *testing.T) {
+		if got := access(alice); got != "" {
+			t.Fatalf("access before sharing = %q, want none", got)
+		}
+		if err := share(owner, models.GranteeTypeUser, "alice", "view"); err != nil {
+			t.Fatalf("ShareView: %v", err)
+		}
+		if err := share(owner, models.GranteeTypeUser, "alice", models.ViewAccessEdit); err != nil { // Updates the share
+			t.Fatalf("ShareView: %v", err)
+		}
+		if err := share(owner, models.GranteeTypeRole, models.RoleViewer, models.ViewAccessView); err != nil {
+			t.Fatalf("ShareView with role: %v", err)
+		}
+		if got := access(alice); got != models.ViewAccessEdit {
+			t.Errorf("alice's access = %q, want EDIT", got)
+		}
+		if got := access(bob); got != models.ViewAccessView {
+			t.Errorf("access through the viewer role = %q, want VIEW", got)
+		}
+
+		if err := share(owner, models.GranteeTypeUser, "owner", models.ViewAccessView); err == nil {
+			t.Error("sharing with the owner succeeded")
+		}
+		if err := share(owner, models.GranteeTypeUser, "alice", models.ViewAccessOwner); err == nil {
+			t.Error("sharing OWNER access succeeded")
+		}
+		if err := share(alice, models.GranteeTypeUser, "bob", models.ViewAccessView); !errors.Is(err, ErrViewAccessDenied) {
+			t.Errorf("sharing by an editor: got %v, want ErrViewAccessDenied", err)
+		}
+		if _, err := vss.ListViewShares(models.ViewTypeVirtualBaseView, viewID, bob); !errors.Is(err, ErrViewAccessDenied) {
+			t.Errorf("listing shares with VIEW access: got %v, want ErrViewAccessDenied", err)
+		}
+		if shares, err := vss.ListViewShares(models.ViewTypeVirtualBaseView, viewID, alice); err != nil || len(shares) != 2 {
+			t.Errorf("ListViewShares = %d shares (%v), want 2", len(shares), err)
+		}
+
+		if err := vss.UnshareView(models.ViewTypeVirtualBaseView, viewID, models.GranteeTypeRole, models.RoleViewer, owner); err != nil {
+			t.Fatalf("UnshareView: %v", err)
+		}
+		if got := access(bob); got != "" {
+			t.Errorf("access after unsharing = %q, want none", got)
+		}
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		if err := vss.SetViewPublished(models.ViewTypeVirtualBaseView, viewID, true, alice); !errors.Is(err, ErrViewAccessDenied) {
+			t.Errorf("publishing by an editor: got %v, want ErrViewAccessDenied", err)
+		}
+		if err := vss.SetViewPublished(models.ViewTypeVirtualBaseView, viewID, true, owner); err != nil {
+			t.Fatalf("SetViewPublished: %v", err)
+		}
+		if got := access(bob); got != models.ViewAccessView {
+			t.Errorf("access to a published view = %q, want VIEW", got)
+		}
+		if got := access(alice); got != models.ViewAccessEdit {
+			t.Errorf("publishing changed alice's access to %q, want EDIT", got)
+		}
+		catalog, err := vss.GetPublishedCatalog()
+		if err != nil || len(catalog) != 1 || catalog[0].ID != viewID || catalog[0].OwnerUsername != "owner" {
+			t.Errorf("GetPublishedCatalog = %+v (%v), want the view owned by owner", catalog, err)
+		}
+
+		if err = vss.SetViewPublished(models.ViewTypeVirtualBaseView, viewID, false, owner); err != nil {
+			t.Fatalf("SetViewPublished: %v", err)
+		}
+		if got := access(bob); got != "" {
+			t.Errorf("access to a withdrawn view = %q, want none", got)
+		}
+		if catalog, err = vss.GetPublishedCatalog(); err != nil || len(catalog) != 0 {
+			t.Errorf("GetPublishedCatalog = %+v (%v), want an empty catalog", catalog, err)
+		}
+	})
+
+	t.Run("transfer", func(t *testing.T) {
+		err := vss.TransferViewOwnership(models.ViewTypeVirtualBaseView, viewID, "bob", owner)
+		if err == nil {
+			t.Fatal("transfer to a user without QUERY on the data source succeeded")
+		}
+		_, err = NewPrivilegeService(db).GrantPrivilege(models.GrantDataSourcePrivilegeInput{
+			DataSourceID: ds, UserID: bob, PrivilegeType: models.PrivilegeQuery, GrantorUserID: owner,
+		})
+		if err != nil {
+			t.Fatalf("GrantPrivilege: %v", err)
+		}
+		if err = vss.TransferViewOwnership(models.ViewTypeVirtualBaseView, viewID, "bob", owner); err != nil {
+			t.Fatalf("TransferViewOwnership: %v", err)
+		}
+		if got := access(bob); got != models.ViewAccessOwner {
+			t.Errorf("new owner's access = %q, want OWNER", got)
+		}
+		if got := access(owner); got != models.ViewAccessEdit {
+			t.Errorf("previous owner's access = %q, want EDIT", got)
+		}
+		if err = vss.TransferViewOwnership(models.ViewTypeVirtualBaseView, viewID, "alice", owner); !errors.Is(err, ErrViewAccessDenied) {
+			t.Errorf("transfer by the previous owner: got %v, want ErrViewAccessDenied", err)
+		}
+	})
+}
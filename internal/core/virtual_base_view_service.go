@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"Bridgo/internal/metadata"
 	"Bridgo/internal/models"
 
 	_ "github.com/go-sql-driver/mysql" // MySQL driver
@@ -39,31 +40,8 @@ func (vbvs *VirtualBaseViewService) CreateVirtualBaseView(input models.CreateVir
 		return nil, fmt.Errorf("at least one column must be selected")
 	}
 
-	// Validate that all selected columns belong to the specified table and data source
-	placeholders := make([]string, len(input.SelectedColumns))
-	args := make([]interface{}, len(input.SelectedColumns)+3)
-	for i, columnName := range input.SelectedColumns {
-		placeholders[i] = "?"
-		args[i] = columnName
-	}
-	args[len(input.SelectedColumns)] = input.DataSourceID
-	args[len(input.SelectedColumns)+1] = input.TableName
-	args[len(input.SelectedColumns)+2] = input.UserID
-
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) 
-		FROM data_source_schemas dss 
-		JOIN data_sources ds ON dss.data_source_id = ds.id 
-		WHERE dss.column_name IN (%s) AND ds.id = ? AND dss.table_name = ? AND ds.user_id = ?
-	`, strings.Join(placeholders, ","))
-
-	var count int
-	err := vbvs.metaDB.QueryRow(query, args...).Scan(&count)
-	if err != nil {
-		return nil, fmt.Errorf("failed to validate column access: %w", err)
-	}
-	if count != len(input.SelectedColumns) {
-		return nil, fmt.Errorf("some selected columns do not belong to the specified table or data source")
+	if err := vbvs.validateColumnAccess(input.DataSourceID, input.TableName, input.SelectedColumns, input.UserID); err != nil {
+		return nil, err
 	}
 
 	// Create definition
@@ -86,6 +64,7 @@ func (vbvs *VirtualBaseViewService) CreateVirtualBaseView(input models.CreateVir
 		SelectedColumns: string(definitionJSON),
 		CreatedAt:       now,
 		UpdatedAt:       now,
+		AccessLevel:     models.ViewAccessOwner,
 	}
 
 	_, err = vbvs.metaDB.Exec(`
@@ -102,16 +81,117 @@ func (vbvs *VirtualBaseViewService) CreateVirtualBaseView(input models.CreateVir
 	return virtualBaseView, nil
 }
 
-// GetUserVirtualBaseViews retrieves all virtual base views for a user
+// UpdateVirtualBaseView changes the name, description or columns of a virtual base view.
+// The owner and users the view is shared with for EDIT may update it. The columns must be
+// readable by both the editor and the owner, whose privileges the view runs with.
+func (vbvs *VirtualBaseViewService) UpdateVirtualBaseView(input models.UpdateVirtualBaseViewInput) (*models.VirtualBaseView, error) {
+	ownerID, err := requireViewAccess(vbvs.metaDB, models.ViewTypeVirtualBaseView, input.ID, input.UserID, models.ViewAccessEdit)
+	if err != nil {
+		return nil, err
+	}
+	if err = requireUnmanaged(vbvs.metaDB, models.ManagedVirtualBaseView, input.ID); err != nil {
+		return nil, err
+	}
+	if input.Name != nil && *input.Name == "" {
+		return nil, fmt.Errorf("virtual base view name cannot be empty")
+	}
+
+	now := time.Now().UTC()
+	if input.SelectedColumns != nil {
+		if len(input.SelectedColumns) == 0 {
+			return nil, fmt.Errorf("at least one column must be selected")
+		}
+
+		var dataSourceID, tableName string
+		err = vbvs.metaDB.QueryRow("SELECT data_source_id, table_name FROM virtual_base_views WHERE id = ?", input.ID).Scan(&dataSourceID, &tableName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get virtual base view: %w", err)
+		}
+		for _, checkedUserID := range []string{input.UserID, ownerID} {
+			if err = vbvs.validateColumnAccess(dataSourceID, tableName, input.SelectedColumns, checkedUserID); err != nil {
+				return nil, err
+			}
+		}
+
+		definitionJSON, err := json.Marshal(models.VirtualBaseViewDefinition{ColumnNames: input.SelectedColumns})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal virtual base view definition: %w", err)
+		}
+		if _, err = vbvs.metaDB.Exec("UPDATE virtual_base_views SET selected_columns = ?, updated_at = ? WHERE id = ?", string(definitionJSON), now, input.ID); err != nil {
+			return nil, fmt.Errorf("failed to update virtual base view columns: %w", err)
+		}
+	}
+	if input.Description != nil {
+		if _, err = vbvs.metaDB.Exec("UPDATE virtual_base_views SET description = ?, updated_at = ? WHERE id = ?", *input.Description, now, input.ID); err != nil {
+			return nil, fmt.Errorf("failed to update virtual base view description: %w", err)
+		}
+	}
+	if input.Name != nil {
+		// name is part of the (user_id, name) unique index, which DuckDB cannot UPDATE in place
+		if err = metadata.ReplaceRow(vbvs.metaDB, "virtual_base_views", input.ID, map[string]interface{}{"name": *input.Name, "updated_at": now}); err != nil {
+			return nil, fmt.Errorf("failed to rename virtual base view: %w. Ensure the name is unique for this user.", err)
+		}
+	}
+
+	var vbv models.VirtualBaseView
+	var description sql.NullString
+	err = vbvs.metaDB.QueryRow(`
+		SELECT id, user_id, name, description, data_source_id, table_name, selected_columns, created_at, updated_at
+		FROM virtual_base_views WHERE id = ?
+	`, input.ID).Scan(&vbv.ID, &vbv.UserID, &vbv.Name, &description, &vbv.DataSourceID, &vbv.TableName, &vbv.SelectedColumns, &vbv.CreatedAt, &vbv.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload virtual base view: %w", err)
+	}
+	if description.Valid {
+		vbv.Description = &description.String
+	}
+	return &vbv, nil
+}
+
+// validateColumnAccess checks that all columns belong to the given table and to a data source
+// the user owns or has been granted QUERY on.
+func (vbvs *VirtualBaseViewService) validateColumnAccess(dataSourceID, tableName string, columnNames []string, userID string) error {
+	placeholders := make([]string, len(columnNames))
+	args := make([]interface{}, len(columnNames)+2)
+	for i, columnName := range columnNames {
+		placeholders[i] = "?"
+		args[i] = columnName
+	}
+	args[len(columnNames)] = dataSourceID
+	args[len(columnNames)+1] = tableName
+	accessCondition, accessArgs := dataSourceAccessCondition("ds.id", "ds.user_id", userID, models.PrivilegeQuery)
+	args = append(args, accessArgs...)
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) 
+		FROM data_source_schemas dss 
+		JOIN data_sources ds ON dss.data_source_id = ds.id 
+		WHERE dss.column_name IN (%s) AND ds.id = ? AND dss.table_name = ? AND %s
+	`, strings.Join(placeholders, ","), accessCondition)
+
+	var count int
+	err := vbvs.metaDB.QueryRow(query, args...).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to validate column access: %w", err)
+	}
+	if count != len(columnNames) {
+		return fmt.Errorf("some selected columns do not belong to the specified table or data source")
+	}
+	return nil
+}
+
+// GetUserVirtualBaseViews retrieves all virtual base views a user owns or that are shared with them
 func (vbvs *VirtualBaseViewService) GetUserVirtualBaseViews(userID string) ([]models.VirtualBaseView, error) {
+	accessExpr, accessArgs, whereExpr, whereArgs := viewListingSQL("virtual_base_views", models.ViewTypeVirtualBaseView, userID)
 	query := `
-        SELECT id, user_id, name, description, data_source_id, table_name, selected_columns, created_at, updated_at, last_accessed_at
+        SELECT id, user_id, name, description, data_source_id, table_name, selected_columns, created_at, updated_at, last_accessed_at, ` + accessExpr + `,
+               ` + managedExpr(models.ManagedVirtualBaseView, "id") + `
         FROM virtual_base_views 
-        WHERE user_id = ? 
+        WHERE ` + whereExpr + `
         ORDER BY created_at DESC
     `
 
-	rows, err := vbvs.metaDB.Query(query, userID)
+	rows, err := vbvs.metaDB.Query(query, append(accessArgs, whereArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query virtual base views: %w", err)
 	}
@@ -124,7 +204,7 @@ func (vbvs *VirtualBaseViewService) GetUserVirtualBaseViews(userID string) ([]mo
 		var lastAccessedAt sql.NullTime
 
 		err = rows.Scan(&vbv.ID, &vbv.UserID, &vbv.Name, &description, &vbv.DataSourceID,
-			&vbv.TableName, &vbv.SelectedColumns, &vbv.CreatedAt, &vbv.UpdatedAt, &lastAccessedAt)
+			&vbv.TableName, &vbv.SelectedColumns, &vbv.CreatedAt, &vbv.UpdatedAt, &lastAccessedAt, &vbv.AccessLevel, &vbv.Managed)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan virtual base view: %w", err)
 		}
@@ -148,9 +228,13 @@ func (vbvs *VirtualBaseViewService) GetUserVirtualBaseViews(userID string) ([]mo
 
 // GetVirtualBaseViewSchema retrieves schema information for a virtual base view
 func (vbvs *VirtualBaseViewService) GetVirtualBaseViewSchema(virtualBaseViewID string, userID string) ([]models.DataSourceSchema, error) {
-	// First verify the virtual base view belongs to the user and get its definition
+	// First verify the user owns the virtual base view or it is shared with them, then get its definition
+	if _, err := requireViewAccess(vbvs.metaDB, models.ViewTypeVirtualBaseView, virtualBaseViewID, userID, models.ViewAccessView); err != nil {
+		return nil, err
+	}
+
 	var selectedColumnsJSON, dataSourceID, tableName string
-	err := vbvs.metaDB.QueryRow("SELECT selected_columns, data_source_id, table_name FROM virtual_base_views WHERE id = ? AND user_id = ?", virtualBaseViewID, userID).Scan(&selectedColumnsJSON, &dataSourceID, &tableName)
+	err := vbvs.metaDB.QueryRow("SELECT selected_columns, data_source_id, table_name FROM virtual_base_views WHERE id = ?", virtualBaseViewID).Scan(&selectedColumnsJSON, &dataSourceID, &tableName)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("virtual base view not found or access denied")
@@ -213,13 +297,20 @@ func (vbvs *VirtualBaseViewService) GetVirtualBaseViewSchema(virtualBaseViewID s
 
 // GetVirtualBaseViewSampleData retrieves sample data (5 rows) from a virtual base view
 func (vbvs *VirtualBaseViewService) GetVirtualBaseViewSampleData(virtualBaseViewID string, userID string) (map[string]interface{}, error) {
+	// Verify the user may read the view. Data is then read with the owner's data source
+	// privileges, so consumers never need (or see) the underlying credentials.
+	ownerID, err := requireViewAccess(vbvs.metaDB, models.ViewTypeVirtualBaseView, virtualBaseViewID, userID, models.ViewAccessView)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get virtual base view details
 	var dataSourceID, tableName, selectedColumnsJSON string
-	err := vbvs.metaDB.QueryRow(`
+	err = vbvs.metaDB.QueryRow(`
 		SELECT data_source_id, table_name, selected_columns 
 		FROM virtual_base_views 
-		WHERE id = ? AND user_id = ?
-	`, virtualBaseViewID, userID).Scan(&dataSourceID, &tableName, &selectedColumnsJSON)
+		WHERE id = ?
+	`, virtualBaseViewID).Scan(&dataSourceID, &tableName, &selectedColumnsJSON)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -237,19 +328,18 @@ func (vbvs *VirtualBaseViewService) GetVirtualBaseViewSampleData(virtualBaseView
 
 	// Get data source connection info
 	var dbType string
-	var host sql.NullString
-	var port sql.NullInt64
-	var databaseName sql.NullString
-	var dbUsername sql.NullString
-	var passwordEncrypted sql.NullString
 
+	// The view owner must still own the data source or hold an unexpired QUERY privilege on it
+	accessCondition, accessArgs := dataSourceAccessCondition("id", "user_id", ownerID, models.PrivilegeQuery)
 	err = vbvs.metaDB.QueryRow(`
-		SELECT db_type, host, port, database_name, db_username, password_encrypted
+		SELECT db_type
 		FROM data_sources 
-		WHERE id = ? AND user_id = ?
-	`, dataSourceID, userID).Scan(&dbType, &host, &port, &databaseName, &dbUsername, &passwordEncrypted)
+		WHERE id = ? AND `+accessCondition, append([]interface{}{dataSourceID}, accessArgs...)...).Scan(&dbType)
 
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("data source not found or access denied")
+		}
 		return nil, fmt.Errorf("failed to get data source info: %w", err)
 	}
 
@@ -257,37 +347,36 @@ func (vbvs *VirtualBaseViewService) GetVirtualBaseViewSampleData(virtualBaseView
 	columnNames := definition.ColumnNames
 
 	// Connect to external database
-	var connectionString string
-	var driverName string
-
-	switch dbType {
-	case "postgresql":
-		driverName = "postgres"
-		connectionString = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-			host.String, port.Int64, dbUsername.String, passwordEncrypted.String, databaseName.String)
-	case "mysql":
-		driverName = "mysql"
-		connectionString = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-			dbUsername.String, passwordEncrypted.String, host.String, port.Int64, databaseName.String)
-	default:
-		return nil, fmt.Errorf("unsupported database type: %s", dbType)
-	}
-
-	extDB, err := sql.Open(driverName, connectionString)
+	extDB, err := openDataSourceByID(vbvs.metaDB, dataSourceID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to external database: %w", err)
+		return nil, err
 	}
 	defer extDB.Close()
 
-	err = extDB.Ping()
+	// Resolve the masking policies that apply to the caller before reading any data
+	maskColumns := make([]resultColumn, len(columnNames))
+	for i, name := range columnNames {
+		maskColumns[i] = resultColumn{Name: name, DataSourceID: dataSourceID, TableName: tableName, ColumnName: name}
+	}
+	masker, err := columnMasker(vbvs.metaDB, models.ViewTypeVirtualBaseView, virtualBaseViewID, userID, maskColumns)
 	if err != nil {
-		return nil, fmt.Errorf("failed to ping external database: %w", err)
+		return nil, err
+	}
+
+	// Restrict the query to the rows the caller may see
+	rowFilter, rowFilterArgs, err := rowSecurityFilter(vbvs.metaDB, models.ViewTypeVirtualBaseView, virtualBaseViewID, userID, bindVarFor(dbType), 0)
+	if err != nil {
+		return nil, err
+	}
+	whereClause := ""
+	if rowFilter != "" {
+		whereClause = " WHERE " + rowFilter
 	}
 
 	// Build SELECT query for the single table
-	selectQuery := fmt.Sprintf("SELECT %s FROM %s LIMIT 5", strings.Join(columnNames, ", "), tableName)
+	selectQuery := fmt.Sprintf("SELECT %s FROM %s%s LIMIT 5", strings.Join(columnNames, ", "), tableName, whereClause)
 
-	dataRows, err := extDB.Query(selectQuery)
+	dataRows, err := extDB.Query(selectQuery, rowFilterArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute sample data query: %w", err)
 	}
@@ -300,8 +389,11 @@ func (vbvs *VirtualBaseViewService) GetVirtualBaseViewSampleData(virtualBaseView
 	}
 
 	result := map[string]interface{}{
-		"columns": columnNames,
-		"rows":    []map[string]interface{}{},
+		"columns":        columnNames,
+		"rows":           []map[string]interface{}{},
+		"query":          selectQuery,
+		"data_source_id": dataSourceID,
+		"masked_columns": masker.maskedColumns(columnNames),
 	}
 
 	for dataRows.Next() {
@@ -326,9 +418,9 @@ func (vbvs *VirtualBaseViewService) GetVirtualBaseViewSampleData(virtualBaseView
 			} else {
 				switch v := val.(type) {
 				case []byte:
-					row[columnNames[i]] = string(v)
+					row[columnNames[i]] = masker.apply(i, string(v))
 				default:
-					row[columnNames[i]] = v
+					row[columnNames[i]] = masker.apply(i, v)
 				}
 			}
 		}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"Bridgo/internal/metadata"
 	"Bridgo/internal/models"
 
 	_ "github.com/go-sql-driver/mysql" // MySQL driver
@@ -41,33 +42,13 @@ func (vvs *VirtualViewService) CreateVirtualView(input CreateVirtualViewInput) (
 		return nil, fmt.Errorf("at least one schema column must be selected")
 	}
 
-	// Validate that all SelectedSchemaIDs belong to data sources accessible by UserID
-	for _, schema_id := range input.SelectedSchemaIDs {
-		var count int
-		err := vvs.metaDB.QueryRow(`
-			SELECT COUNT(*) 
-			FROM data_source_schemas dss 
-			JOIN data_sources ds ON dss.data_source_id = ds.id 
-			WHERE dss.id = ? AND ds.user_id = ?
-		`, schema_id, input.UserID).Scan(&count)
-		if err != nil {
-			return nil, fmt.Errorf("failed to validate schema access: %w", err)
-		}
-		if count == 0 {
-			return nil, fmt.Errorf("schema with ID %s not found or access denied", schema_id)
-		}
-	}
-
-	definition := models.VirtualViewDefinition{
-		SelectedColumns: make([]models.SelectedColumn, len(input.SelectedSchemaIDs)),
-	}
-	for i, schema_id := range input.SelectedSchemaIDs {
-		definition.SelectedColumns[i] = models.SelectedColumn{DataSourceSchemaID: schema_id}
+	if err := vvs.validateSchemaAccess(input.SelectedSchemaIDs, input.UserID); err != nil {
+		return nil, err
 	}
 
-	definition_json, err := json.Marshal(definition)
+	definition_json, err := buildVirtualViewDefinition(input.SelectedSchemaIDs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal virtual view definition: %w", err)
+		return nil, err
 	}
 
 	now := time.Now().UTC()
@@ -76,9 +57,10 @@ func (vvs *VirtualViewService) CreateVirtualView(input CreateVirtualViewInput) (
 		UserID:      input.UserID,
 		Name:        input.Name,
 		Description: input.Description,
-		Definition:  string(definition_json),
+		Definition:  definition_json,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		AccessLevel: models.ViewAccessOwner,
 	}
 
 	_, err = vvs.metaDB.Exec(`
@@ -97,16 +79,122 @@ func (vvs *VirtualViewService) CreateVirtualView(input CreateVirtualViewInput) (
 	return virtual_view, nil
 }
 
-// GetUserVirtualViews retrieves all virtual views for a user
+// UpdateVirtualViewInput defines the input for updating a virtual view. Nil fields are left unchanged.
+type UpdateVirtualViewInput struct {
+	UserID            string   `json:"-"` // Passed internally
+	ID                string   `json:"id"`
+	Name              *string  `json:"name"`
+	Description       *string  `json:"description"`
+	SelectedSchemaIDs []string `json:"selected_schema_ids"`
+}
+
+// UpdateVirtualView changes the name, description or columns of a virtual view.
+// The owner and users the view is shared with for EDIT may update it. New columns must be
+// readable by both the editor and the owner, whose privileges the view runs with.
+func (vvs *VirtualViewService) UpdateVirtualView(input UpdateVirtualViewInput) (*models.VirtualView, error) {
+	owner_id, err := requireViewAccess(vvs.metaDB, models.ViewTypeVirtualView, input.ID, input.UserID, models.ViewAccessEdit)
+	if err != nil {
+		return nil, err
+	}
+	if err = requireUnmanaged(vvs.metaDB, models.ManagedVirtualView, input.ID); err != nil {
+		return nil, err
+	}
+	if input.Name != nil && *input.Name == "" {
+		return nil, fmt.Errorf("virtual view name cannot be empty")
+	}
+
+	now := time.Now().UTC()
+	if input.SelectedSchemaIDs != nil {
+		if len(input.SelectedSchemaIDs) == 0 {
+			return nil, fmt.Errorf("at least one schema column must be selected")
+		}
+		for _, checked_user_id := range []string{input.UserID, owner_id} {
+			if err = vvs.validateSchemaAccess(input.SelectedSchemaIDs, checked_user_id); err != nil {
+				return nil, err
+			}
+		}
+		definition_json, err := buildVirtualViewDefinition(input.SelectedSchemaIDs)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = vvs.metaDB.Exec("UPDATE virtual_views SET definition = ?, updated_at = ? WHERE id = ?", definition_json, now, input.ID); err != nil {
+			return nil, fmt.Errorf("failed to update virtual view definition: %w", err)
+		}
+	}
+	if input.Description != nil {
+		if _, err = vvs.metaDB.Exec("UPDATE virtual_views SET description = ?, updated_at = ? WHERE id = ?", *input.Description, now, input.ID); err != nil {
+			return nil, fmt.Errorf("failed to update virtual view description: %w", err)
+		}
+	}
+	if input.Name != nil {
+		// name is part of the (user_id, name) unique index, which DuckDB cannot UPDATE in place
+		if err = metadata.ReplaceRow(vvs.metaDB, "virtual_views", input.ID, map[string]interface{}{"name": *input.Name, "updated_at": now}); err != nil {
+			return nil, fmt.Errorf("failed to rename virtual view: %w. Ensure the name is unique for this user.", err)
+		}
+	}
+
+	var vv models.VirtualView
+	var description sql.NullString
+	err = vvs.metaDB.QueryRow(
+		"SELECT id, user_id, name, description, definition, created_at, updated_at FROM virtual_views WHERE id = ?", input.ID,
+	).Scan(&vv.ID, &vv.UserID, &vv.Name, &description, &vv.Definition, &vv.CreatedAt, &vv.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload virtual view: %w", err)
+	}
+	if description.Valid {
+		vv.Description = &description.String
+	}
+	return &vv, nil
+}
+
+// validateSchemaAccess checks that every schema column belongs to a data source user_id owns or may QUERY.
+func (vvs *VirtualViewService) validateSchemaAccess(schema_ids []string, user_id string) error {
+	access_condition, access_args := dataSourceAccessCondition("ds.id", "ds.user_id", user_id, models.PrivilegeQuery)
+	for _, schema_id := range schema_ids {
+		var count int
+		err := vvs.metaDB.QueryRow(`
+			SELECT COUNT(*) 
+			FROM data_source_schemas dss 
+			JOIN data_sources ds ON dss.data_source_id = ds.id 
+			WHERE dss.id = ? AND `+access_condition, append([]interface{}{schema_id}, access_args...)...).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to validate schema access: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("schema with ID %s not found or access denied", schema_id)
+		}
+	}
+	return nil
+}
+
+// buildVirtualViewDefinition returns the JSON definition selecting the given schema columns.
+func buildVirtualViewDefinition(schema_ids []string) (string, error) {
+	definition := models.VirtualViewDefinition{
+		SelectedColumns: make([]models.SelectedColumn, len(schema_ids)),
+	}
+	for i, schema_id := range schema_ids {
+		definition.SelectedColumns[i] = models.SelectedColumn{DataSourceSchemaID: schema_id}
+	}
+
+	definition_json, err := json.Marshal(definition)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal virtual view definition: %w", err)
+	}
+	return string(definition_json), nil
+}
+
+// GetUserVirtualViews retrieves all virtual views a user owns or that are shared with them
 func (vvs *VirtualViewService) GetUserVirtualViews(user_id string) ([]models.VirtualView, error) {
+	access_expr, access_args, where_expr, where_args := viewListingSQL("virtual_views", models.ViewTypeVirtualView, user_id)
 	query := `
-        SELECT id, user_id, name, description, definition, created_at, updated_at, last_accessed_at
+        SELECT id, user_id, name, description, definition, created_at, updated_at, last_accessed_at, ` + access_expr + `,
+               ` + managedExpr(models.ManagedVirtualView, "id") + `
         FROM virtual_views 
-        WHERE user_id = ? 
+        WHERE ` + where_expr + `
         ORDER BY created_at DESC
     `
 
-	rows, err := vvs.metaDB.Query(query, user_id)
+	rows, err := vvs.metaDB.Query(query, append(access_args, where_args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query virtual views: %w", err)
 	}
@@ -118,7 +206,7 @@ func (vvs *VirtualViewService) GetUserVirtualViews(user_id string) ([]models.Vir
 		var description sql.NullString
 		var last_accessed_at sql.NullTime
 
-		err = rows.Scan(&vv.ID, &vv.UserID, &vv.Name, &description, &vv.Definition, &vv.CreatedAt, &vv.UpdatedAt, &last_accessed_at)
+		err = rows.Scan(&vv.ID, &vv.UserID, &vv.Name, &description, &vv.Definition, &vv.CreatedAt, &vv.UpdatedAt, &last_accessed_at, &vv.AccessLevel, &vv.Managed)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan virtual view: %w", err)
 		}
@@ -142,9 +230,13 @@ func (vvs *VirtualViewService) GetUserVirtualViews(user_id string) ([]models.Vir
 
 // GetVirtualViewSchema retrieves schema information for a virtual view
 func (vvs *VirtualViewService) GetVirtualViewSchema(virtual_view_id string, user_id string) ([]models.DataSourceSchema, error) {
-	// First verify the virtual view belongs to the user
+	// First verify the user owns the virtual view or it is shared with them
+	if _, err := requireViewAccess(vvs.metaDB, models.ViewTypeVirtualView, virtual_view_id, user_id, models.ViewAccessView); err != nil {
+		return nil, err
+	}
+
 	var definition_json string
-	err := vvs.metaDB.QueryRow("SELECT definition FROM virtual_views WHERE id = ? AND user_id = ?", virtual_view_id, user_id).Scan(&definition_json)
+	err := vvs.metaDB.QueryRow("SELECT definition FROM virtual_views WHERE id = ?", virtual_view_id).Scan(&definition_json)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("virtual view not found or access denied")
@@ -204,9 +296,15 @@ func (vvs *VirtualViewService) GetVirtualViewSchema(virtual_view_id string, user
 
 // GetVirtualViewSampleData retrieves sample data (5 rows) from a virtual view
 func (vvs *VirtualViewService) GetVirtualViewSampleData(virtual_view_id string, user_id string) (map[string]interface{}, error) {
-	// First verify the virtual view belongs to the user and get its definition
+	// First verify the user may read the virtual view. Data is then read with the owner's
+	// data source privileges, so consumers never need (or see) the underlying credentials.
+	owner_id, err := requireViewAccess(vvs.metaDB, models.ViewTypeVirtualView, virtual_view_id, user_id, models.ViewAccessView)
+	if err != nil {
+		return nil, err
+	}
+
 	var definition_json string
-	err := vvs.metaDB.QueryRow("SELECT definition FROM virtual_views WHERE id = ? AND user_id = ?", virtual_view_id, user_id).Scan(&definition_json)
+	err = vvs.metaDB.QueryRow("SELECT definition FROM virtual_views WHERE id = ?", virtual_view_id).Scan(&definition_json)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("virtual view not found or access denied")
@@ -225,23 +323,24 @@ func (vvs *VirtualViewService) GetVirtualViewSampleData(virtual_view_id string,
 		return nil, fmt.Errorf("virtual view has no selected columns")
 	}
 
-	// Get schema information for the selected columns
+	// Get schema information for the selected columns, limited to data sources the owner may still QUERY
 	placeholders := make([]string, len(definition.SelectedColumns))
 	args := make([]interface{}, len(definition.SelectedColumns))
 	for i, col := range definition.SelectedColumns {
 		placeholders[i] = "?"
 		args[i] = col.DataSourceSchemaID
 	}
+	access_condition, access_args := dataSourceAccessCondition("ds.id", "ds.user_id", owner_id, models.PrivilegeQuery)
 
 	query := fmt.Sprintf(`
 		SELECT dss.id, dss.table_name, dss.column_name, ds.id as datasource_id, ds.db_type, ds.host, ds.port, ds.database_name, ds.db_username, ds.password_encrypted
 		FROM data_source_schemas dss 
 		JOIN data_sources ds ON dss.data_source_id = ds.id
-		WHERE dss.id IN (%s) AND ds.user_id = ?
+		WHERE dss.id IN (%s) AND %s
 		ORDER BY dss.table_name, dss.column_name
-	`, strings.Join(placeholders, ","))
+	`, strings.Join(placeholders, ","), access_condition)
 
-	args = append(args, user_id)
+	args = append(args, access_args...)
 
 	rows, err := vvs.metaDB.Query(query, args...)
 	if err != nil {
@@ -268,6 +367,7 @@ func (vvs *VirtualViewService) GetVirtualViewSampleData(virtual_view_id string,
 	}
 
 	dataSources := make(map[string]*DataSourceInfo)
+	accessible_columns := 0
 
 	for rows.Next() {
 		var col ColumnInfo
@@ -287,12 +387,17 @@ func (vvs *VirtualViewService) GetVirtualViewSampleData(virtual_view_id string,
 			ds.Tables[col.TableName] = []ColumnInfo{}
 		}
 		ds.Tables[col.TableName] = append(ds.Tables[col.TableName], col)
+		accessible_columns++
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating schema rows: %w", err)
 	}
 
+	if accessible_columns != len(definition.SelectedColumns) {
+		return nil, fmt.Errorf("access denied to one or more data sources used by this virtual view")
+	}
+
 	// Execute queries against each data source
 	result := map[string]interface{}{
 		"columns": []string{},
@@ -307,42 +412,28 @@ func (vvs *VirtualViewService) GetVirtualViewSampleData(virtual_view_id string,
 
 	for _, dsInfo := range dataSources {
 		// Connect to the external database
-		var connectionString string
-		var driverName string
-
-		switch dsInfo.DBType {
-		case "postgresql":
-			driverName = "postgres" // Correct driver name for github.com/lib/pq
-			connectionString = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-				dsInfo.Host.String, dsInfo.Port.Int64, dsInfo.DBUsername.String, dsInfo.PasswordEncrypted.String, dsInfo.DatabaseName.String)
-		case "mysql":
-			driverName = "mysql" // Correct driver name for github.com/go-sql-driver/mysql
-			connectionString = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-				dsInfo.DBUsername.String, dsInfo.PasswordEncrypted.String, dsInfo.Host.String, dsInfo.Port.Int64, dsInfo.DatabaseName.String)
-		default:
-			return nil, fmt.Errorf("unsupported database type: %s", dsInfo.DBType)
-		}
-
-		ext_db, err := sql.Open(driverName, connectionString)
+		ext_db, err := openDataSourceByID(vvs.metaDB, dsInfo.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to connect to external database: %w", err)
+			return nil, err
 		}
 		defer ext_db.Close()
 
-		err = ext_db.Ping()
-		if err != nil {
-			return nil, fmt.Errorf("failed to ping external database: %w", err)
-		}
-
 		// Build SELECT query
 		var columns []string
 		var tableNames []string
+		var maskColumns []resultColumn
 
 		for tableName, cols := range dsInfo.Tables {
 			tableNames = append(tableNames, tableName)
 			for _, col := range cols {
 				columns = append(columns, fmt.Sprintf("%s.%s", tableName, col.ColumnName))
 				result["columns"] = append(result["columns"].([]string), fmt.Sprintf("%s.%s", tableName, col.ColumnName))
+				maskColumns = append(maskColumns, resultColumn{
+					Name:         fmt.Sprintf("%s.%s", tableName, col.ColumnName),
+					DataSourceID: dsInfo.ID,
+					TableName:    tableName,
+					ColumnName:   col.ColumnName,
+				})
 			}
 		}
 
@@ -352,9 +443,28 @@ func (vvs *VirtualViewService) GetVirtualViewSampleData(virtual_view_id string,
 			return nil, fmt.Errorf("virtual views with multiple tables require JOIN logic which is not implemented yet")
 		}
 
-		selectQuery := fmt.Sprintf("SELECT %s FROM %s LIMIT 5", strings.Join(columns, ", "), tableNames[0])
+		// Resolve the masking policies that apply to the caller before reading any data
+		masker, err := columnMasker(vvs.metaDB, models.ViewTypeVirtualView, virtual_view_id, user_id, maskColumns)
+		if err != nil {
+			return nil, err
+		}
+
+		// Restrict the query to the rows the caller may see
+		rowFilter, rowFilterArgs, err := rowSecurityFilter(vvs.metaDB, models.ViewTypeVirtualView, virtual_view_id, user_id, bindVarFor(dsInfo.DBType), 0)
+		if err != nil {
+			return nil, err
+		}
+		whereClause := ""
+		if rowFilter != "" {
+			whereClause = " WHERE " + rowFilter
+		}
+
+		selectQuery := fmt.Sprintf("SELECT %s FROM %s%s LIMIT 5", strings.Join(columns, ", "), tableNames[0], whereClause)
+		result["query"] = selectQuery
+		result["data_source_id"] = dsInfo.ID
+		result["masked_columns"] = masker.maskedColumns(columns)
 
-		dataRows, err := ext_db.Query(selectQuery)
+		dataRows, err := ext_db.Query(selectQuery, rowFilterArgs...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to execute sample data query: %w", err)
 		}
@@ -388,9 +498,9 @@ func (vvs *VirtualViewService) GetVirtualViewSampleData(virtual_view_id string,
 				} else {
 					switch v := val.(type) {
 					case []byte:
-						row[i] = string(v)
+						row[i] = masker.apply(i, string(v))
 					default:
-						row[i] = v
+						row[i] = masker.apply(i, v)
 					}
 				}
 			}
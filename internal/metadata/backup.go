@@ -0,0 +1,421 @@
+package metadata
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snapshotFormat is the version of the snapshot file layout, independent of the schema version.
+const snapshotFormat = 1
+
+// Snapshot is a gzip-compressed JSON copy of every metadata table. It records the schema version
+// it was taken at, so it can be restored into a database of the same layout.
+type Snapshot struct {
+	Format        int             `json:"format"`
+	SchemaVersion int             `json:"schema_version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Tables        []SnapshotTable `json:"tables"` // Referenced tables before the tables referencing them
+}
+
+// SnapshotTable holds the rows of one table.
+type SnapshotTable struct {
+	Name    string           `json:"name"`
+	Columns []SnapshotColumn `json:"columns"`
+	Rows    [][]interface{}  `json:"rows"`
+}
+
+// SnapshotColumn describes a column of a SnapshotTable.
+type SnapshotColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // Database type name, e.g. TEXT or TIMESTAMP
+}
+
+// SnapshotInfo summarizes a written or restored snapshot.
+type SnapshotInfo struct {
+	SchemaVersion int            `json:"schema_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	RowCounts     map[string]int `json:"row_counts"`
+}
+
+// WriteSnapshot writes a consistent snapshot of the metadata database to w while Bridgo keeps
+// running: all tables are read in one transaction, so concurrent changes are either fully in the
+// snapshot or not at all.
+func WriteSnapshot(db *sql.DB, w io.Writer) (SnapshotInfo, error) {
+	ctx := context.Background()
+	var opts *sql.TxOptions
+	if IsPostgres(db) {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	// DuckDB transactions always read a snapshot
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to begin snapshot: %w", err)
+	}
+	defer tx.Rollback()
+
+	info := SnapshotInfo{CreatedAt: time.Now().UTC(), RowCounts: map[string]int{}}
+	if info.SchemaVersion, err = schemaVersion(tx); err != nil {
+		return SnapshotInfo{}, err
+	}
+	if info.SchemaVersion == 0 {
+		return SnapshotInfo{}, errors.New("the metadata database has no schema to back up")
+	}
+	tables, err := tablesInDependencyOrder(tx, IsPostgres(db))
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	zw := gzip.NewWriter(w)
+	out := &errWriter{w: zw}
+	header, _ := json.Marshal(struct {
+		Format        int       `json:"format"`
+		SchemaVersion int       `json:"schema_version"`
+		CreatedAt     time.Time `json:"created_at"`
+	}{snapshotFormat, info.SchemaVersion, info.CreatedAt})
+	// The tables are streamed into the header object, so large audit logs are never held in memory
+	out.write(header[:len(header)-1])
+	out.write([]byte(`,"tables":[`))
+	for i, table := range tables {
+		if i > 0 {
+			out.write([]byte(","))
+		}
+		count, err := writeSnapshotTable(tx, table, out)
+		if err != nil {
+			return SnapshotInfo{}, err
+		}
+		info.RowCounts[table] = count
+	}
+	out.write([]byte("]}\n"))
+	if out.err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to write snapshot: %w", out.err)
+	}
+	if err = zw.Close(); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return info, nil
+}
+
+// writeSnapshotTable writes one table as a SnapshotTable object and returns its row count.
+func writeSnapshotTable(tx *sql.Tx, table string, out *errWriter) (int, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT * FROM %s", table))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+	columns := make([]SnapshotColumn, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = SnapshotColumn{Name: ct.Name(), Type: strings.ToUpper(ct.DatabaseTypeName())}
+	}
+	head, _ := json.Marshal(struct {
+		Name    string           `json:"name"`
+		Columns []SnapshotColumn `json:"columns"`
+	}{table, columns})
+	out.write(head[:len(head)-1])
+	out.write([]byte(`,"rows":[`))
+
+	count := 0
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(ptrs...); err != nil {
+			return count, fmt.Errorf("failed to scan %s row: %w", table, err)
+		}
+		for i, value := range values {
+			// lib/pq returns text as bytes; the schema has no binary columns
+			if raw, ok := value.([]byte); ok {
+				values[i] = string(raw)
+			}
+		}
+		row, err := json.Marshal(values)
+		if err != nil {
+			return count, fmt.Errorf("failed to encode %s row: %w", table, err)
+		}
+		if count > 0 {
+			out.write([]byte(","))
+		}
+		out.write(row)
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return count, fmt.Errorf("error iterating %s rows: %w", table, err)
+	}
+	out.write([]byte("]}"))
+	return count, nil
+}
+
+// ReadSnapshot reads and checks a snapshot written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a Bridgo snapshot: %w", err)
+	}
+	defer zr.Close()
+
+	decoder := json.NewDecoder(zr)
+	decoder.UseNumber()
+	var snapshot Snapshot
+	if err = decoder.Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if snapshot.Format != snapshotFormat {
+		return nil, fmt.Errorf("unsupported snapshot format %d", snapshot.Format)
+	}
+	if snapshot.SchemaVersion < 1 {
+		return nil, errors.New("snapshot has no schema version")
+	}
+	return &snapshot, nil
+}
+
+// CheckVersion fails with ErrSchemaTooNew if the snapshot was taken by a newer Bridgo than this
+// one, which could not restore it.
+func (s *Snapshot) CheckVersion() error {
+	if s.SchemaVersion > LatestSchemaVersion() {
+		return fmt.Errorf("%w: snapshot is at version %d, this binary knows up to %d",
+			ErrSchemaTooNew, s.SchemaVersion, LatestSchemaVersion())
+	}
+	return nil
+}
+
+// RestoreSnapshot replaces the whole metadata database with a snapshot, in one transaction: the
+// tables are dropped, re-created by the migrations up to the snapshot's schema version, filled,
+// and migrated to the current version. Snapshots failing CheckVersion are refused. Bridgo must
+// not be running against the database meanwhile.
+func RestoreSnapshot(db *sql.DB, snapshot *Snapshot) (SnapshotInfo, error) {
+	if err := snapshot.CheckVersion(); err != nil {
+		return SnapshotInfo{}, err
+	}
+	info := SnapshotInfo{SchemaVersion: snapshot.SchemaVersion, CreatedAt: snapshot.CreatedAt, RowCounts: map[string]int{}}
+
+	err := withSetupLock(db, func() error {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin restore: %w", err)
+		}
+		defer tx.Rollback()
+
+		// Referencing tables are dropped before the tables they reference
+		tables, err := tablesInDependencyOrder(tx, IsPostgres(db))
+		if err != nil {
+			return err
+		}
+		for i := len(tables) - 1; i >= 0; i-- {
+			if _, err = tx.Exec(fmt.Sprintf("DROP TABLE %s", tables[i])); err != nil {
+				return fmt.Errorf("failed to drop %s: %w", tables[i], err)
+			}
+		}
+		if _, err = tx.Exec("DROP TABLE IF EXISTS schema_migrations"); err != nil {
+			return fmt.Errorf("failed to drop schema_migrations: %w", err)
+		}
+
+		if _, err = tx.Exec(createMigrationsTable); err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+		for _, m := range migrations[:snapshot.SchemaVersion] {
+			if err = applyMigration(tx, m); err != nil {
+				return err
+			}
+		}
+		for _, table := range snapshot.Tables {
+			if err = restoreSnapshotTable(tx, table); err != nil {
+				return err
+			}
+			info.RowCounts[table.Name] = len(table.Rows)
+		}
+		for _, m := range migrations[snapshot.SchemaVersion:] {
+			if err = applyMigration(tx, m); err != nil {
+				return err
+			}
+		}
+
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit restore: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	return info, nil
+}
+
+// restoreSnapshotTable inserts the rows of a snapshot table.
+func restoreSnapshotTable(tx *sql.Tx, table SnapshotTable) error {
+	if len(table.Rows) == 0 {
+		return nil
+	}
+	names := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		names[i] = column.Name
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.Name, strings.Join(names, ", "), placeholders))
+	if err != nil {
+		return fmt.Errorf("failed to prepare restore of %s: %w", table.Name, err)
+	}
+	defer stmt.Close()
+
+	for _, row := range table.Rows {
+		if len(row) != len(table.Columns) {
+			return fmt.Errorf("snapshot row of %s has %d values for %d columns", table.Name, len(row), len(table.Columns))
+		}
+		values := make([]interface{}, len(row))
+		for i, value := range row {
+			if values[i], err = snapshotValue(table.Columns[i], value); err != nil {
+				return fmt.Errorf("invalid %s.%s value: %w", table.Name, table.Columns[i].Name, err)
+			}
+		}
+		if _, err = stmt.Exec(values...); err != nil {
+			return fmt.Errorf("failed to restore %s row: %w", table.Name, err)
+		}
+	}
+	return nil
+}
+
+// snapshotValue converts a JSON-decoded value back to the Go type of its column.
+func snapshotValue(column SnapshotColumn, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n, nil
+		}
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		if strings.HasPrefix(column.Type, "TIMESTAMP") {
+			return time.Parse(time.RFC3339Nano, v)
+		}
+	}
+	return value, nil
+}
+
+// schemaVersion is SchemaVersion within a transaction.
+func schemaVersion(tx *sql.Tx) (int, error) {
+	var version int
+	err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// tablesInDependencyOrder returns the metadata tables other than schema_migrations, each after
+// the tables it references through foreign keys.
+func tablesInDependencyOrder(tx *sql.Tx, postgres bool) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' AND table_name <> 'schema_migrations'
+		ORDER BY table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err = rows.Scan(&table); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tables: %w", err)
+	}
+
+	references, err := tableReferences(tx, postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make([]string, 0, len(tables))
+	placed := map[string]bool{}
+	var place func(table string, path map[string]bool) error
+	place = func(table string, path map[string]bool) error {
+		if placed[table] {
+			return nil
+		}
+		if path[table] {
+			return fmt.Errorf("foreign keys of %s form a cycle", table)
+		}
+		path[table] = true
+		for _, parent := range references[table] {
+			if parent != table {
+				if err := place(parent, path); err != nil {
+					return err
+				}
+			}
+		}
+		delete(path, table)
+		placed[table] = true
+		ordered = append(ordered, table)
+		return nil
+	}
+	for _, table := range tables {
+		if err = place(table, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// tableReferences maps each table to the tables its foreign keys reference.
+func tableReferences(tx *sql.Tx, postgres bool) (map[string][]string, error) {
+	query := `
+		SELECT DISTINCT lower(table_name), lower(referenced_table)
+		FROM duckdb_constraints()
+		WHERE constraint_type = 'FOREIGN KEY' AND schema_name = current_schema()`
+	if postgres {
+		query = `
+			SELECT DISTINCT c.relname, p.relname
+			FROM pg_constraint k
+			JOIN pg_class c ON c.oid = k.conrelid
+			JOIN pg_class p ON p.oid = k.confrelid
+			WHERE k.contype = 'f' AND k.connamespace = current_schema()::regnamespace`
+	}
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	references := map[string][]string{}
+	for rows.Next() {
+		var table, referenced string
+		if err = rows.Scan(&table, &referenced); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+		}
+		references[table] = append(references[table], referenced)
+	}
+	for _, parents := range references {
+		sort.Strings(parents)
+	}
+	return references, rows.Err()
+}
+
+// errWriter keeps the first error of a sequence of writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) write(p []byte) {
+	if ew.err == nil {
+		_, ew.err = ew.w.Write(p)
+	}
+}
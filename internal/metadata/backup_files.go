@@ -0,0 +1,181 @@
+package metadata
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backup files are named after the time they were taken, so names sort chronologically.
+const (
+	backupFilePrefix     = "bridgo-backup-"
+	backupFileSuffix     = ".json.gz"
+	backupFileTimeFormat = "20060102T150405.000Z"
+)
+
+// ErrBackupNotFound is returned for backup names that are not in the backup directory.
+var ErrBackupNotFound = errors.New("backup not found")
+
+// BackupConfig controls where backups are kept and how often they are taken.
+type BackupConfig struct {
+	Dir      string        // Directory of the backup files
+	Interval time.Duration // Time between scheduled backups; 0 disables them
+	Retain   int           // Number of backups kept after each scheduled backup; older ones are deleted
+}
+
+// DefaultBackupConfig keeps backups in ./backups, without scheduled backups.
+var DefaultBackupConfig = BackupConfig{Dir: "backups", Retain: 7}
+
+// BackupFile describes a backup in the backup directory.
+type BackupFile struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BackupStore takes snapshots of the metadata database into the backup directory.
+type BackupStore struct {
+	db  *sql.DB
+	cfg BackupConfig
+}
+
+// NewBackupStore creates a BackupStore for db.
+func NewBackupStore(db *sql.DB, cfg BackupConfig) *BackupStore {
+	return &BackupStore{db: db, cfg: cfg}
+}
+
+// Config returns the store's configuration.
+func (s *BackupStore) Config() BackupConfig {
+	return s.cfg
+}
+
+// Create writes a snapshot to a new file in the backup directory. The file only appears under its
+// final name once complete, and is readable by the owner only: it holds password hashes, data
+// source credentials and signing secrets.
+func (s *BackupStore) Create() (BackupFile, SnapshotInfo, error) {
+	if err := os.MkdirAll(s.cfg.Dir, 0o700); err != nil {
+		return BackupFile{}, SnapshotInfo{}, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.cfg.Dir, ".partial-*")
+	if err != nil {
+		return BackupFile{}, SnapshotInfo{}, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	info, err := WriteSnapshot(s.db, tmp)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write backup file: %w", closeErr)
+	}
+	if err != nil {
+		return BackupFile{}, SnapshotInfo{}, err
+	}
+
+	name := backupFilePrefix + info.CreatedAt.Format(backupFileTimeFormat) + backupFileSuffix
+	path := filepath.Join(s.cfg.Dir, name)
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return BackupFile{}, SnapshotInfo{}, fmt.Errorf("failed to store backup file: %w", err)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return BackupFile{}, SnapshotInfo{}, fmt.Errorf("failed to read backup file: %w", err)
+	}
+	return BackupFile{Name: name, Size: stat.Size(), CreatedAt: info.CreatedAt}, info, nil
+}
+
+// List returns the backups in the backup directory, newest first.
+func (s *BackupStore) List() ([]BackupFile, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if os.IsNotExist(err) {
+		return []BackupFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	backups := []BackupFile{}
+	for _, entry := range entries {
+		createdAt, ok := parseBackupName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupFile{Name: entry.Name(), Size: stat.Size(), CreatedAt: createdAt})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// Path returns the path of the backup with the given name, which must be one listed by List.
+func (s *BackupStore) Path(name string) (string, error) {
+	if _, ok := parseBackupName(name); !ok || filepath.Base(name) != name {
+		return "", ErrBackupNotFound
+	}
+	path := filepath.Join(s.cfg.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrBackupNotFound
+	}
+	return path, nil
+}
+
+// Prune deletes all but the newest Retain backups and returns the names deleted.
+func (s *BackupStore) Prune() ([]string, error) {
+	backups, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for i := s.cfg.Retain; i < len(backups); i++ {
+		if err = os.Remove(filepath.Join(s.cfg.Dir, backups[i].Name)); err != nil {
+			return deleted, fmt.Errorf("failed to delete old backup %s: %w", backups[i].Name, err)
+		}
+		deleted = append(deleted, backups[i].Name)
+	}
+	return deleted, nil
+}
+
+// RunSchedule takes a backup every Interval and prunes old ones, until stop is closed. It returns
+// immediately if scheduled backups are disabled.
+func (s *BackupStore) RunSchedule(stop <-chan struct{}) {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			backup, _, err := s.Create()
+			if err != nil {
+				log.Printf("Scheduled metadata backup failed: %v", err)
+				continue
+			}
+			log.Printf("Scheduled metadata backup written to %s", filepath.Join(s.cfg.Dir, backup.Name))
+			if deleted, err := s.Prune(); err != nil {
+				log.Printf("Failed to prune metadata backups: %v", err)
+			} else if len(deleted) > 0 {
+				log.Printf("Deleted %d old metadata backup(s)", len(deleted))
+			}
+		}
+	}
+}
+
+// parseBackupName returns the creation time encoded in a backup file name.
+func parseBackupName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, backupFilePrefix) || !strings.HasSuffix(name, backupFileSuffix) {
+		return time.Time{}, false
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, backupFilePrefix), backupFileSuffix)
+	createdAt, err := time.Parse(backupFileTimeFormat, stamp)
+	return createdAt, err == nil
+}
@@ -0,0 +1,161 @@
+package metadata_test
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/metadata/metadatatest"
+)
+
+func TestSnapshot(t *testing.T) {
+	for store, open := range metadatatest.Stores {
+		t.Run(store, func(t *testing.T) {
+			testSnapshot(t, open(t))
+		})
+	}
+}
+
+// snapshotTestRows returns the users and data sources of db, for comparing states.
+func snapshotTestRows(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.is_active, u.created_at, COALESCE(d.source_name, ''), COALESCE(d.port, 0)
+		FROM users u LEFT JOIN data_sources d ON d.user_id = u.id
+		ORDER BY u.username, d.source_name
+	`)
+	if err != nil {
+		t.Fatalf("query rows: %v", err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var id, username, createdAt, sourceName string
+		var active bool
+		var port int
+		if err = rows.Scan(&id, &username, &active, &createdAt, &sourceName, &port); err != nil {
+			t.Fatalf("scan row: %v", err)
+		}
+		out = append(out, fmt.Sprintf("%s|%s|%t|%s|%s|%d", id, username, active, createdAt, sourceName, port))
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatalf("iterate rows: %v", err)
+	}
+	return out
+}
+
+func testSnapshot(t *testing.T, db *sql.DB) {
+	aliceID := metadatatest.InsertUser(t, db, "alice", "Correct-horse-1")
+	metadatatest.InsertDataSource(t, db, aliceID, "sales")
+	metadatatest.InsertDataSource(t, db, aliceID, "hr")
+	if _, err := db.Exec("UPDATE users SET is_active = FALSE WHERE id = ?", aliceID); err != nil {
+		t.Fatalf("deactivate user: %v", err)
+	}
+	before := snapshotTestRows(t, db)
+
+	var buf bytes.Buffer
+	info, err := metadata.WriteSnapshot(db, &buf)
+	if err != nil {
+		t.Fatalf("WriteSnapshot: %v", err)
+	}
+	if info.SchemaVersion != metadata.LatestSchemaVersion() || info.RowCounts["data_sources"] != 2 || info.RowCounts["users"] != 1 {
+		t.Errorf("snapshot info = %+v, want the latest version, 1 user and 2 data sources", info)
+	}
+	written := buf.Bytes()
+	read := func() *metadata.Snapshot {
+		t.Helper()
+		snapshot, err := metadata.ReadSnapshot(bytes.NewReader(written))
+		if err != nil {
+			t.Fatalf("ReadSnapshot: %v", err)
+		}
+		return snapshot
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		if _, err := db.Exec("DELETE FROM data_sources WHERE source_name = 'hr'"); err != nil {
+			t.Fatalf("delete data source: %v", err)
+		}
+		metadatatest.InsertUser(t, db, "bob", "Correct-horse-1")
+
+		if _, err := metadata.RestoreSnapshot(db, read()); err != nil {
+			t.Fatalf("RestoreSnapshot: %v", err)
+		}
+		if after := snapshotTestRows(t, db); !reflect.DeepEqual(after, before) {
+			t.Errorf("rows after restore = %v, want %v", after, before)
+		}
+		if version, err := metadata.SchemaVersion(db); err != nil || version != metadata.LatestSchemaVersion() {
+			t.Errorf("SchemaVersion after restore = %d (%v), want %d", version, err, metadata.LatestSchemaVersion())
+		}
+	})
+
+	t.Run("older schema", func(t *testing.T) {
+		// A snapshot taken before migrations 3 and 4 is filled at version 2, then migrated
+		snapshot := read()
+		snapshot.SchemaVersion = 2
+		tables := snapshot.Tables[:0]
+		for _, table := range snapshot.Tables {
+			if table.Name != "data_source_tls" && table.Name != "change_journal" {
+				tables = append(tables, table)
+			}
+		}
+		snapshot.Tables = tables
+
+		if _, err := metadata.RestoreSnapshot(db, snapshot); err != nil {
+			t.Fatalf("RestoreSnapshot: %v", err)
+		}
+		if after := snapshotTestRows(t, db); !reflect.DeepEqual(after, before) {
+			t.Errorf("rows after restore = %v, want %v", after, before)
+		}
+		if version, err := metadata.SchemaVersion(db); err != nil || version != metadata.LatestSchemaVersion() {
+			t.Errorf("SchemaVersion after restore = %d (%v), want %d", version, err, metadata.LatestSchemaVersion())
+		}
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM data_source_tls").Scan(&count); err != nil {
+			t.Errorf("table of a later migration is missing after restore: %v", err)
+		}
+	})
+
+	t.Run("failed restore", func(t *testing.T) {
+		// The tables are only dropped inside the restore's transaction, so a bad row leaves them as they were
+		snapshot := read()
+		for i, table := range snapshot.Tables {
+			if table.Name == "data_sources" {
+				snapshot.Tables[i].Rows = append(table.Rows, []interface{}{"too few values"})
+			}
+		}
+		if _, err := metadata.RestoreSnapshot(db, snapshot); err == nil {
+			t.Fatal("RestoreSnapshot of a corrupt snapshot succeeded")
+		}
+		if after := snapshotTestRows(t, db); !reflect.DeepEqual(after, before) {
+			t.Errorf("rows after a failed restore = %v, want %v", after, before)
+		}
+	})
+
+	t.Run("newer schema", func(t *testing.T) {
+		metadatatest.InsertUser(t, db, "carol", "Correct-horse-1")
+		current := snapshotTestRows(t, db)
+
+		snapshot := read()
+		snapshot.SchemaVersion = metadata.LatestSchemaVersion() + 1
+		if err := snapshot.CheckVersion(); !errors.Is(err, metadata.ErrSchemaTooNew) {
+			t.Errorf("CheckVersion = %v, want ErrSchemaTooNew", err)
+		}
+		if _, err := metadata.RestoreSnapshot(db, snapshot); !errors.Is(err, metadata.ErrSchemaTooNew) {
+			t.Fatalf("RestoreSnapshot = %v, want ErrSchemaTooNew", err)
+		}
+		if after := snapshotTestRows(t, db); !reflect.DeepEqual(after, current) {
+			t.Errorf("refused restore changed the rows to %v, want %v", after, current)
+		}
+	})
+
+	t.Run("not a snapshot", func(t *testing.T) {
+		if _, err := metadata.ReadSnapshot(strings.NewReader(`{"format":1}`)); err == nil {
+			t.Error("ReadSnapshot accepted uncompressed JSON")
+		}
+	})
+}
@@ -0,0 +1,331 @@
+package metadata
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func init() {
+	// Column values are journaled as interface{}; gob needs every concrete type that is not a
+	// Go basic type registered
+	gob.Register(time.Time{})
+}
+
+// querier is what *sql.DB and *sql.Tx have in common.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Change groups writes to the metadata database so that they take effect completely or not at
+// all. Callers defer Rollback, which does nothing once Commit succeeded.
+//
+// On PostgreSQL a Change is a transaction. DuckDB cannot run these writes in one: it rejects
+// deleting a row in the transaction that deleted the rows referencing it, and re-inserting a key
+// in the transaction that deleted it (https://duckdb.org/docs/sql/indexes). There each write
+// commits on its own, after the rows it inserts, deletes or rewrites have been recorded in
+// change_journal.
+// Rollback puts them back, and InitDB does so for changes interrupted by a crash. Other
+// connections can see a DuckDB change half-done.
+type Change struct {
+	db   *sql.DB
+	tx   *sql.Tx // PostgreSQL only
+	id   string  // change_journal entries of the change; DuckDB only
+	step int
+	done bool
+}
+
+// BeginChange starts a change of db.
+func BeginChange(db *sql.DB) (*Change, error) {
+	if IsPostgres(db) {
+		tx, err := db.Begin()
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		return &Change{db: db, tx: tx}, nil
+	}
+	return &Change{db: db, id: uuid.NewString()}, nil
+}
+
+// conn returns where the change's statements run.
+func (c *Change) conn() querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.db
+}
+
+// QueryRow runs a query returning at most one row, seeing the change's own writes.
+func (c *Change) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn().QueryRow(query, args...)
+}
+
+// Delete deletes the rows of table matching where and returns how many were deleted. Rows other
+// rows reference must be deleted after those.
+func (c *Change) Delete(table, where string, args ...interface{}) (int, error) {
+	if c.tx == nil {
+		rows, err := selectRows(c.db, table, where, args)
+		if err != nil {
+			return 0, err
+		}
+		if len(rows.values) == 0 {
+			return 0, nil
+		}
+		if err = c.record(rows, stepDeleted); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := c.conn().Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", table, where), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete %s rows: %w", table, err)
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// Insert adds a row with the given column values to table, which must have an 'id' column.
+func (c *Change) Insert(table string, values map[string]interface{}) error {
+	rows := &rowSet{table: table, values: [][]interface{}{{}}}
+	for column := range values {
+		rows.columns = append(rows.columns, column)
+	}
+	sort.Strings(rows.columns)
+	for _, column := range rows.columns {
+		rows.values[0] = append(rows.values[0], values[column])
+	}
+	if rows.columnIndex("id") < 0 {
+		return fmt.Errorf("%s row has no id", table)
+	}
+
+	if c.tx == nil {
+		if err := c.record(rows, stepInserted); err != nil {
+			return err
+		}
+	}
+	if err := rows.insert(c.conn(), rows.values[0]); err != nil {
+		return fmt.Errorf("failed to insert %s row: %w", table, err)
+	}
+	return nil
+}
+
+// Commit makes the change permanent.
+func (c *Change) Commit() error {
+	if c.done {
+		return fmt.Errorf("change already finished")
+	}
+	c.done = true
+	if c.tx != nil {
+		if err := c.tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil
+	}
+	if _, err := c.db.Exec("DELETE FROM change_journal WHERE change_id = ?", c.id); err != nil {
+		return fmt.Errorf("failed to commit change: %w", err)
+	}
+	return nil
+}
+
+// Rollback undoes the change, unless it was committed or rolled back already.
+func (c *Change) Rollback() error {
+	if c.done {
+		return nil
+	}
+	c.done = true
+	if c.tx != nil {
+		return c.tx.Rollback()
+	}
+	if c.step == 0 {
+		return nil
+	}
+	return undoChange(c.db, c.id)
+}
+
+// What a step of a DuckDB change did to the rows of its journal entry.
+const (
+	stepInserted  = "inserted"
+	stepDeleted   = "deleted"
+	stepRewritten = "rewritten"
+)
+
+// journalEntry is a step of a DuckDB change: rows of a table as they were before the step
+// deleted or rewrote them, or as it inserted them.
+type journalEntry struct {
+	Step    string
+	Table   string
+	Columns []string
+	Values  [][]interface{}
+}
+
+// record journals rows before the change inserts, deletes or rewrites them.
+func (c *Change) record(rows *rowSet, step string) error {
+	var buf bytes.Buffer
+	entry := journalEntry{Step: step, Table: rows.table, Columns: rows.columns, Values: rows.values}
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return fmt.Errorf("failed to encode %s rows for the change journal: %w", rows.table, err)
+	}
+	c.step++
+	_, err := c.db.Exec(
+		"INSERT INTO change_journal (change_id, step, entry, recorded_at) VALUES (?, ?, ?, ?)",
+		c.id, c.step, base64.StdEncoding.EncodeToString(buf.Bytes()), time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to journal %s rows: %w", rows.table, err)
+	}
+	return nil
+}
+
+// undoChange restores the rows journaled by a DuckDB change, latest step first, and then drops
+// its journal. On failure the journal is kept, so that InitDB tries again.
+func undoChange(db *sql.DB, changeID string) error {
+	entries, err := readJournal(db, changeID)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		set := &rowSet{table: entry.Table, columns: entry.Columns, values: entry.Values}
+		switch entry.Step {
+		case stepInserted:
+			err = set.deleteByID(db)
+		case stepDeleted:
+			err = set.insertMissing(db)
+		case stepRewritten:
+			err = revertRows(db, set)
+		default:
+			err = fmt.Errorf("unknown change journal step %q", entry.Step)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to roll back change: %w", err)
+		}
+	}
+
+	if _, err = db.Exec("DELETE FROM change_journal WHERE change_id = ?", changeID); err != nil {
+		return fmt.Errorf("failed to drop change journal: %w", err)
+	}
+	return nil
+}
+
+// readJournal returns the journal entries of a change, latest step first.
+func readJournal(db *sql.DB, changeID string) ([]journalEntry, error) {
+	rows, err := db.Query("SELECT entry FROM change_journal WHERE change_id = ? ORDER BY step DESC", changeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change journal: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []journalEntry
+	for rows.Next() {
+		var encoded string
+		if err = rows.Scan(&encoded); err != nil {
+			return nil, fmt.Errorf("failed to scan change journal: %w", err)
+		}
+		var entry journalEntry
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err == nil {
+			err = gob.NewDecoder(bytes.NewReader(data)).Decode(&entry)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode change journal: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating change journal: %w", err)
+	}
+	return entries, nil
+}
+
+// revertRows puts rewritten rows back as they were, re-inserting any that are missing.
+func revertRows(db *sql.DB, original *rowSet) error {
+	idIndex := original.columnIndex("id")
+	if idIndex < 0 {
+		return fmt.Errorf("table %s has no id column", original.table)
+	}
+	for _, values := range original.values {
+		var exists int
+		if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id = ?", original.table), values[idIndex]).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to look up %s row: %w", original.table, err)
+		}
+		if exists == 0 {
+			if err := original.insert(db, values); err != nil {
+				return fmt.Errorf("failed to restore %s row: %w", original.table, err)
+			}
+			continue
+		}
+
+		columns := make(map[string]interface{}, len(values))
+		for i, column := range original.columns {
+			if i != idIndex {
+				columns[column] = values[i]
+			}
+		}
+		if _, err := rewriteRows(db, nil, original.table, "id = ?", []interface{}{values[idIndex]}, columns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteByID deletes the rows of the set by their id.
+func (rs *rowSet) deleteByID(db *sql.DB) error {
+	idIndex := rs.columnIndex("id")
+	for _, values := range rs.values {
+		if _, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", rs.table), values[idIndex]); err != nil {
+			return fmt.Errorf("failed to remove %s row: %w", rs.table, err)
+		}
+	}
+	return nil
+}
+
+// insertMissing re-inserts the rows of the set, skipping those whose key exists again.
+func (rs *rowSet) insertMissing(db *sql.DB) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(rs.columns)), ", ")
+	query := fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)", rs.table, strings.Join(rs.columns, ", "), placeholders)
+	for _, values := range rs.values {
+		if _, err := db.Exec(query, values...); err != nil {
+			return fmt.Errorf("failed to restore %s row: %w", rs.table, err)
+		}
+	}
+	return nil
+}
+
+// rollBackInterruptedChanges undoes DuckDB changes a crash left unfinished.
+func rollBackInterruptedChanges(db *sql.DB) error {
+	rows, err := db.Query("SELECT DISTINCT change_id FROM change_journal")
+	if err != nil {
+		return fmt.Errorf("failed to read change journal: %w", err)
+	}
+	var changeIDs []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan change journal: %w", err)
+		}
+		changeIDs = append(changeIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating change journal: %w", err)
+	}
+
+	for _, id := range changeIDs {
+		if err = undoChange(db, id); err != nil {
+			return fmt.Errorf("change %s: %w", id, err)
+		}
+		log.Printf("Rolled back metadata change %s interrupted by a restart", id)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package metadata
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newChangeTestDB returns a migrated DuckDB file with users 'u1' and 'u2' who have a role each.
+// u1 also has an audit log entry and a data source 'd1', whose column 's1' references it in turn.
+func newChangeTestDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "meta.db")
+	db, err := InitDB(StoreConfig{Driver: DriverDuckDB, DSN: dsn})
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, statement := range []string{
+		"INSERT INTO users (id, username, email, password_hash) VALUES ('u1', 'alice', 'alice@example.com', 'x')",
+		"INSERT INTO users (id, username, email, password_hash) VALUES ('u2', 'bob', 'bob@example.com', 'x')",
+		"INSERT INTO user_roles (user_id, role_id) SELECT u.id, r.id FROM users u, roles r WHERE r.role_name = 'editor'",
+		"INSERT INTO audit_logs (id, user_id, action_type) VALUES ('a1', 'u1', 'user.login')",
+		"INSERT INTO data_sources (id, user_id, source_name, db_type) VALUES ('d1', 'u1', 'sales', 'postgresql')",
+		"INSERT INTO data_source_schemas (id, data_source_id, table_name, column_name, column_type) VALUES ('s1', 'd1', 'orders', 'id', 'int')",
+	} {
+		if _, err = db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	return db, dsn
+}
+
+// changeTestRows returns the rows of the tables newChangeTestDB fills, for comparing states.
+func changeTestRows(t *testing.T, db *sql.DB) map[string][]string {
+	t.Helper()
+	queries := map[string]string{
+		"users":               "SELECT id || ' ' || username || ' ' || email FROM users ORDER BY id",
+		"user_roles":          "SELECT user_id FROM user_roles ORDER BY user_id",
+		"audit_logs":          "SELECT id || ' ' || COALESCE(user_id, '-') FROM audit_logs ORDER BY id",
+		"data_sources":        "SELECT id || ' ' || user_id || ' ' || source_name FROM data_sources ORDER BY id",
+		"data_source_schemas": "SELECT id || ' ' || data_source_id FROM data_source_schemas ORDER BY id",
+		"view_shares":         "SELECT id FROM view_shares ORDER BY id",
+		"change_journal":      "SELECT change_id FROM change_journal",
+	}
+	state := map[string][]string{}
+	for table, query := range queries {
+		rows, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("read %s: %v", table, err)
+		}
+		for rows.Next() {
+			var row string
+			if err = rows.Scan(&row); err != nil {
+				t.Fatalf("scan %s: %v", table, err)
+			}
+			state[table] = append(state[table], row)
+		}
+		rows.Close()
+	}
+	return state
+}
+
+func TestReplaceRowKeepsReferencingRows(t *testing.T) {
+	db, _ := newChangeTestDB(t)
+
+	if err := ReplaceRow(db, "users", "u1", map[string]interface{}{"email": "alice@example.org", "updated_at": time.Now().UTC()}); err != nil {
+		t.Fatalf("ReplaceRow: %v", err)
+	}
+	if err := ReplaceRow(db, "users", "missing", map[string]interface{}{"email": "x@example.org"}); err != sql.ErrNoRows {
+		t.Errorf("ReplaceRow of a missing row = %v, want sql.ErrNoRows", err)
+	}
+
+	got := changeTestRows(t, db)
+	if want := []string{"u1 alice alice@example.org", "u2 bob bob@example.com"}; !reflect.DeepEqual(got["users"], want) {
+		t.Errorf("users = %v, want %v", got["users"], want)
+	}
+	for table, count := range map[string]int{"user_roles": 2, "audit_logs": 1, "data_sources": 1, "data_source_schemas": 1, "change_journal": 0} {
+		if len(got[table]) != count {
+			t.Errorf("%s has %d rows, want %d: %v", table, len(got[table]), count, got[table])
+		}
+	}
+}
+
+func TestReplaceRowsIsAllOrNothing(t *testing.T) {
+	db, _ := newChangeTestDB(t)
+	before := changeTestRows(t, db)
+
+	// The second user cannot take the same e-mail address, so the first one must keep its own
+	_, err := ReplaceRows(db, "users", "id IN ('u1', 'u2')", nil, map[string]interface{}{"email": "same@example.com"})
+	if err == nil {
+		t.Fatal("ReplaceRows with a duplicate e-mail address succeeded")
+	}
+	if after := changeTestRows(t, db); !reflect.DeepEqual(after, before) {
+		t.Errorf("rows after failed ReplaceRows = %v, want %v", after, before)
+	}
+}
+
+// changeTestSteps deletes u1's role and data source, clears their audit reference, renames them
+// and shares a view with them, without committing.
+func changeTestSteps(t *testing.T, change *Change) {
+	t.Helper()
+	if _, err := change.Delete("data_source_schemas", "data_source_id = ?", "d1"); err != nil {
+		t.Fatalf("Delete data_source_schemas: %v", err)
+	}
+	if _, err := change.Delete("data_sources", "id = ?", "d1"); err != nil {
+		t.Fatalf("Delete data_sources: %v", err)
+	}
+	if _, err := change.Delete("user_roles", "user_id = ?", "u1"); err != nil {
+		t.Fatalf("Delete user_roles: %v", err)
+	}
+	if _, err := change.ReplaceRows("audit_logs", "user_id = ?", []interface{}{"u1"}, map[string]interface{}{"user_id": nil}); err != nil {
+		t.Fatalf("ReplaceRows audit_logs: %v", err)
+	}
+	if err := change.ReplaceRow("users", "u1", map[string]interface{}{"username": "alice2"}); err != nil {
+		t.Fatalf("ReplaceRow users: %v", err)
+	}
+	err := change.Insert("view_shares", map[string]interface{}{
+		"id": "v1", "view_type": "virtual_view", "view_id": "x", "grantee_type": "user", "grantee_id": "u1",
+		"access_level": "VIEW", "granted_at": time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("Insert view_shares: %v", err)
+	}
+}
+
+func TestChangeRollback(t *testing.T) {
+	db, _ := newChangeTestDB(t)
+	before := changeTestRows(t, db)
+
+	change, err := BeginChange(db)
+	if err != nil {
+		t.Fatalf("BeginChange: %v", err)
+	}
+	changeTestSteps(t, change)
+	if during := changeTestRows(t, db); len(during["data_sources"]) != 0 || len(during["change_journal"]) == 0 {
+		t.Fatalf("rows during the change = %v, want the data source deleted and journaled", during)
+	}
+	if err = change.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if after := changeTestRows(t, db); !reflect.DeepEqual(after, before) {
+		t.Errorf("rows after Rollback = %v, want %v", after, before)
+	}
+	if err = change.Commit(); err == nil {
+		t.Error("Commit after Rollback succeeded")
+	}
+}
+
+func TestChangeCommit(t *testing.T) {
+	db, _ := newChangeTestDB(t)
+
+	change, err := BeginChange(db)
+	if err != nil {
+		t.Fatalf("BeginChange: %v", err)
+	}
+	changeTestSteps(t, change)
+	if err = change.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err = change.Rollback(); err != nil {
+		t.Fatalf("Rollback after Commit: %v", err)
+	}
+
+	want := map[string][]string{
+		"users":       {"u1 alice2 alice@example.com", "u2 bob bob@example.com"},
+		"audit_logs":  {"a1 -"},
+		"view_shares": {"v1"},
+		"user_roles":  {"u2"},
+	}
+	got := changeTestRows(t, db)
+	for table, rows := range want {
+		if !reflect.DeepEqual(got[table], rows) {
+			t.Errorf("%s = %v, want %v", table, got[table], rows)
+		}
+	}
+	for _, table := range []string{"data_sources", "data_source_schemas", "change_journal"} {
+		if len(got[table]) != 0 {
+			t.Errorf("%s = %v, want no rows", table, got[table])
+		}
+	}
+}
+
+func TestInitDBRollsBackInterruptedChanges(t *testing.T) {
+	db, dsn := newChangeTestDB(t)
+	before := changeTestRows(t, db)
+
+	change, err := BeginChange(db)
+	if err != nil {
+		t.Fatalf("BeginChange: %v", err)
+	}
+	changeTestSteps(t, change)
+	// The process stops without committing or rolling back
+	db.Close()
+
+	db, err = InitDB(StoreConfig{Driver: DriverDuckDB, DSN: dsn})
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer db.Close()
+	if after := changeTestRows(t, db); !reflect.DeepEqual(after, before) {
+		t.Errorf("rows after restart = %v, want %v", after, before)
+	}
+}
+
+func TestJournalEntryRoundTrip(t *testing.T) {
+	// Every column type the metadata schema uses must survive the change journal
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	rows := &rowSet{table: "t", columns: []string{"s", "i", "i64", "b", "ts", "null"}, values: [][]interface{}{{"x", int32(7), int64(8), true, now, nil}}}
+
+	db, _ := newChangeTestDB(t)
+	change, err := BeginChange(db)
+	if err != nil {
+		t.Fatalf("BeginChange: %v", err)
+	}
+	if err = change.record(rows, stepDeleted); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	var count int
+	if err = db.QueryRow("SELECT COUNT(*) FROM change_journal WHERE change_id = ?", change.id).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("journal entries = %d (%v), want 1", count, err)
+	}
+	entries, err := readJournal(db, change.id)
+	if err != nil {
+		t.Fatalf("readJournal: %v", err)
+	}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0].Values, rows.values) {
+		t.Errorf("journaled values = %v, want %v", fmt.Sprint(entries), rows.values)
+	}
+}
@@ -1,50 +1,78 @@
 package metadata
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"os"
-	"path/filepath"
 	"time"
 
+	"Bridgo/internal/models"
+
 	"github.com/google/uuid"
 	_ "github.com/marcboeker/go-duckdb" // DuckDB driver
-	"golang.org/x/crypto/bcrypt"
 )
 
 const dbFileName = "bridgo_meta.db"
 
-// InitDB initializes the DuckDB database connection and creates tables if they don't exist.
-// It returns the database connection pool.
-func InitDB(basePath string) (*sql.DB, error) {
-	dbPath := filepath.Join(basePath, dbFileName)
-
-	db, err := sql.Open("duckdb", dbPath)
+// InitDB opens the metadata database selected by cfg, applies pending schema migrations and seeds
+// the system roles and secrets. It returns the database connection pool.
+func InitDB(cfg StoreConfig) (*sql.DB, error) {
+	db, err := OpenDB(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	if err = db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	if err = withSetupLock(db, func() error { return setupDB(db) }); err != nil {
+		db.Close()
+		return nil, err
 	}
+	return db, nil
+}
 
-	fmt.Println("Successfully connected to DuckDB at:", dbPath)
+// setupDB migrates the schema and seeds the system roles and secrets.
+func setupDB(db *sql.DB) error {
+	applied, err := Migrate(db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	for _, m := range applied {
+		fmt.Printf("Applied metadata schema migration %d: %s\n", m.Version, m.Description)
+	}
+	fmt.Printf("Metadata schema is at version %d.\n", LatestSchemaVersion())
 
-	if err = createSchema(db); err != nil {
-		return nil, fmt.Errorf("failed to create schema: %w", err)
+	if err = rollBackInterruptedChanges(db); err != nil {
+		return fmt.Errorf("failed to roll back interrupted changes: %w", err)
 	}
 
-	// Ensure admin user exists
-	if err = ensureAdminUserExists(db); err != nil {
-		return nil, fmt.Errorf("failed to ensure admin user: %w", err)
+	// Seed system roles and permissions
+	if err = ensureSystemRoles(db); err != nil {
+		return fmt.Errorf("failed to ensure system roles: %w", err)
 	}
 
-	return db, nil
+	// Users created before roles existed keep the rights they had
+	if err = assignDefaultRoles(db); err != nil {
+		return fmt.Errorf("failed to assign default roles: %w", err)
+	}
+
+	// Keys used to hash and tokenize masked column values, and to sign tokens when no key is configured
+	if err = ensureSecretSetting(db, models.SettingMaskingSecret); err != nil {
+		return fmt.Errorf("failed to ensure masking secret: %w", err)
+	}
+	if err = ensureSecretSetting(db, models.SettingJWTSecret); err != nil {
+		return fmt.Errorf("failed to ensure JWT secret: %w", err)
+	}
+	if err = ensureSecretSetting(db, models.SettingDataSourceSecret); err != nil {
+		return fmt.Errorf("failed to ensure data source secret: %w", err)
+	}
+	return nil
 }
 
-// createSchema creates all necessary tables if they do not already exist.
-func createSchema(db *sql.DB) error {
-	schemaSQL := `
+// baselineSchema is migration 1: every table as of the introduction of versioned migrations. It
+// only creates missing tables, so databases created before then are brought up to date as well.
+// Never change it; schema changes are new migrations in migrations.go.
+const baselineSchema = `
 CREATE TABLE IF NOT EXISTS users (
     id TEXT PRIMARY KEY,
     username TEXT UNIQUE NOT NULL,
@@ -198,50 +226,315 @@ CREATE TABLE IF NOT EXISTS virtual_base_views (
     FOREIGN KEY (data_source_id) REFERENCES data_sources(id),
     UNIQUE (user_id, name) -- A user cannot have two virtual base views with the same name
 );
-	`
 
-	_, err := db.Exec(schemaSQL)
-	if err != nil {
-		return fmt.Errorf("failed to execute schema creation SQL: %w", err)
+CREATE TABLE IF NOT EXISTS view_shares (
+    id TEXT PRIMARY KEY,
+    view_type TEXT NOT NULL, -- 'virtual_view' or 'virtual_base_view'
+    view_id TEXT NOT NULL,
+    grantee_type TEXT NOT NULL, -- 'user', 'role' or 'everyone' (published)
+    grantee_id TEXT NOT NULL, -- users.id, roles.id or '*'
+    access_level TEXT NOT NULL, -- 'VIEW' or 'EDIT'
+    granted_by_user_id TEXT,
+    granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (view_type, view_id, grantee_type, grantee_id)
+);
+
+CREATE TABLE IF NOT EXISTS column_masking_policies (
+    id TEXT PRIMARY KEY,
+    data_source_schema_id TEXT, -- Set for policies on a data source column
+    view_type TEXT, -- Set, together with view_id and column_name, for policies on a view column
+    view_id TEXT,
+    column_name TEXT,
+    mask_type TEXT NOT NULL, -- 'PARTIAL', 'TOKENIZE', 'HASH' or 'REDACT'
+    exempt_roles TEXT NOT NULL DEFAULT '[]', -- JSON array of role names that see unmasked values
+    created_by_user_id TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS row_security_policies (
+    id TEXT PRIMARY KEY,
+    view_type TEXT NOT NULL, -- 'virtual_view' or 'virtual_base_view'
+    view_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    predicate TEXT NOT NULL, -- Filter template over the view's columns and {{user.*}} placeholders
+    exempt_roles TEXT NOT NULL DEFAULT '[]', -- JSON array of role names that see every row
+    created_by_user_id TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_attributes (
+    user_id TEXT NOT NULL,
+    attribute_key TEXT NOT NULL,
+    attribute_value TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, attribute_key),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    family_id TEXT NOT NULL, -- Tokens rotated from the same login share a family
+    token_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the token; the token itself is never stored
+    issued_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    replaced_by_id TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id TEXT,
+    expires_at TIMESTAMP NOT NULL, -- Purged once the access token would have expired anyway
+    revoked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    user_id TEXT PRIMARY KEY,
+    revoked_before TIMESTAMP NOT NULL -- Access tokens issued before this instant are rejected
+);
+
+CREATE TABLE IF NOT EXISTS service_accounts (
+    user_id TEXT PRIMARY KEY, -- The account's row in 'users'; its password can never match
+    description TEXT,
+    created_by_user_id TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL, -- User or service account the key acts as
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the key; the key itself is never stored
+    scopes TEXT NOT NULL, -- JSON array of {"type", "id"}: the data sources and views the key may access
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_by_user_id TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer TEXT NOT NULL, -- OIDC provider the user signs in with
+    subject TEXT NOT NULL, -- The provider's stable ID of the user ('sub' claim)
+    user_id TEXT NOT NULL,
+    email TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    PRIMARY KEY (issuer, subject),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state TEXT PRIMARY KEY, -- Pending single sign-on logins, consumed by the callback
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL, -- PKCE verifier, never sent to the browser
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS password_change_required (
+    user_id TEXT PRIMARY KEY, -- Users who must choose a new password at their next login
+    required_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id TEXT PRIMARY KEY,
+    totp_secret TEXT NOT NULL, -- Base32 TOTP secret
+    enabled BOOLEAN DEFAULT FALSE, -- False until the first code confirms the enrollment
+    last_used_step BIGINT DEFAULT 0, -- Time step of the last accepted code, so codes cannot be replayed
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    enabled_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    code_hash TEXT UNIQUE NOT NULL, -- SHA-256 of the normalized code
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS login_failures (
+    username TEXT PRIMARY KEY, -- Lower-cased login name; names that do not exist are tracked too
+    failed_count INTEGER NOT NULL, -- Consecutive failed logins
+    last_failed_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP -- Set while the account is locked
+);
+
+CREATE TABLE IF NOT EXISTS user_invites (
+    id TEXT PRIMARY KEY,
+    token_hash TEXT UNIQUE NOT NULL, -- SHA-256 of the invite code; the code itself is never stored
+    email TEXT, -- When set, only this address can register with the invite
+    role_name TEXT NOT NULL,
+    created_by_user_id TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    used_by_user_id TEXT
+);
+
+CREATE TABLE IF NOT EXISTS system_settings (
+    setting_key TEXT PRIMARY KEY,
+    setting_value TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// ensureSystemRoles seeds the system permissions, roles and their role-permission links.
+// Existing rows are left untouched, apart from refreshing permission descriptions, so the seeding
+// is safe to run on every startup.
+func ensureSystemRoles(db *sql.DB) error {
+	now := time.Now().UTC()
+
+	permissionIDs := make(map[string]string)
+	for _, p := range models.SystemPermissions {
+		var permissionID string
+		err := db.QueryRow("SELECT id FROM permissions WHERE permission_name = ?", p.Name).Scan(&permissionID)
+		if err == sql.ErrNoRows {
+			permissionID = uuid.NewString()
+			_, err = db.Exec(
+				"INSERT INTO permissions (id, permission_name, description, category, created_at) VALUES (?, ?, ?, ?, ?)",
+				permissionID, p.Name, p.Description, p.Category, now,
+			)
+		} else if err == nil {
+			_, err = db.Exec("UPDATE permissions SET description = ? WHERE id = ? AND description IS DISTINCT FROM ?", p.Description, permissionID, p.Description)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to ensure permission '%s': %w", p.Name, err)
+		}
+		permissionIDs[p.Name] = permissionID
+	}
+
+	for _, r := range models.SystemRoles {
+		var roleID string
+		err := db.QueryRow("SELECT id FROM roles WHERE role_name = ?", r.Name).Scan(&roleID)
+		if err == sql.ErrNoRows {
+			roleID = uuid.NewString()
+			_, err = db.Exec(
+				"INSERT INTO roles (id, role_name, description, is_system_role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+				roleID, r.Name, r.Description, true, now, now,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to ensure role '%s': %w", r.Name, err)
+		}
+
+		for _, permissionName := range r.Permissions {
+			var count int
+			err = db.QueryRow("SELECT COUNT(*) FROM role_permissions WHERE role_id = ? AND permission_id = ?", roleID, permissionIDs[permissionName]).Scan(&count)
+			if err != nil {
+				return fmt.Errorf("failed to check role permission '%s/%s': %w", r.Name, permissionName, err)
+			}
+			if count > 0 {
+				continue
+			}
+			_, err = db.Exec(
+				"INSERT INTO role_permissions (role_id, permission_id, assigned_at) VALUES (?, ?, ?)",
+				roleID, permissionIDs[permissionName], now,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to grant permission '%s' to role '%s': %w", permissionName, r.Name, err)
+			}
+		}
 	}
 
-	fmt.Println("Database schema checked/created successfully.")
+	fmt.Println("System roles checked/created successfully.")
 	return nil
 }
 
-// ensureAdminUserExists checks if an admin user exists and creates one if not.
-func ensureAdminUserExists(db *sql.DB) error {
-	var userID string
-	err := db.QueryRow("SELECT id FROM users WHERE username = ?", "admin").Scan(&userID)
-	if err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("failed to check for admin user: %w", err)
+// assignDefaultRoles gives every user without any role the default user role.
+func assignDefaultRoles(db *sql.DB) error {
+	rows, err := db.Query("SELECT id FROM users WHERE id NOT IN (SELECT user_id FROM user_roles)")
+	if err != nil {
+		return fmt.Errorf("failed to query users without roles: %w", err)
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err = rows.Scan(&userID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan user id: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating user rows: %w", err)
 	}
 
-	if err == sql.ErrNoRows {
-		// Admin user does not exist, create it
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
-		if err != nil {
-			return fmt.Errorf("failed to hash admin password: %w", err)
+	for _, userID := range userIDs {
+		if err = ensureUserRole(db, userID, models.DefaultUserRole); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		adminUserID := uuid.NewString()
-		adminEmail := "admin@admin.com" // Using a valid email format
-		now := time.Now().UTC()
+// ensureUserRole assigns the named role to a user unless it is already assigned.
+func ensureUserRole(db *sql.DB, userID, roleName string) error {
+	var roleID string
+	if err := db.QueryRow("SELECT id FROM roles WHERE role_name = ?", roleName).Scan(&roleID); err != nil {
+		return fmt.Errorf("failed to look up role '%s': %w", roleName, err)
+	}
 
-		_, err = db.Exec(
-			"INSERT INTO users (id, username, email, password_hash, is_active, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
-			adminUserID, "admin", adminEmail, string(hashedPassword), true, now, now,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to insert admin user: %w", err)
-		}
-		fmt.Println("Admin user created successfully.")
-	} else {
-		fmt.Println("Admin user already exists.")
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check role '%s' for user %s: %w", roleName, userID, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := db.Exec("INSERT INTO user_roles (user_id, role_id, assigned_at) VALUES (?, ?, ?)", userID, roleID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to assign role '%s' to user %s: %w", roleName, userID, err)
 	}
 	return nil
 }
 
+// ensureSecretSetting stores a random 256-bit hex secret under key unless one already exists.
+func ensureSecretSetting(db *sql.DB, key string) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM system_settings WHERE setting_key = ?", key).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check setting '%s': %w", key, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate secret: %w", err)
+	}
+	_, err := db.Exec(
+		"INSERT INTO system_settings (setting_key, setting_value, updated_at) VALUES (?, ?, ?)",
+		key, hex.EncodeToString(secret), time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store setting '%s': %w", key, err)
+	}
+	return nil
+}
+
+// GetSetting returns the value stored under key in system_settings.
+func GetSetting(db *sql.DB, key string) (string, error) {
+	var value string
+	err := db.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key = ?", key).Scan(&value)
+	if err != nil {
+		return "", fmt.Errorf("failed to read setting '%s': %w", key, err)
+	}
+	return value, nil
+}
+
 // Helper function to get the project root (if needed, for now db is in root)
 func getProjectRoot() (string, error) {
 	wd, err := os.Getwd()
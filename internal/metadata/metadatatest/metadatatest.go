@@ -0,0 +1,112 @@
+// Package metadatatest provides migrated metadata databases and fixtures for tests.
+package metadatatest
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"Bridgo/internal/metadata"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// NewDB returns a migrated metadata database in a temporary DuckDB file that is closed when the
+// test ends.
+func NewDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := metadata.InitDB(metadata.StoreConfig{Driver: metadata.DriverDuckDB, DSN: filepath.Join(t.TempDir(), "meta.db")})
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// PostgresDSNEnv names the variable holding the connection string of a PostgreSQL database that
+// integration tests may create schemas in. Tests needing PostgreSQL are skipped when it is unset.
+const PostgresDSNEnv = "BRIDGO_TEST_POSTGRES_DSN"
+
+// NewPostgresDB returns a migrated metadata database in a new schema of the PostgreSQL database
+// named by PostgresDSNEnv, dropped when the test ends. It skips the test if the variable is unset.
+func NewPostgresDB(t testing.TB) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(PostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", PostgresDSNEnv)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open PostgreSQL: %v", err)
+	}
+	schema := "bridgo_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err = admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	db, err := metadata.InitDB(metadata.StoreConfig{Driver: metadata.DriverPostgres, DSN: withSearchPath(dsn, schema)})
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// withSearchPath adds a search_path run-time parameter to a PostgreSQL connection string, in URL
+// or key=value form.
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			query := u.Query()
+			query.Set("search_path", schema)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+	}
+	return dsn + " search_path=" + schema
+}
+
+// Stores opens a metadata database on each store tests run against: DuckDB, and PostgreSQL when
+// PostgresDSNEnv is set.
+var Stores = map[string]func(testing.TB) *sql.DB{
+	metadata.DriverDuckDB:   NewDB,
+	metadata.DriverPostgres: NewPostgresDB,
+}
+
+// InsertUser adds an active user with the given password and returns its ID.
+func InsertUser(t testing.TB, db *sql.DB, username, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	id := uuid.NewString()
+	_, err = db.Exec("INSERT INTO users (id, username, email, password_hash) VALUES (?, ?, ?, ?)", id, username, username+"@example.com", string(hash))
+	if err != nil {
+		t.Fatalf("insert user %s: %v", username, err)
+	}
+	return id
+}
+
+// InsertDataSource adds a PostgreSQL data source owned by ownerID and returns its ID.
+func InsertDataSource(t testing.TB, db *sql.DB, ownerID, name string) string {
+	t.Helper()
+	id := uuid.NewString()
+	_, err := db.Exec("INSERT INTO data_sources (id, user_id, source_name, db_type, host, port, database_name) VALUES (?, ?, ?, 'postgresql', 'localhost', 5432, 'db')", id, ownerID, name)
+	if err != nil {
+		t.Fatalf("insert data source %s: %v", name, err)
+	}
+	return id
+}
@@ -0,0 +1,198 @@
+package metadata
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Migration is a numbered, forward-only change of the metadata schema. Once released, a migration
+// must never change; fixes are new migrations.
+type Migration struct {
+	Version     int
+	Description string
+	SQL         string // One or more statements, run in a single transaction
+}
+
+// migrations lists every schema change in order. Versions are consecutive, starting at 1.
+var migrations = []Migration{
+	{Version: 1, Description: "baseline schema", SQL: baselineSchema},
+	{Version: 2, Description: "managed objects of declarative configuration", SQL: `
+CREATE TABLE IF NOT EXISTS managed_objects (
+    object_type TEXT NOT NULL, -- 'data_source', 'virtual_base_view', 'virtual_view', 'role', 'role_members', 'data_source_grant' or 'view_grant'
+    object_id TEXT NOT NULL, -- ID of the row in the object's table; the role's ID for 'role_members'
+    manifest TEXT NOT NULL, -- Manifest file declaring the object, relative to the manifest directory
+    reconciled_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (object_type, object_id)
+);`},
+	{Version: 3, Description: "TLS certificates of data source connections", SQL: `
+CREATE TABLE IF NOT EXISTS data_source_tls (
+    data_source_id TEXT PRIMARY KEY, -- Deleted together with the data source
+    ca_cert_encrypted TEXT, -- PEM CA bundle the server certificate is verified against
+    client_cert_encrypted TEXT, -- PEM client certificate chain
+    client_key_encrypted TEXT, -- PEM private key of the client certificate
+    updated_at TIMESTAMP NOT NULL
+);`},
+	{Version: 4, Description: "journal of unfinished DuckDB metadata changes", SQL: `
+CREATE TABLE IF NOT EXISTS change_journal (
+    change_id TEXT NOT NULL, -- Entries are deleted when their change commits or is rolled back
+    step INTEGER NOT NULL,
+    entry TEXT NOT NULL, -- Base64 gob of the rows the step inserted, or deleted or rewrote as they were before
+    recorded_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (change_id, step)
+);`},
+}
+
+func init() {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			panic(fmt.Sprintf("metadata migration %q has version %d, expected %d", m.Description, m.Version, i+1))
+		}
+	}
+}
+
+// ErrSchemaTooNew is returned for a metadata database migrated by a newer Bridgo than this one.
+var ErrSchemaTooNew = errors.New("metadata database schema is newer than this binary supports")
+
+// createMigrationsTable records which migrations were applied to the database.
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    description TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+);`
+
+// LatestSchemaVersion returns the schema version this binary migrates databases to.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the version of the newest migration applied to db; 0 for a database
+// that has never been migrated.
+func SchemaVersion(db *sql.DB) (int, error) {
+	var exists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'").Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	if err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// CheckReady checks that db answers and has every migration this binary knows of applied, for
+// readiness probes. It returns the schema version.
+func CheckReady(ctx context.Context, db *sql.DB) (int, error) {
+	if err := db.PingContext(ctx); err != nil {
+		return 0, fmt.Errorf("metadata database unreachable: %w", err)
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version != LatestSchemaVersion() {
+		return version, fmt.Errorf("metadata schema version is %d, expected %d", version, LatestSchemaVersion())
+	}
+	return version, nil
+}
+
+// PendingMigrations returns the migrations not yet applied to db, oldest first. It fails with
+// ErrSchemaTooNew if db was migrated beyond LatestSchemaVersion, since this binary would not know
+// how to use it.
+func PendingMigrations(db *sql.DB) ([]Migration, error) {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if version > LatestSchemaVersion() {
+		return nil, fmt.Errorf("%w: database is at version %d, this binary knows up to %d; upgrade Bridgo or restore a backup",
+			ErrSchemaTooNew, version, LatestSchemaVersion())
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies the pending migrations, each in its own transaction together with its
+// schema_migrations row, and returns the ones applied. A failing migration is rolled back and
+// stops the upgrade, leaving the database at the last successful version.
+func Migrate(db *sql.DB) ([]Migration, error) {
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range pending {
+		tx, err := db.Begin()
+		if err != nil {
+			return applied, fmt.Errorf("failed to begin migration %d: %w", m.Version, err)
+		}
+		if err = applyMigration(tx, m); err != nil {
+			tx.Rollback()
+			return applied, err
+		}
+		if err = tx.Commit(); err != nil {
+			return applied, fmt.Errorf("failed to commit migration %d: %w", m.Version, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// DryRunMigrations applies the pending migrations in one transaction that is always rolled back,
+// so they can be checked against a copy of production data without changing it. It returns the
+// migrations that would be applied.
+func DryRunMigrations(db *sql.DB) ([]Migration, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil || len(pending) == 0 {
+		return pending, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin dry run: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	for _, m := range pending {
+		if err = applyMigration(tx, m); err != nil {
+			return pending, err
+		}
+	}
+	return pending, nil
+}
+
+// applyMigration runs a migration and records it within tx.
+func applyMigration(tx *sql.Tx, m Migration) error {
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+	}
+	_, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Description, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+	}
+	return nil
+}
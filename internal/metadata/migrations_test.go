@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB returns an empty, unmigrated DuckDB file.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := OpenDB(StoreConfig{Driver: DriverDuckDB, DSN: filepath.Join(t.TempDir(), "meta.db")})
+	if err != nil {
+		t.Fatalf("OpenDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// tableExists reports whether the current schema has the named table.
+func tableExists(t *testing.T, db *sql.DB, table string) bool {
+	t.Helper()
+	var exists bool
+	err := db.QueryRow("SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?", table).Scan(&exists)
+	if err != nil {
+		t.Fatalf("look up table %s: %v", table, err)
+	}
+	return exists
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+	latest := LatestSchemaVersion()
+
+	if version, err := SchemaVersion(db); err != nil || version != 0 {
+		t.Fatalf("SchemaVersion of an empty database = %d (%v), want 0", version, err)
+	}
+	if _, err := CheckReady(context.Background(), db); err == nil {
+		t.Error("CheckReady passed an unmigrated database")
+	}
+
+	pending, err := DryRunMigrations(db)
+	if err != nil || len(pending) != latest {
+		t.Fatalf("DryRunMigrations = %d migrations (%v), want %d", len(pending), err, latest)
+	}
+	if tableExists(t, db, "users") || tableExists(t, db, "schema_migrations") {
+		t.Error("dry run left tables behind")
+	}
+
+	applied, err := Migrate(db)
+	if err != nil || len(applied) != latest {
+		t.Fatalf("Migrate applied %d migrations (%v), want %d", len(applied), err, latest)
+	}
+	if version, err := CheckReady(context.Background(), db); err != nil || version != latest {
+		t.Errorf("CheckReady = %d (%v), want %d", version, err, latest)
+	}
+	if applied, err = Migrate(db); err != nil || len(applied) != 0 {
+		t.Errorf("second Migrate applied %v (%v), want nothing", applied, err)
+	}
+
+	// A failing migration is rolled back as a whole and stops the upgrade
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = append(append([]Migration(nil), saved...),
+		Migration{Version: latest + 1, Description: "broken", SQL: "CREATE TABLE half_done (id TEXT); SELECT * FROM missing_table;"},
+		Migration{Version: latest + 2, Description: "never reached", SQL: "CREATE TABLE later (id TEXT);"},
+	)
+	if applied, err = Migrate(db); err == nil || len(applied) != 0 {
+		t.Fatalf("Migrate with a broken migration applied %v (%v), want an error", applied, err)
+	}
+	if version, _ := SchemaVersion(db); version != latest || tableExists(t, db, "half_done") || tableExists(t, db, "later") {
+		t.Errorf("after a failed migration the schema is at version %d, want %d and no new tables", version, latest)
+	}
+
+	migrations[latest].SQL = "CREATE TABLE half_done (id TEXT);"
+	if applied, err = Migrate(db); err != nil || len(applied) != 2 {
+		t.Fatalf("Migrate after the fix applied %v (%v), want 2 migrations", applied, err)
+	}
+	if version, _ := SchemaVersion(db); version != latest+2 || !tableExists(t, db, "later") {
+		t.Errorf("schema version = %d, want %d with every table", version, latest+2)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "meta.db")
+	db, err := InitDB(StoreConfig{Driver: DriverDuckDB, DSN: dsn})
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	newer := LatestSchemaVersion() + 1
+	_, err = db.Exec("INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, 'from the future', CURRENT_TIMESTAMP)", newer)
+	if err != nil {
+		t.Fatalf("record newer migration: %v", err)
+	}
+
+	if _, err = Migrate(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Migrate = %v, want ErrSchemaTooNew", err)
+	}
+	if _, err = DryRunMigrations(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("DryRunMigrations = %v, want ErrSchemaTooNew", err)
+	}
+	if version, err := CheckReady(context.Background(), db); err == nil || version != newer {
+		t.Errorf("CheckReady = %d (%v), want version %d and an error", version, err, newer)
+	}
+	db.Close()
+
+	if db, err = InitDB(StoreConfig{Driver: DriverDuckDB, DSN: dsn}); !errors.Is(err, ErrSchemaTooNew) {
+		if db != nil {
+			db.Close()
+		}
+		t.Errorf("InitDB = %v, want ErrSchemaTooNew", err)
+	}
+}
@@ -0,0 +1,127 @@
+package metadata
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresDriverName is the database/sql driver of PostgreSQL metadata databases. Data sources keep
+// using lib/pq's own "postgres" driver.
+const postgresDriverName = "bridgo-postgres-metadata"
+
+// setupLockID is the PostgreSQL advisory lock held while a replica migrates and seeds the database.
+const setupLockID int64 = 0x42726964676f // "Bridgo"
+
+func init() {
+	sql.Register(postgresDriverName, postgresDriver{})
+}
+
+// postgresDriver wraps lib/pq so the services' queries, written with DuckDB's '?' placeholders,
+// run unchanged: placeholders are rewritten to PostgreSQL's $1, $2, ... Each connection uses UTC,
+// like the timestamps Bridgo writes.
+type postgresDriver struct{}
+
+// postgresConnection is the set of optional driver interfaces lib/pq connections implement and
+// database/sql relies on.
+type postgresConnection interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+func (postgresDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := pq.Driver{}.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	pgConn, ok := conn.(postgresConnection)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("lib/pq connection lacks a required driver interface")
+	}
+	if _, err = pgConn.ExecContext(context.Background(), "SET TIME ZONE 'UTC'", nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return rebindingConn{pgConn}, nil
+}
+
+// rebindingConn rewrites the placeholders of every statement before passing it to lib/pq.
+type rebindingConn struct {
+	postgresConnection
+}
+
+func (c rebindingConn) Prepare(query string) (driver.Stmt, error) {
+	return c.postgresConnection.Prepare(rebindPlaceholders(query))
+}
+
+func (c rebindingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.postgresConnection.PrepareContext(ctx, rebindPlaceholders(query))
+}
+
+func (c rebindingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.postgresConnection.QueryContext(ctx, rebindPlaceholders(query), args)
+}
+
+func (c rebindingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.postgresConnection.ExecContext(ctx, rebindPlaceholders(query), args)
+}
+
+// rebindPlaceholders numbers the '?' placeholders of query as $1, $2, ..., leaving question marks
+// in string literals, quoted identifiers and comments alone.
+func rebindPlaceholders(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"':
+			// Doubled quotes inside the literal end it and start a new one, which is equivalent
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+4])
+			i += end + 3
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package metadata_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/metadata/metadatatest"
+)
+
+// TestPostgresStore runs the metadata layer's PostgreSQL-specific paths against the database named
+// by BRIDGO_TEST_POSTGRES_DSN.
+func TestPostgresStore(t *testing.T) {
+	db := metadatatest.NewPostgresDB(t)
+	if !metadata.IsPostgres(db) {
+		t.Fatal("IsPostgres = false for a PostgreSQL metadata database")
+	}
+	ownerID := metadatatest.InsertUser(t, db, "alice", "Correct-horse-1")
+	dataSourceID := metadatatest.InsertDataSource(t, db, ownerID, "sales")
+
+	count := func(query string, args ...interface{}) int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	t.Run("migrations", func(t *testing.T) {
+		version, err := metadata.SchemaVersion(db)
+		if err != nil || version != metadata.LatestSchemaVersion() {
+			t.Errorf("SchemaVersion = %d (%v), want %d", version, err, metadata.LatestSchemaVersion())
+		}
+		if applied, err := metadata.Migrate(db); err != nil || len(applied) != 0 {
+			t.Errorf("second Migrate applied %v (%v), want nothing", applied, err)
+		}
+	})
+
+	t.Run("replace row", func(t *testing.T) {
+		err := metadata.ReplaceRow(db, "users", ownerID, map[string]interface{}{"email": "alice@example.org", "updated_at": time.Now().UTC()})
+		if err != nil {
+			t.Fatalf("ReplaceRow: %v", err)
+		}
+		if count("SELECT COUNT(*) FROM users WHERE id = ? AND email = 'alice@example.org'", ownerID) != 1 {
+			t.Error("e-mail address was not replaced")
+		}
+		if count("SELECT COUNT(*) FROM data_sources WHERE user_id = ?", ownerID) != 1 {
+			t.Error("data source of the rewritten user was lost")
+		}
+	})
+
+	t.Run("change rollback", func(t *testing.T) {
+		change, err := metadata.BeginChange(db)
+		if err != nil {
+			t.Fatalf("BeginChange: %v", err)
+		}
+		if _, err = change.Delete("data_sources", "id = ?", dataSourceID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if err = change.Rollback(); err != nil {
+			t.Fatalf("Rollback: %v", err)
+		}
+		if count("SELECT COUNT(*) FROM data_sources WHERE id = ?", dataSourceID) != 1 {
+			t.Error("rolled back deletion removed the data source")
+		}
+		if count("SELECT COUNT(*) FROM change_journal") != 0 {
+			t.Error("PostgreSQL changes wrote to the change journal")
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := metadata.WriteSnapshot(db, &buf); err != nil {
+			t.Fatalf("WriteSnapshot: %v", err)
+		}
+		if _, err := db.Exec("DELETE FROM data_sources"); err != nil {
+			t.Fatalf("delete data sources: %v", err)
+		}
+		snapshot, err := metadata.ReadSnapshot(&buf)
+		if err != nil {
+			t.Fatalf("ReadSnapshot: %v", err)
+		}
+		// Restoring drops the tables in dependency order and refills them, referenced tables first
+		if _, err = metadata.RestoreSnapshot(db, snapshot); err != nil {
+			t.Fatalf("RestoreSnapshot: %v", err)
+		}
+		var name string
+		if err = db.QueryRow("SELECT source_name FROM data_sources WHERE id = ?", dataSourceID).Scan(&name); err != nil || name != "sales" {
+			t.Errorf("restored data source = %q (%v), want sales", name, err)
+		}
+		if err = db.QueryRow("SELECT username FROM users WHERE id = ?", ownerID).Scan(&name); err != nil || name != "alice" {
+			t.Errorf("restored user = %q (%v), want alice", name, err)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package metadata
+
+import "testing"
+
+func TestRebindPlaceholders(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM users WHERE id = ? AND name = ?", "SELECT * FROM users WHERE id = $1 AND name = $2"},
+		{"INSERT INTO t (a, b, c) VALUES (?,?,?)", "INSERT INTO t (a, b, c) VALUES ($1,$2,$3)"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{"SELECT 'it''s ?' WHERE a = ?", "SELECT 'it''s ?' WHERE a = $1"},
+		{`SELECT "odd?name" FROM t WHERE a = ?`, `SELECT "odd?name" FROM t WHERE a = $1`},
+		{"SELECT a -- why?\nFROM t WHERE a = ?", "SELECT a -- why?\nFROM t WHERE a = $1"},
+		{"SELECT a /* ? */ FROM t WHERE a = ? /* ? */", "SELECT a /* ? */ FROM t WHERE a = $1 /* ? */"},
+		{"SELECT ? -- trailing ?", "SELECT $1 -- trailing ?"},
+		{"SELECT 'unterminated ?", "SELECT 'unterminated ?"},
+		{"SELECT ? /* unterminated ?", "SELECT $1 /* unterminated ?"},
+		{"SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?", "SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11"},
+	}
+	for _, tt := range tests {
+		if got := rebindPlaceholders(tt.query); got != tt.want {
+			t.Errorf("rebindPlaceholders(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
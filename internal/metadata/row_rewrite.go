@@ -0,0 +1,321 @@
+package metadata
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ReplaceRow changes columns of the row of table with the given id, like ReplaceRows.
+// It returns sql.ErrNoRows if there is no such row.
+func ReplaceRow(db *sql.DB, table string, id string, changes map[string]interface{}) error {
+	change, err := BeginChange(db)
+	if err != nil {
+		return err
+	}
+	defer change.Rollback()
+	if err = change.ReplaceRow(table, id, changes); err != nil {
+		return err
+	}
+	return change.Commit()
+}
+
+// ReplaceRows changes columns of the rows of table matching where in a Change of its own, and
+// returns how many rows were changed; see Change.ReplaceRows.
+func ReplaceRows(db *sql.DB, table, where string, args []interface{}, changes map[string]interface{}) (int, error) {
+	change, err := BeginChange(db)
+	if err != nil {
+		return 0, err
+	}
+	defer change.Rollback()
+	replaced, err := change.ReplaceRows(table, where, args, changes)
+	if err != nil {
+		return 0, err
+	}
+	return replaced, change.Commit()
+}
+
+// ReplaceRow changes columns of the row of table with the given id, like ReplaceRows.
+// It returns sql.ErrNoRows if there is no such row.
+func (c *Change) ReplaceRow(table string, id string, changes map[string]interface{}) error {
+	replaced, err := c.ReplaceRows(table, "id = ?", []interface{}{id}, changes)
+	if err == nil && replaced == 0 {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// ReplaceRows changes columns of the rows of table matching where, and returns how many rows
+// were changed. The table must have an 'id' column identifying its rows.
+//
+// DuckDB rejects UPDATEs of columns covered by a PRIMARY KEY, UNIQUE or FOREIGN KEY index, and
+// of any indexed column of a row other tables reference (its index constraints are checked
+// eagerly). So each row is deleted and re-inserted instead, and rows referencing it through
+// foreign keys are set aside meanwhile and restored afterwards; changes must therefore not touch
+// referenced columns. If a row cannot be re-inserted, every row is put back as it was and the
+// insert error is returned.
+//
+// PostgreSQL has no such restriction, so there the rows are simply updated.
+func (c *Change) ReplaceRows(table, where string, args []interface{}, changes map[string]interface{}) (int, error) {
+	if c.tx != nil {
+		return updateRows(c.tx, table, where, args, changes)
+	}
+	return rewriteRows(c.db, c, table, where, args, changes)
+}
+
+// rewriteRows is ReplaceRows for DuckDB. Rows are journaled in change before they are set aside
+// or rewritten, unless change is nil.
+func rewriteRows(db *sql.DB, change *Change, table, where string, args []interface{}, changes map[string]interface{}) (int, error) {
+	rows, err := selectRows(db, table, where, args)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows.values) == 0 {
+		return 0, nil
+	}
+	idIndex := rows.columnIndex("id")
+	if idIndex < 0 {
+		return 0, fmt.Errorf("table %s has no id column", table)
+	}
+
+	dependents, err := detachDependents(db, change, rows)
+	if err != nil {
+		return 0, errorWithRestore(db, dependents, err)
+	}
+	if change != nil {
+		if err = change.record(rows, stepRewritten); err != nil {
+			return 0, errorWithRestore(db, dependents, err)
+		}
+	}
+
+	replaced := 0
+	for _, original := range rows.values {
+		updated := make([]interface{}, len(original))
+		copy(updated, original)
+		for i, column := range rows.columns {
+			if value, ok := changes[column]; ok {
+				updated[i] = value
+			}
+		}
+
+		if _, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", table), original[idIndex]); err != nil {
+			err = fmt.Errorf("failed to remove %s row: %w", table, err)
+			break
+		}
+		if err = rows.insert(db, updated); err != nil {
+			if restoreErr := rows.insert(db, original); restoreErr != nil {
+				err = fmt.Errorf("failed to rewrite %s row (%v) and to restore it: %w", table, err, restoreErr)
+			} else {
+				err = fmt.Errorf("failed to rewrite %s row: %w", table, err)
+			}
+			break
+		}
+		replaced++
+	}
+
+	if err != nil {
+		// Rows rewritten before the failing one are put back too, as the dependents are still set aside
+		for _, original := range rows.values[:replaced] {
+			_, restoreErr := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", table), original[idIndex])
+			if restoreErr == nil {
+				restoreErr = rows.insert(db, original)
+			}
+			if restoreErr != nil {
+				log.Printf("Failed to restore %s row %v: %v", table, original, restoreErr)
+			}
+		}
+		return 0, errorWithRestore(db, dependents, err)
+	}
+	return replaced, restoreRows(db, dependents)
+}
+
+// updateRows changes columns of the rows of table matching where with a plain UPDATE.
+func updateRows(db querier, table, where string, args []interface{}, changes map[string]interface{}) (int, error) {
+	columns := make([]string, 0, len(changes))
+	for column := range changes {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	assignments := make([]string, len(columns))
+	values := make([]interface{}, 0, len(columns)+len(args))
+	for i, column := range columns {
+		assignments[i] = column + " = ?"
+		values = append(values, changes[column])
+	}
+	values = append(values, args...)
+
+	result, err := db.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(assignments, ", "), where), values...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update %s rows: %w", table, err)
+	}
+	updated, err := result.RowsAffected()
+	return int(updated), err
+}
+
+// rowSet holds rows read from a table.
+type rowSet struct {
+	table   string
+	columns []string
+	values  [][]interface{}
+}
+
+// selectRows reads every column of the rows of table matching where.
+func selectRows(db querier, table, where string, args []interface{}) (*rowSet, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s", table, where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s rows: %w", table, err)
+	}
+	defer rows.Close()
+
+	set := &rowSet{table: table}
+	if set.columns, err = rows.Columns(); err != nil {
+		return nil, fmt.Errorf("failed to read %s columns: %w", table, err)
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(set.columns))
+		ptrs := make([]interface{}, len(values))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s row: %w", table, err)
+		}
+		set.values = append(set.values, values)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating %s rows: %w", table, err)
+	}
+	return set, nil
+}
+
+// columnIndex returns the position of a column, or -1.
+func (rs *rowSet) columnIndex(column string) int {
+	for i, name := range rs.columns {
+		if strings.EqualFold(name, column) {
+			return i
+		}
+	}
+	return -1
+}
+
+// insert writes one row with the set's columns.
+func (rs *rowSet) insert(db querier, values []interface{}) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(rs.columns)), ", ")
+	_, err := db.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", rs.table, strings.Join(rs.columns, ", "), placeholders), values...)
+	return err
+}
+
+// foreignKey is a single-column foreign key of table referencing another table.
+type foreignKey struct {
+	table            string
+	column           string
+	referencedColumn string
+}
+
+// referencingForeignKeys returns the foreign keys referencing table.
+func referencingForeignKeys(db *sql.DB, table string) ([]foreignKey, error) {
+	rows, err := db.Query(`
+		SELECT table_name, constraint_column_names, referenced_column_names
+		FROM duckdb_constraints()
+		WHERE constraint_type = 'FOREIGN KEY' AND lower(referenced_table) = lower(?)`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up foreign keys referencing %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var keys []foreignKey
+	for rows.Next() {
+		var key foreignKey
+		var columns, referencedColumns []interface{}
+		if err = rows.Scan(&key.table, &columns, &referencedColumns); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+		}
+		if len(columns) != 1 || len(referencedColumns) != 1 {
+			return nil, fmt.Errorf("multi-column foreign key from %s to %s is not supported", key.table, table)
+		}
+		key.column, _ = columns[0].(string)
+		key.referencedColumn, _ = referencedColumns[0].(string)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// detachDependents deletes the rows referencing parent through foreign keys, recursively, and
+// returns them in the order they were deleted; restoreRows puts them back. They are journaled in
+// change before they are deleted, unless change is nil.
+func detachDependents(db *sql.DB, change *Change, parent *rowSet) ([]*rowSet, error) {
+	keys, err := referencingForeignKeys(db, parent.table)
+	if err != nil {
+		return nil, err
+	}
+
+	var detached []*rowSet
+	for _, key := range keys {
+		index := parent.columnIndex(key.referencedColumn)
+		if index < 0 {
+			return detached, fmt.Errorf("column %s of %s not found", key.referencedColumn, parent.table)
+		}
+		var values []interface{}
+		for _, row := range parent.values {
+			if row[index] != nil {
+				values = append(values, row[index])
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		where := fmt.Sprintf("%s IN (%s)", key.column, strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", "))
+		children, err := selectRows(db, key.table, where, values)
+		if err != nil {
+			return detached, err
+		}
+		if len(children.values) == 0 {
+			continue
+		}
+
+		grandchildren, err := detachDependents(db, change, children)
+		detached = append(detached, grandchildren...)
+		if err != nil {
+			return detached, err
+		}
+		if change != nil {
+			if err = change.record(children, stepDeleted); err != nil {
+				return detached, err
+			}
+		}
+		if _, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", key.table, where), values...); err != nil {
+			return detached, fmt.Errorf("failed to set aside %s rows: %w", key.table, err)
+		}
+		detached = append(detached, children)
+	}
+	return detached, nil
+}
+
+// restoreRows re-inserts rows set aside by detachDependents, parents before children.
+// It restores as many rows as it can and returns the first error.
+func restoreRows(db *sql.DB, detached []*rowSet) error {
+	var firstErr error
+	for i := len(detached) - 1; i >= 0; i-- {
+		for _, values := range detached[i].values {
+			if err := detached[i].insert(db, values); err != nil {
+				log.Printf("Failed to restore %s row %v: %v", detached[i].table, values, err)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to restore %s rows: %w", detached[i].table, err)
+				}
+			}
+		}
+	}
+	return firstErr
+}
+
+// errorWithRestore restores detached rows after err and returns err, noting a failed restore.
+func errorWithRestore(db *sql.DB, detached []*rowSet, err error) error {
+	if restoreErr := restoreRows(db, detached); restoreErr != nil {
+		return fmt.Errorf("%w (and %v)", err, restoreErr)
+	}
+	return err
+}
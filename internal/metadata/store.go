@@ -0,0 +1,97 @@
+package metadata
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Metadata store backends. DuckDB is an embedded file for single-node installs; PostgreSQL lets
+// several Bridgo replicas share one metadata database.
+const (
+	DriverDuckDB   = "duckdb"
+	DriverPostgres = "postgres"
+)
+
+// StoreConfig selects the metadata database and sizes its connection pool.
+type StoreConfig struct {
+	Driver          string        // DriverDuckDB or DriverPostgres
+	DSN             string        // DuckDB file path, or PostgreSQL connection string (URL or key=value form)
+	MaxOpenConns    int           // 0 means unlimited
+	MaxIdleConns    int           // 0 means database/sql's default
+	ConnMaxLifetime time.Duration // 0 means connections are reused forever
+}
+
+// DefaultStoreConfig is the embedded DuckDB file in the working directory.
+var DefaultStoreConfig = StoreConfig{Driver: DriverDuckDB, DSN: dbFileName}
+
+// IsPostgres reports whether db is a PostgreSQL metadata database opened by OpenDB.
+func IsPostgres(db *sql.DB) bool {
+	_, ok := db.Driver().(postgresDriver)
+	return ok
+}
+
+// OpenDB opens the metadata database without changing it.
+func OpenDB(cfg StoreConfig) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	var location string
+	switch cfg.Driver {
+	case DriverDuckDB:
+		location = "DuckDB at: " + filepath.Clean(cfg.DSN)
+		db, err = sql.Open("duckdb", cfg.DSN)
+	case DriverPostgres:
+		location = "PostgreSQL metadata database"
+		db, err = sql.Open(postgresDriverName, cfg.DSN)
+	default:
+		return nil, fmt.Errorf("unsupported metadata store '%s'", cfg.Driver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	fmt.Println("Successfully connected to", location)
+	return db, nil
+}
+
+// withSetupLock runs fn, which migrates and seeds the database, while holding a lock that keeps
+// other replicas starting at the same time from doing so concurrently.
+func withSetupLock(db *sql.DB, fn func() error) error {
+	return WithLock(db, setupLockID, fn)
+}
+
+// WithLock runs fn while holding the PostgreSQL advisory lock key, so replicas sharing the
+// database take turns. DuckDB files have a single writing process, so there fn simply runs.
+func WithLock(db *sql.DB, key int64, fn func() error) error {
+	if !IsPostgres(db) {
+		return fn()
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reserve connection for lock: %w", err)
+	}
+	defer conn.Close()
+
+	// Session-level advisory locks belong to the connection, so lock and unlock on the same one
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock(?)", key); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock(?)", key)
+
+	return fn()
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// ScopeTypeDataSource is the scope type granting an API key access to a data source.
+// Views are scoped with their view type (ViewTypeVirtualView, ViewTypeVirtualBaseView).
+const ScopeTypeDataSource = "datasource"
+
+// APIKeyScope names one data source or view an API key may access.
+type APIKeyScope struct {
+	Type string `json:"type"` // ScopeTypeDataSource or a view type
+	ID   string `json:"id"`
+}
+
+// APIKey represents the structure of the 'api_keys' table. The key itself is only
+// returned once, on creation; Bridgo stores its SHA-256 hash.
+type APIKey struct {
+	ID              string        `json:"id"`
+	UserID          string        `json:"user_id"` // User or service account the key acts as
+	Name            string        `json:"name"`
+	KeyPrefix       string        `json:"key_prefix"` // First characters of the key, to recognise it
+	Scopes          []APIKeyScope `json:"scopes"`
+	ExpiresAt       *time.Time    `json:"expires_at,omitempty"`
+	LastUsedAt      *time.Time    `json:"last_used_at,omitempty"`
+	RevokedAt       *time.Time    `json:"revoked_at,omitempty"`
+	CreatedByUserID *string       `json:"created_by_user_id,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+}
+
+// CreateAPIKeyInput defines the input for creating an API key.
+type CreateAPIKeyInput struct {
+	CreatedByUserID string        `json:"-"`       // Passed internally
+	UserID          string        `json:"user_id"` // Defaults to the caller; a service account otherwise
+	Name            string        `json:"name"`
+	Scopes          []APIKeyScope `json:"scopes"`
+	ExpiresInDays   int           `json:"expires_in_days"` // 0 means the key does not expire
+}
+
+// ServiceAccount represents the structure of the 'service_accounts' table: a non-human
+// user that cannot log in and authenticates with API keys only.
+type ServiceAccount struct {
+	UserID          string    `json:"user_id"`
+	Username        string    `json:"username"`
+	Description     *string   `json:"description,omitempty"`
+	IsActive        bool      `json:"is_active"`
+	Roles           []string  `json:"roles"`
+	CreatedByUserID *string   `json:"created_by_user_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// Audit action types stored in 'audit_logs.action_type'.
+const (
+	AuditLoginSuccess          = "auth.login_success"
+	AuditLoginFailure          = "auth.login_failure"
+	AuditAccountLocked         = "auth.account_locked"
+	AuditRegister              = "auth.register"
+	AuditSetupComplete         = "auth.setup"
+	AuditLogout                = "auth.logout"
+	AuditTokenRefresh          = "auth.token_refresh"
+	AuditTokenRevoke           = "auth.token_revoke"
+	AuditDataSourceCreate      = "datasource.create"
+	AuditDataSourceUpdate      = "datasource.update"
+	AuditDataSourceDelete      = "datasource.delete"
+	AuditDataSourceTest        = "datasource.test_connection"
+	AuditCredentialAccess      = "datasource.credential_access"
+	AuditPrivilegeGrant        = "privilege.grant"
+	AuditPrivilegeRevoke       = "privilege.revoke"
+	AuditRoleAssign            = "role.assign"
+	AuditRoleRemove            = "role.remove"
+	AuditViewCreate            = "view.create"
+	AuditViewUpdate            = "view.update"
+	AuditViewShare             = "view.share"
+	AuditViewUnshare           = "view.unshare"
+	AuditViewPublish           = "view.publish"
+	AuditViewTransferOwnership = "view.transfer_ownership"
+	AuditMaskingPolicySet      = "policy.masking_set"
+	AuditMaskingPolicyDelete   = "policy.masking_delete"
+	AuditRowPolicySet          = "policy.row_set"
+	AuditRowPolicyDelete       = "policy.row_delete"
+	AuditUserAttributeSet      = "user.attribute_set"
+	AuditUserAttributeDelete   = "user.attribute_delete"
+	AuditUserCreate            = "user.create"
+	AuditInviteCreate          = "user.invite_create"
+	AuditInviteDelete          = "user.invite_delete"
+	AuditUserDeactivate        = "user.deactivate"
+	AuditUserReactivate        = "user.reactivate"
+	AuditUserPasswordReset     = "user.password_reset"
+	AuditUserEmailChange       = "user.email_change"
+	AuditUserDelete            = "user.delete"
+	AuditUserUnlock            = "user.unlock"
+	AuditUserLDAPLink          = "user.ldap_link"
+	AuditUserLDAPUnlink        = "user.ldap_unlink"
+	AuditUserOIDCLink          = "user.oidc_link"
+	AuditUserOIDCUnlink        = "user.oidc_unlink"
+	AuditPasswordChange        = "auth.password_change"
+	AuditMFAEnable             = "auth.mfa_enable"
+	AuditMFADisable            = "auth.mfa_disable"
+	AuditMFARecoveryCodes      = "auth.mfa_recovery_codes"
+	AuditMFAReset              = "user.mfa_reset"
+	AuditServiceAccountCreate  = "user.service_account_create"
+	AuditServiceAccountDisable = "user.service_account_disable"
+	AuditAPIKeyCreate          = "apikey.create"
+	AuditAPIKeyRevoke          = "apikey.revoke"
+	AuditQueryExecute          = "query.execute"
+	AuditLogExport             = "audit.export"
+	AuditBackupCreate          = "system.backup_create"
+	AuditBackupDownload        = "system.backup_download"
+	AuditBundleExport          = "bundle.export"
+	AuditBundleImport          = "bundle.import"
+	AuditGitOpsReconcile       = "system.gitops_reconcile"
+)
+
+// AuditLog represents the structure of the 'audit_logs' table.
+type AuditLog struct {
+	ID               string    `json:"id"`
+	UserID           *string   `json:"user_id,omitempty"`
+	Username         *string   `json:"username,omitempty"` // Joined from 'users' for display
+	ActionType       string    `json:"action_type"`
+	TargetResourceID *string   `json:"target_resource_id,omitempty"`
+	Details          *string   `json:"details,omitempty"` // JSON object with action-specific fields
+	IPAddress        *string   `json:"ip_address,omitempty"`
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// AuditLogFilter narrows an audit log search. Zero values are ignored.
+type AuditLogFilter struct {
+	UserID           string
+	ActionType       string // Exact action, or a prefix ending in "." such as "view."
+	TargetResourceID string
+	IPAddress        string
+	Search           string // Substring matched against details
+	From             time.Time
+	To               time.Time
+	Limit            int
+	Offset           int
+}
@@ -0,0 +1,170 @@
+package models
+
+// Bundle format identifiers. Version is bumped when a change to the format would be misread by
+// older imports.
+const (
+	BundleKind    = "BridgoBundle"
+	BundleVersion = 1
+)
+
+// Bundle encodings. JSON is also valid YAML, so imports accept either.
+const (
+	BundleFormatYAML = "yaml"
+	BundleFormatJSON = "json"
+)
+
+// How an import treats objects of the bundle whose name is already taken by one of the caller's.
+const (
+	BundleConflictFail      = "fail"      // Import nothing and report the conflicts
+	BundleConflictSkip      = "skip"      // Keep the existing object; references resolve to it
+	BundleConflictOverwrite = "overwrite" // Update the existing object from the bundle
+)
+
+// How an export treats data source passwords.
+const (
+	BundleSecretsOmit    = "omit"    // Leave passwords out; they are entered again after import
+	BundleSecretsEncrypt = "encrypt" // Encrypt passwords with a key shared with the importing side
+)
+
+// Bundle is a portable set of data sources and views. Unlike the metadata tables it never
+// contains IDs: views name their data source, and columns are referenced as schema.table.column,
+// so a bundle can be imported into another installation or kept in version control.
+// Roles and grants are only applied by declarative reconciliation (see ReconcilePlan).
+type Bundle struct {
+	Kind             string                  `json:"kind" yaml:"kind"`
+	Version          int                     `json:"version" yaml:"version"`
+	DataSources      []BundleDataSource      `json:"data_sources,omitempty" yaml:"data_sources,omitempty"`
+	VirtualBaseViews []BundleVirtualBaseView `json:"virtual_base_views,omitempty" yaml:"virtual_base_views,omitempty"`
+	VirtualViews     []BundleVirtualView     `json:"virtual_views,omitempty" yaml:"virtual_views,omitempty"`
+	Roles            []BundleRole            `json:"roles,omitempty" yaml:"roles,omitempty"`
+	DataSourceGrants []BundleDataSourceGrant `json:"data_source_grants,omitempty" yaml:"data_source_grants,omitempty"`
+	ViewGrants       []BundleViewGrant       `json:"view_grants,omitempty" yaml:"view_grants,omitempty"`
+}
+
+// BundleDataSource is a data source's connection settings and cached schema.
+type BundleDataSource struct {
+	Name              string            `json:"name" yaml:"name"`
+	DBType            string            `json:"db_type" yaml:"db_type"`
+	Host              string            `json:"host,omitempty" yaml:"host,omitempty"`
+	Port              int               `json:"port,omitempty" yaml:"port,omitempty"`
+	Database          string            `json:"database,omitempty" yaml:"database,omitempty"`
+	Username          string            `json:"username,omitempty" yaml:"username,omitempty"`
+	SSLMode           string            `json:"ssl_mode,omitempty" yaml:"ssl_mode,omitempty"`
+	AdditionalParams  map[string]string `json:"additional_params,omitempty" yaml:"additional_params,omitempty"` // Driver options
+	Description       string            `json:"description,omitempty" yaml:"description,omitempty"`
+	PasswordEncrypted string            `json:"password_encrypted,omitempty" yaml:"password_encrypted,omitempty"` // Base64; only with secrets=encrypt
+	Tables            []BundleTable     `json:"tables,omitempty" yaml:"tables,omitempty"`
+}
+
+// BundleTable is a table of a bundled data source.
+type BundleTable struct {
+	Schema  string         `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Name    string         `json:"name" yaml:"name"`
+	Columns []BundleColumn `json:"columns" yaml:"columns"`
+}
+
+// BundleColumn is a column of a bundled table.
+type BundleColumn struct {
+	Name       string `json:"name" yaml:"name"`
+	Type       string `json:"type" yaml:"type"`
+	Nullable   *bool  `json:"nullable,omitempty" yaml:"nullable,omitempty"`
+	PrimaryKey bool   `json:"primary_key,omitempty" yaml:"primary_key,omitempty"`
+}
+
+// BundleVirtualBaseView is a virtual base view, naming its data source.
+type BundleVirtualBaseView struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	DataSource  string   `json:"data_source" yaml:"data_source"`
+	Table       string   `json:"table" yaml:"table"`
+	Columns     []string `json:"columns" yaml:"columns"`
+}
+
+// BundleVirtualView is a virtual view with its columns referenced by name.
+type BundleVirtualView struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Columns     []BundleColumnRef `json:"columns" yaml:"columns"`
+}
+
+// BundleColumnRef references a column of a data source as schema.table.column, or table.column
+// for data sources without schemas.
+type BundleColumnRef struct {
+	DataSource string `json:"data_source" yaml:"data_source"`
+	Column     string `json:"column" yaml:"column"`
+	Alias      string `json:"alias,omitempty" yaml:"alias,omitempty"`
+}
+
+// BundleRole is a custom role. When Members is given, the role's members are managed too and
+// users are added to and removed from it to match.
+type BundleRole struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Permissions []string `json:"permissions" yaml:"permissions"`
+	Members     []string `json:"members,omitempty" yaml:"members,omitempty"` // Usernames
+}
+
+// BundleDataSourceGrant is a privilege of a user on a data source.
+type BundleDataSourceGrant struct {
+	DataSource string `json:"data_source" yaml:"data_source"`
+	User       string `json:"user" yaml:"user"`
+	Privilege  string `json:"privilege" yaml:"privilege"` // READ, QUERY or MANAGE
+	CanGrant   bool   `json:"can_grant,omitempty" yaml:"can_grant,omitempty"`
+}
+
+// BundleViewGrant shares a view with a user or a role, or publishes it to everyone.
+type BundleViewGrant struct {
+	ViewType string `json:"view_type" yaml:"view_type"` // virtual_view or virtual_base_view
+	View     string `json:"view" yaml:"view"`
+	User     string `json:"user,omitempty" yaml:"user,omitempty"`
+	Role     string `json:"role,omitempty" yaml:"role,omitempty"`
+	Everyone bool   `json:"everyone,omitempty" yaml:"everyone,omitempty"` // Publish the view; access must be VIEW
+	Access   string `json:"access" yaml:"access"`                         // VIEW or EDIT
+}
+
+// ExportBundleInput selects what goes into a bundle. The caller must own the data sources and
+// have at least VIEW access on the views.
+type ExportBundleInput struct {
+	UserID             string   `json:"-"` // Passed internally
+	DataSourceIDs      []string `json:"data_source_ids"`
+	VirtualBaseViewIDs []string `json:"virtual_base_view_ids"`
+	VirtualViewIDs     []string `json:"virtual_view_ids"`
+	Secrets            string   `json:"secrets"`     // "omit" (default) or "encrypt"
+	SecretsKey         string   `json:"secrets_key"` // Passphrase passwords are encrypted with
+	Format             string   `json:"format"`      // "yaml" (default) or "json"; used by the handler
+}
+
+// ImportBundleInput defines the input for importing a bundle as the calling user.
+type ImportBundleInput struct {
+	UserID     string
+	Bundle     Bundle
+	OnConflict string // "fail" (default), "skip" or "overwrite"
+	SecretsKey string // Passphrase the bundle's passwords were encrypted with
+	DryRun     bool
+}
+
+// Import actions reported per bundle object.
+const (
+	BundleActionCreate   = "create"
+	BundleActionUpdate   = "update"
+	BundleActionSkip     = "skip"
+	BundleActionConflict = "conflict"
+)
+
+// BundleImportItem reports what an import does, or would do, with one object of the bundle.
+type BundleImportItem struct {
+	Kind    string `json:"kind"` // "data_source", "virtual_base_view" or "virtual_view"
+	Name    string `json:"name"`
+	ID      string `json:"id,omitempty"` // Existing object of the same name, if any
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"`
+}
+
+// BundleImportReport is the outcome of an import. Nothing is written unless Applied is true.
+type BundleImportReport struct {
+	DryRun    bool               `json:"dry_run"`
+	Applied   bool               `json:"applied"`
+	Items     []BundleImportItem `json:"items"`
+	Conflicts int                `json:"conflicts"`
+	Errors    []string           `json:"errors,omitempty"` // Unresolved references and invalid objects
+}
@@ -15,7 +15,7 @@ type DataSource struct {
 	Port                 sql.NullInt64  `json:"port"`
 	DatabaseName         sql.NullString `json:"database_name"`
 	DBUsername           sql.NullString `json:"db_username"`
-	PasswordEncrypted    sql.NullString `json:"password_encrypted"` // Store securely, e.g., encrypted
+	PasswordEncrypted    sql.NullString `json:"-"` // Store securely, e.g., encrypted; never sent to clients
 	SSLMode              sql.NullString `json:"ssl_mode"`
 	AdditionalParams     sql.NullString `json:"additional_params"`
 	Description          sql.NullString `json:"description"`
@@ -24,6 +24,32 @@ type DataSource struct {
 	LastConnectionStatus sql.NullString `json:"last_connection_status"`
 	LastConnectionAt     sql.NullTime   `json:"last_connection_at"`
 	LastErrorMessage     sql.NullString `json:"last_error_message"`
+	Managed              bool           `json:"managed,omitempty"` // Managed by declarative configuration
+}
+
+// SSL modes of data source connections. As in libpq, require with a CA certificate verifies the
+// server certificate like verify-ca.
+const (
+	SSLModeDisable    = "disable"     // Plain connection
+	SSLModeRequire    = "require"     // Encrypted, the server certificate is not verified
+	SSLModeVerifyCA   = "verify-ca"   // Encrypted, the server certificate is signed by a trusted CA
+	SSLModeVerifyFull = "verify-full" // As verify-ca, and the certificate matches the host name
+)
+
+// DataSourceTLSState is the TLS state negotiated with a data source, as reported by the server.
+type DataSourceTLSState struct {
+	SSLMode string `json:"ssl_mode"`
+	Enabled bool   `json:"enabled"`
+	Version string `json:"version,omitempty"`
+	Cipher  string `json:"cipher,omitempty"`
+}
+
+// DataSourceHealth is the result of checking that a data source answers, for readiness probes.
+// It names no host and carries no error message, since probes are unauthenticated.
+type DataSourceHealth struct {
+	ID     string `json:"id"`
+	DBType string `json:"db_type"`
+	Status string `json:"status"` // "ok" or "failed"
 }
 
 // DataSourceSchema represents the structure of the 'data_source_schemas' table.
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Types of objects in 'managed_objects'. Managed objects are kept in line with the manifests
+// of declarative configuration and cannot be changed through the API.
+const (
+	ManagedDataSource      = "data_source"
+	ManagedVirtualBaseView = ViewTypeVirtualBaseView
+	ManagedVirtualView     = ViewTypeVirtualView
+	ManagedRole            = "role"
+	ManagedRoleMembers     = "role_members" // The members of a role, when its manifest lists them
+	ManagedDataSourceGrant = "data_source_grant"
+	ManagedViewGrant       = "view_grant"
+)
+
+// Reconciliation actions.
+const (
+	ReconcileCreate  = "create"
+	ReconcileUpdate  = "update"
+	ReconcileAdopt   = "adopt"   // An existing object becomes managed, and is updated to match
+	ReconcileDelete  = "delete"  // A managed object no longer in the manifests is pruned
+	ReconcileRelease = "release" // ...or, with pruning disabled, no longer managed
+)
+
+// ReconcileChange is a change reconciliation makes, or would make, to one object.
+type ReconcileChange struct {
+	Kind     string   `json:"kind"` // One of the Managed* types
+	Name     string   `json:"name"`
+	ID       string   `json:"id"`
+	Action   string   `json:"action"`
+	Manifest string   `json:"manifest,omitempty"`
+	Diff     []string `json:"diff,omitempty"` // Changed fields, e.g. `host: "a" -> "b"`, `+ column s.t.c`
+}
+
+// ReconcilePlan lists the changes that bring the metadata in line with the manifests. Nothing is
+// applied while Errors is not empty.
+type ReconcilePlan struct {
+	Changes   []ReconcileChange `json:"changes"`
+	Unchanged int               `json:"unchanged"` // Managed objects already matching their manifest
+	Errors    []string          `json:"errors,omitempty"`
+}
+
+// ReconcileResult is the outcome of a reconciliation run.
+type ReconcileResult struct {
+	Plan       ReconcilePlan `json:"plan"`
+	Applied    bool          `json:"applied"`
+	Error      string        `json:"error,omitempty"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+}
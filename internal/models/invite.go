@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Invite lets someone register while registration is invite-only. The invite code itself is shown
+// once when the invite is created and is stored only as a hash.
+type Invite struct {
+	ID              string     `json:"id"`
+	Email           *string    `json:"email,omitempty"` // When set, only this address can use the invite
+	RoleName        string     `json:"role_name"`
+	CreatedByUserID *string    `json:"created_by_user_id,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	UsedAt          *time.Time `json:"used_at,omitempty"`
+	UsedByUserID    *string    `json:"used_by_user_id,omitempty"`
+}
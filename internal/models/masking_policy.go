@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Mask types stored in 'column_masking_policies.mask_type', from least to most restrictive.
+const (
+	MaskPartial  = "PARTIAL"  // Keep the last few characters (or an e-mail's domain), star out the rest
+	MaskTokenize = "TOKENIZE" // Replace with a deterministic token of the same shape (digits stay digits)
+	MaskHash     = "HASH"     // Replace with a keyed SHA-256 hash of the value
+	MaskRedact   = "REDACT"   // Replace the value entirely
+)
+
+// MaskingPolicy represents the structure of the 'column_masking_policies' table.
+// A policy targets either a data source column (DataSourceSchemaID) or a column of a
+// single view (ViewType, ViewID, ColumnName).
+type MaskingPolicy struct {
+	ID                 string    `json:"id"`
+	DataSourceSchemaID *string   `json:"data_source_schema_id,omitempty"`
+	ViewType           *string   `json:"view_type,omitempty"`
+	ViewID             *string   `json:"view_id,omitempty"`
+	ColumnName         string    `json:"column_name"` // Column name in the data source, or in the view's results
+	TableName          string    `json:"table_name,omitempty"`
+	MaskType           string    `json:"mask_type"`
+	ExemptRoles        []string  `json:"exempt_roles"` // Role names that see unmasked values
+	CreatedByUserID    *string   `json:"created_by_user_id,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// SetMaskingPolicyInput defines the input for creating or replacing a masking policy.
+// Set either DataSourceSchemaID, or ViewType, ViewID and ColumnName.
+type SetMaskingPolicyInput struct {
+	UserID             string   `json:"-"` // Passed internally
+	DataSourceSchemaID string   `json:"data_source_schema_id"`
+	ViewType           string   `json:"view_type"`
+	ViewID             string   `json:"view_id"`
+	ColumnName         string   `json:"column_name"`
+	MaskType           string   `json:"mask_type"`
+	ExemptRoles        []string `json:"exempt_roles"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// MFAStatus describes a user's two-factor authentication.
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"` // One of the user's roles requires two-factor authentication
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// MFAEnrollment is a pending TOTP enrollment, to be added to an authenticator app and confirmed
+// with its first code.
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`           // Base32 secret for manual entry
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, usually shown as a QR code
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Privilege types stored in 'user_datasource_privileges.privilege_type'.
+// Each level includes the ones before it: MANAGE implies QUERY, QUERY implies READ.
+const (
+	PrivilegeRead   = "READ"   // See the data source and its schema
+	PrivilegeQuery  = "QUERY"  // Build views on the data source and read its data
+	PrivilegeManage = "MANAGE" // Grant and revoke privileges on the data source
+)
+
+// DataSourcePrivilege represents the structure of the 'user_datasource_privileges' table.
+type DataSourcePrivilege struct {
+	ID              string     `json:"id"`
+	UserID          string     `json:"user_id"`
+	Username        string     `json:"username,omitempty"` // Joined from 'users' for display
+	DataSourceID    string     `json:"data_source_id"`
+	PrivilegeType   string     `json:"privilege_type"`
+	CanGrant        bool       `json:"can_grant"`
+	GrantedByUserID *string    `json:"granted_by_user_id,omitempty"`
+	GrantedAt       time.Time  `json:"granted_at"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+// GrantDataSourcePrivilegeInput defines the input for granting a privilege on a data source.
+type GrantDataSourcePrivilegeInput struct {
+	GrantorUserID string     `json:"-"` // Passed internally
+	DataSourceID  string     `json:"data_source_id"`
+	Username      string     `json:"username"` // Grantee, either by username...
+	UserID        string     `json:"user_id"`  // ...or by user ID
+	PrivilegeType string     `json:"privilege_type"`
+	CanGrant      bool       `json:"can_grant"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+}
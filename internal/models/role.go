@@ -0,0 +1,98 @@
+package models
+
+import "time"
+
+// System role names seeded into the 'roles' table on startup.
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Permission names seeded into the 'permissions' table on startup.
+// Handlers check these against the roles carried in the caller's JWT.
+const (
+	PermDataSourceRead   = "datasource.read"
+	PermDataSourceCreate = "datasource.create"
+	PermDataSourceShare  = "datasource.share"
+	PermViewRead         = "view.read"
+	PermViewCreate       = "view.create"
+	PermViewShare        = "view.share"
+	PermRoleManage       = "role.manage"
+	PermAuditRead        = "audit.read"
+	PermPolicyManage     = "policy.manage"
+	PermUserManage       = "user.manage"
+	PermSystemBackup     = "system.backup"
+	PermSystemConfig     = "system.config"
+)
+
+// Role represents the structure of the 'roles' table.
+type Role struct {
+	ID           string    `json:"id"`
+	RoleName     string    `json:"role_name"`
+	Description  *string   `json:"description,omitempty"`
+	IsSystemRole bool      `json:"is_system_role"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Permissions  []string  `json:"permissions,omitempty"` // Permission names granted to the role
+}
+
+// Permission represents the structure of the 'permissions' table.
+type Permission struct {
+	ID             string  `json:"id"`
+	PermissionName string  `json:"permission_name"`
+	Description    *string `json:"description,omitempty"`
+	Category       *string `json:"category,omitempty"`
+}
+
+// PermissionDefinition describes a permission to be seeded.
+type PermissionDefinition struct {
+	Name        string
+	Description string
+	Category    string
+}
+
+// SystemRoleDefinition describes a system role and the permissions it is granted.
+type SystemRoleDefinition struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// SystemPermissions lists every permission known to Bridgo.
+var SystemPermissions = []PermissionDefinition{
+	{Name: PermDataSourceRead, Description: "View data sources and their schemas", Category: "datasource"},
+	{Name: PermDataSourceCreate, Description: "Test, create and save data sources", Category: "datasource"},
+	{Name: PermDataSourceShare, Description: "Grant and revoke other users' privileges on data sources", Category: "datasource"},
+	{Name: PermViewRead, Description: "View virtual views, their schemas and sample data", Category: "view"},
+	{Name: PermViewCreate, Description: "Create virtual views and virtual base views", Category: "view"},
+	{Name: PermViewShare, Description: "Share, publish and transfer ownership of views", Category: "view"},
+	{Name: PermPolicyManage, Description: "Define column masking and row-level security policies", Category: "policy"},
+	{Name: PermRoleManage, Description: "List roles, assign them to users and set user attributes", Category: "admin"},
+	{Name: PermAuditRead, Description: "Search and export the audit log", Category: "admin"},
+	{Name: PermUserManage, Description: "Create, invite, update and delete users, manage service accounts and other users' API keys, and revoke their sessions and tokens", Category: "admin"},
+	{Name: PermSystemBackup, Description: "Take and download metadata backups", Category: "admin"},
+	{Name: PermSystemConfig, Description: "View and run declarative configuration reconciliation", Category: "admin"},
+}
+
+// SystemRoles lists the roles seeded on startup together with their permissions.
+var SystemRoles = []SystemRoleDefinition{
+	{
+		Name:        RoleAdmin,
+		Description: "Full access, including role management",
+		Permissions: []string{PermDataSourceRead, PermDataSourceCreate, PermDataSourceShare, PermViewRead, PermViewCreate, PermViewShare, PermPolicyManage, PermRoleManage, PermAuditRead, PermUserManage, PermSystemBackup, PermSystemConfig},
+	},
+	{
+		Name:        RoleEditor,
+		Description: "Create and use data sources and views",
+		Permissions: []string{PermDataSourceRead, PermDataSourceCreate, PermDataSourceShare, PermViewRead, PermViewCreate, PermViewShare, PermPolicyManage},
+	},
+	{
+		Name:        RoleViewer,
+		Description: "Read-only access to data sources and views",
+		Permissions: []string{PermDataSourceRead, PermViewRead},
+	},
+}
+
+// DefaultUserRole is the role assigned to newly registered users.
+const DefaultUserRole = RoleEditor
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// RowSecurityPolicy represents the structure of the 'row_security_policies' table.
+// Predicate is a filter over the columns of the view's table, e.g.
+// "region = {{user.attr.region}} OR {{user.id}} = manager_id". Caller values are
+// always bound as query parameters, never spliced into the SQL.
+type RowSecurityPolicy struct {
+	ID              string    `json:"id"`
+	ViewType        string    `json:"view_type"`
+	ViewID          string    `json:"view_id"`
+	Name            string    `json:"name"`
+	Predicate       string    `json:"predicate"`
+	ExemptRoles     []string  `json:"exempt_roles"` // Role names that see every row
+	CreatedByUserID *string   `json:"created_by_user_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// SetRowSecurityPolicyInput defines the input for creating or replacing a named row-level
+// security policy on a view.
+type SetRowSecurityPolicyInput struct {
+	UserID      string   `json:"-"` // Passed internally
+	ViewType    string   `json:"view_type"`
+	ViewID      string   `json:"view_id"`
+	Name        string   `json:"name"`
+	Predicate   string   `json:"predicate"`
+	ExemptRoles []string `json:"exempt_roles"`
+}
+
+// UserAttribute represents the structure of the 'user_attributes' table: a custom
+// key/value pair (such as region) that row-level security predicates can reference.
+type UserAttribute struct {
+	UserID    string    `json:"user_id"`
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
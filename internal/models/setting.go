@@ -0,0 +1,10 @@
+package models
+
+// Keys of the 'system_settings' table.
+const (
+	SettingMaskingSecret = "masking_secret" // Secret used to hash and tokenize masked column values
+	SettingJWTSecret     = "jwt_secret"     // HS256 secret used when no JWT signing key is configured
+	SettingSetupToken    = "setup_token"    // SHA-256 of the one-time token for creating the first admin
+
+	SettingDataSourceSecret = "datasource_secret" // AES-256 key data source TLS certificates and keys are encrypted with
+)
@@ -13,3 +13,21 @@ type User struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 	// Roles      []Role    `json:"roles,omitempty"` // Example for future use if roles are directly embedded
 }
+
+// UserSummary is a user as listed to administrators.
+type UserSummary struct {
+	User
+	Roles            []string   `json:"roles"`
+	IsServiceAccount bool       `json:"isServiceAccount"`
+	HasPassword      bool       `json:"hasPassword"` // False for service accounts and users provisioned by SSO or LDAP
+	MFAEnabled       bool       `json:"mfaEnabled"`
+	LockedUntil      *time.Time `json:"lockedUntil,omitempty"` // Set while locked after too many failed logins
+}
+
+// UserFilter narrows a user search. Zero values are ignored.
+type UserFilter struct {
+	Search string // Substring matched case-insensitively against username and email
+	Active *bool
+	Limit  int
+	Offset int
+}
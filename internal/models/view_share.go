@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// View types that can be shared; each maps to its own metadata table.
+const (
+	ViewTypeVirtualView     = "virtual_view"      // 'virtual_views'
+	ViewTypeVirtualBaseView = "virtual_base_view" // 'virtual_base_views'
+)
+
+// Grantee types stored in 'view_shares.grantee_type'.
+const (
+	GranteeTypeUser     = "user"     // grantee_id is a users.id
+	GranteeTypeRole     = "role"     // grantee_id is a roles.id
+	GranteeTypeEveryone = "everyone" // The view is published; grantee_id is "*"
+)
+
+// Access levels on a view. OWNER is never stored; it is reported for the view's creator.
+const (
+	ViewAccessView  = "VIEW"  // Read the schema and data of the view
+	ViewAccessEdit  = "EDIT"  // VIEW, plus change the view's name, description and columns
+	ViewAccessOwner = "OWNER" // EDIT, plus share, publish and transfer the view
+)
+
+// ViewShare represents the structure of the 'view_shares' table.
+type ViewShare struct {
+	ID              string    `json:"id"`
+	ViewType        string    `json:"view_type"`
+	ViewID          string    `json:"view_id"`
+	GranteeType     string    `json:"grantee_type"`
+	GranteeID       string    `json:"grantee_id"`
+	GranteeName     string    `json:"grantee_name,omitempty"` // Username or role name, joined for display
+	AccessLevel     string    `json:"access_level"`
+	GrantedByUserID *string   `json:"granted_by_user_id,omitempty"`
+	GrantedAt       time.Time `json:"granted_at"`
+}
+
+// ShareViewInput defines the input for sharing a view with a user or a role.
+type ShareViewInput struct {
+	UserID      string `json:"-"` // Passed internally
+	ViewType    string `json:"view_type"`
+	ViewID      string `json:"view_id"`
+	GranteeType string `json:"grantee_type"` // "user" or "role"
+	Grantee     string `json:"grantee"`      // Username or role name
+	AccessLevel string `json:"access_level"` // "VIEW" or "EDIT"
+}
+
+// CatalogEntry is a published view as listed in the organization-wide catalog.
+// It deliberately carries no data source details.
+type CatalogEntry struct {
+	ViewType      string    `json:"view_type"`
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`
+	Description   *string   `json:"description,omitempty"`
+	OwnerUsername string    `json:"owner_username"`
+	PublishedAt   time.Time `json:"published_at"`
+}
@@ -15,6 +15,8 @@ type VirtualBaseView struct {
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 	LastAccessedAt  *time.Time `json:"last_accessed_at,omitempty"`
+	AccessLevel     string     `json:"access_level,omitempty"` // Caller's access: OWNER, EDIT or VIEW
+	Managed         bool       `json:"managed,omitempty"`      // Managed by declarative configuration
 }
 
 // VirtualBaseViewDefinition defines the structure for the JSON 'selected_columns' field
@@ -31,3 +33,13 @@ type CreateVirtualBaseViewInput struct {
 	TableName       string   `json:"table_name"`
 	SelectedColumns []string `json:"selected_columns"`
 }
+
+// UpdateVirtualBaseViewInput defines the input for updating a virtual base view.
+// Nil fields are left unchanged.
+type UpdateVirtualBaseViewInput struct {
+	UserID          string   `json:"-"` // Passed internally
+	ID              string   `json:"id"`
+	Name            *string  `json:"name"`
+	Description     *string  `json:"description"`
+	SelectedColumns []string `json:"selected_columns"`
+}
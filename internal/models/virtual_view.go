@@ -14,6 +14,8 @@ type VirtualView struct {
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	AccessLevel    string     `json:"access_level,omitempty"` // Caller's access: OWNER, EDIT or VIEW
+	Managed        bool       `json:"managed,omitempty"`      // Managed by declarative configuration
 }
 
 // VirtualViewDefinition defines the structure for the JSON 'definition' field
@@ -3,6 +3,7 @@ package server
 import (
 	"database/sql" // Added import
 
+	"Bridgo/internal/audit"
 	"Bridgo/internal/core"
 	"Bridgo/internal/users"
 )
@@ -10,8 +11,9 @@ import (
 // App represents the central application structure, holding references to all services.
 // It was formerly named Server, renamed to App for clarity as it now manages services.
 type App struct {
-	UserService *users.Service
-	CoreService *core.CoreService
+	UserService  *users.Service
+	CoreService  *core.CoreService
+	AuditService *audit.Service
 	// Add other services here as the application grows
 }
 
@@ -20,10 +22,12 @@ type App struct {
 func NewApp(db *sql.DB) *App { // Modified to accept *sql.DB
 	userService := users.NewService(db)    // Pass db to users.NewService
 	coreService := core.NewCoreService(db) // Pass db to core.NewCoreService
+	auditService := audit.NewService(db)
 
 	return &App{
-		UserService: userService,
-		CoreService: coreService,
+		UserService:  userService,
+		CoreService:  coreService,
+		AuditService: auditService,
 	}
 }
 
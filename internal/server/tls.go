@@ -0,0 +1,177 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsReloadCheckInterval is how often, at most, the certificate files are checked for changes.
+const tlsReloadCheckInterval = 10 * time.Second
+
+// TLSConfig describes the server certificate and the client certificates the server accepts.
+type TLSConfig struct {
+	CertFile          string // PEM certificate chain
+	KeyFile           string // PEM private key of the certificate
+	MinVersion        string // "1.2" or "1.3"
+	ClientCAFile      string // PEM CAs client certificates are verified against; no client certificates when empty
+	RequireClientCert bool   // Reject connections without a valid client certificate
+}
+
+// TLSReloader serves the certificate and client CAs from their files. When the files change, for
+// example after a certificate is renewed, it loads them again at the next handshake, so rotated
+// certificates are used without a restart.
+type TLSReloader struct {
+	cfg        TLSConfig
+	minVersion uint16
+
+	mu        sync.Mutex
+	current   *tls.Config
+	modTimes  []time.Time // Modification times of the loaded files
+	checkedAt time.Time
+}
+
+// NewTLSReloader loads the certificate and client CAs described by cfg.
+func NewTLSReloader(cfg TLSConfig) (*TLSReloader, error) {
+	r := &TLSReloader{cfg: cfg}
+	switch cfg.MinVersion {
+	case "", "1.2":
+		r.minVersion = tls.VersionTLS12
+	case "1.3":
+		r.minVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported minimum TLS version '%s'", cfg.MinVersion)
+	}
+
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return nil, err
+	}
+	if r.current, err = r.load(); err != nil {
+		return nil, err
+	}
+	r.modTimes = modTimes
+	r.checkedAt = time.Now()
+	return r, nil
+}
+
+// ServerConfig returns the TLS configuration for the HTTP server.
+func (r *TLSReloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         r.minVersion,
+		GetConfigForClient: r.configForClient,
+	}
+}
+
+// configForClient returns the configuration of the latest certificate files for a new connection.
+func (r *TLSReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= tlsReloadCheckInterval {
+		r.checkedAt = time.Now()
+		r.reloadIfChanged()
+	}
+	return r.current, nil
+}
+
+// reloadIfChanged loads the files again when one of them changed. A failed reload, such as while
+// the files are being replaced, keeps the previous certificate.
+func (r *TLSReloader) reloadIfChanged() {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		log.Printf("Failed to check TLS certificate files: %v", err)
+		return
+	}
+	changed := false
+	for i := range modTimes {
+		changed = changed || !modTimes[i].Equal(r.modTimes[i])
+	}
+	if !changed {
+		return
+	}
+
+	current, err := r.load()
+	if err != nil {
+		log.Printf("Failed to reload TLS certificate, still using the previous one: %v", err)
+		return
+	}
+	r.current = current
+	r.modTimes = modTimes
+	log.Printf("Reloaded TLS certificate from %s", r.cfg.CertFile)
+}
+
+// files returns the files the configuration is loaded from.
+func (r *TLSReloader) files() []string {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+	return files
+}
+
+// fileModTimes returns the modification times of the files.
+func (r *TLSReloader) fileModTimes() ([]time.Time, error) {
+	var modTimes []time.Time
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+// load reads the files into a TLS configuration.
+func (r *TLSReloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   r.minVersion,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("client CA file holds no PEM certificates")
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.cfg.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
+
+// HTTPSRedirect redirects plain HTTP requests to the same URL on the HTTPS port.
+func HTTPSRedirect(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Trim(r.Host, "[]")
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6 address
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,273 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultUserSearchLimit = 100
+	maxUserSearchLimit     = 1000
+)
+
+var (
+	// ErrUserOwnsResources is returned when deleting a user who still owns data sources or views.
+	ErrUserOwnsResources = errors.New("user still owns data sources or views; reassign them first")
+	// ErrNoLocalPassword is returned when changing the password of a user who cannot have one.
+	ErrNoLocalPassword = errors.New("account has no local password")
+)
+
+// ListUsers returns the users matching filter, ordered by username, with their roles.
+func (s *Service) ListUsers(filter models.UserFilter) ([]models.UserSummary, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUserSearchLimit
+	}
+	if filter.Limit > maxUserSearchLimit {
+		filter.Limit = maxUserSearchLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	summaries, err := s.users.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range summaries {
+		if summaries[i].Roles, err = s.GetUserRoles(summaries[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return summaries, nil
+}
+
+// SetUserActive deactivates or reactivates a user. Deactivation ends all of the user's sessions;
+// the last active admin cannot be deactivated.
+func (s *Service) SetUserActive(userID string, active bool) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		if err = s.checkNotLastAdmin(userID); err != nil {
+			return err
+		}
+	}
+
+	if _, err = s.db.Exec("UPDATE users SET is_active = ?, updated_at = ? WHERE id = ?", active, time.Now().UTC(), user.ID); err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+	if !active {
+		return s.RevokeAllUserTokens(user.ID)
+	}
+	return nil
+}
+
+// SetPassword replaces a user's password, which must satisfy the password policy, and lifts any
+// requirement to change it. Service accounts cannot have a password. Users provisioned by SSO or
+// LDAP get a local password, which takes precedence. Callers decide whether the user's existing
+// sessions should end.
+func (s *Service) SetPassword(userID, password string) error {
+	if password == "" {
+		return errors.New("password is required")
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	isServiceAccount, err := s.IsServiceAccount(user.ID)
+	if err != nil {
+		return err
+	}
+	if isServiceAccount {
+		return ErrNoLocalPassword
+	}
+	if err = s.checkPassword(user.Username, password); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	result, err := s.db.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?", string(hashedPassword), time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("user not found")
+	}
+	if _, err = s.db.Exec("DELETE FROM password_change_required WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to clear password change requirement: %w", err)
+	}
+	return nil
+}
+
+// ChangePassword lets a user replace their own local password after confirming the current one.
+func (s *Service) ChangePassword(userID, currentPassword, newPassword string) error {
+	if err := s.CheckPasswordChange(userID, currentPassword, newPassword); err != nil {
+		return err
+	}
+	return s.SetPassword(userID, newPassword)
+}
+
+// CheckPasswordChange reports whether ChangePassword would accept the passwords, without changing
+// anything.
+func (s *Service) CheckPasswordChange(userID, currentPassword, newPassword string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == unusablePasswordHash {
+		return ErrNoLocalPassword
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)) != nil {
+		return errors.New("current password is incorrect")
+	}
+	if newPassword == currentPassword {
+		return errors.New("new password must differ from the current one")
+	}
+	return s.checkPassword(user.Username, newPassword)
+}
+
+// RequirePasswordChange makes a user choose a new password at their next login, e.g. after an
+// admin set a temporary one.
+func (s *Service) RequirePasswordChange(userID string) error {
+	required, err := s.PasswordChangeRequired(userID)
+	if err != nil || required {
+		return err
+	}
+	if _, err = s.db.Exec("INSERT INTO password_change_required (user_id, required_at) VALUES (?, ?)", userID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to require password change: %w", err)
+	}
+	return nil
+}
+
+// PasswordChangeRequired reports whether a user must choose a new password before logging in.
+func (s *Service) PasswordChangeRequired(userID string) (bool, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM password_change_required WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check password change requirement: %w", err)
+	}
+	return count > 0, nil
+}
+
+// UpdateEmail changes a user's e-mail address, which must not belong to another user.
+func (s *Service) UpdateEmail(userID, email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return fmt.Errorf("invalid email address '%s'", email)
+	}
+
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM users WHERE lower(email) = lower(?) AND id <> ?", email, userID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check if email is taken: %w", err)
+	}
+	if count > 0 {
+		return errors.New("email already exists")
+	}
+
+	// email has a UNIQUE index, which DuckDB cannot UPDATE in place
+	err = metadata.ReplaceRow(s.db, "users", userID, map[string]interface{}{"email": email, "updated_at": time.Now().UTC()})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("user not found")
+		}
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser permanently deletes a user with their roles, attributes, sessions, API keys, linked
+// identities, privileges and shares, completely or not at all. Their audit log entries are kept
+// without the user reference. Data sources and views they own must be reassigned first, and the
+// last active admin cannot be deleted.
+func (s *Service) DeleteUser(userID string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err = s.checkNotLastAdmin(user.ID); err != nil {
+		return err
+	}
+
+	change, err := metadata.BeginChange(s.db)
+	if err != nil {
+		return err
+	}
+	defer change.Rollback()
+
+	var owned int
+	err = change.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM data_sources WHERE user_id = ?)
+		     + (SELECT COUNT(*) FROM virtual_views WHERE user_id = ?)
+		     + (SELECT COUNT(*) FROM virtual_base_views WHERE user_id = ?)`,
+		user.ID, user.ID, user.ID,
+	).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("failed to count owned resources: %w", err)
+	}
+	if owned > 0 {
+		return ErrUserOwnsResources
+	}
+
+	// References that outlive the user are cleared; DuckDB cannot UPDATE foreign key columns in place
+	nulled := map[string]string{"audit_logs": "user_id", "user_datasource_privileges": "granted_by_user_id"}
+	for table, column := range nulled {
+		_, err = change.ReplaceRows(table, column+" = ?", []interface{}{user.ID}, map[string]interface{}{column: nil})
+		if err != nil {
+			return fmt.Errorf("failed to clear %s references: %w", table, err)
+		}
+	}
+
+	for _, table := range []string{
+		"user_roles", "user_preferences", "user_attributes", "saved_queries", "user_datasource_privileges",
+		"refresh_tokens", "revoked_tokens", "user_token_revocations", "api_keys", "service_accounts", "user_identities",
+		"password_change_required", "user_mfa", "mfa_recovery_codes",
+	} {
+		if _, err = change.Delete(table, "user_id = ?", user.ID); err != nil {
+			return fmt.Errorf("failed to delete %s of user: %w", table, err)
+		}
+	}
+	if _, err = change.Delete("view_shares", "grantee_type = ? AND grantee_id = ?", models.GranteeTypeUser, user.ID); err != nil {
+		return fmt.Errorf("failed to delete view shares of user: %w", err)
+	}
+	if _, err = change.Delete("login_failures", "username = ?", throttleKey(user.Username)); err != nil {
+		return fmt.Errorf("failed to clear failed logins: %w", err)
+	}
+
+	if _, err = change.Delete("users", "id = ?", user.ID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return change.Commit()
+}
+
+// checkNotLastAdmin fails if userID is an admin and no other active admin exists, so the instance
+// always stays manageable.
+func (s *Service) checkNotLastAdmin(userID string) error {
+	roles, err := s.GetUserRoles(userID)
+	if err != nil {
+		return err
+	}
+	if !containsRole(roles, models.RoleAdmin) {
+		return nil
+	}
+
+	otherAdmins, err := s.countActiveAdmins(userID)
+	if err != nil {
+		return err
+	}
+	if otherAdmins == 0 {
+		return errors.New("cannot deactivate or delete the last active admin")
+	}
+	return nil
+}
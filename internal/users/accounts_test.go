@@ -0,0 +1,94 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+)
+
+func TestDeleteUser(t *testing.T) {
+	s := NewService(metadatatest.NewDB(t))
+	adminID := metadatatest.InsertUser(t, s.db, "root", "Correct-horse-1")
+	if err := s.AssignRole(adminID, models.RoleAdmin); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+
+	count := func(query string, args ...interface{}) int {
+		t.Helper()
+		var n int
+		if err := s.db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	t.Run("last admin", func(t *testing.T) {
+		if err := s.DeleteUser(adminID); err == nil {
+			t.Fatal("DeleteUser of the last admin succeeded")
+		}
+		if count("SELECT COUNT(*) FROM user_roles WHERE user_id = ?", adminID) != 1 {
+			t.Error("last admin lost their role")
+		}
+	})
+
+	t.Run("owns resources", func(t *testing.T) {
+		userID := metadatatest.InsertUser(t, s.db, "owner", "Correct-horse-1")
+		if err := s.AssignRole(userID, models.RoleEditor); err != nil {
+			t.Fatalf("AssignRole: %v", err)
+		}
+		metadatatest.InsertDataSource(t, s.db, userID, "sales")
+
+		if err := s.DeleteUser(userID); !errors.Is(err, ErrUserOwnsResources) {
+			t.Fatalf("DeleteUser = %v, want ErrUserOwnsResources", err)
+		}
+		if count("SELECT COUNT(*) FROM users WHERE id = ?", userID) != 1 || count("SELECT COUNT(*) FROM user_roles WHERE user_id = ?", userID) != 1 {
+			t.Error("refused deletion removed the user or their role")
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		userID := metadatatest.InsertUser(t, s.db, "leaver", "Correct-horse-1")
+		if err := s.AssignRole(userID, models.RoleEditor); err != nil {
+			t.Fatalf("AssignRole: %v", err)
+		}
+		if _, err := s.IssueRefreshToken(userID, "127.0.0.1", "test"); err != nil {
+			t.Fatalf("IssueRefreshToken: %v", err)
+		}
+		dataSourceID := metadatatest.InsertDataSource(t, s.db, adminID, "hr")
+		if _, err := s.db.Exec("INSERT INTO audit_logs (id, user_id, action_type) VALUES ('a1', ?, 'user.login')", userID); err != nil {
+			t.Fatalf("insert audit log: %v", err)
+		}
+		_, err := s.db.Exec(
+			"INSERT INTO user_datasource_privileges (id, user_id, data_source_id, privilege_type, granted_by_user_id) VALUES ('p1', ?, ?, 'QUERY', ?)",
+			adminID, dataSourceID, userID,
+		)
+		if err != nil {
+			t.Fatalf("insert privilege: %v", err)
+		}
+
+		if err := s.DeleteUser(userID); err != nil {
+			t.Fatalf("DeleteUser: %v", err)
+		}
+		if _, err := s.GetUserByID(userID); err == nil {
+			t.Error("deleted user still exists")
+		}
+		for _, table := range []string{"user_roles", "refresh_tokens"} {
+			if n := count("SELECT COUNT(*) FROM "+table+" WHERE user_id = ?", userID); n != 0 {
+				t.Errorf("%s still has %d rows of the deleted user", table, n)
+			}
+		}
+		var auditUser, grantor sql.NullString
+		if err := s.db.QueryRow("SELECT user_id FROM audit_logs WHERE id = 'a1'").Scan(&auditUser); err != nil || auditUser.Valid {
+			t.Errorf("audit entry user = %v (%v), want kept without the user", auditUser, err)
+		}
+		if err := s.db.QueryRow("SELECT granted_by_user_id FROM user_datasource_privileges WHERE id = 'p1'").Scan(&grantor); err != nil || grantor.Valid {
+			t.Errorf("privilege grantor = %v (%v), want kept without the user", grantor, err)
+		}
+		if n := count("SELECT COUNT(*) FROM change_journal"); n != 0 {
+			t.Errorf("change journal has %d entries after DeleteUser", n)
+		}
+	})
+}
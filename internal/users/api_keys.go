@@ -0,0 +1,362 @@
+package users
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidAPIKey is returned for unknown, expired or revoked API keys.
+	ErrInvalidAPIKey = errors.New("invalid, expired or revoked API key")
+	// ErrAPIKeyNotFound is returned when an API key ID does not exist.
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// serviceAccountEmailDomain gives service accounts a unique placeholder e-mail; .invalid is reserved (RFC 2606).
+const serviceAccountEmailDomain = "@service-account.invalid"
+
+// unusablePasswordHash is stored for service accounts. It is not a bcrypt hash, so no password ever matches it.
+const unusablePasswordHash = "!"
+
+// scopeTables maps API key scope types to the table holding the scoped resources.
+var scopeTables = map[string]string{
+	models.ScopeTypeDataSource:     "data_sources",
+	models.ViewTypeVirtualView:     "virtual_views",
+	models.ViewTypeVirtualBaseView: "virtual_base_views",
+}
+
+// CreateServiceAccount creates a service account: a user that cannot log in with a password and
+// authenticates with API keys only. It gets roleName, or the viewer role when empty.
+func (s *Service) CreateServiceAccount(username, description, roleName, createdByUserID string) (models.ServiceAccount, error) {
+	if username == "" {
+		return models.ServiceAccount{}, errors.New("username is required")
+	}
+	if roleName == "" {
+		roleName = models.RoleViewer
+	}
+	if _, err := s.getRoleID(roleName); err != nil {
+		return models.ServiceAccount{}, err
+	}
+
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&count); err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("failed to check if user exists: %w", err)
+	}
+	if count > 0 {
+		return models.ServiceAccount{}, errors.New("username already exists")
+	}
+
+	userID := uuid.NewString()
+	now := time.Now().UTC()
+	_, err := s.db.Exec(
+		"INSERT INTO users (id, username, email, password_hash, is_active, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, username, strings.ToLower(username)+serviceAccountEmailDomain, unusablePasswordHash, true, now, now,
+	)
+	if err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("failed to insert service account user: %w", err)
+	}
+
+	var descriptionValue interface{}
+	if description != "" {
+		descriptionValue = description
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO service_accounts (user_id, description, created_by_user_id, created_at) VALUES (?, ?, ?, ?)",
+		userID, descriptionValue, createdByUserID, now,
+	)
+	if err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("failed to insert service account: %w", err)
+	}
+
+	if err = s.AssignRole(userID, roleName); err != nil {
+		return models.ServiceAccount{}, fmt.Errorf("failed to assign role: %w", err)
+	}
+
+	account := models.ServiceAccount{
+		UserID:          userID,
+		Username:        username,
+		IsActive:        true,
+		Roles:           []string{roleName},
+		CreatedByUserID: &createdByUserID,
+		CreatedAt:       now,
+	}
+	if description != "" {
+		account.Description = &description
+	}
+	return account, nil
+}
+
+// ListServiceAccounts returns every service account with its roles.
+func (s *Service) ListServiceAccounts() ([]models.ServiceAccount, error) {
+	rows, err := s.db.Query(`
+		SELECT sa.user_id, u.username, sa.description, u.is_active, sa.created_by_user_id, sa.created_at
+		FROM service_accounts sa
+		JOIN users u ON u.id = sa.user_id
+		ORDER BY u.username
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		var a models.ServiceAccount
+		if err = rows.Scan(&a.UserID, &a.Username, &a.Description, &a.IsActive, &a.CreatedByUserID, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan service account: %w", err)
+		}
+		accounts = append(accounts, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating service account rows: %w", err)
+	}
+
+	for i := range accounts {
+		if accounts[i].Roles, err = s.GetUserRoles(accounts[i].UserID); err != nil {
+			return nil, err
+		}
+	}
+	return accounts, nil
+}
+
+// IsServiceAccount reports whether the user is a service account.
+func (s *Service) IsServiceAccount(userID string) (bool, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM service_accounts WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check service account: %w", err)
+	}
+	return count > 0, nil
+}
+
+// DisableServiceAccount deactivates a service account and revokes all of its API keys.
+func (s *Service) DisableServiceAccount(userID string) error {
+	isServiceAccount, err := s.IsServiceAccount(userID)
+	if err != nil {
+		return err
+	}
+	if !isServiceAccount {
+		return errors.New("user is not a service account")
+	}
+
+	if _, err = s.db.Exec("UPDATE users SET is_active = FALSE, updated_at = ? WHERE id = ?", time.Now().UTC(), userID); err != nil {
+		return fmt.Errorf("failed to deactivate service account: %w", err)
+	}
+	return s.revokeUserAPIKeys(userID)
+}
+
+// CreateAPIKey creates an API key acting as input.UserID and returns it together with the key
+// itself, which is not stored and cannot be retrieved again. Keys can be created for the caller
+// or for a service account, and must be scoped to at least one data source or view.
+func (s *Service) CreateAPIKey(input models.CreateAPIKeyInput) (models.APIKey, string, error) {
+	if input.Name == "" {
+		return models.APIKey{}, "", errors.New("name is required")
+	}
+	if input.UserID == "" {
+		input.UserID = input.CreatedByUserID
+	}
+	if input.ExpiresInDays < 0 {
+		return models.APIKey{}, "", errors.New("expires_in_days cannot be negative")
+	}
+
+	user, err := s.GetUserByID(input.UserID)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	if !user.IsActive {
+		return models.APIKey{}, "", ErrUserInactive
+	}
+	if input.UserID != input.CreatedByUserID {
+		isServiceAccount, err := s.IsServiceAccount(input.UserID)
+		if err != nil {
+			return models.APIKey{}, "", err
+		}
+		if !isServiceAccount {
+			return models.APIKey{}, "", errors.New("API keys can only be created for yourself or a service account")
+		}
+	}
+
+	if err = s.validateScopes(input.Scopes); err != nil {
+		return models.APIKey{}, "", err
+	}
+	scopesJSON, err := json.Marshal(input.Scopes)
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("failed to encode scopes: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return models.APIKey{}, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := auth.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	apiKey := models.APIKey{
+		ID:              uuid.NewString(),
+		UserID:          input.UserID,
+		Name:            input.Name,
+		KeyPrefix:       key[:len(auth.APIKeyPrefix)+8],
+		Scopes:          input.Scopes,
+		CreatedByUserID: &input.CreatedByUserID,
+		CreatedAt:       now,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, input.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO api_keys (id, user_id, name, key_prefix, key_hash, scopes, expires_at, created_by_user_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, apiKey.ID, apiKey.UserID, apiKey.Name, apiKey.KeyPrefix, hashToken(key), string(scopesJSON), apiKey.ExpiresAt, input.CreatedByUserID, now)
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("failed to store API key: %w", err)
+	}
+	return apiKey, key, nil
+}
+
+// validateScopes checks that every scope names an existing data source or view.
+// Scopes only narrow access: the key's user still needs privileges on each resource.
+func (s *Service) validateScopes(scopes []models.APIKeyScope) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope (data source or view) is required")
+	}
+	for _, scope := range scopes {
+		table, ok := scopeTables[scope.Type]
+		if !ok {
+			return fmt.Errorf("invalid scope type '%s'", scope.Type)
+		}
+		var count int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE id = ?", scope.ID).Scan(&count); err != nil {
+			return fmt.Errorf("failed to check scope: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("%s '%s' not found", scope.Type, scope.ID)
+		}
+	}
+	return nil
+}
+
+// scanAPIKey scans an api_keys row selected with apiKeyColumns.
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (models.APIKey, error) {
+	var k models.APIKey
+	var scopesJSON string
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.KeyPrefix, &scopesJSON, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedByUserID, &k.CreatedAt); err != nil {
+		return models.APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(scopesJSON), &k.Scopes); err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to decode scopes of API key %s: %w", k.ID, err)
+	}
+	return k, nil
+}
+
+// apiKeyColumns are the api_keys columns read by scanAPIKey.
+const apiKeyColumns = "id, user_id, name, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_by_user_id, created_at"
+
+// ListAPIKeys returns the API keys acting as a user, newest first.
+func (s *Service) ListAPIKeys(userID string) ([]models.APIKey, error) {
+	rows, err := s.db.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating API key rows: %w", err)
+	}
+	return keys, nil
+}
+
+// GetAPIKey returns an API key by its ID.
+func (s *Service) GetAPIKey(keyID string) (models.APIKey, error) {
+	k, err := scanAPIKey(s.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", keyID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.APIKey{}, ErrAPIKeyNotFound
+		}
+		return models.APIKey{}, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return k, nil
+}
+
+// RevokeAPIKey revokes an API key; requests using it are rejected from then on.
+func (s *Service) RevokeAPIKey(keyID string) error {
+	result, err := s.db.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), keyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err = s.GetAPIKey(keyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeUserAPIKeys revokes every API key acting as a user.
+func (s *Service) revokeUserAPIKeys(userID string) error {
+	_, err := s.db.Exec("UPDATE api_keys SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API keys: %w", err)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey implements auth.SessionChecker: it resolves an API key to claims for its
+// user, carrying the user's current roles and the key's scopes, and records when it was used.
+func (s *Service) AuthenticateAPIKey(key string) (*auth.Claims, error) {
+	k, err := scanAPIKey(s.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hashToken(key)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if k.RevokedAt != nil || (k.ExpiresAt != nil && !k.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.GetUserByID(k.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrUserInactive
+	}
+	roles, err := s.GetUserRoles(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = s.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", now, k.ID); err != nil {
+		return nil, fmt.Errorf("failed to record API key use: %w", err)
+	}
+
+	return &auth.Claims{
+		Username: user.Username,
+		UserID:   user.ID,
+		Roles:    roles,
+		APIKeyID: k.ID,
+		Scopes:   k.Scopes,
+	}, nil
+}
@@ -0,0 +1,137 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+)
+
+func TestAPIKeys(t *testing.T) {
+	s := NewService(metadatatest.NewDB(t))
+	adminID := metadatatest.InsertUser(t, s.db, "admin", "Correct-horse-1")
+	aliceID := metadatatest.InsertUser(t, s.db, "alice", "Correct-horse-1")
+	dataSourceID := metadatatest.InsertDataSource(t, s.db, adminID, "sales")
+	scopes := []models.APIKeyScope{{Type: models.ScopeTypeDataSource, ID: dataSourceID}}
+
+	account, err := s.CreateServiceAccount("airflow", "Nightly loads", "", adminID)
+	if err != nil {
+		t.Fatalf("CreateServiceAccount: %v", err)
+	}
+	if len(account.Roles) != 1 || account.Roles[0] != models.RoleViewer {
+		t.Errorf("service account roles = %v, want [viewer]", account.Roles)
+	}
+	if _, err = s.ValidatePassword("airflow", ""); err == nil {
+		t.Error("service account logged in with a password")
+	}
+
+	create := func(input models.CreateAPIKeyInput) (models.APIKey, string, error) {
+		input.CreatedByUserID = adminID
+		if input.Name == "" {
+			input.Name = "key"
+		}
+		if input.Scopes == nil {
+			input.Scopes = scopes
+		}
+		return s.CreateAPIKey(input)
+	}
+
+	t.Run("create", func(t *testing.T) {
+		if _, _, err := create(models.CreateAPIKeyInput{UserID: aliceID}); err == nil {
+			t.Error("created a key acting as another human user")
+		}
+		if _, _, err := create(models.CreateAPIKeyInput{Scopes: []models.APIKeyScope{}}); err == nil {
+			t.Error("created a key without scopes")
+		}
+		if _, _, err := create(models.CreateAPIKeyInput{Scopes: []models.APIKeyScope{{Type: models.ScopeTypeDataSource, ID: "missing"}}}); err == nil {
+			t.Error("created a key scoped to a missing data source")
+		}
+		if _, _, err := create(models.CreateAPIKeyInput{Scopes: []models.APIKeyScope{{Type: "table", ID: dataSourceID}}}); err == nil {
+			t.Error("created a key with an unknown scope type")
+		}
+
+		apiKey, key, err := create(models.CreateAPIKeyInput{UserID: account.UserID, ExpiresInDays: 30})
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		if !strings.HasPrefix(key, auth.APIKeyPrefix) || !strings.HasPrefix(key, apiKey.KeyPrefix) || apiKey.ExpiresAt == nil {
+			t.Errorf("key %q (prefix %q, expires %v), want a %s key with a stored prefix and expiry", key, apiKey.KeyPrefix, apiKey.ExpiresAt, auth.APIKeyPrefix)
+		}
+		var stored int
+		if err = s.db.QueryRow("SELECT COUNT(*) FROM api_keys WHERE key_hash = ?", key).Scan(&stored); err != nil || stored != 0 {
+			t.Errorf("the key is stored in plain text (%v)", err)
+		}
+	})
+
+	t.Run("authenticate", func(t *testing.T) {
+		apiKey, key, err := create(models.CreateAPIKeyInput{UserID: account.UserID})
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		claims, err := s.AuthenticateAPIKey(key)
+		if err != nil {
+			t.Fatalf("AuthenticateAPIKey: %v", err)
+		}
+		if claims.UserID != account.UserID || claims.APIKeyID != apiKey.ID || len(claims.Roles) != 1 || claims.Roles[0] != models.RoleViewer {
+			t.Errorf("claims = %+v, want the service account's", claims)
+		}
+		if !claims.InScope(models.ScopeTypeDataSource, dataSourceID) || claims.InScope(models.ScopeTypeDataSource, "other") {
+			t.Errorf("scopes = %v, want only data source %s", claims.Scopes, dataSourceID)
+		}
+		if stored, err := s.GetAPIKey(apiKey.ID); err != nil || stored.LastUsedAt == nil {
+			t.Errorf("last_used_at = %v (%v), want it recorded", stored.LastUsedAt, err)
+		}
+		if _, err = s.AuthenticateAPIKey(key + "x"); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("unknown key: got %v, want ErrInvalidAPIKey", err)
+		}
+
+		if err = s.RevokeAPIKey(apiKey.ID); err != nil {
+			t.Fatalf("RevokeAPIKey: %v", err)
+		}
+		if _, err = s.AuthenticateAPIKey(key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("revoked key: got %v, want ErrInvalidAPIKey", err)
+		}
+		if err = s.RevokeAPIKey("missing"); !errors.Is(err, ErrAPIKeyNotFound) {
+			t.Errorf("revoking a missing key: got %v, want ErrAPIKeyNotFound", err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		apiKey, key, err := create(models.CreateAPIKeyInput{ExpiresInDays: 1})
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		if _, err = s.AuthenticateAPIKey(key); err != nil {
+			t.Fatalf("AuthenticateAPIKey: %v", err)
+		}
+		if _, err = s.db.Exec("UPDATE api_keys SET expires_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Minute), apiKey.ID); err != nil {
+			t.Fatalf("expire key: %v", err)
+		}
+		if _, err = s.AuthenticateAPIKey(key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("expired key: got %v, want ErrInvalidAPIKey", err)
+		}
+	})
+
+	t.Run("disable service account", func(t *testing.T) {
+		_, key, err := create(models.CreateAPIKeyInput{UserID: account.UserID})
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		if err = s.DisableServiceAccount(aliceID); err == nil {
+			t.Error("disabled a human user as a service account")
+		}
+		if err = s.DisableServiceAccount(account.UserID); err != nil {
+			t.Fatalf("DisableServiceAccount: %v", err)
+		}
+		if _, err = s.AuthenticateAPIKey(key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("key of a disabled service account: got %v, want ErrInvalidAPIKey", err)
+		}
+		if _, _, err = create(models.CreateAPIKeyInput{UserID: account.UserID}); !errors.Is(err, ErrUserInactive) {
+			t.Errorf("key for a disabled service account: got %v, want ErrUserInactive", err)
+		}
+	})
+}
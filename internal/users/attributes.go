@@ -0,0 +1,76 @@
+package users
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"Bridgo/internal/models"
+)
+
+// attributeKeyPattern restricts attribute keys to names row-level security predicates can reference as {{user.attr.<key>}}.
+var attributeKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// GetUserAttributes returns the custom attributes set on a user.
+func (s *Service) GetUserAttributes(userID string) ([]models.UserAttribute, error) {
+	rows, err := s.db.Query(`
+		SELECT user_id, attribute_key, attribute_value, updated_at
+		FROM user_attributes
+		WHERE user_id = ?
+		ORDER BY attribute_key
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attributes for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	attributes := []models.UserAttribute{}
+	for rows.Next() {
+		var a models.UserAttribute
+		if err = rows.Scan(&a.UserID, &a.Key, &a.Value, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user attribute: %w", err)
+		}
+		attributes = append(attributes, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user attribute rows: %w", err)
+	}
+
+	return attributes, nil
+}
+
+// SetUserAttribute sets (or replaces) a custom attribute on a user.
+func (s *Service) SetUserAttribute(userID, key, value string) error {
+	if !attributeKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid attribute key '%s' (letters, digits and underscores only)", key)
+	}
+	if _, err := s.GetUserByID(userID); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM user_attributes WHERE user_id = ? AND attribute_key = ?", userID, key).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check existing attribute: %w", err)
+	}
+	if count > 0 {
+		_, err = s.db.Exec("UPDATE user_attributes SET attribute_value = ?, updated_at = ? WHERE user_id = ? AND attribute_key = ?", value, now, userID, key)
+	} else {
+		_, err = s.db.Exec("INSERT INTO user_attributes (user_id, attribute_key, attribute_value, updated_at) VALUES (?, ?, ?, ?)", userID, key, value, now)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set attribute '%s': %w", key, err)
+	}
+	return nil
+}
+
+// DeleteUserAttribute removes a custom attribute from a user.
+func (s *Service) DeleteUserAttribute(userID, key string) error {
+	_, err := s.db.Exec("DELETE FROM user_attributes WHERE user_id = ? AND attribute_key = ?", userID, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete attribute '%s': %w", key, err)
+	}
+	return nil
+}
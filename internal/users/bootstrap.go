@@ -0,0 +1,146 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"Bridgo/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrSetupComplete is returned when the first-run setup is attempted although an admin exists.
+var ErrSetupComplete = errors.New("setup has already been completed")
+
+// BootstrapConfig holds the credentials of the first admin, when given by the operator.
+type BootstrapConfig struct {
+	AdminUsername string
+	AdminEmail    string
+	AdminPassword string // Temporary; the admin must change it at their first login
+}
+
+// Bootstrap makes sure the instance can be administered without a well-known login. While no
+// active admin exists, it creates one from cfg or, without an admin password in cfg, returns a
+// one-time setup token with which the first admin can be created through CompleteSetup. An admin
+// still using the former default password admin/admin must change it at their next login.
+func (s *Service) Bootstrap(cfg BootstrapConfig) (string, error) {
+	if err := s.expireDefaultAdminPassword(); err != nil {
+		return "", err
+	}
+
+	adminExists, err := s.activeAdminExists()
+	if err != nil {
+		return "", err
+	}
+	if adminExists {
+		if _, err = s.db.Exec("DELETE FROM system_settings WHERE setting_key = ?", models.SettingSetupToken); err != nil {
+			return "", fmt.Errorf("failed to clear setup token: %w", err)
+		}
+		return "", nil
+	}
+
+	if cfg.AdminPassword != "" {
+		if cfg.AdminUsername == "" {
+			cfg.AdminUsername = "admin"
+		}
+		if _, err = s.CreateUser(cfg.AdminUsername, cfg.AdminEmail, cfg.AdminPassword, models.RoleAdmin); err != nil {
+			return "", fmt.Errorf("failed to create admin '%s': %w", cfg.AdminUsername, err)
+		}
+		log.Printf("Created admin '%s'; the password must be changed at the first login", cfg.AdminUsername)
+		return "", nil
+	}
+
+	raw := make([]byte, 24)
+	if _, err = rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate setup token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	if _, err = s.db.Exec("DELETE FROM system_settings WHERE setting_key = ?", models.SettingSetupToken); err == nil {
+		_, err = s.db.Exec(
+			"INSERT INTO system_settings (setting_key, setting_value, updated_at) VALUES (?, ?, ?)",
+			models.SettingSetupToken, hashToken(token), time.Now().UTC(),
+		)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to store setup token: %w", err)
+	}
+	return token, nil
+}
+
+// CompleteSetup creates the first admin with the setup token returned by Bootstrap, which can
+// only be used once.
+func (s *Service) CompleteSetup(token, username, email, password string) (models.User, error) {
+	adminExists, err := s.activeAdminExists()
+	if err != nil {
+		return models.User{}, err
+	}
+	if adminExists {
+		return models.User{}, ErrSetupComplete
+	}
+
+	var tokenHash string
+	err = s.db.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key = ?", models.SettingSetupToken).Scan(&tokenHash)
+	if err != nil && err != sql.ErrNoRows {
+		return models.User{}, fmt.Errorf("failed to read setup token: %w", err)
+	}
+	if err == sql.ErrNoRows || subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(tokenHash)) != 1 {
+		return models.User{}, errors.New("invalid setup token")
+	}
+
+	user, err := s.addUser(username, email, password, models.RoleAdmin, true)
+	if err != nil {
+		return models.User{}, err
+	}
+	if _, err = s.db.Exec("DELETE FROM system_settings WHERE setting_key = ?", models.SettingSetupToken); err != nil {
+		return models.User{}, fmt.Errorf("failed to clear setup token: %w", err)
+	}
+	return user, nil
+}
+
+// activeAdminExists reports whether any active user has the admin role.
+func (s *Service) activeAdminExists() (bool, error) {
+	count, err := s.countActiveAdmins("")
+	return count > 0, err
+}
+
+// countActiveAdmins counts the active users with the admin role, other than exceptUserID.
+func (s *Service) countActiveAdmins(exceptUserID string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		JOIN users u ON u.id = ur.user_id
+		WHERE r.role_name = ? AND u.is_active AND u.id <> ?`,
+		models.RoleAdmin, exceptUserID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return count, nil
+}
+
+// expireDefaultAdminPassword forces the 'admin' account created by earlier versions to change its
+// well-known password admin/admin, and ends its sessions the first time it is found.
+func (s *Service) expireDefaultAdminPassword() error {
+	user, err := s.GetUserByUsername("admin")
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("admin")) != nil {
+		return nil
+	}
+
+	log.Printf("WARNING: user 'admin' still has the default password; it must be changed at the next login")
+	required, err := s.PasswordChangeRequired(user.ID)
+	if err != nil || required {
+		return err
+	}
+	if err = s.RequirePasswordChange(user.ID); err != nil {
+		return err
+	}
+	return s.RevokeAllUserTokens(user.ID)
+}
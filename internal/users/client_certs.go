@@ -0,0 +1,133 @@
+package users
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/auth"
+)
+
+// Certificate fields a client certificate names its user with.
+const (
+	ClientCertUserCommonName = "cn"    // Subject common name is the username
+	ClientCertUserEmail      = "email" // First e-mail address of the subject alternative names is the user's e-mail
+)
+
+var (
+	// ErrUnknownCertificateUser is returned when no user matches a client certificate.
+	ErrUnknownCertificateUser = errors.New("no user matches the client certificate")
+	// ErrCertificateRevoked is returned for certificates issued before the user's sessions were revoked.
+	ErrCertificateRevoked = errors.New("client certificate was issued before the user's sessions were revoked")
+	// ErrCertificatePasswordChange is returned while the certificate's user must change their password.
+	ErrCertificatePasswordChange = errors.New("the user must change their password; log in with the password first")
+	// ErrCertificateMFA is returned for users who use, or must use, two-factor authentication.
+	ErrCertificateMFA = errors.New("two-factor authentication is enabled or required for the user; log in with a password and one-time code")
+)
+
+// SetClientCertUserField selects the certificate field, ClientCertUserCommonName or
+// ClientCertUserEmail, that client certificates name their user with.
+func (s *Service) SetClientCertUserField(field string) error {
+	switch field {
+	case ClientCertUserCommonName, ClientCertUserEmail:
+		s.clientCertUserField = field
+		return nil
+	}
+	return fmt.Errorf("unsupported client certificate user field '%s' (use %s or %s)", field, ClientCertUserCommonName, ClientCertUserEmail)
+}
+
+// AuthenticateClientCertificate implements auth.SessionChecker: it resolves a client certificate,
+// already verified against the trusted CAs during the TLS handshake, to claims for the user or
+// service account it names. The user must be able to log in: a certificate is refused while the
+// account is locked or must change its password, if it was issued before the user's sessions were
+// revoked, and for users with two-factor authentication, which a certificate cannot provide.
+func (s *Service) AuthenticateClientCertificate(cert *x509.Certificate) (*auth.Claims, error) {
+	var userID string
+	var err error
+	switch s.clientCertUserField {
+	case ClientCertUserEmail:
+		if len(cert.EmailAddresses) == 0 {
+			return nil, ErrUnknownCertificateUser
+		}
+		err = s.db.QueryRow("SELECT id FROM users WHERE lower(email) = lower(?)", cert.EmailAddresses[0]).Scan(&userID)
+	default:
+		if strings.TrimSpace(cert.Subject.CommonName) == "" {
+			return nil, ErrUnknownCertificateUser
+		}
+		err = s.db.QueryRow("SELECT id FROM users WHERE username = ?", cert.Subject.CommonName).Scan(&userID)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUnknownCertificateUser
+		}
+		return nil, fmt.Errorf("failed to look up client certificate user: %w", err)
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrUserInactive
+	}
+	if err = s.checkCertificateLogin(user.ID, user.Username, cert); err != nil {
+		return nil, err
+	}
+	roles, err := s.GetUserRoles(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Claims{
+		Username:          user.Username,
+		UserID:            user.ID,
+		Roles:             roles,
+		ClientCertificate: cert.Subject.String(),
+	}, nil
+}
+
+// checkCertificateLogin applies the checks of a password login to a certificate's user.
+func (s *Service) checkCertificateLogin(userID, username string, cert *x509.Certificate) error {
+	now := time.Now().UTC()
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRow("SELECT locked_until FROM login_failures WHERE username = ?", throttleKey(username)).Scan(&lockedUntil)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check account lockout: %w", err)
+	}
+	if lockedUntil.Valid && lockedUntil.Time.After(now) {
+		return &LoginThrottledError{RetryAfter: lockedUntil.Time.Sub(now), Locked: true}
+	}
+
+	var revokedBefore time.Time
+	err = s.db.QueryRow("SELECT revoked_before FROM user_token_revocations WHERE user_id = ?", userID).Scan(&revokedBefore)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check session revocation: %w", err)
+	}
+	if err == nil && !cert.NotBefore.After(revokedBefore) {
+		return ErrCertificateRevoked
+	}
+
+	// Service accounts have neither a password nor a second factor
+	isServiceAccount, err := s.IsServiceAccount(userID)
+	if err != nil || isServiceAccount {
+		return err
+	}
+	mustChange, err := s.PasswordChangeRequired(userID)
+	if err != nil {
+		return err
+	}
+	if mustChange {
+		return ErrCertificatePasswordChange
+	}
+	status, err := s.MFAStatus(userID)
+	if err != nil {
+		return err
+	}
+	if status.Enabled || status.Required {
+		return ErrCertificateMFA
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package users
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"Bridgo/internal/metadata/metadatatest"
+)
+
+func TestAuthenticateClientCertificate(t *testing.T) {
+	s := NewService(metadatatest.NewDB(t))
+	if err := s.SetClientCertUserField(ClientCertUserCommonName); err != nil {
+		t.Fatalf("SetClientCertUserField: %v", err)
+	}
+	certFor := func(username string, notBefore time.Time) *x509.Certificate {
+		return &x509.Certificate{Subject: pkix.Name{CommonName: username}, NotBefore: notBefore}
+	}
+	issued := time.Now().Add(-time.Hour)
+
+	t.Run("success", func(t *testing.T) {
+		userID := metadatatest.InsertUser(t, s.db, "alice", "password")
+		claims, err := s.AuthenticateClientCertificate(certFor("alice", issued))
+		if err != nil {
+			t.Fatalf("AuthenticateClientCertificate: %v", err)
+		}
+		if claims.UserID != userID || claims.ClientCertificate != "CN=alice" {
+			t.Errorf("claims = %+v", claims)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		if _, err := s.AuthenticateClientCertificate(certFor("nobody", issued)); !errors.Is(err, ErrUnknownCertificateUser) {
+			t.Errorf("err = %v, want ErrUnknownCertificateUser", err)
+		}
+	})
+
+	t.Run("inactive", func(t *testing.T) {
+		userID := metadatatest.InsertUser(t, s.db, "bob", "password")
+		if _, err := s.db.Exec("UPDATE users SET is_active = FALSE WHERE id = ?", userID); err != nil {
+			t.Fatalf("deactivate: %v", err)
+		}
+		if _, err := s.AuthenticateClientCertificate(certFor("bob", issued)); !errors.Is(err, ErrUserInactive) {
+			t.Errorf("err = %v, want ErrUserInactive", err)
+		}
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		metadatatest.InsertUser(t, s.db, "carol", "password")
+		_, err := s.db.Exec("INSERT INTO login_failures (username, failed_count, last_failed_at, locked_until) VALUES (?, ?, ?, ?)",
+			"carol", 10, time.Now().UTC(), time.Now().UTC().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("lock: %v", err)
+		}
+		var throttled *LoginThrottledError
+		if _, err = s.AuthenticateClientCertificate(certFor("carol", issued)); !errors.As(err, &throttled) || !throttled.Locked {
+			t.Errorf("err = %v, want a lockout", err)
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		userID := metadatatest.InsertUser(t, s.db, "dave", "password")
+		if err := s.RevokeAllUserTokens(userID); err != nil {
+			t.Fatalf("RevokeAllUserTokens: %v", err)
+		}
+		if _, err := s.AuthenticateClientCertificate(certFor("dave", issued)); !errors.Is(err, ErrCertificateRevoked) {
+			t.Errorf("err = %v, want ErrCertificateRevoked", err)
+		}
+		if _, err := s.AuthenticateClientCertificate(certFor("dave", time.Now().Add(time.Second))); err != nil {
+			t.Errorf("certificate issued after the revocation: %v", err)
+		}
+	})
+
+	t.Run("password change required", func(t *testing.T) {
+		userID := metadatatest.InsertUser(t, s.db, "erin", "password")
+		if _, err := s.db.Exec("INSERT INTO password_change_required (user_id) VALUES (?)", userID); err != nil {
+			t.Fatalf("require password change: %v", err)
+		}
+		if _, err := s.AuthenticateClientCertificate(certFor("erin", issued)); !errors.Is(err, ErrCertificatePasswordChange) {
+			t.Errorf("err = %v, want ErrCertificatePasswordChange", err)
+		}
+	})
+
+	t.Run("mfa required", func(t *testing.T) {
+		userID := metadatatest.InsertUser(t, s.db, "frank", "password")
+		if err := s.AssignRole(userID, "editor"); err != nil {
+			t.Fatalf("AssignRole: %v", err)
+		}
+		if err := s.SetMFAPolicy(MFAPolicy{RequiredRoles: []string{"editor"}}); err != nil {
+			t.Fatalf("SetMFAPolicy: %v", err)
+		}
+		defer s.SetMFAPolicy(MFAPolicy{})
+		if _, err := s.AuthenticateClientCertificate(certFor("frank", issued)); !errors.Is(err, ErrCertificateMFA) {
+			t.Errorf("err = %v, want ErrCertificateMFA", err)
+		}
+	})
+}
@@ -0,0 +1,390 @@
+package users
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"Bridgo/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+)
+
+// ldapTimeout bounds connecting to and each request against the directory.
+const ldapTimeout = 10 * time.Second
+
+// ErrLDAPDisabled is returned when linking directory logins while LDAP authentication is off.
+var ErrLDAPDisabled = errors.New("LDAP authentication is not enabled")
+
+// LDAPConfig describes the LDAP or Active Directory server users without a local password
+// authenticate against.
+type LDAPConfig struct {
+	URL             string            // ldap://host:389 or ldaps://host:636
+	StartTLS        bool              // Upgrade ldap:// connections with StartTLS
+	CAFile          string            // PEM CA bundle for verifying the server; system roots when empty
+	BindDN          string            // Account used to search the directory; anonymous when empty
+	BindPassword    string            // Password of BindDN
+	UserSearchBase  string            // Subtree searched for users
+	UserFilter      string            // {username} is replaced by the escaped login name
+	EmailAttribute  string            // Attribute holding the user's e-mail
+	GroupSearchBase string            // Subtree searched for groups; only memberOf is used when empty
+	GroupFilter     string            // {dn} and {username} are replaced by the escaped user DN and login name
+	GroupRoles      map[string]string // Group DN or CN -> Bridgo role name
+	DefaultRole     string            // Role of new users none of whose groups is mapped
+}
+
+// Enabled reports whether an LDAP server is configured.
+func (c LDAPConfig) Enabled() bool {
+	return c.URL != "" && c.UserSearchBase != ""
+}
+
+// ldapAuthenticator binds users against the configured directory.
+type ldapAuthenticator struct {
+	cfg       LDAPConfig
+	tlsConfig *tls.Config
+}
+
+// EnableLDAP makes ValidatePassword authenticate users without a local password against the
+// directory described by cfg. Local accounts keep using their bcrypt password.
+func (s *Service) EnableLDAP(cfg LDAPConfig) error {
+	serverURL, err := url.Parse(cfg.URL)
+	if err != nil || (serverURL.Scheme != "ldap" && serverURL.Scheme != "ldaps") {
+		return fmt.Errorf("invalid LDAP URL '%s' (expected ldap:// or ldaps://)", cfg.URL)
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid={username})"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.GroupFilter == "" {
+		cfg.GroupFilter = "(|(member={dn})(uniqueMember={dn})(memberUid={username}))"
+	}
+	for _, filter := range []string{cfg.UserFilter, cfg.GroupFilter} {
+		if _, err = ldap.CompileFilter(expandLDAPFilter(filter, "x", "x")); err != nil {
+			return fmt.Errorf("invalid LDAP filter '%s': %w", filter, err)
+		}
+	}
+
+	tlsConfig := &tls.Config{ServerName: serverURL.Hostname(), MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read LDAP CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in LDAP CA file %s", cfg.CAFile)
+		}
+	}
+
+	s.ldap = &ldapAuthenticator{cfg: cfg, tlsConfig: tlsConfig}
+	return nil
+}
+
+// expandLDAPFilter replaces the {username} and {dn} placeholders of a configured search filter
+// with the escaped values, so a login name cannot change the filter's structure.
+func expandLDAPFilter(filter, username, dn string) string {
+	return strings.NewReplacer("{username}", ldap.EscapeFilter(username), "{dn}", ldap.EscapeFilter(dn)).Replace(filter)
+}
+
+// issuer identifies the directory in user_identities.
+func (a *ldapAuthenticator) issuer() string {
+	return "ldap:" + strings.ToLower(a.cfg.UserSearchBase)
+}
+
+// dial connects to the directory and binds with the search account, if one is configured.
+func (a *ldapAuthenticator) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(a.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(a.tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if a.cfg.StartTLS {
+		if err = conn.StartTLS(a.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS with LDAP server: %w", err)
+		}
+	}
+	if err = a.bindSearchAccount(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// bindSearchAccount (re)binds the connection as the configured search account.
+func (a *ldapAuthenticator) bindSearchAccount(conn *ldap.Conn) error {
+	if a.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+		return fmt.Errorf("failed to bind to LDAP server as %s: %w", a.cfg.BindDN, err)
+	}
+	return nil
+}
+
+// isExternalUser reports whether a user signs in through an identity provider: they have no local
+// password and are not a service account, which only authenticates with API keys.
+func (s *Service) isExternalUser(user models.User) bool {
+	if user.Password != unusablePasswordHash {
+		return false
+	}
+	isServiceAccount, err := s.IsServiceAccount(user.ID)
+	return err == nil && !isServiceAccount
+}
+
+// validateLDAPPassword authenticates a user by binding to the directory with their password, then
+// returns their local user record, created on first login, with roles mapped from their groups.
+func (s *Service) validateLDAPPassword(username, password string) (models.User, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if password == "" {
+		return models.User{}, errors.New("invalid password")
+	}
+	a := s.ldap
+
+	conn, err := a.dial()
+	if err != nil {
+		return models.User{}, err
+	}
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.UserSearchBase, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		expandLDAPFilter(a.cfg.UserFilter, username, ""),
+		[]string{a.cfg.EmailAttribute, "memberOf"}, nil,
+	))
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to search LDAP for user: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return models.User{}, errors.New("user not found")
+	}
+	entry := result.Entries[0]
+
+	if err = conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return models.User{}, errors.New("invalid password")
+		}
+		return models.User{}, fmt.Errorf("failed to bind to LDAP server as %s: %w", entry.DN, err)
+	}
+
+	groups := entry.GetAttributeValues("memberOf")
+	if a.cfg.GroupSearchBase != "" {
+		if err = a.bindSearchAccount(conn); err != nil {
+			return models.User{}, err
+		}
+		groupResult, err := conn.Search(ldap.NewSearchRequest(
+			a.cfg.GroupSearchBase, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(ldapTimeout.Seconds()), false,
+			expandLDAPFilter(a.cfg.GroupFilter, username, entry.DN), []string{"cn"}, nil,
+		))
+		if err != nil {
+			return models.User{}, fmt.Errorf("failed to search LDAP for groups: %w", err)
+		}
+		for _, group := range groupResult.Entries {
+			groups = append(groups, group.DN)
+		}
+	}
+
+	return s.provisionLDAPUser(username, entry.GetAttributeValue(a.cfg.EmailAttribute), groups)
+}
+
+// provisionLDAPUser returns the Bridgo user for a directory user who has just authenticated, with
+// roles mapped from their groups. Logins seen before, or linked to an account by an administrator
+// (LinkLDAPIdentity), map to their user; otherwise a new user without a local password is created.
+// Directory e-mails never link existing accounts: whoever can set an entry's e-mail attribute could
+// otherwise take over any account, administrators included.
+func (s *Service) provisionLDAPUser(username, email string, groups []string) (models.User, error) {
+	a := s.ldap
+	issuer, subject := a.issuer(), strings.ToLower(username)
+	roles, managedRoles := a.rolesForGroups(groups)
+	now := time.Now().UTC()
+
+	var userID string
+	err := s.db.QueryRow("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&userID)
+	switch {
+	case err == nil:
+		if _, err = s.db.Exec("UPDATE user_identities SET last_login_at = ? WHERE issuer = ? AND subject = ?", now, issuer, subject); err != nil {
+			return models.User{}, fmt.Errorf("failed to record login: %w", err)
+		}
+	case err == sql.ErrNoRows:
+		if userID, err = s.createLDAPUser(issuer, subject, username, email, now); err != nil {
+			return models.User{}, err
+		}
+		if len(roles) == 0 {
+			defaultRole := a.cfg.DefaultRole
+			if defaultRole == "" {
+				defaultRole = models.DefaultUserRole
+			}
+			roles = []string{defaultRole}
+		}
+	default:
+		return models.User{}, fmt.Errorf("failed to look up identity: %w", err)
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !user.IsActive {
+		return models.User{}, ErrUserInactive
+	}
+
+	for _, role := range roles {
+		if err = s.AssignRole(user.ID, role); err != nil {
+			return models.User{}, fmt.Errorf("failed to assign role from directory groups: %w", err)
+		}
+	}
+	for _, role := range managedRoles {
+		if containsRole(roles, role) {
+			continue
+		}
+		if err = s.RemoveRole(user.ID, role); err != nil && !errors.Is(err, ErrRoleNotFound) {
+			// E.g. the last admin keeps the admin role
+			log.Printf("Keeping role %s of user %s despite directory groups: %v", role, user.Username, err)
+		}
+	}
+	return user, nil
+}
+
+// createLDAPUser creates the user for a directory login seen for the first time and returns its ID.
+func (s *Service) createLDAPUser(issuer, subject, username, email string, now time.Time) (string, error) {
+	if email == "" {
+		// Users need a unique e-mail; .invalid is reserved (RFC 2606)
+		sum := sha256.Sum256([]byte(issuer + "\x00" + subject))
+		email = hex.EncodeToString(sum[:8]) + "@ldap.invalid"
+	}
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE lower(email) = lower(?)", email).Scan(&count); err != nil {
+		return "", fmt.Errorf("failed to look up user by email: %w", err)
+	}
+	if count > 0 {
+		return "", fmt.Errorf("email %s belongs to an existing account; an administrator must link it to LDAP login '%s'", email, username)
+	}
+
+	username, err := s.availableUsername(username)
+	if err != nil {
+		return "", err
+	}
+	userID := uuid.NewString()
+	_, err = s.db.Exec(
+		"INSERT INTO users (id, username, email, password_hash, is_active, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, username, email, unusablePasswordHash, true, now, now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert user: %w", err)
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO user_identities (issuer, subject, user_id, email, created_at, last_login_at) VALUES (?, ?, ?, ?, ?, ?)",
+		issuer, subject, userID, email, now, now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to link identity: %w", err)
+	}
+	return userID, nil
+}
+
+// LinkLDAPIdentity makes an existing account sign in as the directory user ldapUsername. The
+// account's local password is removed, as linked users authenticate against the directory.
+func (s *Service) LinkLDAPIdentity(userID, ldapUsername string) error {
+	if s.ldap == nil {
+		return ErrLDAPDisabled
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if isServiceAccount, err := s.IsServiceAccount(user.ID); err != nil || isServiceAccount {
+		return errors.New("service accounts cannot sign in with LDAP")
+	}
+	issuer, subject := s.ldap.issuer(), strings.ToLower(strings.TrimSpace(ldapUsername))
+	if subject == "" {
+		return errors.New("LDAP username is required")
+	}
+
+	var linkedUserID string
+	err = s.db.QueryRow("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&linkedUserID)
+	if err == nil {
+		return fmt.Errorf("LDAP login '%s' is already linked to another account", ldapUsername)
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up identity: %w", err)
+	}
+	var count int
+	if err = s.db.QueryRow("SELECT COUNT(*) FROM user_identities WHERE issuer = ? AND user_id = ?", issuer, user.ID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to look up identity: %w", err)
+	}
+	if count > 0 {
+		return errors.New("user is already linked to an LDAP login; unlink it first")
+	}
+
+	now := time.Now().UTC()
+	_, err = s.db.Exec(
+		"INSERT INTO user_identities (issuer, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?)",
+		issuer, subject, user.ID, user.Email, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	if _, err = s.db.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?", unusablePasswordHash, now, user.ID); err != nil {
+		return fmt.Errorf("failed to remove local password: %w", err)
+	}
+	return nil
+}
+
+// UnlinkLDAPIdentity removes the directory login linked to a user. The user cannot sign in again
+// until an administrator sets a password or links another login.
+func (s *Service) UnlinkLDAPIdentity(userID string) error {
+	if s.ldap == nil {
+		return ErrLDAPDisabled
+	}
+	result, err := s.db.Exec("DELETE FROM user_identities WHERE issuer = ? AND user_id = ?", s.ldap.issuer(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("user is not linked to an LDAP login")
+	}
+	return nil
+}
+
+// rolesForGroups maps group DNs to Bridgo role names; mappings may name a group by DN or CN.
+// It also returns every role the mapping can grant, which is kept in sync on each login.
+func (a *ldapAuthenticator) rolesForGroups(groupDNs []string) (roles []string, managed []string) {
+	names := map[string]bool{}
+	for _, dn := range groupDNs {
+		names[strings.ToLower(dn)] = true
+		if parsed, err := ldap.ParseDN(dn); err == nil && len(parsed.RDNs) > 0 {
+			for _, attribute := range parsed.RDNs[0].Attributes {
+				if strings.EqualFold(attribute.Type, "cn") {
+					names[strings.ToLower(attribute.Value)] = true
+				}
+			}
+		}
+	}
+
+	for group, role := range a.cfg.GroupRoles {
+		if !containsRole(managed, role) {
+			managed = append(managed, role)
+		}
+		if names[group] && !containsRole(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, managed
+}
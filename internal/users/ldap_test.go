@@ -0,0 +1,80 @@
+package users
+
+import (
+	"strings"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestExpandLDAPFilter(t *testing.T) {
+	tests := []struct {
+		filter, username, dn, want string
+	}{
+		{"(uid={username})", "alice", "", "(uid=alice)"},
+		{"(uid={username})", "*", "", `(uid=\2a)`},
+		{"(uid={username})", "*)(uid=*))(|(uid=*", "", `(uid=\2a\29\28uid=\2a\29\29\28|\28uid=\2a)`},
+		{"(sAMAccountName={username})", `a\b` + "\x00", "", `(sAMAccountName=a\5cb\00)`},
+		{"(|(member={dn})(memberUid={username}))", "bob", "CN=Bob (Ops),DC=corp", `(|(member=CN=Bob \28Ops\29,DC=corp)(memberUid=bob))`},
+		// A placeholder in the value is not expanded again
+		{"(&(uid={username})(member={dn}))", "{dn}", "x", `(&(uid={dn})(member=x))`},
+	}
+	for _, tt := range tests {
+		got := expandLDAPFilter(tt.filter, tt.username, tt.dn)
+		if got != tt.want {
+			t.Errorf("expandLDAPFilter(%q, %q, %q) = %q, want %q", tt.filter, tt.username, tt.dn, got, tt.want)
+		}
+		if _, err := ldap.CompileFilter(got); err != nil {
+			t.Errorf("expanded filter %q does not compile: %v", got, err)
+		}
+	}
+}
+
+func TestProvisionLDAPUserDoesNotLinkByEmail(t *testing.T) {
+	s := NewService(metadatatest.NewDB(t))
+	s.ldap = &ldapAuthenticator{cfg: LDAPConfig{
+		UserSearchBase: "OU=People,DC=corp",
+		GroupRoles:     map[string]string{"bridgo-admins": models.RoleAdmin},
+	}}
+	adminID := metadatatest.InsertUser(t, s.db, "root", "Correct-horse-1")
+
+	// A directory entry carrying the admin's e-mail does not get the admin's account
+	if _, err := s.provisionLDAPUser("mallory", "root@example.com", nil); err == nil || !strings.Contains(err.Error(), "administrator must link") {
+		t.Fatalf("provisioning with an existing e-mail: got %v, want link error", err)
+	}
+
+	user, err := s.provisionLDAPUser("dave", "dave@example.com", []string{"CN=bridgo-admins,OU=Groups,DC=corp"})
+	if err != nil {
+		t.Fatalf("provisioning a new user: %v", err)
+	}
+	if user.ID == adminID || user.Username != "dave" || user.Password != unusablePasswordHash {
+		t.Fatalf("provisioned %+v, want a new user without a password", user)
+	}
+	if roles, _ := s.GetUserRoles(user.ID); !containsRole(roles, models.RoleAdmin) {
+		t.Errorf("provisioned user has roles %v, want the mapped admin role", roles)
+	}
+	if again, err := s.provisionLDAPUser("Dave", "dave@example.com", nil); err != nil || again.ID != user.ID {
+		t.Errorf("second login mapped to %+v (%v), want the same user", again, err)
+	}
+
+	// An administrator links the account explicitly
+	if err = s.LinkLDAPIdentity(adminID, "dave"); err == nil {
+		t.Errorf("linking a login already linked to another user succeeded")
+	}
+	if err = s.LinkLDAPIdentity(adminID, "root.admin"); err != nil {
+		t.Fatalf("LinkLDAPIdentity: %v", err)
+	}
+	linked, err := s.provisionLDAPUser("root.admin", "root@example.com", nil)
+	if err != nil || linked.ID != adminID {
+		t.Fatalf("linked login mapped to %+v (%v), want the admin", linked, err)
+	}
+	if linked.Password != unusablePasswordHash {
+		t.Errorf("linked account kept its local password")
+	}
+	if err = s.UnlinkLDAPIdentity(adminID); err != nil {
+		t.Fatalf("UnlinkLDAPIdentity: %v", err)
+	}
+}
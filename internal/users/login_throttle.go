@@ -0,0 +1,240 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTrackedIPs bounds the number of client addresses whose failed logins are kept in memory.
+const maxTrackedIPs = 100000
+
+// LoginThrottleConfig controls how failed logins slow down further attempts. After FreeAttempts
+// consecutive failures, each further attempt must wait BaseDelay, doubled with every failure up to
+// MaxDelay. Failures are counted per account and, separately, per client IP.
+type LoginThrottleConfig struct {
+	FreeAttempts     int           // Failures per account before backoff starts
+	IPFreeAttempts   int           // Failures per client IP before backoff starts
+	BaseDelay        time.Duration // First backoff delay
+	MaxDelay         time.Duration // Upper bound of the backoff delay
+	LockoutThreshold int           // Consecutive failures that lock an account; 0 disables lockout
+	LockoutDuration  time.Duration // How long a lockout lasts
+	FailureWindow    time.Duration // Failures are forgotten after this long without another one
+}
+
+// DefaultLoginThrottleConfig is used unless another configuration is applied.
+var DefaultLoginThrottleConfig = LoginThrottleConfig{
+	FreeAttempts:     3,
+	IPFreeAttempts:   10,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	FailureWindow:    time.Hour,
+}
+
+// delay returns how long to wait after the given number of consecutive failures.
+func (c LoginThrottleConfig) delay(failures, freeAttempts int) time.Duration {
+	if failures < freeAttempts {
+		return 0
+	}
+	delay := c.BaseDelay
+	for i := freeAttempts; i < failures && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+	return delay
+}
+
+// LoginThrottledError is returned by CheckLoginAllowed while logins must wait.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool // The account is locked rather than backing off
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account is temporarily locked after too many failed logins; try again in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed logins; try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// ipFailures tracks consecutive failed logins from one client IP.
+type ipFailures struct {
+	count      int
+	lastFailed time.Time
+}
+
+// loginThrottle holds the throttle configuration and the per-IP failures. Per-account failures
+// are stored in 'login_failures', so lockouts survive restarts.
+type loginThrottle struct {
+	cfg LoginThrottleConfig
+	mu  sync.Mutex
+	ips map[string]*ipFailures
+}
+
+func newLoginThrottle(cfg LoginThrottleConfig) *loginThrottle {
+	return &loginThrottle{cfg: cfg, ips: map[string]*ipFailures{}}
+}
+
+// SetLoginThrottle validates and applies a login throttle configuration.
+func (s *Service) SetLoginThrottle(cfg LoginThrottleConfig) error {
+	if cfg.FreeAttempts < 1 || cfg.IPFreeAttempts < 1 {
+		return errors.New("free login attempts must be at least 1")
+	}
+	if cfg.BaseDelay <= 0 || cfg.MaxDelay < cfg.BaseDelay {
+		return errors.New("backoff delays must be positive, with the maximum not below the base delay")
+	}
+	if cfg.LockoutThreshold < 0 || (cfg.LockoutThreshold > 0 && cfg.LockoutDuration <= 0) {
+		return errors.New("lockout threshold must not be negative and lockouts need a positive duration")
+	}
+	if cfg.FailureWindow <= 0 {
+		return errors.New("failure window must be positive")
+	}
+	s.throttle = newLoginThrottle(cfg)
+	return nil
+}
+
+// throttleKey normalizes a login name, so that variants of one name share their failures.
+func throttleKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// CheckLoginAllowed fails with a *LoginThrottledError while the account or the client IP has to
+// wait after failed logins. It is checked before the password, so throttled attempts cost nothing
+// and reveal nothing. Unknown usernames are throttled like existing ones.
+func (s *Service) CheckLoginAllowed(username, ip string) error {
+	now := time.Now().UTC()
+	cfg := s.throttle.cfg
+
+	var wait time.Duration
+	s.throttle.mu.Lock()
+	if failures, ok := s.throttle.ips[ip]; ok && now.Sub(failures.lastFailed) < cfg.FailureWindow {
+		wait = failures.lastFailed.Add(cfg.delay(failures.count, cfg.IPFreeAttempts)).Sub(now)
+	}
+	s.throttle.mu.Unlock()
+
+	var count int
+	var lastFailed time.Time
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRow(
+		"SELECT failed_count, last_failed_at, locked_until FROM login_failures WHERE username = ?",
+		throttleKey(username),
+	).Scan(&count, &lastFailed, &lockedUntil)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check failed logins: %w", err)
+	}
+	if err == nil {
+		if lockedUntil.Valid && lockedUntil.Time.After(now) {
+			return &LoginThrottledError{RetryAfter: lockedUntil.Time.Sub(now), Locked: true}
+		}
+		if now.Sub(lastFailed) < cfg.FailureWindow {
+			if accountWait := lastFailed.Add(cfg.delay(count, cfg.FreeAttempts)).Sub(now); accountWait > wait {
+				wait = accountWait
+			}
+		}
+	}
+
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed login for the account and the client IP. It returns the end
+// of the lockout if this failure locked the account.
+func (s *Service) RecordLoginFailure(username, ip string) (*time.Time, error) {
+	now := time.Now().UTC()
+	cfg := s.throttle.cfg
+
+	s.throttle.mu.Lock()
+	failures, ok := s.throttle.ips[ip]
+	if !ok || now.Sub(failures.lastFailed) >= cfg.FailureWindow {
+		if len(s.throttle.ips) >= maxTrackedIPs {
+			s.throttle.pruneIPs(now)
+		}
+		failures = &ipFailures{}
+		// Beyond the bound, further addresses are only throttled per account
+		if len(s.throttle.ips) < maxTrackedIPs {
+			s.throttle.ips[ip] = failures
+		}
+	}
+	failures.count++
+	failures.lastFailed = now
+	s.throttle.mu.Unlock()
+
+	// Forget stale failures, including those of names that do not exist
+	_, err := s.db.Exec(
+		"DELETE FROM login_failures WHERE last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)",
+		now.Add(-cfg.FailureWindow), now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean up failed logins: %w", err)
+	}
+
+	key := throttleKey(username)
+	var count int
+	err = s.db.QueryRow("SELECT failed_count FROM login_failures WHERE username = ?", key).Scan(&count)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to read failed logins: %w", err)
+	}
+	count++
+
+	var lockedUntil *time.Time
+	if cfg.LockoutThreshold > 0 && count >= cfg.LockoutThreshold {
+		until := now.Add(cfg.LockoutDuration)
+		lockedUntil = &until
+	}
+	if err == sql.ErrNoRows {
+		_, err = s.db.Exec(
+			"INSERT INTO login_failures (username, failed_count, last_failed_at, locked_until) VALUES (?, ?, ?, ?)",
+			key, count, now, lockedUntil,
+		)
+	} else {
+		_, err = s.db.Exec(
+			"UPDATE login_failures SET failed_count = ?, last_failed_at = ?, locked_until = ? WHERE username = ?",
+			count, now, lockedUntil, key,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record failed login: %w", err)
+	}
+	return lockedUntil, nil
+}
+
+// RecordLoginSuccess clears the failed logins of an account. Failures of the client IP are kept,
+// so one valid account cannot be used to reset the backoff of an attacking address.
+func (s *Service) RecordLoginSuccess(username string) error {
+	return s.clearLoginFailures(username)
+}
+
+// UnlockAccount lifts a lockout and clears the failed logins of a user.
+func (s *Service) UnlockAccount(userID string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	return s.clearLoginFailures(user.Username)
+}
+
+// clearLoginFailures forgets the failed logins and any lockout of an account.
+func (s *Service) clearLoginFailures(username string) error {
+	if _, err := s.db.Exec("DELETE FROM login_failures WHERE username = ?", throttleKey(username)); err != nil {
+		return fmt.Errorf("failed to clear failed logins: %w", err)
+	}
+	return nil
+}
+
+// pruneIPs forgets the failures of addresses outside the failure window; the caller holds mu.
+func (t *loginThrottle) pruneIPs(now time.Time) {
+	for ip, failures := range t.ips {
+		if now.Sub(failures.lastFailed) >= t.cfg.FailureWindow {
+			delete(t.ips, ip)
+		}
+	}
+}
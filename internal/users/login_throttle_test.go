@@ -0,0 +1,112 @@
+package users
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Bridgo/internal/metadata/metadatatest"
+)
+
+func TestLoginThrottleDelay(t *testing.T) {
+	cfg := DefaultLoginThrottleConfig
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{11, 256 * time.Second},
+		{12, 5 * time.Minute},
+		{1000, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := cfg.delay(tt.failures, cfg.FreeAttempts); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := NewService(metadatatest.NewDB(t))
+	userID := metadatatest.InsertUser(t, s.db, "alice", "Correct-horse-1")
+	err := s.SetLoginThrottle(LoginThrottleConfig{
+		FreeAttempts:     2,
+		IPFreeAttempts:   3,
+		BaseDelay:        time.Hour,
+		MaxDelay:         time.Hour,
+		LockoutThreshold: 3,
+		LockoutDuration:  15 * time.Minute,
+		FailureWindow:    24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("SetLoginThrottle: %v", err)
+	}
+
+	throttled := func(username, ip string) *LoginThrottledError {
+		t.Helper()
+		err := s.CheckLoginAllowed(username, ip)
+		var throttledErr *LoginThrottledError
+		if err != nil && !errors.As(err, &throttledErr) {
+			t.Fatalf("CheckLoginAllowed: %v", err)
+		}
+		return throttledErr
+	}
+	fail := func(username, ip string) *time.Time {
+		t.Helper()
+		lockedUntil, err := s.RecordLoginFailure(username, ip)
+		if err != nil {
+			t.Fatalf("RecordLoginFailure: %v", err)
+		}
+		return lockedUntil
+	}
+
+	fail("alice", "10.0.0.1")
+	if e := throttled("alice", "10.0.0.2"); e != nil {
+		t.Fatalf("after one failure: %v", e)
+	}
+	// Variants of the name share the account's failures, whatever the client address
+	fail(" Alice ", "10.0.0.2")
+	e := throttled("ALICE", "10.0.0.3")
+	if e == nil || e.Locked || e.RetryAfter <= 59*time.Minute {
+		t.Fatalf("after two failures: got %+v, want backoff of about an hour", e)
+	}
+	if lockedUntil := fail("alice", "10.0.0.3"); lockedUntil == nil {
+		t.Fatalf("third failure did not lock the account")
+	}
+	if e = throttled("alice", "10.0.0.4"); e == nil || !e.Locked {
+		t.Fatalf("after lockout: got %+v, want locked", e)
+	}
+	if e = throttled("bob", "10.0.0.4"); e != nil {
+		t.Fatalf("other account: %v", e)
+	}
+
+	if err = s.UnlockAccount(userID); err != nil {
+		t.Fatalf("UnlockAccount: %v", err)
+	}
+	if e = throttled("alice", "10.0.0.4"); e != nil {
+		t.Fatalf("after unlock: %v", e)
+	}
+
+	// One address failing on many names backs off as well
+	for _, name := range []string{"carol", "dave", "erin"} {
+		fail(name, "10.0.0.9")
+	}
+	if e = throttled("frank", "10.0.0.9"); e == nil || e.Locked {
+		t.Fatalf("address after three failures: got %+v, want backoff", e)
+	}
+	// A success clears the account's failures, but not the address's
+	fail("frank", "10.0.0.10")
+	if err = s.RecordLoginSuccess("frank"); err != nil {
+		t.Fatalf("RecordLoginSuccess: %v", err)
+	}
+	if e = throttled("frank", "10.0.0.11"); e != nil {
+		t.Fatalf("after success: %v", e)
+	}
+	if e = throttled("frank", "10.0.0.9"); e == nil {
+		t.Fatalf("address after success of one account: want backoff")
+	}
+}
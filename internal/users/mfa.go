@@ -0,0 +1,249 @@
+package users
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets; each can replace one TOTP code once.
+const recoveryCodeCount = 10
+
+var (
+	// ErrInvalidMFACode is returned for wrong, expired or already used one-time codes.
+	ErrInvalidMFACode = errors.New("invalid one-time code")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already uses two-factor authentication.
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnabled is returned when verifying codes of a user without two-factor authentication.
+	ErrMFANotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrMFAEnforced is returned when a user whose role requires two-factor authentication disables it.
+	ErrMFAEnforced = errors.New("two-factor authentication is required for one of your roles")
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAPolicy controls who must use two-factor authentication; everyone else may opt in.
+type MFAPolicy struct {
+	RequiredRoles []string // Users with any of these roles must enroll at their next login
+}
+
+// SetMFAPolicy validates and applies a two-factor authentication policy.
+func (s *Service) SetMFAPolicy(policy MFAPolicy) error {
+	for _, role := range policy.RequiredRoles {
+		if _, err := s.getRoleID(role); err != nil {
+			return fmt.Errorf("role '%s' in MFA policy: %w", role, err)
+		}
+	}
+	s.mfaPolicy = policy
+	return nil
+}
+
+// MFAStatus reports whether a user has enabled, or must enable, two-factor authentication.
+func (s *Service) MFAStatus(userID string) (models.MFAStatus, error) {
+	var status models.MFAStatus
+	err := s.db.QueryRow("SELECT enabled FROM user_mfa WHERE user_id = ?", userID).Scan(&status.Enabled)
+	if err != nil && err != sql.ErrNoRows {
+		return models.MFAStatus{}, fmt.Errorf("failed to read two-factor status: %w", err)
+	}
+	if status.Required, err = s.mfaRequired(userID); err != nil {
+		return models.MFAStatus{}, err
+	}
+	if status.Enabled {
+		err = s.db.QueryRow("SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&status.RecoveryCodesRemaining)
+		if err != nil {
+			return models.MFAStatus{}, fmt.Errorf("failed to count recovery codes: %w", err)
+		}
+	}
+	return status, nil
+}
+
+// mfaRequired reports whether one of the user's roles requires two-factor authentication.
+func (s *Service) mfaRequired(userID string) (bool, error) {
+	if len(s.mfaPolicy.RequiredRoles) == 0 {
+		return false, nil
+	}
+	roles, err := s.GetUserRoles(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range s.mfaPolicy.RequiredRoles {
+		if containsRole(roles, role) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BeginMFAEnrollment returns the TOTP secret the user adds to their authenticator app. A pending
+// enrollment is returned again until it is confirmed with ConfirmMFAEnrollment.
+func (s *Service) BeginMFAEnrollment(userID string) (models.MFAEnrollment, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return models.MFAEnrollment{}, err
+	}
+
+	var secret string
+	var enabled bool
+	err = s.db.QueryRow("SELECT totp_secret, enabled FROM user_mfa WHERE user_id = ?", user.ID).Scan(&secret, &enabled)
+	switch {
+	case err == sql.ErrNoRows:
+		if secret, err = auth.GenerateTOTPSecret(); err != nil {
+			return models.MFAEnrollment{}, err
+		}
+		_, err = s.db.Exec("INSERT INTO user_mfa (user_id, totp_secret, enabled, created_at) VALUES (?, ?, FALSE, ?)", user.ID, secret, time.Now().UTC())
+		if err != nil {
+			return models.MFAEnrollment{}, fmt.Errorf("failed to store two-factor enrollment: %w", err)
+		}
+	case err != nil:
+		return models.MFAEnrollment{}, fmt.Errorf("failed to read two-factor enrollment: %w", err)
+	case enabled:
+		return models.MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	return models.MFAEnrollment{Secret: secret, ProvisioningURI: auth.TOTPProvisioningURI(user.Username, secret)}, nil
+}
+
+// ConfirmMFAEnrollment enables two-factor authentication once the user proves with a first code
+// that their authenticator app works, and returns their recovery codes, which are not stored and
+// cannot be retrieved again.
+func (s *Service) ConfirmMFAEnrollment(userID, code string) ([]string, error) {
+	var secret string
+	var enabled bool
+	err := s.db.QueryRow("SELECT totp_secret, enabled FROM user_mfa WHERE user_id = ?", userID).Scan(&secret, &enabled)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("no pending two-factor enrollment; start one first")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read two-factor enrollment: %w", err)
+	}
+	if enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	now := time.Now().UTC()
+	step, ok := auth.ValidateTOTP(secret, normalizeMFACode(code), now)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	if _, err = s.db.Exec("UPDATE user_mfa SET enabled = TRUE, enabled_at = ?, last_used_step = ? WHERE user_id = ?", now, step, userID); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	return s.RegenerateRecoveryCodes(userID)
+}
+
+// VerifyMFA checks a TOTP code or an unused recovery code of a user with two-factor
+// authentication, and returns which kind it was ("totp" or "recovery_code"). Each code is accepted
+// only once.
+func (s *Service) VerifyMFA(userID, code string) (string, error) {
+	var secret string
+	var enabled bool
+	var lastUsedStep int64
+	err := s.db.QueryRow("SELECT totp_secret, enabled, last_used_step FROM user_mfa WHERE user_id = ?", userID).Scan(&secret, &enabled, &lastUsedStep)
+	if err == sql.ErrNoRows || (err == nil && !enabled) {
+		return "", ErrMFANotEnabled
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read two-factor settings: %w", err)
+	}
+
+	code = normalizeMFACode(code)
+	if step, ok := auth.ValidateTOTP(secret, code, time.Now().UTC()); ok {
+		if step <= lastUsedStep {
+			return "", ErrInvalidMFACode
+		}
+		result, err := s.db.Exec("UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?", step, userID, step)
+		if err != nil {
+			return "", fmt.Errorf("failed to record one-time code use: %w", err)
+		}
+		if affected, _ := result.RowsAffected(); affected != 1 {
+			return "", ErrInvalidMFACode
+		}
+		return "totp", nil
+	}
+
+	result, err := s.db.Exec(
+		"UPDATE mfa_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		time.Now().UTC(), userID, hashToken(code),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected != 1 {
+		return "", ErrInvalidMFACode
+	}
+	return "recovery_code", nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of a user with two-factor authentication and
+// returns the new ones.
+func (s *Service) RegenerateRecoveryCodes(userID string) ([]string, error) {
+	var enabled bool
+	err := s.db.QueryRow("SELECT enabled FROM user_mfa WHERE user_id = ?", userID).Scan(&enabled)
+	if err == sql.ErrNoRows || (err == nil && !enabled) {
+		return nil, ErrMFANotEnabled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read two-factor status: %w", err)
+	}
+
+	if _, err = s.db.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	now := time.Now().UTC()
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err = rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))[:10]
+		_, err = s.db.Exec(
+			"INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at) VALUES (?, ?, ?, ?)",
+			uuid.NewString(), userID, hashToken(code), now,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// DisableMFA turns off two-factor authentication at the user's request, unless one of their roles
+// requires it.
+func (s *Service) DisableMFA(userID string) error {
+	required, err := s.mfaRequired(userID)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFAEnforced
+	}
+	return s.ResetMFA(userID)
+}
+
+// ResetMFA removes a user's two-factor enrollment and recovery codes, e.g. after they lost their
+// device. Users whose role requires two-factor authentication enroll again at their next login.
+func (s *Service) ResetMFA(userID string) error {
+	if _, err := s.db.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := s.db.Exec("DELETE FROM user_mfa WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("failed to delete two-factor enrollment: %w", err)
+	}
+	return nil
+}
+
+// normalizeMFACode strips the spaces and dashes users type or paste, and lower-cases recovery codes.
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
@@ -0,0 +1,239 @@
+package users
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// OIDCLoginTTL is how long a user has to complete signing in at the provider.
+const OIDCLoginTTL = 10 * time.Minute
+
+// ErrInvalidOIDCState is returned when a single sign-on callback does not match a pending login.
+var ErrInvalidOIDCState = errors.New("unknown or expired single sign-on request")
+
+// SaveOIDCLoginState records a pending single sign-on login until its callback consumes it.
+func (s *Service) SaveOIDCLoginState(state, nonce, codeVerifier string) error {
+	now := time.Now().UTC()
+	if _, err := s.db.Exec("DELETE FROM oidc_login_states WHERE expires_at < ?", now); err != nil {
+		return fmt.Errorf("failed to purge expired login states: %w", err)
+	}
+
+	_, err := s.db.Exec(
+		"INSERT INTO oidc_login_states (state, nonce, code_verifier, expires_at) VALUES (?, ?, ?, ?)",
+		state, nonce, codeVerifier, now.Add(OIDCLoginTTL),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save login state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCLoginState returns the nonce and PKCE code verifier of a pending login and deletes
+// it, so each state can complete a login only once.
+func (s *Service) ConsumeOIDCLoginState(state string) (string, string, error) {
+	var nonce, codeVerifier string
+	var expiresAt time.Time
+	err := s.db.QueryRow("SELECT nonce, code_verifier, expires_at FROM oidc_login_states WHERE state = ?", state).Scan(&nonce, &codeVerifier, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", ErrInvalidOIDCState
+		}
+		return "", "", fmt.Errorf("failed to look up login state: %w", err)
+	}
+
+	result, err := s.db.Exec("DELETE FROM oidc_login_states WHERE state = ?", state)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to consume login state: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected != 1 || !expiresAt.After(time.Now().UTC()) {
+		return "", "", ErrInvalidOIDCState
+	}
+	return nonce, codeVerifier, nil
+}
+
+// ProvisionOIDCUser returns the Bridgo user for an identity verified by the OIDC provider.
+// Identities seen before, or linked to an account by an administrator (LinkOIDCIdentity), map to
+// their user; otherwise a new user is created, who cannot log in with a password. Provider e-mails
+// never link existing accounts, verified or not: whoever controls an account at the provider could
+// otherwise take over the Bridgo account with the same address. Roles in managedRoles are kept in
+// sync with roles on every login; a new user none of whose groups is mapped gets defaultRole.
+func (s *Service) ProvisionOIDCUser(identity *auth.OIDCIdentity, roles, managedRoles []string, defaultRole string) (models.User, error) {
+	now := time.Now().UTC()
+
+	var userID string
+	err := s.db.QueryRow("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Scan(&userID)
+	switch {
+	case err == nil:
+		if _, err = s.db.Exec("UPDATE user_identities SET last_login_at = ? WHERE issuer = ? AND subject = ?", now, identity.Issuer, identity.Subject); err != nil {
+			return models.User{}, fmt.Errorf("failed to record login: %w", err)
+		}
+	case err == sql.ErrNoRows:
+		if userID, err = s.createOIDCUser(identity, now); err != nil {
+			return models.User{}, err
+		}
+		if len(roles) == 0 {
+			if defaultRole == "" {
+				defaultRole = models.DefaultUserRole
+			}
+			roles = []string{defaultRole}
+		}
+	default:
+		return models.User{}, fmt.Errorf("failed to look up identity: %w", err)
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !user.IsActive {
+		return models.User{}, ErrUserInactive
+	}
+
+	for _, role := range roles {
+		if err = s.AssignRole(user.ID, role); err != nil {
+			return models.User{}, fmt.Errorf("failed to assign role from provider groups: %w", err)
+		}
+	}
+	for _, role := range managedRoles {
+		if containsRole(roles, role) {
+			continue
+		}
+		if err = s.RemoveRole(user.ID, role); err != nil && !errors.Is(err, ErrRoleNotFound) {
+			// E.g. the last admin keeps the admin role
+			log.Printf("Keeping role %s of user %s despite provider groups: %v", role, user.Username, err)
+		}
+	}
+	return user, nil
+}
+
+// createOIDCUser creates the user for an identity seen for the first time and returns its ID.
+func (s *Service) createOIDCUser(identity *auth.OIDCIdentity, now time.Time) (string, error) {
+	email := identity.Email
+	if email == "" {
+		// Users need a unique e-mail; .invalid is reserved (RFC 2606)
+		sum := sha256.Sum256([]byte(identity.Issuer + "\x00" + identity.Subject))
+		email = hex.EncodeToString(sum[:8]) + "@oidc.invalid"
+	}
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE lower(email) = lower(?)", email).Scan(&count); err != nil {
+		return "", fmt.Errorf("failed to look up user by email: %w", err)
+	}
+	if count > 0 {
+		return "", fmt.Errorf("email %s belongs to an existing account; an administrator must link it to OIDC subject '%s'", email, identity.Subject)
+	}
+
+	username, err := s.availableUsername(identity.Username)
+	if err != nil {
+		return "", err
+	}
+	userID := uuid.NewString()
+	_, err = s.db.Exec(
+		"INSERT INTO users (id, username, email, password_hash, is_active, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		userID, username, email, unusablePasswordHash, true, now, now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert user: %w", err)
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO user_identities (issuer, subject, user_id, email, created_at, last_login_at) VALUES (?, ?, ?, ?, ?, ?)",
+		identity.Issuer, identity.Subject, userID, identity.Email, now, now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to link identity: %w", err)
+	}
+	return userID, nil
+}
+
+// LinkOIDCIdentity makes an existing account sign in as the provider's user subject ('sub' claim)
+// of issuer. The account's local password is removed, as linked users sign in at the provider.
+func (s *Service) LinkOIDCIdentity(userID, issuer, subject string) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if isServiceAccount, err := s.IsServiceAccount(user.ID); err != nil || isServiceAccount {
+		return errors.New("service accounts cannot sign in with single sign-on")
+	}
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return errors.New("OIDC subject is required")
+	}
+
+	var linkedUserID string
+	err = s.db.QueryRow("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&linkedUserID)
+	if err == nil {
+		return fmt.Errorf("OIDC subject '%s' is already linked to another account", subject)
+	}
+	if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up identity: %w", err)
+	}
+	var count int
+	if err = s.db.QueryRow("SELECT COUNT(*) FROM user_identities WHERE issuer = ? AND user_id = ?", issuer, user.ID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to look up identity: %w", err)
+	}
+	if count > 0 {
+		return errors.New("user is already linked to an OIDC subject; unlink it first")
+	}
+
+	now := time.Now().UTC()
+	_, err = s.db.Exec(
+		"INSERT INTO user_identities (issuer, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?)",
+		issuer, subject, user.ID, user.Email, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	if _, err = s.db.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?", unusablePasswordHash, now, user.ID); err != nil {
+		return fmt.Errorf("failed to remove local password: %w", err)
+	}
+	return nil
+}
+
+// UnlinkOIDCIdentity removes the issuer's identity linked to a user. The user cannot sign in again
+// until an administrator sets a password or links another identity.
+func (s *Service) UnlinkOIDCIdentity(userID, issuer string) error {
+	result, err := s.db.Exec("DELETE FROM user_identities WHERE issuer = ? AND user_id = ?", issuer, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("user is not linked to an OIDC subject")
+	}
+	return nil
+}
+
+// availableUsername returns username, or username with a numeric suffix when it is taken.
+func (s *Service) availableUsername(username string) (string, error) {
+	candidate := username
+	for i := 2; ; i++ {
+		var count int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", candidate).Scan(&count); err != nil {
+			return "", fmt.Errorf("failed to check if user exists: %w", err)
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", username, i)
+	}
+}
+
+// containsRole reports whether roles contains role.
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package users
+
+import (
+	"strings"
+	"testing"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/metadata/metadatatest"
+)
+
+func TestProvisionOIDCUser(t *testing.T) {
+	const issuer = "https://idp.example.com"
+	s := NewService(metadatatest.NewDB(t))
+	localID := metadatatest.InsertUser(t, s.db, "alice", "Correct-horse-1")
+
+	identityCount := func(subject string) int {
+		t.Helper()
+		var n int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&n); err != nil {
+			t.Fatalf("count identities: %v", err)
+		}
+		return n
+	}
+
+	t.Run("new identity", func(t *testing.T) {
+		identity := &auth.OIDCIdentity{Issuer: issuer, Subject: "sub-new", Username: "alice", Email: "new@example.com", EmailVerified: true}
+		user, err := s.ProvisionOIDCUser(identity, nil, nil, "")
+		if err != nil {
+			t.Fatalf("ProvisionOIDCUser: %v", err)
+		}
+		if user.ID == localID || user.Username != "alice2" || user.Email != "new@example.com" {
+			t.Errorf("provisioned %+v, want a new user alice2", user)
+		}
+		again, err := s.ProvisionOIDCUser(identity, nil, nil, "")
+		if err != nil || again.ID != user.ID {
+			t.Errorf("second login mapped to %+v (%v), want %s", again, err, user.ID)
+		}
+	})
+
+	for _, verified := range []bool{true, false} {
+		name := "unverified email collision"
+		if verified {
+			name = "verified email collision"
+		}
+		t.Run(name, func(t *testing.T) {
+			subject := "sub-" + strings.ReplaceAll(name, " ", "-")
+			identity := &auth.OIDCIdentity{Issuer: issuer, Subject: subject, Username: "mallory", Email: "ALICE@example.com", EmailVerified: verified}
+			_, err := s.ProvisionOIDCUser(identity, nil, nil, "")
+			if err == nil || !strings.Contains(err.Error(), subject) {
+				t.Fatalf("ProvisionOIDCUser = %v, want an error naming the subject", err)
+			}
+			if n := identityCount(subject); n != 0 {
+				t.Errorf("colliding identity was linked %d times", n)
+			}
+		})
+	}
+
+	t.Run("admin link", func(t *testing.T) {
+		if err := s.LinkOIDCIdentity(localID, issuer, "sub-new"); err == nil {
+			t.Error("linking a subject linked to another account succeeded")
+		}
+		if err := s.LinkOIDCIdentity(localID, issuer, "sub-alice"); err != nil {
+			t.Fatalf("LinkOIDCIdentity: %v", err)
+		}
+		if err := s.LinkOIDCIdentity(localID, issuer, "sub-other"); err == nil {
+			t.Error("linking a second subject to the account succeeded")
+		}
+		if _, err := s.ValidatePassword("alice", "Correct-horse-1"); err == nil {
+			t.Error("linked account can still log in with its local password")
+		}
+
+		identity := &auth.OIDCIdentity{Issuer: issuer, Subject: "sub-alice", Username: "alice", Email: "alice@example.com", EmailVerified: true}
+		user, err := s.ProvisionOIDCUser(identity, nil, nil, "")
+		if err != nil || user.ID != localID {
+			t.Fatalf("login of linked subject mapped to %+v (%v), want %s", user, err, localID)
+		}
+
+		if err = s.UnlinkOIDCIdentity(localID, issuer); err != nil {
+			t.Fatalf("UnlinkOIDCIdentity: %v", err)
+		}
+		if n := identityCount("sub-alice"); n != 0 {
+			t.Errorf("unlinked identity still exists %d times", n)
+		}
+		if err = s.UnlinkOIDCIdentity(localID, issuer); err == nil {
+			t.Error("unlinking an unlinked account succeeded")
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxPasswordBytes is the longest password bcrypt can hash.
+const maxPasswordBytes = 72
+
+// ErrWeakPassword is returned when a new password does not satisfy the password policy.
+var ErrWeakPassword = errors.New("password does not meet the password policy")
+
+// PasswordPolicy lists the rules new passwords must satisfy. Existing passwords are not affected.
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length"`     // Minimum number of characters
+	RequireUpper  bool `json:"require_upper"`  // At least one upper-case letter
+	RequireLower  bool `json:"require_lower"`  // At least one lower-case letter
+	RequireDigit  bool `json:"require_digit"`  // At least one digit
+	RequireSymbol bool `json:"require_symbol"` // At least one character that is not a letter or digit
+}
+
+// DefaultPasswordPolicy is used unless another policy is configured.
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 12}
+
+// SetPasswordPolicy validates and applies the rules for new passwords.
+func (s *Service) SetPasswordPolicy(policy PasswordPolicy) error {
+	if policy.MinLength < 1 || policy.MinLength > maxPasswordBytes {
+		return fmt.Errorf("minimum password length must be between 1 and %d", maxPasswordBytes)
+	}
+	s.passwordPolicy = policy
+	return nil
+}
+
+// PasswordPolicy returns the rules new passwords must satisfy.
+func (s *Service) PasswordPolicy() PasswordPolicy {
+	return s.passwordPolicy
+}
+
+// checkPassword fails with ErrWeakPassword, naming every rule that is not met, if password is not
+// acceptable as the new password of username.
+func (s *Service) checkPassword(username, password string) error {
+	policy := s.passwordPolicy
+	var problems []string
+	if len([]rune(password)) < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("be at least %d characters long", policy.MinLength))
+	}
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, fmt.Sprintf("be at most %d bytes long", maxPasswordBytes))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	for _, rule := range []struct {
+		required, present bool
+		description       string
+	}{
+		{policy.RequireUpper, upper, "contain an upper-case letter"},
+		{policy.RequireLower, lower, "contain a lower-case letter"},
+		{policy.RequireDigit, digit, "contain a digit"},
+		{policy.RequireSymbol, symbol, "contain a symbol"},
+	} {
+		if rule.required && !rule.present {
+			problems = append(problems, rule.description)
+		}
+	}
+	if len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		problems = append(problems, "not contain the username")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: it must %s", ErrWeakPassword, strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package users
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Registration modes: who may create an account through /api/register.
+const (
+	RegistrationDisabled = "disabled" // Only admins create accounts
+	RegistrationInvite   = "invite"   // Only holders of an invite
+	RegistrationDomain   = "domain"   // Holders of an invite, or e-mail addresses in allowed domains
+	RegistrationOpen     = "open"     // Anyone
+)
+
+// DefaultInviteTTL is how long an invite can be used when no expiry is given.
+const DefaultInviteTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrRegistrationClosed is returned when self-registration is not allowed.
+	ErrRegistrationClosed = errors.New("registration is disabled")
+	// ErrInvalidInvite is returned for unknown, expired or used invite codes.
+	ErrInvalidInvite = errors.New("invalid, expired or used invite code")
+)
+
+// RegistrationPolicy controls self-registration.
+type RegistrationPolicy struct {
+	Mode           string   // One of the Registration* modes; disabled when empty
+	AllowedDomains []string // Lower-case e-mail domains allowed in RegistrationDomain mode
+}
+
+// allowsEmail reports whether an e-mail address is in one of the allowed domains.
+func (p RegistrationPolicy) allowsEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range p.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRegistrationPolicy validates and applies a registration policy.
+func (s *Service) SetRegistrationPolicy(policy RegistrationPolicy) error {
+	switch policy.Mode {
+	case "":
+		policy.Mode = RegistrationDisabled
+	case RegistrationDisabled, RegistrationInvite, RegistrationOpen:
+	case RegistrationDomain:
+		if len(policy.AllowedDomains) == 0 {
+			return errors.New("registration mode 'domain' needs at least one allowed domain")
+		}
+	default:
+		return fmt.Errorf("unknown registration mode '%s' (expected disabled, invite, domain or open)", policy.Mode)
+	}
+	s.registration = policy
+	return nil
+}
+
+// RegistrationMode returns the active registration mode.
+func (s *Service) RegistrationMode() string {
+	if s.registration.Mode == "" {
+		return RegistrationDisabled
+	}
+	return s.registration.Mode
+}
+
+// Register creates an account through self-registration, as allowed by the registration policy.
+// With an invite code the user gets the invite's role; otherwise the default role. Accounts
+// registered in domain mode without an invite are inactive until an admin activates them, since
+// nothing proves the user owns the e-mail address.
+func (s *Service) Register(username, email, password, inviteCode string) (models.User, error) {
+	mode := s.RegistrationMode()
+	if mode == RegistrationDisabled {
+		return models.User{}, ErrRegistrationClosed
+	}
+	if inviteCode != "" {
+		return s.registerWithInvite(username, email, password, inviteCode)
+	}
+
+	switch mode {
+	case RegistrationInvite:
+		return models.User{}, errors.New("an invite code is required to register")
+	case RegistrationDomain:
+		if !s.registration.allowsEmail(email) {
+			return models.User{}, fmt.Errorf("registration is limited to e-mail addresses at %s", strings.Join(s.registration.AllowedDomains, ", "))
+		}
+		return s.addUser(username, email, password, models.DefaultUserRole, false)
+	}
+	return s.AddUser(username, email, password)
+}
+
+// registerWithInvite uses up an invite and creates the account it allows.
+func (s *Service) registerWithInvite(username, email, password, inviteCode string) (models.User, error) {
+	var invite models.Invite
+	err := s.db.QueryRow(
+		"SELECT id, email, role_name, expires_at, used_at FROM user_invites WHERE token_hash = ?",
+		hashToken(inviteCode),
+	).Scan(&invite.ID, &invite.Email, &invite.RoleName, &invite.ExpiresAt, &invite.UsedAt)
+	if err == sql.ErrNoRows {
+		return models.User{}, ErrInvalidInvite
+	}
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to look up invite: %w", err)
+	}
+	if invite.UsedAt != nil || !invite.ExpiresAt.After(time.Now().UTC()) {
+		return models.User{}, ErrInvalidInvite
+	}
+	if invite.Email != nil && !strings.EqualFold(*invite.Email, email) {
+		return models.User{}, errors.New("this invite is for a different e-mail address")
+	}
+
+	// Claim the invite first, so it cannot be used twice concurrently
+	result, err := s.db.Exec("UPDATE user_invites SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now().UTC(), invite.ID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to use invite: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected != 1 {
+		return models.User{}, ErrInvalidInvite
+	}
+
+	user, err := s.addUser(username, email, password, invite.RoleName, true)
+	if err != nil {
+		if _, releaseErr := s.db.Exec("UPDATE user_invites SET used_at = NULL WHERE id = ?", invite.ID); releaseErr != nil {
+			return models.User{}, fmt.Errorf("%w (and failed to release invite: %v)", err, releaseErr)
+		}
+		return models.User{}, err
+	}
+	if _, err = s.db.Exec("UPDATE user_invites SET used_by_user_id = ? WHERE id = ?", user.ID, invite.ID); err != nil {
+		return models.User{}, fmt.Errorf("failed to record invite use: %w", err)
+	}
+	return user, nil
+}
+
+// CreateUser creates an account on behalf of an admin. The user must change the password at
+// their first login.
+func (s *Service) CreateUser(username, email, password, roleName string) (models.User, error) {
+	if roleName == "" {
+		roleName = models.DefaultUserRole
+	}
+	user, err := s.addUser(username, email, password, roleName, true)
+	if err != nil {
+		return models.User{}, err
+	}
+	if err = s.RequirePasswordChange(user.ID); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// CreateInvite creates an invite for the named role, optionally restricted to one e-mail address,
+// and returns it with its invite code, which is not stored and cannot be retrieved again.
+func (s *Service) CreateInvite(email, roleName, createdByUserID string, ttl time.Duration) (models.Invite, string, error) {
+	if roleName == "" {
+		roleName = models.DefaultUserRole
+	}
+	if _, err := s.getRoleID(roleName); err != nil {
+		return models.Invite{}, "", err
+	}
+	if ttl <= 0 {
+		ttl = DefaultInviteTTL
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return models.Invite{}, "", fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	code := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	invite := models.Invite{
+		ID:              uuid.NewString(),
+		RoleName:        roleName,
+		CreatedByUserID: &createdByUserID,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(ttl),
+	}
+	var emailValue interface{}
+	if email != "" {
+		invite.Email = &email
+		emailValue = email
+	}
+
+	_, err := s.db.Exec(
+		"INSERT INTO user_invites (id, token_hash, email, role_name, created_by_user_id, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		invite.ID, hashToken(code), emailValue, invite.RoleName, createdByUserID, invite.CreatedAt, invite.ExpiresAt,
+	)
+	if err != nil {
+		return models.Invite{}, "", fmt.Errorf("failed to store invite: %w", err)
+	}
+	return invite, code, nil
+}
+
+// ListInvites returns all invites, newest first.
+func (s *Service) ListInvites() ([]models.Invite, error) {
+	rows, err := s.db.Query(`
+		SELECT id, email, role_name, created_by_user_id, created_at, expires_at, used_at, used_by_user_id
+		FROM user_invites
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invites: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []models.Invite{}
+	for rows.Next() {
+		var i models.Invite
+		if err = rows.Scan(&i.ID, &i.Email, &i.RoleName, &i.CreatedByUserID, &i.CreatedAt, &i.ExpiresAt, &i.UsedAt, &i.UsedByUserID); err != nil {
+			return nil, fmt.Errorf("failed to scan invite: %w", err)
+		}
+		invites = append(invites, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating invite rows: %w", err)
+	}
+	return invites, nil
+}
+
+// DeleteInvite withdraws an invite.
+func (s *Service) DeleteInvite(inviteID string) error {
+	result, err := s.db.Exec("DELETE FROM user_invites WHERE id = ?", inviteID)
+	if err != nil {
+		return fmt.Errorf("failed to delete invite: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return errors.New("invite not found")
+	}
+	return nil
+}
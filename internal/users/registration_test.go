@@ -0,0 +1,112 @@
+package users
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+)
+
+func TestRegister(t *testing.T) {
+	s := NewService(metadatatest.NewDB(t))
+
+	t.Run("disabled", func(t *testing.T) {
+		if _, err := s.Register("dave", "dave@corp.example.com", "Correct-horse-1", ""); !errors.Is(err, ErrRegistrationClosed) {
+			t.Errorf("Register = %v, want ErrRegistrationClosed", err)
+		}
+	})
+
+	t.Run("invite", func(t *testing.T) {
+		if err := s.SetRegistrationPolicy(RegistrationPolicy{Mode: RegistrationInvite}); err != nil {
+			t.Fatalf("SetRegistrationPolicy: %v", err)
+		}
+		if _, err := s.Register("dave", "dave@corp.example.com", "Correct-horse-1", ""); err == nil {
+			t.Error("registration without an invite code succeeded")
+		}
+		if _, err := s.Register("dave", "dave@corp.example.com", "Correct-horse-1", "not-a-code"); !errors.Is(err, ErrInvalidInvite) {
+			t.Errorf("unknown code: got %v, want ErrInvalidInvite", err)
+		}
+
+		_, code, err := s.CreateInvite("", models.RoleViewer, "", 0)
+		if err != nil {
+			t.Fatalf("CreateInvite: %v", err)
+		}
+		metadatatest.InsertUser(t, s.db, "taken", "Correct-horse-1")
+		if _, err = s.Register("taken", "taken@corp.example.com", "Correct-horse-1", code); err == nil {
+			t.Fatal("registration with a taken username succeeded")
+		}
+		user, err := s.Register("dave", "dave@corp.example.com", "Correct-horse-1", code)
+		if err != nil {
+			t.Fatalf("Register with the invite released by the failed attempt: %v", err)
+		}
+		if roles, err := s.GetUserRoles(user.ID); err != nil || len(roles) != 1 || roles[0] != models.RoleViewer {
+			t.Errorf("roles = %v (%v), want the invite's role", roles, err)
+		}
+		if _, err = s.Register("mallory", "mallory@corp.example.com", "Correct-horse-1", code); !errors.Is(err, ErrInvalidInvite) {
+			t.Errorf("reused invite: got %v, want ErrInvalidInvite", err)
+		}
+
+		invite, code, err := s.CreateInvite("grace@corp.example.com", "", "", time.Hour)
+		if err != nil {
+			t.Fatalf("CreateInvite: %v", err)
+		}
+		if _, err = s.Register("mallory", "mallory@corp.example.com", "Correct-horse-1", code); err == nil || errors.Is(err, ErrInvalidInvite) {
+			t.Errorf("invite for another address: got %v, want a different e-mail address error", err)
+		}
+		if _, err = s.db.Exec("UPDATE user_invites SET expires_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Minute), invite.ID); err != nil {
+			t.Fatalf("expire invite: %v", err)
+		}
+		if _, err = s.Register("grace", "grace@corp.example.com", "Correct-horse-1", code); !errors.Is(err, ErrInvalidInvite) {
+			t.Errorf("expired invite: got %v, want ErrInvalidInvite", err)
+		}
+
+		invite, code, err = s.CreateInvite("", "", "", 0)
+		if err != nil {
+			t.Fatalf("CreateInvite: %v", err)
+		}
+		if err = s.DeleteInvite(invite.ID); err != nil {
+			t.Fatalf("DeleteInvite: %v", err)
+		}
+		if _, err = s.Register("grace", "grace@corp.example.com", "Correct-horse-1", code); !errors.Is(err, ErrInvalidInvite) {
+			t.Errorf("withdrawn invite: got %v, want ErrInvalidInvite", err)
+		}
+	})
+
+	t.Run("domain", func(t *testing.T) {
+		if err := s.SetRegistrationPolicy(RegistrationPolicy{Mode: RegistrationDomain, AllowedDomains: []string{"corp.example.com"}}); err != nil {
+			t.Fatalf("SetRegistrationPolicy: %v", err)
+		}
+		if _, err := s.Register("eve", "eve@elsewhere.example.com", "Correct-horse-1", ""); err == nil {
+			t.Error("registration outside the allowed domains succeeded")
+		}
+
+		user, err := s.Register("carol", "carol@CORP.example.com", "Correct-horse-1", "")
+		if err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		if user.IsActive {
+			t.Error("domain registration created an active account")
+		}
+		if _, err = s.ValidatePassword("carol", "Correct-horse-1"); !errors.Is(err, ErrUserInactive) {
+			t.Errorf("login before activation = %v, want ErrUserInactive", err)
+		}
+		if err = s.SetUserActive(user.ID, true); err != nil {
+			t.Fatalf("SetUserActive: %v", err)
+		}
+		if _, err = s.ValidatePassword("carol", "Correct-horse-1"); err != nil {
+			t.Errorf("login after activation: %v", err)
+		}
+	})
+
+	t.Run("open", func(t *testing.T) {
+		if err := s.SetRegistrationPolicy(RegistrationPolicy{Mode: RegistrationOpen}); err != nil {
+			t.Fatalf("SetRegistrationPolicy: %v", err)
+		}
+		user, err := s.Register("frank", "frank@elsewhere.example.com", "Correct-horse-1", "")
+		if err != nil || !user.IsActive {
+			t.Errorf("open registration = %+v (%v), want an active account", user, err)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/models"
+)
+
+// UserRepository reads user records. NewSQLUserRepository reads them from the metadata database;
+// other stores can be substituted, e.g. in tests.
+type UserRepository interface {
+	// GetByID returns the user with the given ID.
+	GetByID(id string) (models.User, error)
+	// GetByUsername returns the user with the given username.
+	GetByUsername(username string) (models.User, error)
+	// List returns the users matching filter, ordered by username, without their roles. Limit and
+	// Offset are already normalized by the Service.
+	List(filter models.UserFilter) ([]models.UserSummary, error)
+}
+
+// sqlUserRepository reads the 'users' table. Its queries only use SQL that DuckDB and PostgreSQL
+// both understand.
+type sqlUserRepository struct {
+	db *sql.DB
+}
+
+// NewSQLUserRepository returns a UserRepository on the metadata database.
+func NewSQLUserRepository(db *sql.DB) UserRepository {
+	return &sqlUserRepository{db: db}
+}
+
+func (r *sqlUserRepository) GetByID(id string) (models.User, error) {
+	return r.getUser("id", id)
+}
+
+func (r *sqlUserRepository) GetByUsername(username string) (models.User, error) {
+	return r.getUser("username", username)
+}
+
+// getUser returns the user whose column equals value.
+func (r *sqlUserRepository) getUser(column, value string) (models.User, error) {
+	var user models.User
+	err := r.db.QueryRow(
+		"SELECT id, username, email, password_hash, is_active, created_at, updated_at FROM users WHERE "+column+" = ?",
+		value,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.User{}, errors.New("user not found")
+		}
+		return models.User{}, fmt.Errorf("failed to get user by %s '%s': %w", column, value, err)
+	}
+	return user, nil
+}
+
+func (r *sqlUserRepository) List(filter models.UserFilter) ([]models.UserSummary, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Search != "" {
+		conditions = append(conditions, "(strpos(lower(u.username), lower(?)) > 0 OR strpos(lower(u.email), lower(?)) > 0)")
+		args = append(args, filter.Search, filter.Search)
+	}
+	if filter.Active != nil {
+		conditions = append(conditions, "u.is_active = ?")
+		args = append(args, *filter.Active)
+	}
+
+	query := `
+		SELECT u.id, u.username, u.email, u.password_hash, u.is_active, u.created_at, u.updated_at, sa.user_id IS NOT NULL, COALESCE(m.enabled, FALSE),
+		       CASE WHEN lf.locked_until > ? THEN lf.locked_until END
+		FROM users u
+		LEFT JOIN service_accounts sa ON sa.user_id = u.id
+		LEFT JOIN user_mfa m ON m.user_id = u.id
+		LEFT JOIN login_failures lf ON lf.username = lower(trim(u.username))`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY u.username\n\t\tLIMIT %d OFFSET %d", filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(query, append([]interface{}{time.Now().UTC()}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []models.UserSummary{}
+	for rows.Next() {
+		var summary models.UserSummary
+		u := &summary.User
+		if err = rows.Scan(&u.ID, &u.Username, &u.Email, &u.Password, &u.IsActive, &u.CreatedAt, &u.UpdatedAt, &summary.IsServiceAccount, &summary.MFAEnabled, &summary.LockedUntil); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		summary.HasPassword = u.Password != unusablePasswordHash
+		summaries = append(summaries, summary)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user rows: %w", err)
+	}
+	return summaries, nil
+}
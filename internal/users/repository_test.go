@@ -0,0 +1,88 @@
+package users
+
+import (
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+)
+
+func TestUserRepository(t *testing.T) {
+	for store, open := range metadatatest.Stores {
+		t.Run(store, func(t *testing.T) {
+			testUserRepository(t, NewService(open(t)))
+		})
+	}
+}
+
+func testUserRepository(t *testing.T, s *Service) {
+	user, err := s.AddUser("carol", "carol@example.com", "Correct-horse-1")
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	byName, err := s.GetUserByUsername("carol")
+	if err != nil || byName.ID != user.ID || byName.Email != "carol@example.com" || !byName.IsActive {
+		t.Errorf("GetUserByUsername = %+v (%v), want %+v", byName, err, user)
+	}
+	if byID, err := s.GetUserByID(user.ID); err != nil || byID.Username != "carol" {
+		t.Errorf("GetUserByID = %+v (%v), want carol", byID, err)
+	}
+	if _, err = s.ValidatePassword("carol", "Correct-horse-1"); err != nil {
+		t.Errorf("ValidatePassword: %v", err)
+	}
+	if err = s.UpdateEmail(user.ID, "carol@example.org"); err != nil {
+		t.Fatalf("UpdateEmail: %v", err)
+	}
+	if err = s.SetUserActive(user.ID, false); err != nil {
+		t.Fatalf("SetUserActive: %v", err)
+	}
+	active := false
+	inactive, err := s.ListUsers(models.UserFilter{Active: &active})
+	if err != nil || len(inactive) != 1 || inactive[0].Email != "carol@example.org" {
+		t.Errorf("inactive users = %+v (%v), want carol with the new e-mail address", inactive, err)
+	}
+	if err = s.DeleteUser(user.ID); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err = s.GetUserByID(user.ID); err == nil {
+		t.Error("deleted user still exists")
+	}
+
+	testListUsersSearch(t, s)
+}
+
+func testListUsersSearch(t *testing.T, s *Service) {
+	metadatatest.InsertUser(t, s.db, "Alice_Admin", "password")
+	metadatatest.InsertUser(t, s.db, "aliceXadmin", "password")
+	metadatatest.InsertUser(t, s.db, "bob", "password")
+
+	tests := []struct {
+		search string
+		want   []string
+	}{
+		{"alice", []string{"Alice_Admin", "aliceXadmin"}},
+		{"ALICE_", []string{"Alice_Admin"}},
+		{"%", nil},
+		{"bob@EXAMPLE", []string{"bob"}},
+	}
+	for _, tt := range tests {
+		users, err := s.ListUsers(models.UserFilter{Search: tt.search})
+		if err != nil {
+			t.Fatalf("ListUsers(%q): %v", tt.search, err)
+		}
+		var got []string
+		for _, u := range users {
+			got = append(got, u.Username)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ListUsers(%q) = %v, want %v", tt.search, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ListUsers(%q) = %v, want %v", tt.search, got, tt.want)
+				break
+			}
+		}
+	}
+}
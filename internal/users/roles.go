@@ -0,0 +1,202 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"Bridgo/internal/models"
+)
+
+// ErrRoleNotFound is returned when a role name does not exist in the 'roles' table.
+var ErrRoleNotFound = errors.New("role not found")
+
+// ErrRoleMembersManaged is returned for manual changes to the members of a role whose members are
+// declared in a manifest of the declarative configuration.
+var ErrRoleMembersManaged = errors.New("the members of this role are managed by declarative configuration; change its manifest instead")
+
+// ListRoles returns every role together with the names of the permissions it grants.
+func (s *Service) ListRoles() ([]models.Role, error) {
+	rows, err := s.db.Query(`
+		SELECT r.id, r.role_name, r.description, r.is_system_role, r.created_at, r.updated_at, p.permission_name
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		ORDER BY r.role_name, p.permission_name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		var description, permissionName sql.NullString
+		err = rows.Scan(&role.ID, &role.RoleName, &description, &role.IsSystemRole, &role.CreatedAt, &role.UpdatedAt, &permissionName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+
+		if len(roles) == 0 || roles[len(roles)-1].ID != role.ID {
+			if description.Valid {
+				role.Description = &description.String
+			}
+			roles = append(roles, role)
+		}
+		if permissionName.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permissionName.String)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating role rows: %w", err)
+	}
+
+	return roles, nil
+}
+
+// GetUserRoles returns the names of the roles assigned to a user.
+func (s *Service) GetUserRoles(userID string) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT r.role_name
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = ?
+		ORDER BY r.role_name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles for user %s: %w", userID, err)
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var roleName string
+		if err = rows.Scan(&roleName); err != nil {
+			return nil, fmt.Errorf("failed to scan role name: %w", err)
+		}
+		roles = append(roles, roleName)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user role rows: %w", err)
+	}
+
+	return roles, nil
+}
+
+// AssignRole assigns the named role to a user. Assigning a role the user already has is a no-op.
+func (s *Service) AssignRole(userID, roleName string) error {
+	if _, err := s.GetUserByID(userID); err != nil {
+		return err
+	}
+
+	roleID, err := s.getRoleID(roleName)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check existing role assignment: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = s.db.Exec("INSERT INTO user_roles (user_id, role_id, assigned_at) VALUES (?, ?, ?)", userID, roleID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to assign role '%s': %w", roleName, err)
+	}
+	return nil
+}
+
+// RemoveRole removes the named role from a user.
+// The last active admin cannot lose the admin role, so the instance always stays manageable.
+func (s *Service) RemoveRole(userID, roleName string) error {
+	roleID, err := s.getRoleID(roleName)
+	if err != nil {
+		return err
+	}
+
+	if roleName == models.RoleAdmin {
+		adminCount, err := s.countActiveAdmins(userID)
+		if err != nil {
+			return err
+		}
+		if adminCount == 0 {
+			return errors.New("cannot remove the admin role from the last active admin")
+		}
+	}
+
+	_, err = s.db.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID)
+	if err != nil {
+		return fmt.Errorf("failed to remove role '%s': %w", roleName, err)
+	}
+	return nil
+}
+
+// CheckRoleMembersEditable returns ErrRoleMembersManaged if declarative configuration manages the
+// members of the named role. Only manual assignments are checked; sign-in provisioning is not.
+func (s *Service) CheckRoleMembersEditable(roleName string) error {
+	roleID, err := s.getRoleID(roleName)
+	if err != nil {
+		return err
+	}
+	var count int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM managed_objects WHERE object_type = ? AND object_id = ?", models.ManagedRoleMembers, roleID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check whether role members are managed: %w", err)
+	}
+	if count > 0 {
+		return ErrRoleMembersManaged
+	}
+	return nil
+}
+
+// RolesHavePermission reports whether any of the given roles grants the named permission.
+func (s *Service) RolesHavePermission(roleNames []string, permission string) (bool, error) {
+	if len(roleNames) == 0 {
+		return false, nil
+	}
+
+	placeholders := make([]string, len(roleNames))
+	args := make([]interface{}, len(roleNames)+1)
+	for i, roleName := range roleNames {
+		placeholders[i] = "?"
+		args[i] = roleName
+	}
+	args[len(roleNames)] = permission
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM roles r
+		JOIN role_permissions rp ON rp.role_id = r.id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE r.role_name IN (%s) AND p.permission_name = ?
+	`, strings.Join(placeholders, ","))
+
+	var count int
+	if err := s.db.QueryRow(query, args...).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check permission '%s': %w", permission, err)
+	}
+	return count > 0, nil
+}
+
+// getRoleID looks up the ID of a role by name.
+func (s *Service) getRoleID(roleName string) (string, error) {
+	var roleID string
+	err := s.db.QueryRow("SELECT id FROM roles WHERE role_name = ?", roleName).Scan(&roleID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrRoleNotFound
+		}
+		return "", fmt.Errorf("failed to look up role '%s': %w", roleName, err)
+	}
+	return roleID, nil
+}
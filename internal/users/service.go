@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"Bridgo/internal/models"
@@ -11,20 +12,57 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// userEmailPlaceholderDomain gives users registered without an e-mail a unique placeholder;
+// .invalid is reserved (RFC 2606).
+const userEmailPlaceholderDomain = "@users.invalid"
+
 // Service handles user-related operations using a database.
 type Service struct {
-	db *sql.DB // Database connection pool
+	db    *sql.DB            // Database connection pool
+	users UserRepository     // User records
+	ldap  *ldapAuthenticator // nil unless LDAP authentication is enabled
+
+	registration   RegistrationPolicy // Who may register through Register
+	passwordPolicy PasswordPolicy     // Rules new passwords must satisfy
+	throttle       *loginThrottle     // Backoff and lockout after failed logins
+	mfaPolicy      MFAPolicy          // Roles that must use two-factor authentication
+
+	clientCertUserField string // Certificate field naming the user of a client certificate
 }
 
 // NewService creates and returns a new UserService instance.
 func NewService(db *sql.DB) *Service {
 	return &Service{
-		db: db,
+		db:             db,
+		users:          NewSQLUserRepository(db),
+		passwordPolicy: DefaultPasswordPolicy,
+		throttle:       newLoginThrottle(DefaultLoginThrottleConfig),
+
+		clientCertUserField: ClientCertUserCommonName,
 	}
 }
 
-// AddUser adds a new user to the DuckDB database.
+// AddUser adds a new user with the default role to the DuckDB database.
 func (s *Service) AddUser(username, email, password string) (models.User, error) {
+	return s.addUser(username, email, password, models.DefaultUserRole, true)
+}
+
+// addUser adds a new user with the named role, active or awaiting activation by an admin. Users
+// without an e-mail get a unique placeholder, since e-mails must be unique.
+func (s *Service) addUser(username, email, password, roleName string, active bool) (models.User, error) {
+	if username == "" || password == "" {
+		return models.User{}, errors.New("username and password are required")
+	}
+	if email == "" {
+		email = strings.ToLower(username) + userEmailPlaceholderDomain
+	}
+	if err := s.checkPassword(username, password); err != nil {
+		return models.User{}, err
+	}
+	if _, err := s.getRoleID(roleName); err != nil {
+		return models.User{}, err
+	}
+
 	// Check if username or email already exists
 	var existingUserID string
 	err := s.db.QueryRow("SELECT id FROM users WHERE username = ? OR email = ? LIMIT 1", username, email).Scan(&existingUserID)
@@ -54,7 +92,7 @@ func (s *Service) AddUser(username, email, password string) (models.User, error)
 		Username: username,
 		Email:    email,
 		Password: string(hashedPassword), // This is the hash
-		IsActive: true,                   // New users are active by default
+		IsActive: active,
 		CreatedAt: now,                  // Set Go time, DB will also set its default
 		UpdatedAt: now,
 	}
@@ -67,59 +105,32 @@ func (s *Service) AddUser(username, email, password string) (models.User, error)
 		return models.User{}, fmt.Errorf("failed to insert user: %w", err)
 	}
 
+	if err = s.AssignRole(newUser.ID, roleName); err != nil {
+		return models.User{}, fmt.Errorf("failed to assign role: %w", err)
+	}
+
 	// Return the user object as it was prepared for insertion (or fetch from DB for full accuracy)
 	// For now, returning newUser is sufficient as DB defaults match what we set.
 	return newUser, nil
 }
 
-// GetUserByUsername retrieves a user by their username from DuckDB.
+// GetUserByUsername retrieves a user by their username.
 func (s *Service) GetUserByUsername(username string) (models.User, error) {
-	var user models.User
-	var createdAtStr, updatedAtStr string // Read as string then parse
-
-	err := s.db.QueryRow(
-		"SELECT id, username, email, password_hash, is_active, created_at, updated_at FROM users WHERE username = ?",
-		username,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.IsActive, &createdAtStr, &updatedAtStr)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return models.User{}, errors.New("user not found")
-		}
-		return models.User{}, fmt.Errorf("failed to get user by username '%s': %w", username, err)
-	}
-
-	// Attempt to parse timestamps (example, adjust format if needed)
-	user.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAtStr) // Or other appropriate format DuckDB uses
-	user.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updatedAtStr)
-
-	return user, nil
+	return s.users.GetByUsername(username)
 }
 
-// GetUserByID retrieves a user by their ID from DuckDB.
+// GetUserByID retrieves a user by their ID.
 func (s *Service) GetUserByID(id string) (models.User, error) {
-	var user models.User
-	var createdAtStr, updatedAtStr string
-
-	err := s.db.QueryRow(
-		"SELECT id, username, email, password_hash, is_active, created_at, updated_at FROM users WHERE id = ?",
-		id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.IsActive, &createdAtStr, &updatedAtStr)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return models.User{}, errors.New("user not found")
-		}
-		return models.User{}, fmt.Errorf("failed to get user by id '%s': %w", id, err)
-	}
-	user.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAtStr)
-	user.UpdatedAt, _ = time.Parse(time.RFC3339Nano, updatedAtStr)
-	return user, nil
+	return s.users.GetByID(id)
 }
 
 // ValidatePassword checks if the provided password matches the stored hashed password in DuckDB.
 func (s *Service) ValidatePassword(username, password string) (models.User, error) {
 	user, err := s.GetUserByUsername(username)
+	// Users without a local password authenticate against the directory, if one is configured
+	if s.ldap != nil && (err != nil || s.isExternalUser(user)) {
+		return s.validateLDAPPassword(username, password)
+	}
 	if err != nil {
 		return models.User{}, err // User not found or other DB error
 	}
@@ -128,5 +139,8 @@ func (s *Service) ValidatePassword(username, password string) (models.User, erro
 	if err != nil {
 		return models.User{}, errors.New("invalid password") // Password does not match
 	}
+	if !user.IsActive {
+		return models.User{}, ErrUserInactive
+	}
 	return user, nil // Validation successful
 }
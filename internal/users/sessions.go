@@ -0,0 +1,268 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"Bridgo/internal/auth"
+
+	"github.com/google/uuid"
+)
+
+// RefreshTokenTTL is how long a refresh token can be exchanged for a new token pair.
+// It is set from the configuration at startup.
+var RefreshTokenTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrUserInactive is returned when a deactivated user logs in or uses an existing session.
+	ErrUserInactive = errors.New("user account is deactivated")
+	// ErrTokenRevoked is returned for access tokens revoked individually or per user.
+	ErrTokenRevoked = errors.New("token has been revoked")
+	// ErrRolesChanged is returned for access tokens issued before the user's roles changed; a
+	// refreshed token carries the current roles.
+	ErrRolesChanged = errors.New("roles have changed since the token was issued; refresh it")
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+	// The whole token family is revoked, since the token has most likely been stolen.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected; session revoked")
+)
+
+// hashToken returns the hex SHA-256 of a refresh token, as stored in refresh_tokens.token_hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckSession implements auth.SessionChecker: the user must still exist and be active, the
+// token must not have been revoked on its own or by revoking all of the user's sessions, and the
+// roles it carries must still be the user's roles, so removed roles stop working at once.
+func (s *Service) CheckSession(claims *auth.Claims) error {
+	var isActive, revoked bool
+	var revokedBefore sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT u.is_active,
+		       EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?),
+		       (SELECT revoked_before FROM user_token_revocations WHERE user_id = u.id)
+		FROM users u
+		WHERE u.id = ?
+	`, claims.ID, claims.UserID).Scan(&isActive, &revoked, &revokedBefore)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("user not found")
+		}
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+
+	if !isActive {
+		return ErrUserInactive
+	}
+	if revoked || claims.ID == "" {
+		return ErrTokenRevoked
+	}
+	if revokedBefore.Valid && (claims.IssuedAt == nil || !claims.IssuedAt.Time.After(revokedBefore.Time)) {
+		return ErrTokenRevoked
+	}
+
+	roles, err := s.GetUserRoles(claims.UserID)
+	if err != nil {
+		return err
+	}
+	if !sameRoles(roles, claims.Roles) {
+		return ErrRolesChanged
+	}
+	return nil
+}
+
+// sameRoles reports whether two lists hold the same role names, in any order.
+func sameRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, role := range a {
+		if !containsRole(b, role) {
+			return false
+		}
+	}
+	return true
+}
+
+// IssueRefreshToken creates a refresh token starting a new token family (a new login).
+func (s *Service) IssueRefreshToken(userID, ipAddress, userAgent string) (string, error) {
+	return s.insertRefreshToken(s.db, userID, uuid.NewString(), ipAddress, userAgent)
+}
+
+// dbExecer is implemented by both *sql.DB and *sql.Tx.
+type dbExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertRefreshToken stores a new random refresh token in a token family and returns it.
+func (s *Service) insertRefreshToken(db dbExecer, userID, familyID, ipAddress, userAgent string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	now := time.Now().UTC()
+	_, err := db.Exec(`
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, issued_at, expires_at, ip_address, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, uuid.NewString(), userID, familyID, hashToken(token), now, now.Add(RefreshTokenTTL), ipAddress, userAgent)
+	if err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same family and returns the
+// user it belongs to. Each refresh token can be used once; presenting a used one again revokes
+// the whole family.
+func (s *Service) RotateRefreshToken(token, ipAddress, userAgent string) (string, string, error) {
+	var id, userID, familyID string
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err := s.db.QueryRow(
+		"SELECT id, user_id, family_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?",
+		hashToken(token),
+	).Scan(&id, &userID, &familyID, &expiresAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", ErrInvalidRefreshToken
+		}
+		return "", "", fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+
+	if revokedAt.Valid {
+		if err = s.revokeTokenFamily(familyID); err != nil {
+			return "", "", err
+		}
+		return userID, "", ErrRefreshTokenReused
+	}
+	if !expiresAt.After(time.Now().UTC()) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if !user.IsActive {
+		return "", "", ErrUserInactive
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only one concurrent rotation of the same token can win
+	result, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), id)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	newToken, err := s.insertRefreshToken(tx, userID, familyID, ipAddress, userAgent)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err = tx.Exec("UPDATE refresh_tokens SET replaced_by_id = (SELECT id FROM refresh_tokens WHERE token_hash = ?) WHERE id = ?", hashToken(newToken), id); err != nil {
+		return "", "", fmt.Errorf("failed to link rotated refresh token: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", "", fmt.Errorf("failed to commit refresh token rotation: %w", err)
+	}
+	return userID, newToken, nil
+}
+
+// revokeTokenFamily revokes every refresh token rotated from the same login.
+func (s *Service) revokeTokenFamily(familyID string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", time.Now().UTC(), familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshToken ends the session a refresh token belongs to. Only the token's own user may revoke it.
+func (s *Service) RevokeRefreshToken(token, userID string) error {
+	var familyID string
+	err := s.db.QueryRow("SELECT family_id FROM refresh_tokens WHERE token_hash = ? AND user_id = ?", hashToken(token), userID).Scan(&familyID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidRefreshToken
+		}
+		return fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+	return s.revokeTokenFamily(familyID)
+}
+
+// RevokeAccessToken rejects a single access token (by its jti) until it expires.
+func (s *Service) RevokeAccessToken(claims *auth.Claims) error {
+	now := time.Now().UTC()
+	expiresAt := now.Add(auth.AccessTokenTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	// Entries are only needed until the token would have expired anyway
+	if _, err := s.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", now); err != nil {
+		return fmt.Errorf("failed to purge revoked tokens: %w", err)
+	}
+
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?", claims.ID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check revoked token: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := s.db.Exec("INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at) VALUES (?, ?, ?, ?)", claims.ID, claims.UserID, expiresAt, now)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllUserTokens ends every session of a user: all refresh tokens and API keys are revoked
+// and every access token issued so far is rejected.
+func (s *Service) RevokeAllUserTokens(userID string) error {
+	if _, err := s.GetUserByID(userID); err != nil {
+		return err
+	}
+
+	// Matches the millisecond precision of token iat claims
+	revokedBefore := time.Now().UTC().Truncate(time.Millisecond)
+
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM user_token_revocations WHERE user_id = ?", userID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if count > 0 {
+		_, err = s.db.Exec("UPDATE user_token_revocations SET revoked_before = ? WHERE user_id = ?", revokedBefore, userID)
+	} else {
+		_, err = s.db.Exec("INSERT INTO user_token_revocations (user_id, revoked_before) VALUES (?, ?)", userID, revokedBefore)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+
+	_, err = s.db.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return s.revokeUserAPIKeys(userID)
+}
@@ -0,0 +1,46 @@
+package users
+
+import (
+	"errors"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+)
+
+func TestRotateRefreshTokenDetectsReuse(t *testing.T) {
+	s := NewService(metadatatest.NewDB(t))
+	userID := metadatatest.InsertUser(t, s.db, "alice", "Correct-horse-1")
+
+	first, err := s.IssueRefreshToken(userID, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken: %v", err)
+	}
+	otherLogin, err := s.IssueRefreshToken(userID, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("IssueRefreshToken: %v", err)
+	}
+
+	gotUser, second, err := s.RotateRefreshToken(first, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("first rotation: %v", err)
+	}
+	if gotUser != userID || second == "" || second == first {
+		t.Fatalf("first rotation returned user %q and token %q", gotUser, second)
+	}
+
+	// Replaying the rotated token revokes the family, including the token it was exchanged for
+	if _, _, err = s.RotateRefreshToken(first, "127.0.0.1", "test"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replayed token: got %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err = s.RotateRefreshToken(second, "127.0.0.1", "test"); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("token of the revoked family: got %v, want ErrRefreshTokenReused", err)
+	}
+
+	// Other logins of the same user are not affected
+	if _, _, err = s.RotateRefreshToken(otherLogin, "127.0.0.1", "test"); err != nil {
+		t.Fatalf("token of another family: %v", err)
+	}
+	if _, _, err = s.RotateRefreshToken("unknown", "127.0.0.1", "test"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("unknown token: got %v, want ErrInvalidRefreshToken", err)
+	}
+}
@@ -0,0 +1,197 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+	"Bridgo/internal/users"
+)
+
+// apiKeysAPIHandler lists (GET), creates (POST) or revokes (DELETE) API keys. Users manage their
+// own keys; managing the keys of service accounts (and revoking anyone's) requires user.manage.
+// API keys cannot be used to manage API keys.
+func (h *HandlerDependencies) apiKeysAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+	if rejectAPIKey(w, claims) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			userID = claims.UserID
+		}
+		if userID != claims.UserID && !h.hasPermission(w, claims, models.PermUserManage) {
+			return
+		}
+
+		keys, err := h.UserService.ListAPIKeys(userID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve API keys: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":  true,
+			"user_id":  userID,
+			"api_keys": keys,
+		})
+
+	case http.MethodPost:
+		var input models.CreateAPIKeyInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		input.CreatedByUserID = claims.UserID
+		if input.UserID != "" && input.UserID != claims.UserID && !h.hasPermission(w, claims, models.PermUserManage) {
+			return
+		}
+
+		apiKey, key, err := h.UserService.CreateAPIKey(input)
+		h.audit(r, models.AuditAPIKeyCreate, apiKey.ID, map[string]interface{}{
+			"name":    input.Name,
+			"user_id": input.UserID,
+			"scopes":  input.Scopes,
+			"success": err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to create API key: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"message": "API key created. Store the key now; it cannot be retrieved again.",
+			"api_key": apiKey,
+			"key":     key,
+		})
+
+	case http.MethodDelete:
+		var request struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.ID == "" {
+			writeJSONError(w, http.StatusBadRequest, "id is required")
+			return
+		}
+
+		apiKey, err := h.UserService.GetAPIKey(request.ID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, users.ErrAPIKeyNotFound) {
+				status = http.StatusNotFound
+			}
+			writeJSONError(w, status, "Failed to revoke API key: "+err.Error())
+			return
+		}
+		if apiKey.UserID != claims.UserID && !h.hasPermission(w, claims, models.PermUserManage) {
+			return
+		}
+
+		err = h.UserService.RevokeAPIKey(apiKey.ID)
+		h.audit(r, models.AuditAPIKeyRevoke, apiKey.ID, map[string]interface{}{"user_id": apiKey.UserID, "success": err == nil})
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to revoke API key: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "API key revoked successfully",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// serviceAccountsAPIHandler lists (GET), creates (POST) or disables (DELETE) service accounts:
+// non-human users for scripts and scheduled jobs, which authenticate with API keys only.
+func (h *HandlerDependencies) serviceAccountsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		accounts, err := h.UserService.ListServiceAccounts()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve service accounts: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":          true,
+			"service_accounts": accounts,
+		})
+
+	case http.MethodPost:
+		claims, _ := auth.GetUserClaimsFromContext(r.Context())
+		var request struct {
+			Username    string `json:"username"`
+			Description string `json:"description"`
+			RoleName    string `json:"role_name"` // Defaults to viewer
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+
+		account, err := h.UserService.CreateServiceAccount(request.Username, request.Description, request.RoleName, claims.UserID)
+		h.audit(r, models.AuditServiceAccountCreate, account.UserID, map[string]interface{}{
+			"username":  request.Username,
+			"role_name": request.RoleName,
+			"success":   err == nil,
+		})
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, users.ErrRoleNotFound) {
+				status = http.StatusNotFound
+			}
+			writeJSONError(w, status, "Failed to create service account: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success":         true,
+			"service_account": account,
+		})
+
+	case http.MethodDelete:
+		var request struct {
+			UserID string `json:"user_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.UserID == "" {
+			writeJSONError(w, http.StatusBadRequest, "user_id is required")
+			return
+		}
+
+		err := h.UserService.DisableServiceAccount(request.UserID)
+		h.audit(r, models.AuditServiceAccountDisable, request.UserID, map[string]interface{}{"success": err == nil})
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to disable service account: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Service account disabled and its API keys revoked",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
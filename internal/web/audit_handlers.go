@@ -0,0 +1,204 @@
+package web
+
+import (
+	"encoding/csv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+)
+
+// clientIP returns the address of the client that sent the request. Behind trusted proxies it is
+// taken from X-Forwarded-For, or else Forwarded: the nearest hop that is not a trusted proxy.
+// The headers are ignored when the request does not come from a trusted proxy, since any client
+// can send them.
+func (h *HandlerDependencies) clientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !h.trustedProxy(peer) {
+		return peer
+	}
+
+	hops := forwardedFor(r.Header)
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		client = hops[i]
+		if !h.trustedProxy(client) {
+			break
+		}
+	}
+	return client
+}
+
+// trustedProxy reports whether addr is one of the configured trusted proxies.
+func (h *HandlerDependencies) trustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the client addresses proxies appended to X-Forwarded-For, or else to the
+// for parameters of Forwarded (RFC 7239), nearest proxy last.
+func forwardedFor(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+
+	for _, value := range header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				name, forValue, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hop = strings.Trim(forValue, `"`)
+				}
+			}
+			// IPv6 addresses are bracketed, and either kind may carry a port
+			if host, _, err := net.SplitHostPort(hop); err == nil {
+				hop = host
+			}
+			hops = append(hops, strings.Trim(hop, "[]"))
+		}
+	}
+	return hops
+}
+
+// audit records an action performed by the authenticated caller of r.
+func (h *HandlerDependencies) audit(r *http.Request, actionType, targetID string, details map[string]interface{}) {
+	userID := ""
+	if claims, ok := auth.GetUserClaimsFromContext(r.Context()); ok && claims != nil {
+		userID = claims.UserID
+	}
+	h.AuditService.Record(userID, actionType, targetID, details, h.clientIP(r))
+}
+
+// auditLogsAPIHandler searches the audit log. Supported query parameters:
+// user_id, action_type (exact, or a prefix ending in "."), target_id, ip, q (details substring),
+// from and to (RFC 3339), limit, offset and format ("json" or "csv").
+func (h *HandlerDependencies) auditLogsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.AuditLogFilter{
+		UserID:           query.Get("user_id"),
+		ActionType:       query.Get("action_type"),
+		TargetResourceID: query.Get("target_id"),
+		IPAddress:        query.Get("ip"),
+		Search:           query.Get("q"),
+	}
+
+	var err error
+	for name, dest := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			if *dest, err = time.Parse(time.RFC3339, value); err != nil {
+				writeJSONError(w, http.StatusBadRequest, name+" must be an RFC 3339 timestamp")
+				return
+			}
+		}
+	}
+	for name, dest := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if value := query.Get(name); value != "" {
+			if *dest, err = strconv.Atoi(value); err != nil {
+				writeJSONError(w, http.StatusBadRequest, name+" must be an integer")
+				return
+			}
+		}
+	}
+
+	entries, err := h.AuditService.Search(filter)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to search audit logs: "+err.Error())
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"entries": entries,
+		})
+	case "csv":
+		h.audit(r, models.AuditLogExport, "", map[string]interface{}{"query": r.URL.RawQuery, "entries": len(entries)})
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="bridgo_audit_log.csv"`)
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"timestamp", "user_id", "username", "action_type", "target_resource_id", "ip_address", "details"})
+		for _, entry := range entries {
+			writer.Write([]string{
+				entry.Timestamp.Format(time.RFC3339Nano),
+				deref(entry.UserID),
+				deref(entry.Username),
+				entry.ActionType,
+				deref(entry.TargetResourceID),
+				deref(entry.IPAddress),
+				deref(entry.Details),
+			})
+		}
+		writer.Flush()
+	default:
+		writeJSONError(w, http.StatusBadRequest, "format must be json or csv")
+	}
+}
+
+// deref returns the pointed-to string, or "" for nil.
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// auditViewQuery records a query run against a data source through a view, together with the
+// use of the data source's stored credentials it required.
+func (h *HandlerDependencies) auditViewQuery(r *http.Request, viewType, viewID string, result map[string]interface{}, started time.Time, err error) {
+	details := map[string]interface{}{
+		"view_type":   viewType,
+		"view_id":     viewID,
+		"duration_ms": time.Since(started).Milliseconds(),
+	}
+	dataSourceID := ""
+	if result != nil {
+		dataSourceID, _ = result["data_source_id"].(string)
+		details["query"] = result["query"]
+		switch rows := result["rows"].(type) {
+		case []map[string]interface{}:
+			details["row_count"] = len(rows)
+		case [][]interface{}:
+			details["row_count"] = len(rows)
+		}
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+
+	if dataSourceID != "" {
+		h.audit(r, models.AuditCredentialAccess, dataSourceID, map[string]interface{}{"view_type": viewType, "view_id": viewID})
+	}
+	h.audit(r, models.AuditQueryExecute, dataSourceID, details)
+}
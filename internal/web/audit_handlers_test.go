@@ -0,0 +1,168 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/core"
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	h := &HandlerDependencies{TrustedProxies: []*net.IPNet{proxies}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string]string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer forging the header", "203.0.113.7:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"client prepending a forged hop", "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "192.0.2.99, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"only trusted hops", "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "10.0.0.4, 10.0.0.3"}, "10.0.0.4"},
+		{"garbage hop", "10.0.0.2:5000", map[string]string{"X-Forwarded-For": "198.51.100.1, unknown"}, "10.0.0.2"},
+		{"trusted proxy without header", "10.0.0.2:5000", nil, "10.0.0.2"},
+		{"forwarded", "10.0.0.2:5000", map[string]string{"Forwarded": `for=192.0.2.60;proto=https, for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+		{"forwarded from untrusted peer", "203.0.113.7:5000", map[string]string{"Forwarded": "for=192.0.2.60"}, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/me", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.header {
+				r.Header.Set(name, value)
+			}
+			if got := h.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataSourceChangesAreAudited(t *testing.T) {
+	h, db := newTestHandlers(t)
+	h.CoreService = core.NewCoreService(db)
+	ownerID := metadatatest.InsertUser(t, db, "admin", "Correct-horse-1")
+	claims := &auth.Claims{UserID: ownerID, Username: "admin", Roles: []string{models.RoleAdmin}}
+	asOwner := func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), auth.UserContextKey, claims))
+	}
+	audited := func(action, targetID string) int {
+		t.Helper()
+		entries, err := h.AuditService.Search(models.AuditLogFilter{ActionType: action, TargetResourceID: targetID})
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		return len(entries)
+	}
+
+	t.Run("bundle import overwrite", func(t *testing.T) {
+		dataSourceID := metadatatest.InsertDataSource(t, db, ownerID, "imported")
+		bundle := "kind: BridgoBundle\nversion: 1\ndata_sources:\n  - name: imported\n    db_type: postgresql\n    host: db.example.com\n"
+		rec := httptest.NewRecorder()
+		h.bundleImportAPIHandler(rec, asOwner(httptest.NewRequest(http.MethodPost, "/api/bundles/import?on_conflict=overwrite", strings.NewReader(bundle))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("import answered %d: %s", rec.Code, rec.Body)
+		}
+		if n := audited(models.AuditDataSourceUpdate, dataSourceID); n != 1 {
+			t.Errorf("%d datasource.update entries for the overwritten data source, want 1", n)
+		}
+	})
+
+	t.Run("gitops reconcile", func(t *testing.T) {
+		dir := t.TempDir()
+		manifest := filepath.Join(dir, "sources.yaml")
+		write := func(content string) {
+			t.Helper()
+			if err := os.WriteFile(manifest, []byte(content), 0o600); err != nil {
+				t.Fatalf("write manifest: %v", err)
+			}
+		}
+		reconcile := func() models.ReconcileResult {
+			t.Helper()
+			rec := httptest.NewRecorder()
+			h.gitOpsReconcileAPIHandler(rec, asOwner(httptest.NewRequest(http.MethodPost, "/api/gitops/reconcile", nil)))
+			var body struct {
+				Result models.ReconcileResult `json:"result"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || !body.Result.Applied {
+				t.Fatalf("reconcile answered %d, result %+v (%v)", rec.Code, body.Result, err)
+			}
+			return body.Result
+		}
+		h.Reconciler = core.NewReconcileService(db, core.GitOpsConfig{Dir: dir, Interval: time.Hour, Owner: "admin", Prune: true})
+
+		write("kind: BridgoBundle\nversion: 1\ndata_sources:\n  - name: managed\n    db_type: postgresql\n    host: a.example.com\n")
+		dataSourceID := reconcile().Plan.Changes[0].ID
+		if n := audited(models.AuditDataSourceCreate, dataSourceID); n != 1 {
+			t.Errorf("%d datasource.create entries for the declared data source, want 1", n)
+		}
+		write("kind: BridgoBundle\nversion: 1\ndata_sources:\n  - name: managed\n    db_type: postgresql\n    host: b.example.com\n")
+		reconcile()
+		if n := audited(models.AuditDataSourceUpdate, dataSourceID); n != 1 {
+			t.Errorf("%d datasource.update entries for the changed data source, want 1", n)
+		}
+		write("kind: BridgoBundle\nversion: 1\n")
+		reconcile()
+		if n := audited(models.AuditDataSourceDelete, dataSourceID); n != 1 {
+			t.Errorf("%d datasource.delete entries for the pruned data source, want 1", n)
+		}
+
+		// Scheduled runs have no request, but are audited the same way
+		h.Reconciler.OnScheduledApply(h.AuditScheduledReconcile)
+		write("kind: BridgoBundle\nversion: 1\ndata_sources:\n  - name: scheduled\n    db_type: postgresql\n")
+		stop := make(chan struct{})
+		close(stop)
+		h.Reconciler.Run(stop)
+		if n := audited(models.AuditDataSourceCreate, h.Reconciler.LastResult().Plan.Changes[0].ID); n != 1 {
+			t.Errorf("%d datasource.create entries for the data source of a scheduled run, want 1", n)
+		}
+	})
+}
+
+func TestLoginIsAudited(t *testing.T) {
+	h, db := newTestHandlers(t)
+	userID := metadatatest.InsertUser(t, db, "alice", "Correct-horse-1")
+	login := func(password string) int {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"username": "alice", "password": password})
+		r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(string(body)))
+		r.RemoteAddr = "203.0.113.7:5000"
+		rec := httptest.NewRecorder()
+		h.loginAPIHandler(rec, r)
+		return rec.Code
+	}
+
+	if code := login("wrong-password"); code != http.StatusUnauthorized {
+		t.Fatalf("login with a wrong password answered %d, want 401", code)
+	}
+	failures, err := h.AuditService.Search(models.AuditLogFilter{ActionType: models.AuditLoginFailure, Search: `"username":"alice"`})
+	if err != nil || len(failures) != 1 {
+		t.Fatalf("%d login failure entries (%v), want 1", len(failures), err)
+	}
+	if failures[0].IPAddress == nil || *failures[0].IPAddress != "203.0.113.7" {
+		t.Errorf("login failure recorded from %v, want 203.0.113.7", failures[0].IPAddress)
+	}
+
+	if code := login("Correct-horse-1"); code != http.StatusOK {
+		t.Fatalf("login answered %d, want 200", code)
+	}
+	successes, err := h.AuditService.Search(models.AuditLogFilter{ActionType: models.AuditLoginSuccess, TargetResourceID: userID})
+	if err != nil || len(successes) != 1 {
+		t.Errorf("%d login success entries (%v), want 1", len(successes), err)
+	}
+}
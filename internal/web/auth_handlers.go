@@ -2,10 +2,15 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+	"Bridgo/internal/users"
 )
 
 // registerAPIHandler handles new user registration.
@@ -16,34 +21,43 @@ func (h *HandlerDependencies) registerAPIHandler(w http.ResponseWriter, r *http.
 	}
 
 	var creds struct {
-		Username string `json:"username"`
-		Email    string `json:"email"` // Optional, but good to have
-		Password string `json:"password"`
+		Username   string `json:"username"`
+		Email      string `json:"email"` // Optional, but good to have
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"` // Required when registration is invite-only
 	}
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if creds.Username == "" || creds.Password == "" {
-		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Username and password are required")
 		return
 	}
 
-	// Use the injected UserService
-	user, err := h.UserService.AddUser(creds.Username, creds.Email, creds.Password)
+	// Use the injected UserService; the registration policy decides who may register
+	user, err := h.UserService.Register(creds.Username, creds.Email, creds.Password, creds.InviteCode)
 	if err != nil {
-		// Check if the error is due to username already existing
-		if err.Error() == "username already exists" { // This check could be more robust
-			http.Error(w, "Username already taken", http.StatusConflict)
-		} else {
-			http.Error(w, "Failed to register user: "+err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, users.ErrRegistrationClosed):
+			writeJSONError(w, http.StatusForbidden, "Registration is disabled; ask an administrator for an account")
+		case err.Error() == "username already exists": // This check could be more robust
+			writeJSONError(w, http.StatusConflict, "Username already taken")
+		default:
+			writeJSONError(w, http.StatusBadRequest, "Failed to register user: "+err.Error())
 		}
 		return
 	}
 
+	h.AuditService.Record(user.ID, models.AuditRegister, user.ID, map[string]interface{}{"username": user.Username, "invite": creds.InviteCode != "", "active": user.IsActive}, h.clientIP(r))
+
+	message := "User registered successfully"
+	if !user.IsActive {
+		message = "User registered; an administrator must activate the account before you can log in"
+	}
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully", "userID": user.ID})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": message, "userID": user.ID, "active": user.IsActive})
 }
 
 // loginAPIHandler handles user login.
@@ -54,8 +68,10 @@ func (h *HandlerDependencies) loginAPIHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	var creds struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		NewPassword string `json:"new_password"` // Only when the password must be changed
+		MFACode     string `json:"mfa_code"`     // TOTP or recovery code, when two-factor authentication is on
 	}
 	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -67,32 +83,340 @@ func (h *HandlerDependencies) loginAPIHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Repeated failures for the account or from the client address have to wait before the password is checked
+	ip := h.clientIP(r)
+	if err := h.UserService.CheckLoginAllowed(creds.Username, ip); err != nil {
+		var throttled *users.LoginThrottledError
+		if !errors.As(err, &throttled) {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to check failed logins")
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		writeJSONError(w, http.StatusTooManyRequests, "Login temporarily blocked: "+throttled.Error())
+		return
+	}
+
 	// Use the injected UserService
 	user, err := h.UserService.ValidatePassword(creds.Username, creds.Password)
 	if err != nil {
 		// Differentiate between "user not found" and "invalid password"
 		// For security, often a generic message is better for login failures.
+		h.recordLoginFailure(creds.Username, "", err.Error(), ip)
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
+	// Users with a temporary or default password must choose a new one before they get a session.
+	// The new password is checked before the second factor uses up a one-time code, and only
+	// applied after it.
+	mustChange, err := h.UserService.PasswordChangeRequired(user.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to check account status")
+		return
+	}
+	if mustChange {
+		if creds.NewPassword == "" {
+			writeJSON(w, http.StatusForbidden, map[string]interface{}{
+				"success":                  false,
+				"password_change_required": true,
+				"message":                  "You must choose a new password",
+			})
+			return
+		}
+		if err = h.UserService.CheckPasswordChange(user.ID, creds.Password, creds.NewPassword); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to change password: "+err.Error())
+			return
+		}
+	}
+
+	// The second factor comes before anything else a password alone would allow
+	recoveryCodes, mfaMethod, ok := h.checkLoginMFA(w, user, creds.MFACode, ip)
+	if !ok {
+		return
+	}
+	if err = h.UserService.RecordLoginSuccess(user.Username); err != nil {
+		log.Printf("Failed to clear failed logins for '%s': %v", user.Username, err)
+	}
+
+	if mustChange {
+		err = h.UserService.ChangePassword(user.ID, creds.Password, creds.NewPassword)
+		h.AuditService.Record(user.ID, models.AuditPasswordChange, user.ID, map[string]interface{}{"required": true, "success": err == nil}, ip)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to change password: "+err.Error())
+			return
+		}
+	}
+
 	// Debug: Log the user information during login
 	log.Printf("User login successful - Username: %s, UserID: %s", user.Username, user.ID)
 
 	// Generate JWT token
-	tokenString, err := auth.GenerateJWT(user.Username, user.ID)
+	tokenString, refreshToken, roles, err := h.issueTokens(r, user)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
 	log.Printf("JWT token generated for user: %s", user.Username)
+	h.AuditService.Record(user.ID, models.AuditLoginSuccess, user.ID, map[string]interface{}{"username": user.Username, "mfa": mfaMethod}, ip)
 
+	response := map[string]interface{}{
+		"message":       "Login successful",
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenTTL.Seconds()),
+		"userID":        user.ID,
+		"roles":         roles,
+	}
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes // Enrolled during this login; shown only once
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Login successful",
-		"token":   tokenString,
+	json.NewEncoder(w).Encode(response)
+}
+
+// recordLoginFailure audits a failed login and counts it towards backoff and lockout, auditing
+// the lockout too if this failure caused it.
+func (h *HandlerDependencies) recordLoginFailure(username, userID, reason, ip string) {
+	h.AuditService.Record("", models.AuditLoginFailure, userID, map[string]interface{}{"username": username, "reason": reason}, ip)
+	lockedUntil, err := h.UserService.RecordLoginFailure(username, ip)
+	if err != nil {
+		log.Printf("Failed to record failed login for '%s': %v", username, err)
+	}
+	if lockedUntil != nil {
+		if userID == "" {
+			if lockedUser, lookupErr := h.UserService.GetUserByUsername(username); lookupErr == nil {
+				userID = lockedUser.ID
+			}
+		}
+		h.AuditService.Record("", models.AuditAccountLocked, userID, map[string]interface{}{"username": username, "locked_until": lockedUntil}, ip)
+	}
+}
+
+// setupAPIHandler creates the first admin with the one-time setup token printed at startup. It
+// only works while no active admin exists.
+func (h *HandlerDependencies) setupAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var request struct {
+		SetupToken string `json:"setup_token"`
+		Username   string `json:"username"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.SetupToken == "" || request.Username == "" || request.Password == "" {
+		writeJSONError(w, http.StatusBadRequest, "setup_token, username and password are required")
+		return
+	}
+
+	user, err := h.UserService.CompleteSetup(request.SetupToken, request.Username, request.Email, request.Password)
+	if err != nil {
+		h.AuditService.Record("", models.AuditSetupComplete, "", map[string]interface{}{"username": request.Username, "success": false, "reason": err.Error()}, h.clientIP(r))
+		status := http.StatusBadRequest
+		if errors.Is(err, users.ErrSetupComplete) {
+			status = http.StatusConflict
+		}
+		writeJSONError(w, status, "Setup failed: "+err.Error())
+		return
+	}
+
+	log.Printf("First admin '%s' created through setup", user.Username)
+	h.AuditService.Record(user.ID, models.AuditSetupComplete, user.ID, map[string]interface{}{"username": user.Username, "success": true}, h.clientIP(r))
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"message": "Admin account created; you can now log in",
 		"userID":  user.ID,
 	})
 }
+
+// issueTokens starts a session for a user who has just signed in: it returns an access token
+// carrying the user's roles and a refresh token.
+func (h *HandlerDependencies) issueTokens(r *http.Request, user models.User) (string, string, []string, error) {
+	roles, err := h.UserService.GetUserRoles(user.ID)
+	if err != nil {
+		return "", "", nil, err
+	}
+	tokenString, err := auth.GenerateJWT(user.Username, user.ID, roles)
+	if err != nil {
+		return "", "", nil, err
+	}
+	refreshToken, err := h.UserService.IssueRefreshToken(user.ID, h.clientIP(r), r.UserAgent())
+	if err != nil {
+		return "", "", nil, err
+	}
+	return tokenString, refreshToken, roles, nil
+}
+
+// refreshTokenAPIHandler exchanges a refresh token for a new access token and refresh token.
+// The presented refresh token is used up; the roles in the new access token are reloaded.
+func (h *HandlerDependencies) refreshTokenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.RefreshToken == "" {
+		writeJSONError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	userID, refreshToken, err := h.UserService.RotateRefreshToken(request.RefreshToken, h.clientIP(r), r.UserAgent())
+	if err != nil {
+		if errors.Is(err, users.ErrRefreshTokenReused) {
+			h.AuditService.Record(userID, models.AuditTokenRevoke, userID, map[string]interface{}{"reason": "refresh token reuse"}, h.clientIP(r))
+		}
+		if errors.Is(err, users.ErrInvalidRefreshToken) || errors.Is(err, users.ErrRefreshTokenReused) || errors.Is(err, users.ErrUserInactive) {
+			writeJSONError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "Failed to refresh token: "+err.Error())
+		return
+	}
+
+	user, err := h.UserService.GetUserByID(userID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load user: "+err.Error())
+		return
+	}
+	roles, err := h.UserService.GetUserRoles(user.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load user roles: "+err.Error())
+		return
+	}
+	tokenString, err := auth.GenerateJWT(user.Username, user.ID, roles)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	h.AuditService.Record(user.ID, models.AuditTokenRefresh, user.ID, nil, h.clientIP(r))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenTTL.Seconds()),
+		"userID":        user.ID,
+		"roles":         roles,
+	})
+}
+
+// logoutAPIHandler revokes the caller's access token and the session of the given refresh token,
+// or every session of the caller when "all" is set.
+func (h *HandlerDependencies) logoutAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+	if rejectAPIKey(w, claims) {
+		return
+	}
+
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+	}
+
+	var err error
+	if request.All {
+		err = h.UserService.RevokeAllUserTokens(claims.UserID)
+	} else {
+		// Client certificates carry no token; only a refresh token given in the body is revoked
+		if claims.ClientCertificate == "" {
+			err = h.UserService.RevokeAccessToken(claims)
+		}
+		if err == nil && request.RefreshToken != "" {
+			err = h.UserService.RevokeRefreshToken(request.RefreshToken, claims.UserID)
+		}
+	}
+	h.audit(r, models.AuditLogout, claims.UserID, map[string]interface{}{"all": request.All, "success": err == nil})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, users.ErrInvalidRefreshToken) {
+			status = http.StatusBadRequest
+		}
+		writeJSONError(w, status, "Failed to log out: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Logged out successfully",
+	})
+}
+
+// revokeUserTokensAPIHandler immediately ends every session of another user, e.g. a departing employee.
+func (h *HandlerDependencies) revokeUserTokensAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var request struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.UserID == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+
+	err := h.UserService.RevokeAllUserTokens(request.UserID)
+	h.audit(r, models.AuditTokenRevoke, request.UserID, map[string]interface{}{"success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to revoke tokens: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "All tokens of the user have been revoked",
+	})
+}
+
+// jwksHandler publishes the public keys Bridgo tokens can be verified with (RFC 7517).
+func (h *HandlerDependencies) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	keys, err := auth.JWKS()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to load signing keys: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/models"
+)
+
+// backupsAPIHandler lists the metadata backups (GET) or takes one now (POST). Restoring is done
+// offline with the -restore command-line flag, since running services hold settings and keys
+// loaded from the database.
+func (h *HandlerDependencies) backupsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		backups, err := h.Backups.List()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to list backups: "+err.Error())
+			return
+		}
+		cfg := h.Backups.Config()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"backups": backups,
+			"schedule": map[string]interface{}{
+				"interval": cfg.Interval.String(),
+				"enabled":  cfg.Interval > 0,
+				"retain":   cfg.Retain,
+			},
+		})
+
+	case http.MethodPost:
+		backup, info, err := h.Backups.Create()
+		if err != nil {
+			h.audit(r, models.AuditBackupCreate, "", map[string]interface{}{"success": false, "error": err.Error()})
+			writeJSONError(w, http.StatusInternalServerError, "Failed to create backup: "+err.Error())
+			return
+		}
+		h.audit(r, models.AuditBackupCreate, backup.Name, map[string]interface{}{"success": true, "schema_version": info.SchemaVersion})
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success":  true,
+			"message":  "Backup created successfully",
+			"backup":   backup,
+			"snapshot": info,
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// backupDownloadAPIHandler sends the backup named by the 'name' query parameter.
+func (h *HandlerDependencies) backupDownloadAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	path, err := h.Backups.Path(name)
+	if errors.Is(err, metadata.ErrBackupNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Backup not found")
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to open backup: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	h.audit(r, models.AuditBackupDownload, name, nil)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeContent(w, r, name, time.Time{}, file)
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/core"
+	"Bridgo/internal/models"
+)
+
+// maxBundleSize bounds the bundles accepted for import.
+const maxBundleSize = 16 << 20
+
+// bundleSecretsKeyHeader carries the passphrase of a bundle's encrypted passwords on import, so it
+// stays out of URLs and access logs.
+const bundleSecretsKeyHeader = "X-Bridgo-Secrets-Key"
+
+// bundleExportAPIHandler returns a bundle of the data sources and views selected in the request
+// body, as a YAML or JSON file.
+func (h *HandlerDependencies) bundleExportAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	var input models.ExportBundleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	input.UserID = claims.UserID
+	if input.Format == "" {
+		input.Format = models.BundleFormatYAML
+	}
+
+	bundle, err := h.CoreService.ExportBundle(input)
+	if err != nil {
+		writeJSONError(w, viewErrorStatus(err), "Failed to export bundle: "+err.Error())
+		return
+	}
+	data, err := core.EncodeBundle(bundle, input.Format)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.audit(r, models.AuditBundleExport, "", map[string]interface{}{
+		"data_source_ids":       input.DataSourceIDs,
+		"virtual_base_view_ids": input.VirtualBaseViewIDs,
+		"virtual_view_ids":      input.VirtualViewIDs,
+		"secrets":               input.Secrets,
+	})
+
+	contentType := "application/yaml"
+	if input.Format == models.BundleFormatJSON {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="bridgo_bundle.`+input.Format+`"`)
+	w.Write(data)
+}
+
+// bundleImportAPIHandler imports the YAML or JSON bundle in the request body as the caller. The
+// query parameters 'on_conflict' (fail, skip or overwrite) and 'dry_run' control the import; the
+// report lists what was, or would be, created, updated or skipped.
+func (h *HandlerDependencies) bundleImportAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBundleSize))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to read bundle: "+err.Error())
+		return
+	}
+	bundle, err := core.DecodeBundle(data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(bundle.DataSources) > 0 && !h.hasPermission(w, claims, models.PermDataSourceCreate) {
+		return
+	}
+
+	input := models.ImportBundleInput{
+		UserID:     claims.UserID,
+		Bundle:     *bundle,
+		OnConflict: r.URL.Query().Get("on_conflict"),
+		SecretsKey: r.Header.Get(bundleSecretsKeyHeader),
+	}
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		if input.DryRun, err = strconv.ParseBool(value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid dry_run value: "+value)
+			return
+		}
+	}
+
+	report, err := h.CoreService.ImportBundle(input)
+	if err != nil {
+		if !input.DryRun {
+			h.audit(r, models.AuditBundleImport, "", map[string]interface{}{"success": false, "error": err.Error()})
+		}
+		writeJSONError(w, http.StatusBadRequest, "Failed to import bundle: "+err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	message := "Bundle imported successfully"
+	switch {
+	case len(report.Errors) > 0:
+		status = http.StatusUnprocessableEntity
+		message = "The bundle has unresolved references or invalid objects; nothing was imported"
+	case report.Conflicts > 0:
+		status = http.StatusConflict
+		message = "Names in the bundle are already taken; nothing was imported. Use on_conflict=skip or on_conflict=overwrite"
+	case input.DryRun:
+		message = "Dry run: the bundle can be imported"
+	}
+	if input.DryRun {
+		status = http.StatusOK
+	} else {
+		h.audit(r, models.AuditBundleImport, "", map[string]interface{}{
+			"success":     report.Applied,
+			"on_conflict": input.OnConflict,
+			"items":       report.Items,
+			"errors":      report.Errors,
+		})
+		if report.Applied {
+			// Overwritten data sources are also audited one by one, like other data source changes
+			for _, item := range report.Items {
+				if item.Kind == models.ManagedDataSource && item.Action == models.BundleActionUpdate {
+					h.audit(r, models.AuditDataSourceUpdate, item.ID, map[string]interface{}{"name": item.Name, "source": models.AuditBundleImport, "success": true})
+				}
+			}
+		}
+	}
+
+	writeJSON(w, status, map[string]interface{}{
+		"success": len(report.Errors) == 0 && report.Conflicts == 0,
+		"message": message,
+		"report":  report,
+	})
+}
@@ -50,6 +50,7 @@ func (h *HandlerDependencies) dbConnectAndFetchSchemaAPIHandler(w http.ResponseW
 	}
 
 	savedSchema, err := h.CoreService.ConnectAndFetchSchema(input)
+	h.audit(r, models.AuditDataSourceCreate, "", dataSourceAuditDetails(input, err))
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to connect, fetch, or save schema: %v", err), http.StatusInternalServerError)
 		return
@@ -85,7 +86,8 @@ func (h *HandlerDependencies) dbTestConnectionAPIHandler(w http.ResponseWriter,
 	input.UserID = claims.UserID
 
 	// Test connection and fetch schema without saving
-	schema, err := h.CoreService.TestConnectionAndFetchSchema(input)
+	schema, tlsState, err := h.CoreService.TestConnectionAndFetchSchema(input)
+	h.audit(r, models.AuditDataSourceTest, "", dataSourceAuditDetails(input, err))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -101,6 +103,7 @@ func (h *HandlerDependencies) dbTestConnectionAPIHandler(w http.ResponseWriter,
 		"success": true,
 		"message": "Connection test successful",
 		"schema":  schema,
+		"tls":     tlsState, // Negotiated TLS state; null when the database does not report it
 	})
 }
 
@@ -146,6 +149,11 @@ func (h *HandlerDependencies) dbSaveDataSourceAPIHandler(w http.ResponseWriter,
 
 	// Save the datasource
 	savedDataSource, err := h.CoreService.SaveDataSource(request.ConnectionInput, request.Schema)
+	savedDataSourceID := ""
+	if savedDataSource != nil {
+		savedDataSourceID = savedDataSource.ID
+	}
+	h.audit(r, models.AuditDataSourceCreate, savedDataSourceID, dataSourceAuditDetails(request.ConnectionInput, err))
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -183,10 +191,18 @@ func (h *HandlerDependencies) getUserDataSourcesAPIHandler(w http.ResponseWriter
 		return
 	}
 
+	// API keys only see the data sources they are scoped to
+	scopedDataSources := dataSources[:0]
+	for _, dataSource := range dataSources {
+		if claims.InScope(models.ScopeTypeDataSource, dataSource.ID) {
+			scopedDataSources = append(scopedDataSources, dataSource)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":     true,
-		"datasources": dataSources,
+		"datasources": scopedDataSources,
 	})
 }
 
@@ -238,3 +254,20 @@ func (h *HandlerDependencies) getDataSourceSchemaAPIHandler(w http.ResponseWrite
 		"schema":  schemaResponses,
 	})
 }
+
+// dataSourceAuditDetails describes a connection attempt for the audit log, without the password.
+func dataSourceAuditDetails(input core.ConnectAndFetchSchemaInput, err error) map[string]interface{} {
+	details := map[string]interface{}{
+		"source_name": input.SourceName,
+		"db_type":     input.DBType,
+		"host":        input.Host,
+		"port":        input.Port,
+		"database":    input.DBName,
+		"db_user":     input.User,
+		"ssl_mode":    input.SSLMode,
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	return details
+}
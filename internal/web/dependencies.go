@@ -1,20 +1,44 @@
 package web
 
 import (
+	"database/sql"
+	"net"
+	"path/filepath"
+
+	"Bridgo/internal/audit"
+	"Bridgo/internal/auth"
+	"Bridgo/internal/config"
 	"Bridgo/internal/core"
+	"Bridgo/internal/metadata"
 	"Bridgo/internal/users"
 )
 
 // HandlerDependencies holds the services that handlers will need.
 type HandlerDependencies struct {
-	UserService *users.Service
-	CoreService *core.CoreService // Will be used for data-related APIs later
+	UserService  *users.Service
+	CoreService  *core.CoreService // Will be used for data-related APIs later
+	AuditService *audit.Service
+	OIDCProvider *auth.OIDCProvider // nil when single sign-on is not configured
+	Backups      *metadata.BackupStore
+	Reconciler   *core.ReconcileService
+	StaticDir    string               // Directory of the web UI files
+	Features     config.FeatureConfig // Optional parts of the server that are switched on
+
+	TrustedProxies []*net.IPNet // Peers whose X-Forwarded-For and Forwarded headers name the client
+
+	MetaDB               *sql.DB // Metadata database, checked by /readyz
+	ReadinessDataSources bool    // /readyz also checks that every data source answers
+	health               *healthState
 }
 
 // NewHandlers creates a new HandlerDependencies struct.
-func NewHandlers(us *users.Service, cs *core.CoreService) *HandlerDependencies {
+func NewHandlers(us *users.Service, cs *core.CoreService, as *audit.Service) *HandlerDependencies {
 	return &HandlerDependencies{
-		UserService: us,
-		CoreService: cs,
+		UserService:  us,
+		CoreService:  cs,
+		AuditService: as,
+		StaticDir:    filepath.Join("web", "ui"),
+		Features:     config.Default().Features,
+		health:       &healthState{},
 	}
 }
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"net/http"
+
+	"Bridgo/internal/models"
+)
+
+// gitOpsStatusAPIHandler returns the declarative configuration settings and the outcome of the
+// latest reconciliation.
+func (h *HandlerDependencies) gitOpsStatusAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	cfg := h.Reconciler.Config()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"enabled": cfg.Enabled(),
+		"config": map[string]interface{}{
+			"dir":      cfg.Dir,
+			"interval": cfg.Interval.String(),
+			"owner":    cfg.Owner,
+			"prune":    cfg.Prune,
+			"adopt":    cfg.Adopt,
+		},
+		"last_result": h.Reconciler.LastResult(),
+	})
+}
+
+// gitOpsPlanAPIHandler returns the changes a reconciliation would make now, without making them.
+func (h *HandlerDependencies) gitOpsPlanAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if !h.Reconciler.Config().Enabled() {
+		writeJSONError(w, http.StatusNotFound, "Declarative configuration is disabled; set BRIDGO_GITOPS_DIR")
+		return
+	}
+	plan, err := h.Reconciler.Plan()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to plan reconciliation: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": len(plan.Errors) == 0,
+		"plan":    plan,
+	})
+}
+
+// gitOpsReconcileAPIHandler reconciles now rather than at the next interval.
+func (h *HandlerDependencies) gitOpsReconcileAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	if !h.Reconciler.Config().Enabled() {
+		writeJSONError(w, http.StatusNotFound, "Declarative configuration is disabled; set BRIDGO_GITOPS_DIR")
+		return
+	}
+
+	result := h.Reconciler.Reconcile()
+	h.audit(r, models.AuditGitOpsReconcile, "", map[string]interface{}{
+		"success": result.Error == "" && len(result.Plan.Errors) == 0,
+		"applied": result.Applied,
+		"changes": len(result.Plan.Changes),
+		"errors":  result.Plan.Errors,
+		"error":   result.Error,
+	})
+	h.auditReconciledDataSources(r, result)
+
+	status := http.StatusOK
+	message := "The metadata matches the manifests"
+	switch {
+	case result.Error != "":
+		status = http.StatusInternalServerError
+		message = "Reconciliation failed: " + result.Error
+	case len(result.Plan.Errors) > 0:
+		status = http.StatusUnprocessableEntity
+		message = "The manifests have errors; nothing was applied"
+	case result.Applied:
+		message = "Reconciliation applied"
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"success": status == http.StatusOK,
+		"message": message,
+		"result":  result,
+	})
+}
+
+// AuditScheduledReconcile records a scheduled reconciliation that applied changes, which no user
+// started, like gitOpsReconcileAPIHandler does for requested ones.
+func (h *HandlerDependencies) AuditScheduledReconcile(result models.ReconcileResult) {
+	h.AuditService.Record("", models.AuditGitOpsReconcile, "", map[string]interface{}{
+		"success":   true,
+		"applied":   result.Applied,
+		"changes":   len(result.Plan.Changes),
+		"scheduled": true,
+	}, "")
+	h.auditReconciledDataSources(nil, result)
+}
+
+// auditReconciledDataSources records the data sources an applied reconciliation created, updated
+// or deleted, each in its own entry; r is nil for scheduled runs.
+func (h *HandlerDependencies) auditReconciledDataSources(r *http.Request, result models.ReconcileResult) {
+	if !result.Applied {
+		return
+	}
+	for _, change := range result.Plan.Changes {
+		if change.Kind != models.ManagedDataSource {
+			continue
+		}
+		action := models.AuditDataSourceUpdate
+		switch change.Action {
+		case models.ReconcileCreate:
+			action = models.AuditDataSourceCreate
+		case models.ReconcileDelete:
+			action = models.AuditDataSourceDelete
+		case models.ReconcileRelease:
+			continue
+		}
+		details := map[string]interface{}{"name": change.Name, "source": models.AuditGitOpsReconcile, "success": true}
+		if r == nil {
+			h.AuditService.Record("", action, change.ID, details, "")
+		} else {
+			h.audit(r, action, change.ID, details)
+		}
+	}
+}
@@ -5,6 +5,22 @@
 // - routes.go: Route registration
 // - page_handlers.go: Page serving handlers
 // - auth_handlers.go: Authentication API handlers
+// - oidc_handlers.go: OpenID Connect single sign-on handlers
+// - mfa_handlers.go: Two-factor authentication login step and enrollment API handlers
 // - datasource_handlers.go: Data source API handlers
 // - virtualview_handlers.go: Virtual view API handlers
+// - view_share_handlers.go: View update, sharing, publishing and catalog API handlers
+// - privilege_handlers.go: Data source sharing (privilege) API handlers
+// - audit_handlers.go: Audit log search/export API and audit helpers
+// - masking_handlers.go: Column masking policy API
+// - row_policy_handlers.go: Row-level security policy API
+// - role_handlers.go: Role and user attribute management API handlers
+// - user_handlers.go: User administration and password change API handlers
+// - api_key_handlers.go: API key and service account API handlers
+// - backup_handlers.go: Metadata backup API handlers
+// - bundle_handlers.go: Data source and view bundle export/import API handlers
+// - gitops_handlers.go: Declarative configuration status, plan and reconcile API handlers
+// - health_handlers.go: Liveness and readiness probes
+// - permissions.go: Permission checks applied to API routes
+// - responses.go: JSON response helpers
 package web
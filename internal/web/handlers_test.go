@@ -0,0 +1,26 @@
+package web
+
+import (
+	"database/sql"
+	"testing"
+
+	"Bridgo/internal/audit"
+	"Bridgo/internal/auth"
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/users"
+)
+
+// newTestHandlers returns handlers backed by a fresh metadata database, signing tokens with a
+// test secret.
+func newTestHandlers(t *testing.T) (*HandlerDependencies, *sql.DB) {
+	t.Helper()
+	db := metadatatest.NewDB(t)
+
+	keys, err := auth.LoadKeySet(auth.KeyConfig{}, "test-secret-test-secret-test-secret")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	auth.SetKeySet(keys)
+
+	return NewHandlers(users.NewService(db), nil, audit.NewService(db)), db
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Bridgo/internal/metadata"
+	"Bridgo/internal/models"
+)
+
+// readinessTimeout bounds the checks of one readiness probe.
+const readinessTimeout = 5 * time.Second
+
+// dataSourceHealthTTL is how long data source health is reused between readiness probes, so
+// frequent probes do not connect to every data source each time.
+const dataSourceHealthTTL = 30 * time.Second
+
+// healthState is what the probes know beyond the services: whether the server is shutting down,
+// and the last data source health.
+type healthState struct {
+	draining atomic.Bool
+
+	mu          sync.Mutex
+	dataSources []models.DataSourceHealth
+	checkedAt   time.Time
+}
+
+// BeginShutdown makes /readyz fail, so load balancers stop sending new requests while the
+// in-flight ones finish.
+func (h *HandlerDependencies) BeginShutdown() {
+	h.health.draining.Store(true)
+}
+
+// healthzHandler reports that the process is up. It checks nothing else, so an orchestrator does
+// not restart Bridgo because a database is unavailable.
+func (h *HandlerDependencies) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// readyzHandler reports whether Bridgo can serve requests: it is not shutting down, the metadata
+// database answers and is fully migrated and, when configured, every data source answers. Causes
+// of failures are logged rather than returned, since the probe is unauthenticated.
+func (h *HandlerDependencies) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if h.health.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	status := http.StatusOK
+	response := map[string]interface{}{}
+
+	metadataCheck := map[string]interface{}{"status": "ok"}
+	version, err := metadata.CheckReady(ctx, h.MetaDB)
+	if err != nil {
+		log.Printf("Readiness check of the metadata database failed: %v", err)
+		metadataCheck["status"] = "failed"
+		status = http.StatusServiceUnavailable
+	}
+	metadataCheck["schema_version"] = version
+	response["metadata"] = metadataCheck
+
+	if h.ReadinessDataSources && err == nil {
+		dataSources, err := h.dataSourceHealth(ctx)
+		if err != nil {
+			log.Printf("Readiness check of the data sources failed: %v", err)
+			status = http.StatusServiceUnavailable
+		}
+		for _, ds := range dataSources {
+			if ds.Status != "ok" {
+				status = http.StatusServiceUnavailable
+			}
+		}
+		response["data_sources"] = dataSources
+	}
+
+	response["status"] = "ready"
+	if status != http.StatusOK {
+		response["status"] = "not_ready"
+	}
+	writeJSON(w, status, response)
+}
+
+// dataSourceHealth returns the health of the data sources, checking them again when the last
+// result is older than dataSourceHealthTTL.
+func (h *HandlerDependencies) dataSourceHealth(ctx context.Context) ([]models.DataSourceHealth, error) {
+	h.health.mu.Lock()
+	defer h.health.mu.Unlock()
+	if h.health.dataSources != nil && time.Since(h.health.checkedAt) < dataSourceHealthTTL {
+		return h.health.dataSources, nil
+	}
+
+	dataSources, err := h.CoreService.CheckDataSourceHealth(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dataSources == nil {
+		dataSources = []models.DataSourceHealth{}
+	}
+	h.health.dataSources = dataSources
+	h.health.checkedAt = time.Now()
+	return dataSources, nil
+}
@@ -0,0 +1,47 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Bridgo/internal/metadata/metadatatest"
+)
+
+func TestReadyz(t *testing.T) {
+	h, db := newTestHandlers(t)
+	h.MetaDB = db
+	probe := func(handler http.HandlerFunc) (int, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var body struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return rec.Code, body.Status
+	}
+
+	if code, status := probe(h.readyzHandler); code != http.StatusOK || status != "ready" {
+		t.Errorf("readyz = %d %q, want 200 ready", code, status)
+	}
+
+	h.BeginShutdown()
+	if code, status := probe(h.readyzHandler); code != http.StatusServiceUnavailable || status != "shutting_down" {
+		t.Errorf("readyz while shutting down = %d %q, want 503 shutting_down", code, status)
+	}
+	if code, _ := probe(h.healthzHandler); code != http.StatusOK {
+		t.Errorf("healthz while shutting down = %d, want 200", code)
+	}
+
+	// A metadata database that does not answer is not ready either
+	h, _ = newTestHandlers(t)
+	h.MetaDB = metadatatest.NewDB(t)
+	h.MetaDB.Close()
+	if code, status := probe(h.readyzHandler); code != http.StatusServiceUnavailable || status != "not_ready" {
+		t.Errorf("readyz with a closed metadata database = %d %q, want 503 not_ready", code, status)
+	}
+}
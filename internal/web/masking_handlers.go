@@ -0,0 +1,127 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/core"
+	"Bridgo/internal/models"
+)
+
+// policyErrorStatus maps policy service errors to HTTP status codes.
+func policyErrorStatus(err error) int {
+	if errors.Is(err, core.ErrPrivilegeDenied) || errors.Is(err, core.ErrViewAccessDenied) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// maskingPoliciesAPIHandler lists (GET), sets (POST) or deletes (DELETE) column masking policies
+// on a data source's columns or on a view's columns.
+func (h *HandlerDependencies) maskingPoliciesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		dataSourceID := query.Get("datasource_id")
+		viewType := query.Get("view_type")
+		viewID := query.Get("view_id")
+		if dataSourceID == "" && (viewType == "" || viewID == "") {
+			writeJSONError(w, http.StatusBadRequest, "datasource_id, or view_type and view_id, parameters are required")
+			return
+		}
+
+		policies, err := h.CoreService.GetMaskingPolicies(dataSourceID, viewType, viewID, claims.UserID)
+		if err != nil {
+			writeJSONError(w, policyErrorStatus(err), "Failed to retrieve masking policies: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":  true,
+			"policies": policies,
+		})
+
+	case http.MethodPost:
+		if !h.hasPermission(w, claims, models.PermPolicyManage) {
+			return
+		}
+
+		var input models.SetMaskingPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		input.UserID = claims.UserID
+
+		if input.MaskType == "" || (input.DataSourceSchemaID == "" && (input.ViewType == "" || input.ViewID == "" || input.ColumnName == "")) {
+			writeJSONError(w, http.StatusBadRequest, "mask_type and either data_source_schema_id, or view_type, view_id and column_name, are required")
+			return
+		}
+
+		policy, err := h.CoreService.SetMaskingPolicy(input)
+		targetID := input.DataSourceSchemaID
+		if targetID == "" {
+			targetID = input.ViewID
+		}
+		h.audit(r, models.AuditMaskingPolicySet, targetID, map[string]interface{}{
+			"data_source_schema_id": input.DataSourceSchemaID,
+			"view_type":             input.ViewType,
+			"column_name":           input.ColumnName,
+			"mask_type":             input.MaskType,
+			"exempt_roles":          input.ExemptRoles,
+			"success":               err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, policyErrorStatus(err), "Failed to set masking policy: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Masking policy saved successfully",
+			"policy":  policy,
+		})
+
+	case http.MethodDelete:
+		if !h.hasPermission(w, claims, models.PermPolicyManage) {
+			return
+		}
+
+		var request struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.ID == "" {
+			writeJSONError(w, http.StatusBadRequest, "id is required")
+			return
+		}
+
+		err := h.CoreService.DeleteMaskingPolicy(request.ID, claims.UserID)
+		h.audit(r, models.AuditMaskingPolicyDelete, request.ID, map[string]interface{}{
+			"success": err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, policyErrorStatus(err), "Failed to delete masking policy: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Masking policy deleted successfully",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
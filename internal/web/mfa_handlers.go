@@ -0,0 +1,287 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+	"Bridgo/internal/users"
+)
+
+// checkLoginMFA is the second login step for a user whose password was accepted. Users with
+// two-factor authentication must send a TOTP or recovery code; users whose role requires it but
+// who have not enrolled get a secret to enroll with and confirm it with their first code. It
+// returns the recovery codes of a new enrollment and the kind of code used, or false after writing
+// the response that ends the login.
+func (h *HandlerDependencies) checkLoginMFA(w http.ResponseWriter, user models.User, code, ip string) ([]string, string, bool) {
+	status, err := h.UserService.MFAStatus(user.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to check two-factor authentication")
+		return nil, "", false
+	}
+
+	switch {
+	case status.Enabled:
+		if code == "" {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"success":      false,
+				"mfa_required": true,
+				"message":      "Enter the code from your authenticator app or a recovery code",
+			})
+			return nil, "", false
+		}
+		method, err := h.UserService.VerifyMFA(user.ID, code)
+		if err != nil {
+			h.rejectLoginMFACode(w, user, err, ip)
+			return nil, "", false
+		}
+		return nil, method, true
+
+	case status.Required:
+		if code == "" {
+			enrollment, err := h.UserService.BeginMFAEnrollment(user.ID)
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "Failed to start two-factor enrollment: "+err.Error())
+				return nil, "", false
+			}
+			writeJSON(w, http.StatusForbidden, map[string]interface{}{
+				"success":                 false,
+				"mfa_enrollment_required": true,
+				"message":                 "Your role requires two-factor authentication. Add this key to your authenticator app and enter the code it shows",
+				"secret":                  enrollment.Secret,
+				"provisioning_uri":        enrollment.ProvisioningURI,
+			})
+			return nil, "", false
+		}
+		recoveryCodes, err := h.UserService.ConfirmMFAEnrollment(user.ID, code)
+		if err != nil {
+			h.rejectLoginMFACode(w, user, err, ip)
+			return nil, "", false
+		}
+		h.AuditService.Record(user.ID, models.AuditMFAEnable, user.ID, map[string]interface{}{"at_login": true}, ip)
+		return recoveryCodes, "totp", true
+	}
+	return nil, "", true
+}
+
+// rejectLoginMFACode ends a login whose one-time code was not accepted. Wrong codes count as
+// failed logins, so they cannot be guessed any faster than passwords.
+func (h *HandlerDependencies) rejectLoginMFACode(w http.ResponseWriter, user models.User, err error, ip string) {
+	if !errors.Is(err, users.ErrInvalidMFACode) {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to verify one-time code: "+err.Error())
+		return
+	}
+	h.recordLoginFailure(user.Username, user.ID, err.Error(), ip)
+	writeJSONError(w, http.StatusUnauthorized, "Invalid one-time code")
+}
+
+// accountMFAAPIHandler shows (GET) or turns off (DELETE, with a current code) the caller's
+// two-factor authentication.
+func (h *HandlerDependencies) accountMFAAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := mfaAccountClaims(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		status, err := h.UserService.MFAStatus(claims.UserID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve two-factor status: "+err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"mfa":     status,
+		})
+
+	case http.MethodDelete:
+		code, ok := decodeMFACode(w, r)
+		if !ok {
+			return
+		}
+		_, err := h.UserService.VerifyMFA(claims.UserID, code)
+		if err == nil {
+			err = h.UserService.DisableMFA(claims.UserID)
+		}
+		h.audit(r, models.AuditMFADisable, claims.UserID, map[string]interface{}{"success": err == nil})
+		if err != nil {
+			writeJSONError(w, mfaErrorStatus(err), "Failed to disable two-factor authentication: "+err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Two-factor authentication disabled",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// accountMFAEnrollAPIHandler starts enrolling the caller in two-factor authentication and returns
+// the TOTP secret with its provisioning URI.
+func (h *HandlerDependencies) accountMFAEnrollAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	claims, ok := mfaAccountClaims(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.UserService.BeginMFAEnrollment(claims.UserID)
+	if err != nil {
+		writeJSONError(w, mfaErrorStatus(err), "Failed to start two-factor enrollment: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"message":    "Add the key to your authenticator app, then confirm with the code it shows",
+		"enrollment": enrollment,
+	})
+}
+
+// accountMFAConfirmAPIHandler enables two-factor authentication with the first code of the
+// caller's authenticator app and returns their recovery codes.
+func (h *HandlerDependencies) accountMFAConfirmAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	claims, ok := mfaAccountClaims(w, r)
+	if !ok {
+		return
+	}
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.UserService.ConfirmMFAEnrollment(claims.UserID, code)
+	h.audit(r, models.AuditMFAEnable, claims.UserID, map[string]interface{}{"success": err == nil})
+	if err != nil {
+		writeJSONError(w, mfaErrorStatus(err), "Failed to enable two-factor authentication: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":        true,
+		"message":        "Two-factor authentication enabled; store the recovery codes safely, they are shown only once",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// accountMFARecoveryCodesAPIHandler replaces the caller's recovery codes, after checking a
+// current code.
+func (h *HandlerDependencies) accountMFARecoveryCodesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	claims, ok := mfaAccountClaims(w, r)
+	if !ok {
+		return
+	}
+	code, ok := decodeMFACode(w, r)
+	if !ok {
+		return
+	}
+
+	var recoveryCodes []string
+	_, err := h.UserService.VerifyMFA(claims.UserID, code)
+	if err == nil {
+		recoveryCodes, err = h.UserService.RegenerateRecoveryCodes(claims.UserID)
+	}
+	h.audit(r, models.AuditMFARecoveryCodes, claims.UserID, map[string]interface{}{"success": err == nil})
+	if err != nil {
+		writeJSONError(w, mfaErrorStatus(err), "Failed to regenerate recovery codes: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":        true,
+		"message":        "New recovery codes generated; the previous ones no longer work",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// userMFAResetAPIHandler removes a user's two-factor enrollment, e.g. after they lost their
+// device. Users whose role requires it enroll again at their next login.
+func (h *HandlerDependencies) userMFAResetAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var request struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.UserID == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+
+	_, err := h.UserService.GetUserByID(request.UserID)
+	if err == nil {
+		err = h.UserService.ResetMFA(request.UserID)
+	}
+	h.audit(r, models.AuditMFAReset, request.UserID, map[string]interface{}{"success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to reset two-factor authentication: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Two-factor authentication reset successfully",
+	})
+}
+
+// mfaAccountClaims returns the caller's claims for the account two-factor endpoints, which API
+// keys cannot use.
+func mfaAccountClaims(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return nil, false
+	}
+	if rejectAPIKey(w, claims) {
+		return nil, false
+	}
+	return claims, true
+}
+
+// decodeMFACode reads the {"code"} body of the account two-factor endpoints.
+func decodeMFACode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return "", false
+	}
+	if request.Code == "" {
+		writeJSONError(w, http.StatusBadRequest, "code is required")
+		return "", false
+	}
+	return request.Code, true
+}
+
+// mfaErrorStatus maps two-factor errors to HTTP status codes.
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, users.ErrInvalidMFACode):
+		return http.StatusUnauthorized
+	case errors.Is(err, users.ErrMFAAlreadyEnabled), errors.Is(err, users.ErrMFANotEnabled):
+		return http.StatusConflict
+	case errors.Is(err, users.ErrMFAEnforced):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
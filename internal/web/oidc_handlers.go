@@ -0,0 +1,159 @@
+package web
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+	"Bridgo/internal/users"
+)
+
+// oidcStateCookie binds a pending single sign-on login to the browser that started it, so a
+// callback carrying someone else's authorization code cannot sign this browser in (login CSRF).
+const oidcStateCookie = "bridgo_oidc_state"
+
+// setOIDCStateCookie sets (or, with an empty state, clears) the login state cookie. It is only
+// sent to the callback, and survives the cross-site redirect back from the provider (SameSite=Lax).
+func (h *HandlerDependencies) setOIDCStateCookie(w http.ResponseWriter, r *http.Request, state string) {
+	maxAge := int(users.OIDCLoginTTL.Seconds())
+	if state == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc/callback",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(h.OIDCProvider.Config().RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// authConfigAPIHandler tells the login page which sign-in methods are available.
+func (h *HandlerDependencies) authConfigAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":         true,
+		"local_login":     true,
+		"oidc_enabled":    h.OIDCProvider != nil,
+		"registration":    h.UserService.RegistrationMode(),
+		"password_policy": h.UserService.PasswordPolicy(),
+	})
+}
+
+// oidcLoginHandler starts single sign-on: it records a pending login, binds it to the browser with
+// a cookie and redirects the browser to the provider's authorization endpoint.
+func (h *HandlerDependencies) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if h.OIDCProvider == nil {
+		writeJSONError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	state, nonce, codeVerifier, err := auth.NewOIDCLoginRequest()
+	if err == nil {
+		err = h.UserService.SaveOIDCLoginState(state, nonce, codeVerifier)
+	}
+	var authURL string
+	if err == nil {
+		authURL, err = h.OIDCProvider.AuthCodeURL(state, nonce, codeVerifier)
+	}
+	if err != nil {
+		log.Printf("Failed to start single sign-on: %v", err)
+		redirectLoginError(w, r, "Single sign-on is unavailable")
+		return
+	}
+
+	h.setOIDCStateCookie(w, r, state)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler completes single sign-on: it redeems the authorization code, provisions the
+// user and hands the Bridgo tokens to the login page in the URL fragment, which never reaches a server.
+func (h *HandlerDependencies) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+	if h.OIDCProvider == nil {
+		writeJSONError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	query := r.URL.Query()
+	h.setOIDCStateCookie(w, r, "") // A login state is good for one callback
+	// fail records the failed sign-in, with the provider's identity once it is known
+	fail := func(reason string, identity *auth.OIDCIdentity) {
+		details := map[string]interface{}{"method": "oidc", "reason": reason}
+		if identity != nil {
+			details["username"] = identity.Username
+			details["subject"] = identity.Subject
+			details["email"] = identity.Email
+		}
+		h.AuditService.Record("", models.AuditLoginFailure, "", details, h.clientIP(r))
+		redirectLoginError(w, r, "Single sign-on failed")
+	}
+
+	if providerError := query.Get("error"); providerError != "" {
+		fail(providerError+": "+query.Get("error_description"), nil)
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		fail("login state does not belong to this browser", nil)
+		return
+	}
+	nonce, codeVerifier, err := h.UserService.ConsumeOIDCLoginState(query.Get("state"))
+	if err != nil {
+		fail(err.Error(), nil)
+		return
+	}
+	identity, err := h.OIDCProvider.Exchange(query.Get("code"), codeVerifier, nonce)
+	if err != nil {
+		fail(err.Error(), nil)
+		return
+	}
+
+	cfg := h.OIDCProvider.Config()
+	roles, managedRoles := h.OIDCProvider.RolesForGroups(identity.Groups)
+	user, err := h.UserService.ProvisionOIDCUser(identity, roles, managedRoles, cfg.DefaultRole)
+	if err != nil {
+		fail(err.Error(), identity)
+		return
+	}
+
+	tokenString, refreshToken, _, err := h.issueTokens(r, user)
+	if err != nil {
+		log.Printf("Failed to issue tokens for %s: %v", user.Username, err)
+		redirectLoginError(w, r, "Failed to generate token")
+		return
+	}
+
+	log.Printf("User login successful via single sign-on - Username: %s, UserID: %s", user.Username, user.ID)
+	h.AuditService.Record(user.ID, models.AuditLoginSuccess, user.ID, map[string]interface{}{
+		"username": user.Username,
+		"method":   "oidc",
+		"subject":  identity.Subject,
+		"groups":   identity.Groups,
+	}, h.clientIP(r))
+
+	fragment := url.Values{"token": {tokenString}, "refresh_token": {refreshToken}}
+	http.Redirect(w, r, "/login#"+fragment.Encode(), http.StatusFound)
+}
+
+// redirectLoginError sends the browser back to the login page with an error message.
+func redirectLoginError(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/login#"+url.Values{"sso_error": {message}}.Encode(), http.StatusFound)
+}
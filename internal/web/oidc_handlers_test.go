@@ -0,0 +1,204 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/metadata/metadatatest"
+	"Bridgo/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubOIDCProvider is a minimal OpenID Connect provider whose token endpoint issues an ID token
+// carrying whatever nonce the test sets.
+type stubOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	nonce string
+}
+
+func newStubOIDCProvider(t *testing.T) *stubOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	p := &stubOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		nonce := p.nonce
+		p.mu.Unlock()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":                p.server.URL,
+			"aud":                "bridgo",
+			"sub":                "subject-1",
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"nonce":              nonce,
+			"preferred_username": "sso-user",
+			"email":              "sso-user@example.com",
+			"email_verified":     true,
+		})
+		token.Header["kid"] = "k1"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *stubOIDCProvider) setNonce(nonce string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nonce = nonce
+}
+
+func TestOIDCCallback(t *testing.T) {
+	h, db := newTestHandlers(t)
+	provider := newStubOIDCProvider(t)
+	oidc, err := auth.NewOIDCProvider(auth.OIDCConfig{
+		Issuer:      provider.server.URL,
+		ClientID:    "bridgo",
+		RedirectURL: "http://bridgo.test/api/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	h.OIDCProvider = oidc
+
+	// startLogin begins a login and returns its state, nonce and state cookie
+	startLogin := func() (string, string, *http.Cookie) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.oidcLoginHandler(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+		location, err := url.Parse(rec.Header().Get("Location"))
+		if rec.Code != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), provider.server.URL+"/authorize?") {
+			t.Fatalf("login redirected with %d to %q", rec.Code, rec.Header().Get("Location"))
+		}
+		var cookie *http.Cookie
+		for _, c := range rec.Result().Cookies() {
+			if c.Name == oidcStateCookie {
+				cookie = c
+			}
+		}
+		if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/api/auth/oidc/callback" {
+			t.Fatalf("login set state cookie %+v", cookie)
+		}
+		return location.Query().Get("state"), location.Query().Get("nonce"), cookie
+	}
+	// callback completes a login and returns the fragment the browser is sent back to /login with
+	callback := func(state string, cookie *http.Cookie) url.Values {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+url.Values{"code": {"code-1"}, "state": {state}}.Encode(), nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		h.oidcCallbackHandler(rec, req)
+		location := rec.Header().Get("Location")
+		if rec.Code != http.StatusFound || !strings.HasPrefix(location, "/login#") {
+			t.Fatalf("callback redirected with %d to %q", rec.Code, location)
+		}
+		fragment, err := url.ParseQuery(strings.TrimPrefix(location, "/login#"))
+		if err != nil {
+			t.Fatalf("parse fragment: %v", err)
+		}
+		return fragment
+	}
+
+	t.Run("email taken", func(t *testing.T) {
+		// A local account with the provider's e-mail is not taken over, even though it is verified
+		localID := metadatatest.InsertUser(t, db, "sso-user", "Correct-horse-1")
+		state, nonce, cookie := startLogin()
+		provider.setNonce(nonce)
+		if fragment := callback(state, cookie); fragment.Get("sso_error") == "" {
+			t.Fatalf("callback for a taken e-mail: got %v, want sso_error", fragment)
+		}
+		failures, err := h.AuditService.Search(models.AuditLogFilter{ActionType: models.AuditLoginFailure, Search: `"subject":"subject-1"`})
+		if err != nil || len(failures) != 1 {
+			t.Fatalf("login failures naming the subject = %v (%v), want 1", failures, err)
+		}
+
+		body := strings.NewReader(`{"user_id": "` + localID + `", "subject": "subject-1"}`)
+		rec := httptest.NewRecorder()
+		h.userOIDCLinkAPIHandler(rec, httptest.NewRequest(http.MethodPost, "/api/users/oidc-link", body))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("link answered %d: %s", rec.Code, rec.Body)
+		}
+		links, err := h.AuditService.Search(models.AuditLogFilter{ActionType: models.AuditUserOIDCLink, TargetResourceID: localID})
+		if err != nil || len(links) != 1 {
+			t.Fatalf("link audit entries = %v (%v), want 1", links, err)
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		state, nonce, cookie := startLogin()
+		provider.setNonce(nonce)
+		fragment := callback(state, cookie)
+		if fragment.Get("token") == "" || fragment.Get("refresh_token") == "" {
+			t.Fatalf("got %v, want tokens", fragment)
+		}
+		claims, err := auth.ValidateJWT(fragment.Get("token"))
+		if err != nil || claims.Username != "sso-user" {
+			t.Fatalf("token for %+v (%v), want sso-user", claims, err)
+		}
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		// An attacker's own login state, delivered to a victim whose browser started another login
+		attackerState, nonce, _ := startLogin()
+		_, _, victimCookie := startLogin()
+		provider.setNonce(nonce)
+		if fragment := callback(attackerState, victimCookie); fragment.Get("sso_error") == "" {
+			t.Fatalf("callback with another browser's state: got %v, want sso_error", fragment)
+		}
+		if fragment := callback(attackerState, nil); fragment.Get("sso_error") == "" {
+			t.Fatalf("callback without state cookie: got %v, want sso_error", fragment)
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		state, _, cookie := startLogin()
+		provider.setNonce("replayed-nonce")
+		if fragment := callback(state, cookie); fragment.Get("sso_error") == "" || fragment.Get("token") != "" {
+			t.Fatalf("callback with wrong nonce: got %v, want sso_error", fragment)
+		}
+	})
+}
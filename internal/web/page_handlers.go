@@ -5,23 +5,34 @@ import (
 	"path/filepath"
 )
 
+// servePage returns a handler serving the named file of the web UI.
+func (h *HandlerDependencies) servePage(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(h.StaticDir, name))
+	}
+}
+
 func (h *HandlerDependencies) homeHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	http.ServeFile(w, r, "web/ui/index.html")
+	h.servePage("index.html")(w, r)
 }
 
 func (h *HandlerDependencies) registerPageHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "web/ui/register.html")
+	h.servePage("register.html")(w, r)
 }
 
 func (h *HandlerDependencies) loginPageHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "web/ui/login.html")
+	h.servePage("login.html")(w, r)
+}
+
+func (h *HandlerDependencies) setupPageHandler(w http.ResponseWriter, r *http.Request) {
+	h.servePage("setup.html")(w, r)
 }
 
 func (h *HandlerDependencies) dashboardPageHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, filepath.Join(".", "web", "ui", "dashboard.html"))
+	h.servePage("dashboard.html")(w, r)
 }
 
 func (h *HandlerDependencies) testButtonPageHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, filepath.Join(".", "web", "ui", "test_button.html"))
+	h.servePage("test_button.html")(w, r)
 }
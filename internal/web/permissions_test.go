@@ -0,0 +1,69 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+)
+
+func TestRequirePermission(t *testing.T) {
+	h, _ := newTestHandlers(t)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	scopes := []models.APIKeyScope{{Type: models.ScopeTypeDataSource, ID: "ds1"}}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		claims  *auth.Claims
+		url     string
+		want    int
+	}{
+		{"no claims", h.requirePermission(models.PermDataSourceRead, ok), nil, "/", http.StatusUnauthorized},
+		{"role grants permission", h.requirePermission(models.PermDataSourceCreate, ok), &auth.Claims{Roles: []string{models.RoleEditor}}, "/", http.StatusOK},
+		{"role lacks permission", h.requirePermission(models.PermDataSourceCreate, ok), &auth.Claims{Roles: []string{models.RoleViewer}}, "/", http.StatusForbidden},
+		{"any role may grant it", h.requirePermission(models.PermUserManage, ok), &auth.Claims{Roles: []string{models.RoleViewer, models.RoleAdmin}}, "/", http.StatusOK},
+		{"no roles", h.requirePermission(models.PermViewRead, ok), &auth.Claims{}, "/", http.StatusForbidden},
+		{
+			"API key on a route closed to keys",
+			h.requirePermission(models.PermDataSourceRead, ok),
+			&auth.Claims{Roles: []string{models.RoleAdmin}, APIKeyID: "k1", Scopes: scopes}, "/?datasource_id=ds1", http.StatusForbidden,
+		},
+		{
+			"API key in scope",
+			h.allowAPIKey(models.ScopeTypeDataSource, "datasource_id", h.requirePermission(models.PermDataSourceRead, ok)),
+			&auth.Claims{Roles: []string{models.RoleViewer}, APIKeyID: "k1", Scopes: scopes}, "/?datasource_id=ds1", http.StatusOK,
+		},
+		{
+			"API key out of scope",
+			h.allowAPIKey(models.ScopeTypeDataSource, "datasource_id", h.requirePermission(models.PermDataSourceRead, ok)),
+			&auth.Claims{Roles: []string{models.RoleAdmin}, APIKeyID: "k1", Scopes: scopes}, "/?datasource_id=ds2", http.StatusForbidden,
+		},
+		{
+			"API key still needs the permission",
+			h.allowAPIKey(models.ScopeTypeDataSource, "datasource_id", h.requirePermission(models.PermDataSourceCreate, ok)),
+			&auth.Claims{Roles: []string{models.RoleViewer}, APIKeyID: "k1", Scopes: scopes}, "/?datasource_id=ds1", http.StatusForbidden,
+		},
+		{
+			"login token is not scoped",
+			h.allowAPIKey(models.ScopeTypeDataSource, "datasource_id", h.requirePermission(models.PermDataSourceRead, ok)),
+			&auth.Claims{Roles: []string{models.RoleViewer}}, "/?datasource_id=ds2", http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.claims != nil {
+				r = r.WithContext(context.WithValue(r.Context(), auth.UserContextKey, tt.claims))
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("answered %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
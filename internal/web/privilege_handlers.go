@@ -0,0 +1,127 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/core"
+	"Bridgo/internal/models"
+)
+
+// dataSourcePrivilegesAPIHandler lists (GET), grants (POST) or revokes (DELETE)
+// privileges other users hold on a data source.
+func (h *HandlerDependencies) dataSourcePrivilegesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		dataSourceID := r.URL.Query().Get("datasource_id")
+		if dataSourceID == "" {
+			writeJSONError(w, http.StatusBadRequest, "datasource_id parameter is required")
+			return
+		}
+
+		privileges, err := h.CoreService.GetDataSourcePrivileges(dataSourceID, claims.UserID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve privileges: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":    true,
+			"privileges": privileges,
+		})
+
+	case http.MethodPost:
+		if !h.hasPermission(w, claims, models.PermDataSourceShare) {
+			return
+		}
+
+		var input models.GrantDataSourcePrivilegeInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		input.GrantorUserID = claims.UserID
+
+		if input.DataSourceID == "" || (input.Username == "" && input.UserID == "") || input.PrivilegeType == "" {
+			writeJSONError(w, http.StatusBadRequest, "data_source_id, username (or user_id) and privilege_type are required")
+			return
+		}
+
+		privilege, err := h.CoreService.GrantDataSourcePrivilege(input)
+		h.audit(r, models.AuditPrivilegeGrant, input.DataSourceID, map[string]interface{}{
+			"grantee_username": input.Username,
+			"grantee_user_id":  input.UserID,
+			"privilege_type":   input.PrivilegeType,
+			"can_grant":        input.CanGrant,
+			"expires_at":       input.ExpiresAt,
+			"success":          err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, privilegeErrorStatus(err), "Failed to grant privilege: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":   true,
+			"message":   "Privilege granted successfully",
+			"privilege": privilege,
+		})
+
+	case http.MethodDelete:
+		if !h.hasPermission(w, claims, models.PermDataSourceShare) {
+			return
+		}
+
+		var request struct {
+			DataSourceID  string `json:"data_source_id"`
+			UserID        string `json:"user_id"`
+			PrivilegeType string `json:"privilege_type"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.DataSourceID == "" || request.UserID == "" || request.PrivilegeType == "" {
+			writeJSONError(w, http.StatusBadRequest, "data_source_id, user_id and privilege_type are required")
+			return
+		}
+
+		err := h.CoreService.RevokeDataSourcePrivilege(request.DataSourceID, request.UserID, request.PrivilegeType, claims.UserID)
+		h.audit(r, models.AuditPrivilegeRevoke, request.DataSourceID, map[string]interface{}{
+			"grantee_user_id": request.UserID,
+			"privilege_type":  request.PrivilegeType,
+			"success":         err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, privilegeErrorStatus(err), "Failed to revoke privilege: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Privilege revoked successfully",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// privilegeErrorStatus maps privilege service errors to HTTP status codes.
+func privilegeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, core.ErrPrivilegeDenied):
+		return http.StatusForbidden
+	case errors.Is(err, core.ErrManagedObject):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,21 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// writeJSON writes payload as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payload)
+}
+
+// writeJSONError writes the {"success": false, "message": ...} body used by the API handlers.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"success": false,
+		"message": message,
+	})
+}
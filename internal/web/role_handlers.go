@@ -0,0 +1,169 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"Bridgo/internal/models"
+	"Bridgo/internal/users"
+)
+
+// listRolesAPIHandler returns all roles with the permissions they grant.
+func (h *HandlerDependencies) listRolesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	roles, err := h.UserService.ListRoles()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve roles: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"roles":   roles,
+	})
+}
+
+// userRolesAPIHandler lists (GET), assigns (POST) or removes (DELETE) roles of a user.
+func (h *HandlerDependencies) userRolesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			writeJSONError(w, http.StatusBadRequest, "user_id parameter is required")
+			return
+		}
+
+		roles, err := h.UserService.GetUserRoles(userID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user roles: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"user_id": userID,
+			"roles":   roles,
+		})
+
+	case http.MethodPost, http.MethodDelete:
+		var request struct {
+			UserID   string `json:"user_id"`
+			RoleName string `json:"role_name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.UserID == "" || request.RoleName == "" {
+			writeJSONError(w, http.StatusBadRequest, "user_id and role_name are required")
+			return
+		}
+
+		action := models.AuditRoleAssign
+		message := "Role assigned successfully"
+		if r.Method == http.MethodDelete {
+			action = models.AuditRoleRemove
+			message = "Role removed successfully"
+		}
+		err := h.UserService.CheckRoleMembersEditable(request.RoleName)
+		switch {
+		case err != nil:
+		case r.Method == http.MethodPost:
+			err = h.UserService.AssignRole(request.UserID, request.RoleName)
+		default:
+			err = h.UserService.RemoveRole(request.UserID, request.RoleName)
+		}
+		h.audit(r, action, request.UserID, map[string]interface{}{"role_name": request.RoleName, "success": err == nil})
+		if err != nil {
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, users.ErrRoleNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, users.ErrRoleMembersManaged):
+				status = http.StatusConflict
+			}
+			writeJSONError(w, status, "Failed to update user roles: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": message,
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// userAttributesAPIHandler lists (GET), sets (PUT) or deletes (DELETE) custom attributes of a user,
+// such as the region row-level security policies filter on.
+func (h *HandlerDependencies) userAttributesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			writeJSONError(w, http.StatusBadRequest, "user_id parameter is required")
+			return
+		}
+
+		attributes, err := h.UserService.GetUserAttributes(userID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve user attributes: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":    true,
+			"user_id":    userID,
+			"attributes": attributes,
+		})
+
+	case http.MethodPut, http.MethodDelete:
+		var request struct {
+			UserID string `json:"user_id"`
+			Key    string `json:"key"`
+			Value  string `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.UserID == "" || request.Key == "" {
+			writeJSONError(w, http.StatusBadRequest, "user_id and key are required")
+			return
+		}
+
+		var err error
+		action := models.AuditUserAttributeSet
+		message := "Attribute set successfully"
+		details := map[string]interface{}{"key": request.Key}
+		if r.Method == http.MethodPut {
+			err = h.UserService.SetUserAttribute(request.UserID, request.Key, request.Value)
+			details["value"] = request.Value
+		} else {
+			err = h.UserService.DeleteUserAttribute(request.UserID, request.Key)
+			action = models.AuditUserAttributeDelete
+			message = "Attribute deleted successfully"
+		}
+		details["success"] = err == nil
+		h.audit(r, action, request.UserID, details)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to update user attributes: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": message,
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
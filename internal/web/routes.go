@@ -3,70 +3,177 @@ package web
 import (
 	"fmt"
 	"net/http"
-	"path/filepath"
+
+	"Bridgo/internal/models"
 )
 
 // RegisterRoutes sets up the HTTP routes using methods of HandlerDependencies.
 func (h *HandlerDependencies) RegisterRoutes(mux *http.ServeMux) {
-	// Page serving handlers
-	mux.HandleFunc("/", h.homeHandler)
-	mux.HandleFunc("/register", h.registerPageHandler)
-	mux.HandleFunc("/login", h.loginPageHandler)
-	mux.HandleFunc("/dashboard", h.dashboardPageHandler)
+	if h.Features.UI {
+		h.registerPageRoutes(mux)
+	}
+
+	// Probes for load balancers and orchestrators
+	mux.HandleFunc("/healthz", h.healthzHandler)
+	mux.HandleFunc("/readyz", h.readyzHandler)
 
 	// API handlers
 	mux.HandleFunc("/api/register", h.registerAPIHandler)
 	mux.HandleFunc("/api/login", h.loginAPIHandler)
-	mux.HandleFunc("/api/db/test-connection", h.dbTestConnectionAPIHandler)
-	mux.HandleFunc("/api/db/save-datasource", h.dbSaveDataSourceAPIHandler)
-	mux.HandleFunc("/api/datasources", h.getUserDataSourcesAPIHandler)
-	mux.HandleFunc("/api/datasources/schema", h.getDataSourceSchemaAPIHandler)
+	mux.HandleFunc("/api/setup", h.setupAPIHandler)
+	mux.HandleFunc("/api/token/refresh", h.refreshTokenAPIHandler)
+	mux.HandleFunc("/api/logout", h.logoutAPIHandler)
+	mux.HandleFunc("/api/auth/config", h.authConfigAPIHandler)
+	mux.HandleFunc("/api/auth/oidc/login", h.oidcLoginHandler)
+	mux.HandleFunc("/api/auth/oidc/callback", h.oidcCallbackHandler)
+	mux.HandleFunc("/.well-known/jwks.json", h.jwksHandler)
+	mux.HandleFunc("/api/db/test-connection", h.requirePermission(models.PermDataSourceCreate, h.dbTestConnectionAPIHandler))
+	mux.HandleFunc("/api/db/save-datasource", h.requirePermission(models.PermDataSourceCreate, h.dbSaveDataSourceAPIHandler))
+	mux.HandleFunc("/api/datasources", h.allowAPIKey(models.ScopeTypeDataSource, "", h.requirePermission(models.PermDataSourceRead, h.getUserDataSourcesAPIHandler)))
+	mux.HandleFunc("/api/datasources/schema", h.allowAPIKey(models.ScopeTypeDataSource, "datasource_id", h.requirePermission(models.PermDataSourceRead, h.getDataSourceSchemaAPIHandler)))
+	mux.HandleFunc("/api/datasources/privileges", h.requirePermission(models.PermDataSourceRead, h.dataSourcePrivilegesAPIHandler))
 	mux.HandleFunc("/api/virtual-views", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
-			h.getUserVirtualViewsAPIHandler(w, r)
+			h.allowAPIKey(models.ViewTypeVirtualView, "", h.requirePermission(models.PermViewRead, h.getUserVirtualViewsAPIHandler))(w, r)
 		} else if r.Method == http.MethodPost {
-			h.createVirtualViewAPIHandler(w, r)
+			h.requirePermission(models.PermViewCreate, h.createVirtualViewAPIHandler)(w, r)
+		} else if r.Method == http.MethodPut {
+			h.requirePermission(models.PermViewCreate, h.updateVirtualViewAPIHandler)(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	mux.HandleFunc("/api/virtual-views/schema", h.getVirtualViewSchemaAPIHandler)
-	mux.HandleFunc("/api/virtual-views/sample-data", h.getVirtualViewSampleDataAPIHandler)
+	mux.HandleFunc("/api/virtual-views/schema", h.allowAPIKey(models.ViewTypeVirtualView, "virtual_view_id", h.requirePermission(models.PermViewRead, h.getVirtualViewSchemaAPIHandler)))
 
 	// Virtual Base Views API
 	mux.HandleFunc("/api/virtual-base-views", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
-			h.getUserVirtualBaseViewsAPIHandler(w, r)
+			h.allowAPIKey(models.ViewTypeVirtualBaseView, "", h.requirePermission(models.PermViewRead, h.getUserVirtualBaseViewsAPIHandler))(w, r)
 		} else if r.Method == http.MethodPost {
-			h.createVirtualBaseViewAPIHandler(w, r)
+			h.requirePermission(models.PermViewCreate, h.createVirtualBaseViewAPIHandler)(w, r)
+		} else if r.Method == http.MethodPut {
+			h.requirePermission(models.PermViewCreate, h.updateVirtualBaseViewAPIHandler)(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
-	mux.HandleFunc("/api/virtual-base-views/schema", h.getVirtualBaseViewSchemaAPIHandler)
-	mux.HandleFunc("/api/virtual-base-views/sample-data", h.getVirtualBaseViewSampleDataAPIHandler)
-	mux.HandleFunc("/api/db/connect-and-fetch-schema", h.dbConnectAndFetchSchemaAPIHandler)
+	mux.HandleFunc("/api/virtual-base-views/schema", h.allowAPIKey(models.ViewTypeVirtualBaseView, "virtual_base_view_id", h.requirePermission(models.PermViewRead, h.getVirtualBaseViewSchemaAPIHandler)))
+	mux.HandleFunc("/api/db/connect-and-fetch-schema", h.requirePermission(models.PermDataSourceCreate, h.dbConnectAndFetchSchemaAPIHandler))
+
+	// View sharing API
+	mux.HandleFunc("/api/view-shares", h.requirePermission(models.PermViewRead, h.viewSharesAPIHandler))
+	mux.HandleFunc("/api/view-shares/publish", h.requirePermission(models.PermViewShare, h.publishViewAPIHandler))
+	mux.HandleFunc("/api/view-shares/transfer", h.requirePermission(models.PermViewShare, h.transferViewOwnershipAPIHandler))
+	mux.HandleFunc("/api/catalog", h.requirePermission(models.PermViewRead, h.viewCatalogAPIHandler))
+
+	// Data governance policies API
+	mux.HandleFunc("/api/masking-policies", h.requirePermission(models.PermViewRead, h.maskingPoliciesAPIHandler))
+	mux.HandleFunc("/api/row-policies", h.requirePermission(models.PermViewRead, h.rowPoliciesAPIHandler))
+
+	// Audit log API
+	mux.HandleFunc("/api/audit-logs", h.requirePermission(models.PermAuditRead, h.auditLogsAPIHandler))
+
+	// Role management API
+	mux.HandleFunc("/api/roles", h.requirePermission(models.PermRoleManage, h.listRolesAPIHandler))
+	mux.HandleFunc("/api/users/roles", h.requirePermission(models.PermRoleManage, h.userRolesAPIHandler))
+	mux.HandleFunc("/api/users/attributes", h.requirePermission(models.PermRoleManage, h.userAttributesAPIHandler))
+	mux.HandleFunc("/api/users/revoke-tokens", h.requirePermission(models.PermUserManage, h.revokeUserTokensAPIHandler))
+
+	// User administration and account self-service
+	mux.HandleFunc("/api/users", h.requirePermission(models.PermUserManage, h.usersAPIHandler))
+	mux.HandleFunc("/api/users/status", h.requirePermission(models.PermUserManage, h.userStatusAPIHandler))
+	mux.HandleFunc("/api/users/password", h.requirePermission(models.PermUserManage, h.userPasswordAPIHandler))
+	mux.HandleFunc("/api/users/email", h.requirePermission(models.PermUserManage, h.userEmailAPIHandler))
+	mux.HandleFunc("/api/users/unlock", h.requirePermission(models.PermUserManage, h.userUnlockAPIHandler))
+	mux.HandleFunc("/api/users/ldap-link", h.requirePermission(models.PermUserManage, h.userLDAPLinkAPIHandler))
+	mux.HandleFunc("/api/users/oidc-link", h.requirePermission(models.PermUserManage, h.userOIDCLinkAPIHandler))
+	mux.HandleFunc("/api/invites", h.requirePermission(models.PermUserManage, h.invitesAPIHandler))
+	mux.HandleFunc("/api/account/password", h.changePasswordAPIHandler)
+
+	// Two-factor authentication
+	mux.HandleFunc("/api/account/mfa", h.accountMFAAPIHandler)
+	mux.HandleFunc("/api/account/mfa/enroll", h.accountMFAEnrollAPIHandler)
+	mux.HandleFunc("/api/account/mfa/confirm", h.accountMFAConfirmAPIHandler)
+	mux.HandleFunc("/api/account/mfa/recovery-codes", h.accountMFARecoveryCodesAPIHandler)
+	mux.HandleFunc("/api/users/mfa/reset", h.requirePermission(models.PermUserManage, h.userMFAResetAPIHandler))
+
+	// API keys and service accounts
+	mux.HandleFunc("/api/api-keys", h.apiKeysAPIHandler)
+	mux.HandleFunc("/api/service-accounts", h.requirePermission(models.PermUserManage, h.serviceAccountsAPIHandler))
+
+	// Metadata backups
+	mux.HandleFunc("/api/backups", h.requirePermission(models.PermSystemBackup, h.backupsAPIHandler))
+	mux.HandleFunc("/api/backups/download", h.requirePermission(models.PermSystemBackup, h.backupDownloadAPIHandler))
+
+	// Rows of views
+	if h.Features.SampleData {
+		mux.HandleFunc("/api/virtual-views/sample-data", h.allowAPIKey(models.ViewTypeVirtualView, "virtual_view_id", h.requirePermission(models.PermViewRead, h.getVirtualViewSampleDataAPIHandler)))
+		mux.HandleFunc("/api/virtual-base-views/sample-data", h.allowAPIKey(models.ViewTypeVirtualBaseView, "virtual_base_view_id", h.requirePermission(models.PermViewRead, h.getVirtualBaseViewSampleDataAPIHandler)))
+	}
+
+	// Bundles of data sources and views
+	if h.Features.Bundles {
+		mux.HandleFunc("/api/bundles/export", h.requirePermission(models.PermViewRead, h.bundleExportAPIHandler))
+		mux.HandleFunc("/api/bundles/import", h.requirePermission(models.PermViewCreate, h.bundleImportAPIHandler))
+	}
 
-	// Static files (CSS, JS, images etc.) from web/ui directory served under /static/ path
+	// Declarative configuration
+	mux.HandleFunc("/api/gitops/status", h.requirePermission(models.PermSystemConfig, h.gitOpsStatusAPIHandler))
+	mux.HandleFunc("/api/gitops/plan", h.requirePermission(models.PermSystemConfig, h.gitOpsPlanAPIHandler))
+	mux.HandleFunc("/api/gitops/reconcile", h.requirePermission(models.PermSystemConfig, h.gitOpsReconcileAPIHandler))
+
+	fmt.Println("Registered web routes")
+}
+
+// registerPageRoutes serves the web UI: its pages and the static files under /static/.
+func (h *HandlerDependencies) registerPageRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/", h.homeHandler)
+	mux.HandleFunc("/register", h.registerPageHandler)
+	mux.HandleFunc("/login", h.loginPageHandler)
+	mux.HandleFunc("/setup", h.setupPageHandler)
+	mux.HandleFunc("/dashboard", h.dashboardPageHandler)
+
+	// Static files (CSS, JS, images etc.) from the UI directory served under /static/ path
 	// e.g., /static/css/style.css will serve web/ui/css/style.css
-	staticDir := http.Dir(filepath.Join(".", "web", "ui"))
-	fileServer := http.FileServer(staticDir)
+	fileServer := http.FileServer(http.Dir(h.StaticDir))
 	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
 
 	// Dashboard iframe pages
-	mux.HandleFunc("/dashboard_home", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, filepath.Join(".", "web", "ui", "dashboard_home.html"))
-	})
-	mux.HandleFunc("/db_connections", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, filepath.Join(".", "web", "ui", "db_connections.html"))
-	})
-	mux.HandleFunc("/virtual_views", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, filepath.Join(".", "web", "ui", "virtual_views.html"))
-	})
-	mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, filepath.Join(".", "web", "ui", "settings.html"))
-	})
+	mux.HandleFunc("/dashboard_home", h.servePage("dashboard_home.html"))
+	mux.HandleFunc("/db_connections", h.servePage("db_connections.html"))
+	mux.HandleFunc("/virtual_views", h.servePage("virtual_views.html"))
+	mux.HandleFunc("/settings", h.servePage("settings.html"))
 	mux.HandleFunc("/test_button", h.testButtonPageHandler)
+}
 
-	fmt.Println("Registered web routes")
+// PublicPaths returns the paths that do not require authentication, for auth.JWTMiddleware.
+func (h *HandlerDependencies) PublicPaths() []string {
+	paths := []string{
+		"/api/login",
+		"/api/register",
+		"/api/setup",              // Authenticated by the one-time setup token in the body
+		"/api/token/refresh",      // Authenticated by the refresh token in the body
+		"/api/auth/config",        // Sign-in methods shown on the login page
+		"/api/auth/oidc/login",    // Single sign-on redirect to the provider
+		"/api/auth/oidc/callback", // Provider redirect after sign-in
+		"/.well-known/jwks.json",  // Public keys for verifying Bridgo tokens
+		"/healthz",                // Liveness probe
+		"/readyz",                 // Readiness probe
+	}
+	if h.Features.UI {
+		paths = append(paths,
+			"/",
+			"/login",
+			"/register",
+			"/setup",
+			"/static/",        // Static assets
+			"/dashboard",      // Main dashboard page
+			"/dashboard_home", // Dashboard iframe content
+			"/db_connections", // Dashboard iframe content
+			"/virtual_views",  // Dashboard iframe content
+			"/settings",       // Dashboard iframe content
+			"/favicon.ico",    // Browser favicon request
+		)
+	}
+	return paths
 }
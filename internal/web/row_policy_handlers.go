@@ -0,0 +1,109 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+)
+
+// rowPoliciesAPIHandler lists (GET), sets (POST) or deletes (DELETE) row-level security policies on a view.
+func (h *HandlerDependencies) rowPoliciesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		viewType := r.URL.Query().Get("view_type")
+		viewID := r.URL.Query().Get("view_id")
+		if viewType == "" || viewID == "" {
+			writeJSONError(w, http.StatusBadRequest, "view_type and view_id parameters are required")
+			return
+		}
+
+		policies, err := h.CoreService.GetRowSecurityPolicies(viewType, viewID, claims.UserID)
+		if err != nil {
+			writeJSONError(w, policyErrorStatus(err), "Failed to retrieve row security policies: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":  true,
+			"policies": policies,
+		})
+
+	case http.MethodPost:
+		if !h.hasPermission(w, claims, models.PermPolicyManage) {
+			return
+		}
+
+		var input models.SetRowSecurityPolicyInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		input.UserID = claims.UserID
+
+		if input.ViewType == "" || input.ViewID == "" || input.Name == "" || input.Predicate == "" {
+			writeJSONError(w, http.StatusBadRequest, "view_type, view_id, name and predicate are required")
+			return
+		}
+
+		policy, err := h.CoreService.SetRowSecurityPolicy(input)
+		h.audit(r, models.AuditRowPolicySet, input.ViewID, map[string]interface{}{
+			"view_type":    input.ViewType,
+			"name":         input.Name,
+			"predicate":    input.Predicate,
+			"exempt_roles": input.ExemptRoles,
+			"success":      err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, policyErrorStatus(err), "Failed to set row security policy: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Row security policy saved successfully",
+			"policy":  policy,
+		})
+
+	case http.MethodDelete:
+		if !h.hasPermission(w, claims, models.PermPolicyManage) {
+			return
+		}
+
+		var request struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.ID == "" {
+			writeJSONError(w, http.StatusBadRequest, "id is required")
+			return
+		}
+
+		err := h.CoreService.DeleteRowSecurityPolicy(request.ID, claims.UserID)
+		h.audit(r, models.AuditRowPolicyDelete, request.ID, map[string]interface{}{
+			"success": err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, policyErrorStatus(err), "Failed to delete row security policy: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Row security policy deleted successfully",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
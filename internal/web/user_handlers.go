@@ -0,0 +1,534 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/models"
+	"Bridgo/internal/users"
+)
+
+// usersAPIHandler lists (GET), creates (POST) or deletes (DELETE) users. Supported query parameters
+// for listing: q (username or email substring), status ("active" or "inactive"), limit and offset.
+// Created users must change the given password at their first login. Deleting a user who owns data sources or views requires reassign_to, the user to move them to.
+func (h *HandlerDependencies) usersAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.GetUserClaimsFromContext(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		filter := models.UserFilter{Search: query.Get("q")}
+		switch query.Get("status") {
+		case "":
+		case "active", "inactive":
+			active := query.Get("status") == "active"
+			filter.Active = &active
+		default:
+			writeJSONError(w, http.StatusBadRequest, "status must be 'active' or 'inactive'")
+			return
+		}
+		var err error
+		for name, dest := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+			if value := query.Get(name); value != "" {
+				if *dest, err = strconv.Atoi(value); err != nil {
+					writeJSONError(w, http.StatusBadRequest, name+" must be an integer")
+					return
+				}
+			}
+		}
+
+		list, err := h.UserService.ListUsers(filter)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve users: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"users":   list,
+		})
+
+	case http.MethodPost:
+		var request struct {
+			Username string `json:"username"`
+			Email    string `json:"email"`
+			Password string `json:"password"` // Temporary; the user must change it at their first login
+			RoleName string `json:"role_name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.Username == "" || request.Password == "" {
+			writeJSONError(w, http.StatusBadRequest, "username and password are required")
+			return
+		}
+
+		user, err := h.UserService.CreateUser(request.Username, request.Email, request.Password, request.RoleName)
+		details := map[string]interface{}{"username": request.Username, "role_name": request.RoleName, "success": err == nil}
+		h.audit(r, models.AuditUserCreate, user.ID, details)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, users.ErrRoleNotFound) {
+				status = http.StatusNotFound
+			}
+			writeJSONError(w, status, "Failed to create user: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"message": "User created; they must change their password at their first login",
+			"user_id": user.ID,
+		})
+
+	case http.MethodDelete:
+		var request struct {
+			UserID     string `json:"user_id"`
+			ReassignTo string `json:"reassign_to"` // Username of the new owner of the user's data sources and views
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.UserID == "" {
+			writeJSONError(w, http.StatusBadRequest, "user_id is required")
+			return
+		}
+		if request.UserID == claims.UserID {
+			writeJSONError(w, http.StatusBadRequest, "You cannot delete your own account")
+			return
+		}
+		user, err := h.UserService.GetUserByID(request.UserID)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "Failed to delete user: "+err.Error())
+			return
+		}
+
+		details := map[string]interface{}{"username": user.Username}
+		if request.ReassignTo != "" {
+			newOwner, err := h.UserService.GetUserByUsername(request.ReassignTo)
+			if err != nil {
+				writeJSONError(w, http.StatusNotFound, "Failed to reassign resources: new owner "+err.Error())
+				return
+			}
+			moved, err := h.CoreService.ReassignOwnedResources(user.ID, newOwner.ID)
+			details["reassigned_to"] = newOwner.ID
+			details["reassigned"] = moved
+			if err != nil {
+				details["success"] = false
+				h.audit(r, models.AuditUserDelete, user.ID, details)
+				writeJSONError(w, http.StatusBadRequest, "Failed to reassign resources: "+err.Error())
+				return
+			}
+		}
+
+		err = h.UserService.DeleteUser(user.ID)
+		details["success"] = err == nil
+		h.audit(r, models.AuditUserDelete, user.ID, details)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, users.ErrUserOwnsResources) {
+				status = http.StatusConflict
+			}
+			writeJSONError(w, status, "Failed to delete user: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "User deleted successfully",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// invitesAPIHandler lists (GET), creates (POST) or withdraws (DELETE) registration invites. The
+// invite code is only returned when the invite is created.
+func (h *HandlerDependencies) invitesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.GetUserClaimsFromContext(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		invites, err := h.UserService.ListInvites()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve invites: "+err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":           true,
+			"invites":           invites,
+			"registration_mode": h.UserService.RegistrationMode(),
+		})
+
+	case http.MethodPost:
+		var request struct {
+			Email          string `json:"email"` // Optional; restricts the invite to this address
+			RoleName       string `json:"role_name"`
+			ExpiresInHours int    `json:"expires_in_hours"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.ExpiresInHours < 0 {
+			writeJSONError(w, http.StatusBadRequest, "expires_in_hours must not be negative")
+			return
+		}
+
+		invite, code, err := h.UserService.CreateInvite(request.Email, request.RoleName, claims.UserID, time.Duration(request.ExpiresInHours)*time.Hour)
+		h.audit(r, models.AuditInviteCreate, invite.ID, map[string]interface{}{"email": request.Email, "role_name": invite.RoleName, "success": err == nil})
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, users.ErrRoleNotFound) {
+				status = http.StatusNotFound
+			}
+			writeJSONError(w, status, "Failed to create invite: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success":     true,
+			"message":     "Invite created; the code is shown only once",
+			"invite":      invite,
+			"invite_code": code,
+		})
+
+	case http.MethodDelete:
+		var request struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.ID == "" {
+			writeJSONError(w, http.StatusBadRequest, "id is required")
+			return
+		}
+
+		err := h.UserService.DeleteInvite(request.ID)
+		h.audit(r, models.AuditInviteDelete, request.ID, map[string]interface{}{"success": err == nil})
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "Failed to delete invite: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Invite deleted successfully",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// userStatusAPIHandler deactivates or reactivates a user. Deactivated users cannot log in and
+// their sessions and API keys stop working.
+func (h *HandlerDependencies) userStatusAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	claims, _ := auth.GetUserClaimsFromContext(r.Context())
+
+	var request struct {
+		UserID   string `json:"user_id"`
+		IsActive *bool  `json:"is_active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.UserID == "" || request.IsActive == nil {
+		writeJSONError(w, http.StatusBadRequest, "user_id and is_active are required")
+		return
+	}
+	if request.UserID == claims.UserID && !*request.IsActive {
+		writeJSONError(w, http.StatusBadRequest, "You cannot deactivate your own account")
+		return
+	}
+
+	err := h.UserService.SetUserActive(request.UserID, *request.IsActive)
+	action := models.AuditUserReactivate
+	message := "User reactivated successfully"
+	if !*request.IsActive {
+		action = models.AuditUserDeactivate
+		message = "User deactivated successfully"
+	}
+	h.audit(r, action, request.UserID, map[string]interface{}{"success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to update user status: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
+
+// userPasswordAPIHandler sets a temporary password for a user, which they must change at their next
+// login, and ends all of their sessions.
+func (h *HandlerDependencies) userPasswordAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var request struct {
+		UserID   string `json:"user_id"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.UserID == "" || request.Password == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id and password are required")
+		return
+	}
+
+	err := h.UserService.SetPassword(request.UserID, request.Password)
+	if err == nil {
+		err = h.UserService.RequirePasswordChange(request.UserID)
+	}
+	if err == nil {
+		err = h.UserService.RevokeAllUserTokens(request.UserID)
+	}
+	h.audit(r, models.AuditUserPasswordReset, request.UserID, map[string]interface{}{"success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to reset password: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Password reset successfully; the user must change it at their next login",
+	})
+}
+
+// userUnlockAPIHandler lifts the lockout of a user after too many failed logins and clears their
+// failed logins.
+func (h *HandlerDependencies) userUnlockAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var request struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.UserID == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+
+	err := h.UserService.UnlockAccount(request.UserID)
+	h.audit(r, models.AuditUserUnlock, request.UserID, map[string]interface{}{"success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to unlock user: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "User unlocked successfully",
+	})
+}
+
+// userLDAPLinkAPIHandler links an existing user to a directory login (POST), so they sign in with
+// LDAP instead of their local password, or removes the link (DELETE).
+func (h *HandlerDependencies) userLDAPLinkAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var request struct {
+		UserID       string `json:"user_id"`
+		LDAPUsername string `json:"ldap_username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.UserID == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err := h.UserService.UnlinkLDAPIdentity(request.UserID)
+		h.audit(r, models.AuditUserLDAPUnlink, request.UserID, map[string]interface{}{"success": err == nil})
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to unlink LDAP login: "+err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "LDAP login unlinked successfully",
+		})
+		return
+	}
+
+	if request.LDAPUsername == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id and ldap_username are required")
+		return
+	}
+	err := h.UserService.LinkLDAPIdentity(request.UserID, request.LDAPUsername)
+	h.audit(r, models.AuditUserLDAPLink, request.UserID, map[string]interface{}{"ldap_username": request.LDAPUsername, "success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to link LDAP login: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "LDAP login linked successfully",
+	})
+}
+
+// userOIDCLinkAPIHandler links an existing user to an identity at the single sign-on provider (POST),
+// so they sign in there instead of with their local password, or removes the link (DELETE).
+func (h *HandlerDependencies) userOIDCLinkAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if h.OIDCProvider == nil {
+		writeJSONError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	var request struct {
+		UserID  string `json:"user_id"`
+		Subject string `json:"subject"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.UserID == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+	issuer := h.OIDCProvider.Config().Issuer
+
+	if r.Method == http.MethodDelete {
+		err := h.UserService.UnlinkOIDCIdentity(request.UserID, issuer)
+		h.audit(r, models.AuditUserOIDCUnlink, request.UserID, map[string]interface{}{"success": err == nil})
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Failed to unlink OIDC subject: "+err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "OIDC subject unlinked successfully",
+		})
+		return
+	}
+
+	if request.Subject == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id and subject are required")
+		return
+	}
+	err := h.UserService.LinkOIDCIdentity(request.UserID, issuer, request.Subject)
+	h.audit(r, models.AuditUserOIDCLink, request.UserID, map[string]interface{}{"subject": request.Subject, "success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to link OIDC subject: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "OIDC subject linked successfully",
+	})
+}
+
+// userEmailAPIHandler changes the e-mail address of a user.
+func (h *HandlerDependencies) userEmailAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	var request struct {
+		UserID string `json:"user_id"`
+		Email  string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.UserID == "" || request.Email == "" {
+		writeJSONError(w, http.StatusBadRequest, "user_id and email are required")
+		return
+	}
+
+	err := h.UserService.UpdateEmail(request.UserID, request.Email)
+	h.audit(r, models.AuditUserEmailChange, request.UserID, map[string]interface{}{"email": request.Email, "success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to change email: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Email changed successfully",
+	})
+}
+
+// changePasswordAPIHandler lets the caller change their own password. All of their sessions end,
+// so they have to log in again.
+func (h *HandlerDependencies) changePasswordAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+	if rejectAPIKey(w, claims) {
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.CurrentPassword == "" || request.NewPassword == "" {
+		writeJSONError(w, http.StatusBadRequest, "current_password and new_password are required")
+		return
+	}
+
+	err := h.UserService.ChangePassword(claims.UserID, request.CurrentPassword, request.NewPassword)
+	if err == nil {
+		err = h.UserService.RevokeAllUserTokens(claims.UserID)
+	}
+	h.audit(r, models.AuditPasswordChange, claims.UserID, map[string]interface{}{"success": err == nil})
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Failed to change password: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Password changed successfully; please log in again",
+	})
+}
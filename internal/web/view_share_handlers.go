@@ -0,0 +1,319 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"Bridgo/internal/auth"
+	"Bridgo/internal/core"
+	"Bridgo/internal/models"
+)
+
+// viewErrorStatus maps view service errors to HTTP status codes.
+func viewErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, core.ErrViewAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, core.ErrManagedObject):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// updateVirtualViewAPIHandler updates the name, description or columns of a virtual view.
+func (h *HandlerDependencies) updateVirtualViewAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	var input core.UpdateVirtualViewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	input.UserID = claims.UserID
+
+	if input.ID == "" {
+		writeJSONError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	virtualView, err := h.CoreService.UpdateVirtualView(input)
+	h.audit(r, models.AuditViewUpdate, input.ID, map[string]interface{}{
+		"view_type":           models.ViewTypeVirtualView,
+		"name":                input.Name,
+		"description":         input.Description,
+		"selected_schema_ids": input.SelectedSchemaIDs,
+		"success":             err == nil,
+	})
+	if err != nil {
+		writeJSONError(w, viewErrorStatus(err), "Failed to update virtual view: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"message":     "Virtual view updated successfully",
+		"virtualview": virtualView,
+	})
+}
+
+// updateVirtualBaseViewAPIHandler updates the name, description or columns of a virtual base view.
+func (h *HandlerDependencies) updateVirtualBaseViewAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	var input models.UpdateVirtualBaseViewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	input.UserID = claims.UserID
+
+	if input.ID == "" {
+		writeJSONError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+
+	virtualBaseView, err := h.CoreService.UpdateVirtualBaseView(input)
+	h.audit(r, models.AuditViewUpdate, input.ID, map[string]interface{}{
+		"view_type":        models.ViewTypeVirtualBaseView,
+		"name":             input.Name,
+		"description":      input.Description,
+		"selected_columns": input.SelectedColumns,
+		"success":          err == nil,
+	})
+	if err != nil {
+		writeJSONError(w, viewErrorStatus(err), "Failed to update virtual base view: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":           true,
+		"message":           "Virtual base view updated successfully",
+		"virtual_base_view": virtualBaseView,
+	})
+}
+
+// viewSharesAPIHandler lists (GET), adds (POST) or removes (DELETE) user and role shares on a view.
+func (h *HandlerDependencies) viewSharesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		viewType := r.URL.Query().Get("view_type")
+		viewID := r.URL.Query().Get("view_id")
+		if viewType == "" || viewID == "" {
+			writeJSONError(w, http.StatusBadRequest, "view_type and view_id parameters are required")
+			return
+		}
+
+		shares, err := h.CoreService.GetViewShares(viewType, viewID, claims.UserID)
+		if err != nil {
+			writeJSONError(w, viewErrorStatus(err), "Failed to retrieve view shares: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"shares":  shares,
+		})
+
+	case http.MethodPost:
+		if !h.hasPermission(w, claims, models.PermViewShare) {
+			return
+		}
+
+		var input models.ShareViewInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		input.UserID = claims.UserID
+
+		if input.ViewType == "" || input.ViewID == "" || input.GranteeType == "" || input.Grantee == "" || input.AccessLevel == "" {
+			writeJSONError(w, http.StatusBadRequest, "view_type, view_id, grantee_type, grantee and access_level are required")
+			return
+		}
+
+		share, err := h.CoreService.ShareView(input)
+		h.audit(r, models.AuditViewShare, input.ViewID, map[string]interface{}{
+			"view_type":    input.ViewType,
+			"grantee_type": input.GranteeType,
+			"grantee":      input.Grantee,
+			"access_level": input.AccessLevel,
+			"success":      err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, viewErrorStatus(err), "Failed to share view: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "View shared successfully",
+			"share":   share,
+		})
+
+	case http.MethodDelete:
+		if !h.hasPermission(w, claims, models.PermViewShare) {
+			return
+		}
+
+		var request struct {
+			ViewType    string `json:"view_type"`
+			ViewID      string `json:"view_id"`
+			GranteeType string `json:"grantee_type"`
+			Grantee     string `json:"grantee"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		if request.ViewType == "" || request.ViewID == "" || request.GranteeType == "" || request.Grantee == "" {
+			writeJSONError(w, http.StatusBadRequest, "view_type, view_id, grantee_type and grantee are required")
+			return
+		}
+
+		err := h.CoreService.UnshareView(request.ViewType, request.ViewID, request.GranteeType, request.Grantee, claims.UserID)
+		h.audit(r, models.AuditViewUnshare, request.ViewID, map[string]interface{}{
+			"view_type":    request.ViewType,
+			"grantee_type": request.GranteeType,
+			"grantee":      request.Grantee,
+			"success":      err == nil,
+		})
+		if err != nil {
+			writeJSONError(w, viewErrorStatus(err), "Failed to unshare view: "+err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "View share removed successfully",
+		})
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// publishViewAPIHandler publishes a view to, or withdraws it from, the organization-wide catalog.
+func (h *HandlerDependencies) publishViewAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	var request struct {
+		ViewType  string `json:"view_type"`
+		ViewID    string `json:"view_id"`
+		Published bool   `json:"published"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.ViewType == "" || request.ViewID == "" {
+		writeJSONError(w, http.StatusBadRequest, "view_type and view_id are required")
+		return
+	}
+
+	err := h.CoreService.SetViewPublished(request.ViewType, request.ViewID, request.Published, claims.UserID)
+	h.audit(r, models.AuditViewPublish, request.ViewID, map[string]interface{}{
+		"view_type": request.ViewType,
+		"published": request.Published,
+		"success":   err == nil,
+	})
+	if err != nil {
+		writeJSONError(w, viewErrorStatus(err), "Failed to update view publication: "+err.Error())
+		return
+	}
+
+	message := "View published successfully"
+	if !request.Published {
+		message = "View unpublished successfully"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": message,
+	})
+}
+
+// transferViewOwnershipAPIHandler makes another user the owner of a view.
+func (h *HandlerDependencies) transferViewOwnershipAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only POST method is allowed")
+		return
+	}
+
+	claims, ok := auth.GetUserClaimsFromContext(r.Context())
+	if !ok || claims == nil {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized: Missing user claims")
+		return
+	}
+
+	var request struct {
+		ViewType string `json:"view_type"`
+		ViewID   string `json:"view_id"`
+		NewOwner string `json:"new_owner"` // Username
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if request.ViewType == "" || request.ViewID == "" || request.NewOwner == "" {
+		writeJSONError(w, http.StatusBadRequest, "view_type, view_id and new_owner are required")
+		return
+	}
+
+	err := h.CoreService.TransferViewOwnership(request.ViewType, request.ViewID, request.NewOwner, claims.UserID)
+	h.audit(r, models.AuditViewTransferOwnership, request.ViewID, map[string]interface{}{
+		"view_type": request.ViewType,
+		"new_owner": request.NewOwner,
+		"success":   err == nil,
+	})
+	if err != nil {
+		writeJSONError(w, viewErrorStatus(err), "Failed to transfer view ownership: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "View ownership transferred successfully",
+	})
+}
+
+// viewCatalogAPIHandler lists every published view.
+func (h *HandlerDependencies) viewCatalogAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET method is allowed")
+		return
+	}
+
+	catalog, err := h.CoreService.GetPublishedCatalog()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Failed to retrieve view catalog: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"catalog": catalog,
+	})
+}
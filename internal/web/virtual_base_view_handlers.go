@@ -3,6 +3,7 @@ package web
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"Bridgo/internal/auth"
 	"Bridgo/internal/models"
@@ -42,10 +43,18 @@ func (h *HandlerDependencies) getUserVirtualBaseViewsAPIHandler(w http.ResponseW
 		return
 	}
 
+	// API keys only see the views they are scoped to
+	scopedViews := virtualBaseViews[:0]
+	for _, view := range virtualBaseViews {
+		if claims.InScope(models.ViewTypeVirtualBaseView, view.ID) {
+			scopedViews = append(scopedViews, view)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":            true,
-		"virtual_base_views": virtualBaseViews,
+		"virtual_base_views": scopedViews,
 	})
 }
 
@@ -122,6 +131,15 @@ func (h *HandlerDependencies) createVirtualBaseViewAPIHandler(w http.ResponseWri
 	}
 
 	virtualBaseView, err := h.CoreService.CreateVirtualBaseView(input)
+	if err == nil {
+		h.audit(r, models.AuditViewCreate, virtualBaseView.ID, map[string]interface{}{
+			"view_type":        models.ViewTypeVirtualBaseView,
+			"name":             input.Name,
+			"data_source_id":   input.DataSourceID,
+			"table_name":       input.TableName,
+			"selected_columns": input.SelectedColumns,
+		})
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -244,7 +262,9 @@ func (h *HandlerDependencies) getVirtualBaseViewSampleDataAPIHandler(w http.Resp
 		return
 	}
 
+	started := time.Now()
 	sampleData, err := h.CoreService.GetVirtualBaseViewSampleData(virtualBaseViewID, claims.UserID)
+	h.auditViewQuery(r, models.ViewTypeVirtualBaseView, virtualBaseViewID, sampleData, started, err)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
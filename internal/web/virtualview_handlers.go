@@ -3,9 +3,11 @@ package web
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"Bridgo/internal/auth"
 	"Bridgo/internal/core"
+	"Bridgo/internal/models"
 )
 
 // getUserVirtualViewsAPIHandler retrieves all virtual views for a user
@@ -42,10 +44,18 @@ func (h *HandlerDependencies) getUserVirtualViewsAPIHandler(w http.ResponseWrite
 		return
 	}
 
+	// API keys only see the views they are scoped to
+	scopedViews := virtualViews[:0]
+	for _, view := range virtualViews {
+		if claims.InScope(models.ViewTypeVirtualView, view.ID) {
+			scopedViews = append(scopedViews, view)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":      true,
-		"virtualviews": virtualViews,
+		"virtualviews": scopedViews,
 	})
 }
 
@@ -105,6 +115,13 @@ func (h *HandlerDependencies) createVirtualViewAPIHandler(w http.ResponseWriter,
 	}
 
 	virtualView, err := h.CoreService.CreateVirtualView(input)
+	if err == nil {
+		h.audit(r, models.AuditViewCreate, virtualView.ID, map[string]interface{}{
+			"view_type":           models.ViewTypeVirtualView,
+			"name":                input.Name,
+			"selected_schema_ids": input.SelectedSchemaIDs,
+		})
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -227,7 +244,9 @@ func (h *HandlerDependencies) getVirtualViewSampleDataAPIHandler(w http.Response
 		return
 	}
 
+	started := time.Now()
 	sampleData, err := h.CoreService.GetVirtualViewSampleData(virtualViewID, claims.UserID)
+	h.auditViewQuery(r, models.ViewTypeVirtualView, virtualViewID, sampleData, started, err)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -4,6 +4,7 @@ class AuthManager {
     constructor() {
         this.registerForm = null;
         this.loginForm = null;
+        this.setupForm = null;
         this.messageElement = null;
         this.logoutButton = null;
     }
@@ -11,6 +12,7 @@ class AuthManager {
     init() {
         this.registerForm = document.getElementById('registerForm');
         this.loginForm = document.getElementById('loginForm');
+        this.setupForm = document.getElementById('setupForm');
         this.messageElement = document.getElementById('message');
         this.logoutButton = document.getElementById('logoutButton');
 
@@ -28,6 +30,11 @@ class AuthManager {
             this.loginForm.addEventListener('submit', (e) => this.handleLogin(e));
         }
 
+        if (this.setupForm) {
+            this.setupSetupForm();
+            this.setupForm.addEventListener('submit', (e) => this.handleSetup(e));
+        }
+
         if (this.logoutButton) {
             this.logoutButton.addEventListener('click', (e) => {
                 e.preventDefault();
@@ -43,6 +50,45 @@ class AuthManager {
         if (usernameFromQuery) {
             this.loginForm.username.value = decodeURIComponent(usernameFromQuery);
         }
+
+        this.handleSSOResult();
+        this.showSSOLogin();
+    }
+
+    // Single sign-on returns to /login with the tokens (or an error) in the URL fragment
+    handleSSOResult() {
+        const fragment = new URLSearchParams(window.location.hash.substring(1));
+        if (!fragment.has('token') && !fragment.has('sso_error')) {
+            return;
+        }
+        // Keep the tokens out of the browser history
+        history.replaceState(null, '', window.location.pathname + window.location.search);
+
+        if (fragment.has('sso_error')) {
+            displayMessage(this.messageElement, `Error: ${fragment.get('sso_error')}`, 'error');
+            return;
+        }
+        setAuthToken(fragment.get('token'), fragment.get('refresh_token'));
+        displayMessage(this.messageElement, 'Login successful! Redirecting to dashboard.', 'success');
+        window.location.href = '/dashboard';
+    }
+
+    async showSSOLogin() {
+        const ssoLogin = document.getElementById('ssoLogin');
+        if (!ssoLogin) return;
+        try {
+            const response = await fetch('/api/auth/config');
+            const config = await response.json();
+            if (config.oidc_enabled) {
+                ssoLogin.style.display = '';
+            }
+            const registerLink = document.getElementById('registerLink');
+            if (registerLink && config.registration === 'disabled') {
+                registerLink.style.display = 'none';
+            }
+        } catch (error) {
+            console.error('Failed to load sign-in options:', error);
+        }
     }
 
     async handleRegister(e) {
@@ -50,6 +96,7 @@ class AuthManager {
         const username = this.registerForm.username.value;
         const email = this.registerForm.email.value;
         const password = this.registerForm.password.value;
+        const invite_code = this.registerForm.inviteCode ? this.registerForm.inviteCode.value : '';
         
         displayMessage(this.messageElement, '');
 
@@ -59,12 +106,14 @@ class AuthManager {
                 headers: {
                     'Content-Type': 'application/json',
                 },
-                body: JSON.stringify({ username, email, password }),
+                body: JSON.stringify({ username, email, password, invite_code }),
             });
 
             const result = await response.json();
 
-            if (response.ok) {
+            if (response.ok && result.active === false) {
+                displayMessage(this.messageElement, result.message, 'success');
+            } else if (response.ok) {
                 displayMessage(this.messageElement, 'Registration successful! Redirecting to login page.', 'success');
                 setTimeout(() => {
                     window.location.href = `/login?username=${encodeURIComponent(username)}`;
@@ -81,6 +130,8 @@ class AuthManager {
         e.preventDefault();
         const username = this.loginForm.username.value;
         const password = this.loginForm.password.value;
+        const new_password = this.loginForm.newPassword ? this.loginForm.newPassword.value : '';
+        const mfa_code = this.loginForm.mfaCode ? this.loginForm.mfaCode.value : '';
         
         displayMessage(this.messageElement, '');
 
@@ -90,17 +141,80 @@ class AuthManager {
                 headers: {
                     'Content-Type': 'application/json',
                 },
-                body: JSON.stringify({ username, password }),
+                body: JSON.stringify({ username, password, new_password, mfa_code }),
             });
 
             const result = await response.json();
 
-            if (response.ok) {
-                setAuthToken(result.token);
+            if (response.ok && result.recovery_codes) {
+                // Two-factor authentication was just enabled: the recovery codes are shown only once
+                setAuthToken(result.token, result.refresh_token);
+                alert('Two-factor authentication is enabled. Store these recovery codes safely; each can be used once instead of a code:\n\n' + result.recovery_codes.join('\n'));
+                window.location.href = '/dashboard';
+            } else if (response.ok) {
+                setAuthToken(result.token, result.refresh_token);
                 displayMessage(this.messageElement, 'Login successful! Redirecting to dashboard.', 'success');
                 setTimeout(() => {
                     window.location.href = '/dashboard';
                 }, 1000);
+            } else if (result.mfa_required || result.mfa_enrollment_required) {
+                if (result.mfa_enrollment_required) {
+                    document.getElementById('mfaSecret').textContent = result.secret;
+                    document.getElementById('mfaProvisioningLink').href = result.provisioning_uri;
+                    document.getElementById('mfaEnrollment').style.display = '';
+                }
+                document.getElementById('mfaCodeField').style.display = '';
+                this.loginForm.mfaCode.value = '';
+                this.loginForm.mfaCode.focus();
+                displayMessage(this.messageElement, result.message, 'error');
+            } else if (result.password_change_required) {
+                // Temporary or default password: ask for a new one and log in again with both
+                document.getElementById('newPasswordField').style.display = '';
+                this.loginForm.newPassword.required = true;
+                this.loginForm.newPassword.focus();
+                displayMessage(this.messageElement, 'You must choose a new password before continuing.', 'error');
+            } else {
+                displayMessage(this.messageElement, `Error: ${result.message || response.statusText}`, 'error');
+            }
+        } catch (error) {
+            displayMessage(this.messageElement, `Unexpected error occurred: ${error.message}`, 'error');
+        }
+    }
+
+    // The setup link printed at startup carries the one-time token in the URL fragment
+    setupSetupForm() {
+        const fragment = new URLSearchParams(window.location.hash.substring(1));
+        if (fragment.has('token')) {
+            this.setupForm.setupToken.value = fragment.get('token');
+            history.replaceState(null, '', window.location.pathname);
+        }
+    }
+
+    async handleSetup(e) {
+        e.preventDefault();
+        const setup_token = this.setupForm.setupToken.value;
+        const username = this.setupForm.username.value;
+        const email = this.setupForm.email.value;
+        const password = this.setupForm.password.value;
+
+        displayMessage(this.messageElement, '');
+
+        try {
+            const response = await fetch('/api/setup', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                },
+                body: JSON.stringify({ setup_token, username, email, password }),
+            });
+
+            const result = await response.json();
+
+            if (response.ok) {
+                displayMessage(this.messageElement, 'Admin account created! Redirecting to login page.', 'success');
+                setTimeout(() => {
+                    window.location.href = `/login?username=${encodeURIComponent(username)}`;
+                }, 2000);
             } else {
                 displayMessage(this.messageElement, `Error: ${result.message || response.statusText}`, 'error');
             }
@@ -55,13 +55,19 @@ class DataSourceManager {
         }
 
         try {
+            // Certificate files are sent as PEM text, they are not part of the form fields
+            data.sslRootCert = await this.readCertificateFile('sslRootCert');
+            data.sslCert = await this.readCertificateFile('sslCert');
+            data.sslKey = await this.readCertificateFile('sslKey');
+            data.additionalParams = this.readDriverOptions();
+
             const token = getAuthToken();
             if (!token) {
                 displayMessage(this.connection_message, 'Error: Please log in first.', 'error');
                 return;
             }
 
-            const response = await fetch('/api/db/test-connection', {
+            const response = await authFetch('/api/db/test-connection', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -73,7 +79,7 @@ class DataSourceManager {
             const result = await response.json();
 
             if (response.ok) {
-                displayMessage(this.connection_message, 'Connection successful!', 'success');
+                displayMessage(this.connection_message, `Connection successful! ${this.describeTLS(result.tls)}`, 'success');
                 displayMessage(this.schema_output_loading_status, 'Schema loaded successfully!', 'success');
                 
                 this.current_connection_data = data;
@@ -93,6 +99,44 @@ class DataSourceManager {
         }
     }
 
+    async readCertificateFile(inputId) {
+        const input = document.getElementById(inputId);
+        if (!input || !input.files || input.files.length === 0) {
+            return '';
+        }
+        return input.files[0].text();
+    }
+
+    readDriverOptions() {
+        const input = document.getElementById('additionalParams');
+        const options = {};
+        if (!input) {
+            return options;
+        }
+        input.value.split('\n').forEach(line => {
+            const separator = line.indexOf('=');
+            if (line.trim() === '') {
+                return;
+            }
+            if (separator < 0) {
+                options[line.trim()] = '';
+            } else {
+                options[line.slice(0, separator).trim()] = line.slice(separator + 1).trim();
+            }
+        });
+        return options;
+    }
+
+    describeTLS(tls) {
+        if (!tls) {
+            return 'The database did not report its TLS state.';
+        }
+        if (!tls.enabled) {
+            return 'The connection is not encrypted.';
+        }
+        return `Encrypted with ${tls.version || 'TLS'}${tls.cipher ? ` (${tls.cipher})` : ''}, SSL mode ${tls.ssl_mode}.`;
+    }
+
     displaySelectableSchema(schema) {
         clearElement(this.selectable_schema_container);
         
@@ -231,7 +275,7 @@ class DataSourceManager {
                 return;
             }
 
-            const response = await fetch('/api/db/save-datasource', {
+            const response = await authFetch('/api/db/save-datasource', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
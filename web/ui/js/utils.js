@@ -1,6 +1,7 @@
 // utils.js - Common utility functions
 
 const TOKEN_KEY = 'authToken';
+const REFRESH_TOKEN_KEY = 'refreshToken';
 
 // Function to check if the user is authenticated
 function isAuthenticated() {
@@ -14,9 +15,25 @@ function requireAuth() {
     }
 }
 
-// Function to handle logout
-function logout() {
+// Function to handle logout: revokes the session server-side, then clears the stored tokens
+async function logout() {
+    const token = getAuthToken();
+    if (token) {
+        try {
+            await fetch('/api/logout', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'Authorization': `Bearer ${token}`
+                },
+                body: JSON.stringify({ refresh_token: localStorage.getItem(REFRESH_TOKEN_KEY) || '' })
+            });
+        } catch (error) {
+            console.error('Logout request failed:', error);
+        }
+    }
     localStorage.removeItem(TOKEN_KEY);
+    localStorage.removeItem(REFRESH_TOKEN_KEY);
     window.location.href = '/login';
 }
 
@@ -25,9 +42,53 @@ function getAuthToken() {
     return localStorage.getItem(TOKEN_KEY);
 }
 
-// Function to set auth token
-function setAuthToken(token) {
+// Function to set auth token, and the refresh token when one is given
+function setAuthToken(token, refreshToken) {
     localStorage.setItem(TOKEN_KEY, token);
+    if (refreshToken) {
+        localStorage.setItem(REFRESH_TOKEN_KEY, refreshToken);
+    }
+}
+
+// Function to exchange the stored refresh token for a new token pair
+async function refreshAuthToken() {
+    const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY);
+    if (!refreshToken) {
+        return false;
+    }
+
+    const response = await fetch('/api/token/refresh', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: refreshToken })
+    });
+    if (!response.ok) {
+        localStorage.removeItem(REFRESH_TOKEN_KEY);
+        return false;
+    }
+
+    const result = await response.json();
+    setAuthToken(result.token, result.refresh_token);
+    return true;
+}
+
+// Function to call an authenticated API: sends the current access token and, when it has
+// expired, refreshes it once and retries. Redirects to login when the session has ended.
+async function authFetch(url, options = {}) {
+    const send = () => fetch(url, {
+        ...options,
+        headers: { ...(options.headers || {}), 'Authorization': `Bearer ${getAuthToken()}` }
+    });
+
+    let response = await send();
+    if (response.status === 401 && await refreshAuthToken()) {
+        response = await send();
+    }
+    if (response.status === 401) {
+        localStorage.removeItem(TOKEN_KEY);
+        window.location.href = '/login';
+    }
+    return response;
 }
 
 // Function to display messages with color coding
@@ -70,11 +131,14 @@ function createStyledDiv(styles = {}) {
 if (typeof module !== 'undefined' && module.exports) {
     module.exports = {
         TOKEN_KEY,
+        REFRESH_TOKEN_KEY,
         isAuthenticated,
         requireAuth,
         logout,
         getAuthToken,
         setAuthToken,
+        refreshAuthToken,
+        authFetch,
         displayMessage,
         clearElement,
         createStyledDiv
@@ -49,7 +49,7 @@ class VirtualViewManager {
                 return;
             }
 
-            const response = await fetch('/api/datasources', {
+            const response = await authFetch('/api/datasources', {
                 method: 'GET',
                 headers: {
                     'Authorization': `Bearer ${token}`
@@ -91,7 +91,7 @@ class VirtualViewManager {
             });
 
             dsDiv.innerHTML = `
-                <h4>${ds.source_name}</h4>
+                <h4>${ds.source_name}${ds.managed ? '<span style="background: #6c757d; color: white; font-size: 10px; padding: 2px 4px; border-radius: 2px; margin-left: 5px;" title="Managed by declarative configuration; change its manifest instead">MANAGED</span>' : ''}</h4>
                 <p><strong>Type:</strong> ${ds.db_type}</p>
                 <p><strong>Host:</strong> ${ds.host.String || 'N/A'}</p>
                 <p><strong>Database:</strong> ${ds.database_name.String || 'N/A'}</p>
@@ -134,7 +134,7 @@ class VirtualViewManager {
 
             this.schemaSelectionArea.innerHTML = '<p>Loading schema...</p>';
 
-            const response = await fetch(`/api/datasources/schema?datasource_id=${dataSourceId}`, {
+            const response = await authFetch(`/api/datasources/schema?datasource_id=${dataSourceId}`, {
                 method: 'GET',
                 headers: {
                     'Authorization': `Bearer ${token}`
@@ -343,7 +343,7 @@ class VirtualViewManager {
         }
 
         try {
-            const response = await fetch('/api/virtual-base-views', {
+            const response = await authFetch('/api/virtual-base-views', {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
@@ -394,7 +394,7 @@ class VirtualViewManager {
                 return;
             }
 
-            const response = await fetch('/api/virtual-base-views', {
+            const response = await authFetch('/api/virtual-base-views', {
                 method: 'GET',
                 headers: {
                     'Authorization': `Bearer ${token}`
@@ -438,7 +438,7 @@ class VirtualViewManager {
             const selectedColumns = vbv.selected_columns ? JSON.parse(vbv.selected_columns) : [];
             
             vbvDiv.innerHTML = `
-                <h4>${vbv.name}</h4>
+                <h4>${vbv.name}${vbv.managed ? '<span style="background: #6c757d; color: white; font-size: 10px; padding: 2px 4px; border-radius: 2px; margin-left: 5px;" title="Managed by declarative configuration; change its manifest instead">MANAGED</span>' : ''}</h4>
                 <p><strong>Description:</strong> ${vbv.description || 'No description'}</p>
                 <p><strong>Table:</strong> ${vbv.table_name}</p>
                 <p><strong>Columns:</strong> ${selectedColumns.length} columns selected</p>
@@ -460,7 +460,7 @@ class VirtualViewManager {
             }
 
             // Load schema
-            const schemaResponse = await fetch(`/api/virtual-base-views/schema?virtual_base_view_id=${virtualBaseView.id}`, {
+            const schemaResponse = await authFetch(`/api/virtual-base-views/schema?virtual_base_view_id=${virtualBaseView.id}`, {
                 method: 'GET',
                 headers: {
                     'Authorization': `Bearer ${token}`
@@ -596,7 +596,7 @@ class VirtualViewManager {
 
         try {
             const token = getAuthToken();
-            const response = await fetch(`/api/virtual-base-views/sample-data?virtual_base_view_id=${virtualBaseViewId}`, {
+            const response = await authFetch(`/api/virtual-base-views/sample-data?virtual_base_view_id=${virtualBaseViewId}`, {
                 method: 'GET',
                 headers: {
                     'Authorization': `Bearer ${token}`